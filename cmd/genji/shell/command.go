@@ -2,6 +2,7 @@ package shell
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/asdine/genji"
 )
@@ -24,3 +25,29 @@ func runTablesCmd(db *genji.DB) error {
 
 	return nil
 }
+
+func runBackupCmd(db *genji.DB, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = db.Backup(f)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return f.Close()
+}
+
+func runRestoreCmd(db *genji.DB, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return db.Restore(f)
+}
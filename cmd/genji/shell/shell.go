@@ -209,17 +209,33 @@ func (sh *Shell) executeInput(in string) error {
 	return nil
 }
 
-func (sh *Shell) runCommand(cmd string) error {
-	switch cmd {
+func (sh *Shell) runCommand(in string) error {
+	cmd := strings.Fields(in)
+
+	switch cmd[0] {
 	case ".tables":
 		db, err := sh.getDB()
 		if err != nil {
 			return err
 		}
 		return runTablesCmd(db)
+	case ".backup", ".restore":
+		if len(cmd) != 2 {
+			return fmt.Errorf("usage: %s FILE", cmd[0])
+		}
+
+		db, err := sh.getDB()
+		if err != nil {
+			return err
+		}
+
+		if cmd[0] == ".backup" {
+			return runBackupCmd(db, cmd[1])
+		}
+		return runRestoreCmd(db, cmd[1])
 	}
 
-	return fmt.Errorf("unknown command %q", cmd)
+	return fmt.Errorf("unknown command %q", in)
 }
 
 func (sh *Shell) runQuery(q string) error {
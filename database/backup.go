@@ -0,0 +1,243 @@
+package database
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/asdine/genji/engine"
+)
+
+// A backup starts with backupHeader followed by the version of the format.
+// It is then made of records, each starting with its kind:
+// a backupStore record is followed by the name of a store,
+// a backupKV record by a key value pair of the last store
+// and the backupEnd record marks the end of the backup.
+// Every name, key and value is prefixed with its length, encoded as an uvarint.
+const (
+	backupHeader  = "genji-backup"
+	backupVersion = 1
+
+	backupEnd   byte = 0
+	backupStore byte = 1
+	backupKV    byte = 2
+
+	// maximum length of a name, key or value, to avoid allocating
+	// large buffers when reading a corrupted backup.
+	backupMaxLength = 1 << 30
+)
+
+// Backup writes a consistent snapshot of the database to w.
+// It reads all the stores, including the ones used internally by the database,
+// from a single read-only transaction and can be run while the database is used.
+// The backup doesn't depend on the engine and can be restored to any engine using Restore.
+func (db *Database) Backup(w io.Writer) error {
+	ntx, err := db.ng.Begin(false)
+	if err != nil {
+		return err
+	}
+	defer ntx.Rollback()
+
+	names, err := ntx.ListStores("")
+	if err != nil {
+		return err
+	}
+
+	bw := backupWriter{w: bufio.NewWriter(w)}
+
+	bw.writeBytes([]byte(backupHeader))
+	bw.writeUvarint(backupVersion)
+
+	for _, name := range names {
+		st, err := ntx.GetStore(name)
+		if err != nil {
+			return err
+		}
+
+		bw.writeByte(backupStore)
+		bw.writeBytes([]byte(name))
+
+		err = st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+			bw.writeByte(backupKV)
+			bw.writeBytes(k)
+			bw.writeBytes(v)
+			return bw.err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	bw.writeByte(backupEnd)
+	if bw.err != nil {
+		return bw.err
+	}
+
+	return bw.w.Flush()
+}
+
+// Restore replaces the whole content of the database by the content of a backup
+// created by Backup. It is done in a single read/write transaction: if the backup
+// is invalid or incomplete, returns ErrInvalidBackup and the database is not modified.
+// The size of the backup is therefore limited by the size of the transactions
+// supported by the engine. For example, Badger fails with badger.ErrTxnTooBig
+// once the transaction exceeds a fraction of its MaxTableSize option, which must then
+// be increased to restore larger backups.
+func (db *Database) Restore(r io.Reader) error {
+	br := backupReader{r: bufio.NewReader(r)}
+
+	if string(br.readBytes()) != backupHeader || br.readUvarint() != backupVersion {
+		return br.error()
+	}
+
+	ntx, err := db.ng.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer ntx.Rollback()
+
+	names, err := ntx.ListStores("")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		err = ntx.DropStore(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	var st engine.Store
+	for {
+		switch br.readByte() {
+		case backupStore:
+			name := string(br.readBytes())
+			if br.err != nil {
+				return br.error()
+			}
+
+			err = ntx.CreateStore(name)
+			if err != nil {
+				return err
+			}
+
+			st, err = ntx.GetStore(name)
+			if err != nil {
+				return err
+			}
+		case backupKV:
+			k, v := br.readBytes(), br.readBytes()
+			if br.err != nil || st == nil {
+				return br.error()
+			}
+
+			err = st.Put(k, v)
+			if err != nil {
+				return err
+			}
+		case backupEnd:
+			if br.err != nil {
+				return br.error()
+			}
+
+			// backups are always complete but the internal stores
+			// must exist for the database to be usable.
+			err = createInternalStores(ntx)
+			if err != nil {
+				return err
+			}
+
+			// the leased keys may already be used by the restored tables.
+			// They are released before the commit, and the transactions begun
+			// until then stop sharing their leases.
+			db.mu.Lock()
+			defer db.mu.Unlock()
+			db.keyLeases = make(map[string]*keyLease)
+			db.generation++
+
+			return ntx.Commit()
+		default:
+			return br.error()
+		}
+	}
+}
+
+// backupWriter writes the elements of a backup and keeps the first error.
+type backupWriter struct {
+	w   *bufio.Writer
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (w *backupWriter) writeByte(c byte) {
+	if w.err == nil {
+		w.err = w.w.WriteByte(c)
+	}
+}
+
+func (w *backupWriter) writeUvarint(x uint64) {
+	if w.err == nil {
+		n := binary.PutUvarint(w.buf[:], x)
+		_, w.err = w.w.Write(w.buf[:n])
+	}
+}
+
+func (w *backupWriter) writeBytes(b []byte) {
+	w.writeUvarint(uint64(len(b)))
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+// backupReader reads the elements of a backup and keeps the first error.
+// Once an error occurred, every read returns a zero value.
+type backupReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+// error returns the reason why the backup is invalid.
+func (r *backupReader) error() error {
+	if r.err != nil && r.err != ErrInvalidBackup && r.err != io.EOF && r.err != io.ErrUnexpectedEOF {
+		return r.err
+	}
+
+	return ErrInvalidBackup
+}
+
+func (r *backupReader) readByte() byte {
+	if r.err != nil {
+		return 0
+	}
+
+	var c byte
+	c, r.err = r.r.ReadByte()
+	return c
+}
+
+func (r *backupReader) readUvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	var x uint64
+	x, r.err = binary.ReadUvarint(r.r)
+	return x
+}
+
+func (r *backupReader) readBytes() []byte {
+	n := r.readUvarint()
+	if r.err != nil {
+		return nil
+	}
+
+	if n > backupMaxLength {
+		r.err = ErrInvalidBackup
+		return nil
+	}
+
+	b := make([]byte, n)
+	_, r.err = io.ReadFull(r.r, b)
+	return b
+}
@@ -0,0 +1,280 @@
+package database_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine"
+	"github.com/asdine/genji/engine/badgerengine"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/dgraph-io/badger/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore(t *testing.T) {
+	newMemory := func() engine.Engine { return memoryengine.NewEngine() }
+	newBadger := func() engine.Engine {
+		ng, err := badgerengine.NewEngine(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		require.NoError(t, err)
+		return ng
+	}
+
+	tests := []struct {
+		name     string
+		src, dst func() engine.Engine
+	}{
+		{"Memory to Badger", newMemory, newBadger},
+		{"Badger to Memory", newBadger, newMemory},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src, err := database.New(test.src(), nil)
+			require.NoError(t, err)
+			defer src.Close()
+
+			dst, err := database.New(test.dst(), nil)
+			require.NoError(t, err)
+			defer dst.Close()
+
+			update := func(db *database.Database, fn func(tx *database.Transaction)) {
+				tx, err := db.Begin(true)
+				require.NoError(t, err)
+				defer tx.Rollback()
+				fn(tx)
+				require.NoError(t, tx.Commit())
+			}
+
+			insert := func(tx *database.Transaction, a int64) {
+				tb, err := tx.GetTable("test")
+				require.NoError(t, err)
+				_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt64Value(a)))
+				require.NoError(t, err)
+			}
+
+			count := func(tx *database.Transaction) int {
+				tb, err := tx.GetTable("test")
+				require.NoError(t, err)
+				var n int
+				err = tb.Iterate(func(d document.Document) error {
+					n++
+					return nil
+				})
+				require.NoError(t, err)
+				return n
+			}
+
+			update(src, func(tx *database.Transaction) {
+				require.NoError(t, tx.CreateTable("test", nil))
+				require.NoError(t, tx.CreateIndex(database.IndexConfig{
+					IndexName: "idx_test_a",
+					TableName: "test",
+					Paths:     []document.ValuePath{document.NewValuePath("a")},
+				}))
+				require.NoError(t, tx.CreateSequence(database.SequenceConfig{Name: "seq"}))
+				for i := int64(1); i <= 3; i++ {
+					insert(tx, i)
+				}
+				_, err := tx.NextValue("seq")
+				require.NoError(t, err)
+			})
+
+			// the destination already has content, which is replaced,
+			// and keys leased for its table
+			update(dst, func(tx *database.Transaction) {
+				require.NoError(t, tx.CreateTable("test", nil))
+				require.NoError(t, tx.CreateTable("other", nil))
+				insert(tx, 10)
+			})
+
+			var buf bytes.Buffer
+			require.NoError(t, src.Backup(&buf))
+
+			// an incomplete backup doesn't modify the database
+			err = dst.Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+			require.Equal(t, database.ErrInvalidBackup, err)
+			err = dst.Restore(bytes.NewReader([]byte("not a backup")))
+			require.Equal(t, database.ErrInvalidBackup, err)
+
+			tx, err := dst.Begin(false)
+			require.NoError(t, err)
+			require.Equal(t, 1, count(tx))
+			require.NoError(t, tx.Rollback())
+
+			require.NoError(t, dst.Restore(&buf))
+
+			update(dst, func(tx *database.Transaction) {
+				require.Equal(t, 3, count(tx))
+
+				_, err := tx.GetTable("other")
+				require.Equal(t, database.ErrTableNotFound, err)
+
+				idx, err := tx.GetIndex("idx_test_a")
+				require.NoError(t, err)
+				var n int
+				err = idx.AscendGreaterOrEqual(nil, func(v document.Value, k []byte) error {
+					n++
+					return nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, 3, n)
+
+				v, err := tx.NextValue("seq")
+				require.NoError(t, err)
+				require.EqualValues(t, 1, v)
+
+				// new documents don't reuse the keys of the restored ones
+				insert(tx, 4)
+				require.Equal(t, 4, count(tx))
+			})
+		})
+	}
+}
+
+func TestRestoreTooBig(t *testing.T) {
+	src, err := database.New(memoryengine.NewEngine(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+
+	ng, err := badgerengine.NewEngine(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil).WithMaxTableSize(1 << 20))
+	require.NoError(t, err)
+	dst, err := database.New(ng, nil)
+	require.NoError(t, err)
+	defer dst.Close()
+
+	tx, err := src.Begin(true)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.NoError(t, tx.CreateTable("test", nil))
+	tb, err := tx.GetTable("test")
+	require.NoError(t, err)
+	for i := int64(0); i < 5000; i++ {
+		_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt64Value(i)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+
+	var buf bytes.Buffer
+	require.NoError(t, src.Backup(&buf))
+
+	// the backup doesn't fit in a single Badger transaction
+	err = dst.Restore(&buf)
+	require.Equal(t, badger.ErrTxnTooBig, err)
+
+	tx, err = dst.Begin(false)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.GetTable("test")
+	require.Equal(t, database.ErrTableNotFound, err)
+}
+
+// commitHookEngine calls onCommit once a transaction is committed, if set.
+type commitHookEngine struct {
+	engine.Engine
+	onCommit *func()
+}
+
+func (e commitHookEngine) Begin(writable bool) (engine.Transaction, error) {
+	tx, err := e.Engine.Begin(writable)
+	if err != nil {
+		return nil, err
+	}
+
+	return commitHookTransaction{Transaction: tx, onCommit: e.onCommit}, nil
+}
+
+type commitHookTransaction struct {
+	engine.Transaction
+	onCommit *func()
+}
+
+func (t commitHookTransaction) Commit() error {
+	err := t.Transaction.Commit()
+	if err == nil && *t.onCommit != nil {
+		fn := *t.onCommit
+		*t.onCommit = nil
+		fn()
+	}
+
+	return err
+}
+
+func TestRestoreConcurrentInserts(t *testing.T) {
+	insert := func(db *database.Database, field string, n int) error {
+		tx, err := db.Begin(true)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		tb, err := tx.GetTable("test")
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			_, err = tb.Insert(document.NewFieldBuffer().Add(field, document.NewInt64Value(int64(i))))
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	}
+
+	var onCommit func()
+	src, err := database.New(memoryengine.NewEngine(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	dst, err := database.New(commitHookEngine{Engine: memoryengine.NewEngine(), onCommit: &onCommit}, nil)
+	require.NoError(t, err)
+	defer dst.Close()
+
+	for _, db := range []*database.Database{src, dst} {
+		tx, err := db.Begin(true)
+		require.NoError(t, err)
+		require.NoError(t, tx.CreateTable("test", nil))
+		require.NoError(t, tx.Commit())
+	}
+
+	require.NoError(t, insert(src, "a", 100))
+	var buf bytes.Buffer
+	require.NoError(t, src.Backup(&buf))
+
+	// the destination leased the keys of the restored documents
+	require.NoError(t, insert(dst, "b", 1))
+
+	// insert a document as soon as the restore is committed
+	inserted := make(chan error, 1)
+	onCommit = func() {
+		go func() {
+			inserted <- insert(dst, "b", 1)
+		}()
+		// give the insertion a chance to run before Restore returns
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	require.NoError(t, dst.Restore(&buf))
+	require.NoError(t, <-inserted)
+
+	// the inserted document didn't replace a restored one
+	tx, err := dst.Begin(false)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	tb, err := tx.GetTable("test")
+	require.NoError(t, err)
+	var a, b int
+	err = tb.Iterate(func(d document.Document) error {
+		if _, err := d.GetByField("a"); err == nil {
+			a++
+		} else {
+			b++
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 100, a)
+	require.Equal(t, 1, b)
+}
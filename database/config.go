@@ -1,6 +1,9 @@
 package database
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/document/encoding"
 	"github.com/asdine/genji/engine"
@@ -32,6 +35,64 @@ type FieldConstraint struct {
 	Type         document.ValueType
 	IsPrimaryKey bool
 	IsNotNull    bool
+	// DefaultValue is an expression whose result is used
+	// when the field is missing.
+	DefaultValue string
+	// Check is a boolean expression that documents must satisfy.
+	// A missing field is evaluated as a NULL value.
+	Check string
+	// References, if its TableName is set, makes the field a foreign key.
+	References ForeignKey
+}
+
+// ForeignKey references a document of another table by its primary key.
+type ForeignKey struct {
+	TableName string
+	// Path of the primary key of the referenced table.
+	Path document.ValuePath
+	// OnDelete is the action taken on the referencing documents
+	// when the referenced document is deleted.
+	OnDelete ForeignKeyAction
+}
+
+// ForeignKeyAction is the action taken when a referenced document is deleted.
+type ForeignKeyAction uint8
+
+// List of foreign key actions.
+const (
+	// Restrict prevents the deletion of referenced documents.
+	Restrict ForeignKeyAction = iota
+	// Cascade deletes the referencing documents.
+	Cascade
+	// SetNull removes the referencing field from the documents.
+	SetNull
+)
+
+// ConstraintExpr is an expression used by the DEFAULT and CHECK constraints of a field,
+// and by the predicate of partial indexes.
+type ConstraintExpr interface {
+	// Eval evaluates the expression against the given document, which can be nil.
+	Eval(tx *Transaction, d document.Document) (document.Value, error)
+}
+
+// parseConstraintExpr parses s with the parser of the database.
+// Expressions are only parsed once per transaction.
+func (tx Transaction) parseConstraintExpr(s string) (ConstraintExpr, error) {
+	if e, ok := tx.exprs[s]; ok {
+		return e, nil
+	}
+
+	if tx.db.opts.ParseConstraintExpr == nil {
+		return nil, errors.New("no parser configured for constraint expressions")
+	}
+
+	e, err := tx.db.opts.ParseConstraintExpr(s)
+	if err != nil {
+		return nil, err
+	}
+
+	tx.exprs[s] = e
+	return e, nil
 }
 
 type tableConfigStore struct {
@@ -112,15 +173,131 @@ func (t *tableConfigStore) Delete(tableName string) error {
 	return err
 }
 
-// Index of a table field. Contains information about
+// Index of one or more table fields. Contains information about
 // the index configuration and provides methods to manipulate the index.
 type Index struct {
 	index.Index
 
 	IndexName string
 	TableName string
-	Path      document.ValuePath
+	Paths     []document.ValuePath
 	Unique    bool
+	Where     string
+}
+
+func newIndex(tx engine.Transaction, opts IndexConfig) *Index {
+	var idx index.Index
+	switch {
+	case len(opts.Paths) > 1:
+		idx = index.NewCompositeIndex(tx, opts.IndexName, opts.Unique)
+	case opts.Unique:
+		idx = index.NewUniqueIndex(tx, opts.IndexName)
+	default:
+		idx = index.NewListIndex(tx, opts.IndexName)
+	}
+
+	return &Index{
+		Index:     idx,
+		IndexName: opts.IndexName,
+		TableName: opts.TableName,
+		Paths:     opts.Paths,
+		Unique:    opts.Unique,
+		Where:     opts.Where,
+	}
+}
+
+// PathsString returns the paths of the index, separated by commas.
+func (i *Index) PathsString() string {
+	return pathsString(i.Paths)
+}
+
+// Predicate returns the predicate of a partial index, or nil if the index isn't partial.
+func (i *Index) Predicate(tx *Transaction) (ConstraintExpr, error) {
+	if i.Where == "" {
+		return nil, nil
+	}
+
+	return tx.parseConstraintExpr(i.Where)
+}
+
+// covers reports whether the document must be indexed, which is always the case
+// unless the index is partial and the document doesn't satisfy its predicate.
+func (i *Index) covers(tx *Transaction, d document.Document) (bool, error) {
+	e, err := i.Predicate(tx)
+	if err != nil {
+		return false, err
+	}
+	if e == nil {
+		return true, nil
+	}
+
+	v, err := e.Eval(tx, d)
+	if err == document.ErrFieldNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return v.IsTruthy(), nil
+}
+
+// value returns the value indexed for the given document.
+// Missing fields are indexed as NULL values. If the index has
+// multiple fields, the value is an array containing the value of each field.
+func (i *Index) value(d document.Document) document.Value {
+	vb := make(document.ValueBuffer, len(i.Paths))
+	for j, p := range i.Paths {
+		v, err := p.GetValue(d)
+		if err != nil {
+			v = document.NewNullValue()
+		}
+		vb[j] = v
+	}
+
+	if len(vb) == 1 {
+		return vb[0]
+	}
+
+	return document.NewArrayValue(vb)
+}
+
+// lookup returns the key associated with the given value in a unique index,
+// or nil if the value isn't indexed.
+func (i *Index) lookup(v document.Value) ([]byte, error) {
+	var key []byte
+	err := i.AscendGreaterOrEqual(&index.Pivot{Value: v}, func(val document.Value, k []byte) error {
+		ok, err := val.IsEqual(v)
+		if err != nil {
+			return err
+		}
+		if ok {
+			key = append([]byte{}, k...)
+		}
+
+		// values are sorted, the first one is the only candidate
+		return errStop
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+var errStop = errors.New("stop")
+
+// pathsString returns the paths of an index, separated by commas.
+func pathsString(paths []document.ValuePath) string {
+	var b strings.Builder
+	for i, p := range paths {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(p.String())
+	}
+
+	return b.String()
 }
 
 type indexStore struct {
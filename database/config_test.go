@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
 	"github.com/asdine/genji/engine/memoryengine"
 	"github.com/stretchr/testify/require"
 )
@@ -55,3 +56,70 @@ func TestTableConfigStore(t *testing.T) {
 	err = tcs.Delete("foo-table")
 	require.Equal(t, ErrTableNotFound, err)
 }
+
+func TestIndexStoreLegacyPath(t *testing.T) {
+	ng := memoryengine.NewEngine()
+	defer ng.Close()
+
+	db, err := New(ng, nil)
+	require.NoError(t, err)
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	err = tx.CreateTable("test", nil)
+	require.NoError(t, err)
+
+	// indexes created before the support of composite indexes
+	// were stored with a single path.
+	legacy := struct {
+		Unique    bool
+		IndexName string
+		TableName string
+		Path      document.ValuePath
+	}{
+		IndexName: "idx_test_a",
+		TableName: "test",
+		Path:      document.NewValuePath("a.b"),
+	}
+	doc, err := document.NewFromStruct(&legacy)
+	require.NoError(t, err)
+	v, err := encoding.EncodeDocument(doc)
+	require.NoError(t, err)
+	err = tx.indexStore.st.Put([]byte("idx_test_a"), v)
+	require.NoError(t, err)
+
+	err = tx.Commit()
+	require.NoError(t, err)
+
+	tx, err = db.Begin(true)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	idx, err := tx.GetIndex("idx_test_a")
+	require.NoError(t, err)
+	require.Equal(t, []document.ValuePath{document.NewValuePath("a.b")}, idx.Paths)
+
+	tb, err := tx.GetTable("test")
+	require.NoError(t, err)
+	indexes, err := tb.Indexes()
+	require.NoError(t, err)
+	require.Len(t, indexes, 1)
+	require.Equal(t, idx.Paths, indexes["a.b"].Paths)
+
+	// new documents are indexed by the value of the legacy path
+	_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewDocumentValue(
+		document.NewFieldBuffer().Add("b", document.NewInt64Value(2)),
+	)))
+	require.NoError(t, err)
+
+	var values []document.Value
+	err = idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+		values = append(values, val)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, values, 1)
+	require.Equal(t, document.NewFloat64Value(2), values[0])
+}
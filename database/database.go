@@ -2,6 +2,7 @@
 package database
 
 import (
+	"context"
 	"sync"
 
 	"github.com/asdine/genji/engine"
@@ -9,15 +10,37 @@ import (
 
 // A Database manages a list of tables in an engine.
 type Database struct {
-	ng engine.Engine
+	ng   engine.Engine
+	opts Options
 
+	// mu protects keyLeases and generation.
 	mu sync.Mutex
+	// keys reserved for the tables without primary key, by table name.
+	keyLeases map[string]*keyLease
+	// generation is incremented when the content of the database is replaced by Restore.
+	// Only the transactions begun since then share the key leases,
+	// the previous ones might see the tables as they were before.
+	generation int64
+}
+
+// Options of the database.
+type Options struct {
+	// ParseConstraintExpr parses the expressions of DEFAULT and CHECK constraints
+	// and the predicates of partial indexes. Since they are written in SQL, it is
+	// usually the one of the SQL parser package. If nil, tables and indexes using
+	// these expressions return an error.
+	ParseConstraintExpr func(s string) (ConstraintExpr, error)
 }
 
 // New initializes the DB using the given engine.
-func New(ng engine.Engine) (*Database, error) {
+// If opts is nil, the default options are used.
+func New(ng engine.Engine, opts *Options) (*Database, error) {
 	db := Database{
-		ng: ng,
+		ng:        ng,
+		keyLeases: make(map[string]*keyLease),
+	}
+	if opts != nil {
+		db.opts = *opts
 	}
 
 	ntx, err := db.ng.Begin(true)
@@ -26,18 +49,7 @@ func New(ng engine.Engine) (*Database, error) {
 	}
 	defer ntx.Rollback()
 
-	_, err = ntx.GetStore(tableConfigStoreName)
-	if err == engine.ErrStoreNotFound {
-		err = ntx.CreateStore(tableConfigStoreName)
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = ntx.GetStore(indexStoreName)
-	if err == engine.ErrStoreNotFound {
-		err = ntx.CreateStore(indexStoreName)
-	}
+	err = createInternalStores(ntx)
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +62,21 @@ func New(ng engine.Engine) (*Database, error) {
 	return &db, nil
 }
 
+// createInternalStores creates the stores used by the database that don't exist yet.
+func createInternalStores(ntx engine.Transaction) error {
+	for _, name := range []string{tableConfigStoreName, indexStoreName, statsStoreName, sequenceStoreName} {
+		_, err := ntx.GetStore(name)
+		if err == engine.ErrStoreNotFound {
+			err = ntx.CreateStore(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Close the underlying engine.
 func (db *Database) Close() error {
 	return db.ng.Close()
@@ -58,15 +85,38 @@ func (db *Database) Close() error {
 // Begin starts a new transaction.
 // The returned transaction must be closed either by calling Rollback or Commit.
 func (db *Database) Begin(writable bool) (*Transaction, error) {
-	ntx, err := db.ng.Begin(writable)
+	return db.BeginTx(context.Background(), writable)
+}
+
+// BeginTx starts a new transaction bound to ctx. Once ctx is canceled or its deadline
+// is exceeded, any operation made within the transaction fails with ctx.Err() and
+// the transaction can only be rolled back.
+// If the engine doesn't implement engine.ContextBeginner, ctx is checked before each
+// statement and document read instead of within the engine.
+// The returned transaction must be closed either by calling Rollback or Commit.
+func (db *Database) BeginTx(ctx context.Context, writable bool) (*Transaction, error) {
+	// the generation must be read before the engine transaction begins
+	db.mu.Lock()
+	generation := db.generation
+	db.mu.Unlock()
+
+	ntx, err := beginContext(ctx, db.ng, writable)
 	if err != nil {
 		return nil, err
 	}
 
+	if _, ok := ntx.(engine.Savepointer); !ok {
+		ntx = &undoTransaction{Transaction: ntx}
+	}
+
 	tx := Transaction{
-		db:       db,
-		Tx:       ntx,
-		writable: writable,
+		db:         db,
+		ctx:        ctx,
+		Tx:         ntx,
+		writable:   writable,
+		generation: generation,
+		savepoints: new([]savepoint),
+		exprs:      make(map[string]ConstraintExpr),
 	}
 
 	tx.tcfgStore, err = tx.getTableConfigStore()
@@ -79,5 +129,38 @@ func (db *Database) Begin(writable bool) (*Transaction, error) {
 		return nil, err
 	}
 
+	tx.statsStore, err = tx.getStatsStore()
+	if err != nil {
+		return nil, err
+	}
+
+	tx.seqStore, err = tx.getSequenceStore()
+	if err != nil {
+		return nil, err
+	}
+
 	return &tx, nil
 }
+
+// beginContext starts an engine transaction bound to ctx if the engine supports it.
+// Otherwise, ctx is only checked before starting the transaction.
+func beginContext(ctx context.Context, ng engine.Engine, writable bool) (engine.Transaction, error) {
+	if cb, ok := ng.(engine.ContextBeginner); ok {
+		return cb.BeginContext(ctx, writable)
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return ng.Begin(writable)
+}
+
+// releaseKeys forgets the keys reserved for a table. It is always safe to do so
+// since new leases start after the last key stored in the table.
+func (db *Database) releaseKeys(tableName string) {
+	db.mu.Lock()
+	delete(db.keyLeases, tableName)
+	db.mu.Unlock()
+}
@@ -2,6 +2,8 @@ package database
 
 import (
 	"errors"
+
+	"github.com/asdine/genji/engine"
 )
 
 var (
@@ -19,10 +21,27 @@ var (
 	// same name as an existing one.
 	ErrIndexAlreadyExists = errors.New("index already exists")
 
+	// ErrSequenceNotFound is returned when the targeted sequence doesn't exist.
+	ErrSequenceNotFound = errors.New("sequence not found")
+
+	// ErrSequenceAlreadyExists is returned when attempting to create a sequence with the
+	// same name as an existing one.
+	ErrSequenceAlreadyExists = errors.New("sequence already exists")
+
+	// ErrSavepointNotFound is returned when the targeted savepoint doesn't exist.
+	ErrSavepointNotFound = errors.New("savepoint not found")
+
 	// ErrDocumentNotFound is returned when no document is associated with the provided key.
 	ErrDocumentNotFound = errors.New("document not found")
 
 	// ErrDuplicateDocument is returned when another document is already associated with a given key, primary key,
 	// or if there is a unique index violation.
 	ErrDuplicateDocument = errors.New("duplicate document")
+
+	// ErrConflict is returned by Commit when the transaction conflicts with another transaction
+	// committed after it began. None of its changes are committed and it can be run again.
+	ErrConflict = engine.ErrConflict
+
+	// ErrInvalidBackup is returned when restoring data that is not a complete backup.
+	ErrInvalidBackup = errors.New("invalid backup")
 )
@@ -0,0 +1,408 @@
+package database
+
+import (
+	"bytes"
+
+	"github.com/asdine/genji/engine"
+	"github.com/pkg/errors"
+)
+
+// A savepoint is a named state of a transaction, created by the SAVEPOINT command.
+type savepoint struct {
+	name string
+	sp   engine.Savepoint
+}
+
+// Savepoint marks the current state of the transaction under the given name.
+// If a savepoint with the same name already exists, the new one hides it until it is released.
+func (tx *Transaction) Savepoint(name string) error {
+	sp, err := tx.Tx.(engine.Savepointer).Savepoint()
+	if err != nil {
+		return err
+	}
+
+	*tx.savepoints = append(*tx.savepoints, savepoint{name: name, sp: sp})
+	return nil
+}
+
+// RollbackTo cancels the changes made since the creation of the most recent savepoint
+// with the given name. The savepoints created after it are released, but it is kept
+// and can be rolled back to again.
+// If the savepoint doesn't exist, returns ErrSavepointNotFound.
+func (tx *Transaction) RollbackTo(name string) error {
+	i, err := tx.releaseAfter(name)
+	if err != nil {
+		return err
+	}
+
+	return (*tx.savepoints)[i].sp.Rollback()
+}
+
+// Release forgets the most recent savepoint with the given name and all the savepoints created after it.
+// The changes made since its creation are kept.
+// If the savepoint doesn't exist, returns ErrSavepointNotFound.
+func (tx *Transaction) Release(name string) error {
+	i, err := tx.releaseAfter(name)
+	if err != nil {
+		return err
+	}
+
+	err = (*tx.savepoints)[i].sp.Release()
+	*tx.savepoints = (*tx.savepoints)[:i]
+	return err
+}
+
+// releaseAfter releases the savepoints created after the most recent savepoint with the given name
+// and returns its position.
+func (tx *Transaction) releaseAfter(name string) (int, error) {
+	sps := *tx.savepoints
+
+	i := len(sps) - 1
+	for i >= 0 && sps[i].name != name {
+		i--
+	}
+	if i < 0 {
+		return 0, ErrSavepointNotFound
+	}
+
+	for j := len(sps) - 1; j > i; j-- {
+		err := sps[j].sp.Release()
+		if err != nil {
+			return 0, err
+		}
+		*tx.savepoints = sps[:j]
+	}
+
+	return i, nil
+}
+
+// undoTransaction adds savepoints to the transactions of engines which don't support them.
+// While there are savepoints, it records how to undo every change made to the stores.
+type undoTransaction struct {
+	engine.Transaction
+
+	// number of savepoints which are not released.
+	active int
+	log    []undoEntry
+	// err is set if the changes couldn't be entirely undone,
+	// the transaction can then only be rolled back.
+	err error
+}
+
+// An undoEntry cancels one change. If the store was dropped or truncated,
+// kvs holds all its key value pairs.
+type undoEntry struct {
+	store string
+	// the store must be dropped, it was created by the change.
+	drop bool
+	// the store must be created, it was dropped by the change.
+	create  bool
+	key     []byte
+	value   []byte
+	existed bool
+	kvs     [][2][]byte
+}
+
+// Savepoint implements the engine.Savepointer interface.
+func (t *undoTransaction) Savepoint() (engine.Savepoint, error) {
+	t.active++
+	return &undoSavepoint{tx: t, pos: len(t.log)}, nil
+}
+
+func (t *undoTransaction) record(e undoEntry) {
+	if t.active > 0 {
+		t.log = append(t.log, e)
+	}
+}
+
+// GetStore returns a store recording its changes.
+func (t *undoTransaction) GetStore(name string) (engine.Store, error) {
+	st, err := t.Transaction.GetStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &undoStore{Store: st, tx: t, name: name}, nil
+}
+
+// CreateStore creates the store and records how to drop it.
+func (t *undoTransaction) CreateStore(name string) error {
+	err := t.Transaction.CreateStore(name)
+	if err != nil {
+		return err
+	}
+
+	t.record(undoEntry{store: name, drop: true})
+	return nil
+}
+
+// DropStore drops the store and records how to recreate it.
+func (t *undoTransaction) DropStore(name string) error {
+	var kvs [][2][]byte
+	if t.active > 0 {
+		st, err := t.Transaction.GetStore(name)
+		if err != nil {
+			return err
+		}
+
+		kvs, err = storeContent(st)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := t.Transaction.DropStore(name)
+	if err != nil {
+		return err
+	}
+
+	t.record(undoEntry{store: name, create: true, kvs: kvs})
+	return nil
+}
+
+// Commit the transaction, unless a rollback to a savepoint failed.
+// In that case, the transaction is rolled back and an error is returned.
+func (t *undoTransaction) Commit() error {
+	if t.err != nil {
+		t.Transaction.Rollback()
+		return errors.Wrap(t.err, "cannot commit after a failed rollback to a savepoint")
+	}
+
+	return t.Transaction.Commit()
+}
+
+// undo cancels the changes recorded after the given position of the log, in reverse order.
+// If it fails, the transaction is left partially undone and can no longer be committed.
+func (t *undoTransaction) undo(pos int) error {
+	if t.err != nil {
+		return t.err
+	}
+
+	err := t.undoLog(pos)
+	if err != nil {
+		t.err = err
+	}
+	return err
+}
+
+func (t *undoTransaction) undoLog(pos int) error {
+	for i := len(t.log) - 1; i >= pos; i-- {
+		e := t.log[i]
+
+		if e.drop {
+			err := t.Transaction.DropStore(e.store)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if e.create {
+			err := t.Transaction.CreateStore(e.store)
+			if err != nil {
+				return err
+			}
+		}
+
+		st, err := t.Transaction.GetStore(e.store)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case e.key == nil:
+			for _, kv := range e.kvs {
+				err = st.Put(kv[0], kv[1])
+				if err != nil {
+					return err
+				}
+			}
+		case e.existed:
+			err = st.Put(e.key, e.value)
+		default:
+			err = deleteKey(st, e.key)
+			// the key is already absent, there is nothing to undo
+			if err == engine.ErrKeyNotFound {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	t.log = t.log[:pos]
+	return nil
+}
+
+type undoSavepoint struct {
+	tx       *undoTransaction
+	pos      int
+	released bool
+}
+
+// Rollback undoes the changes recorded since the creation of the savepoint.
+func (s *undoSavepoint) Rollback() error {
+	return s.tx.undo(s.pos)
+}
+
+// Release stops recording the changes if there are no other savepoints.
+func (s *undoSavepoint) Release() error {
+	if s.released {
+		return nil
+	}
+
+	s.released = true
+	s.tx.active--
+	if s.tx.active == 0 {
+		s.tx.log = nil
+	}
+	return nil
+}
+
+// undoStore records how to undo the changes made to a store.
+type undoStore struct {
+	engine.Store
+
+	tx   *undoTransaction
+	name string
+}
+
+// Put stores the key value pair and records the previous value of the key.
+func (s *undoStore) Put(k, v []byte) error {
+	if s.tx.active == 0 {
+		return s.Store.Put(k, v)
+	}
+
+	e, err := s.entry(k)
+	if err != nil {
+		return err
+	}
+
+	err = s.Store.Put(k, v)
+	if err != nil {
+		return err
+	}
+
+	s.tx.record(e)
+	return nil
+}
+
+// Delete the key and records its value.
+func (s *undoStore) Delete(k []byte) error {
+	if s.tx.active == 0 {
+		return deleteKey(s.Store, k)
+	}
+
+	e, err := s.entry(k)
+	if err != nil {
+		return err
+	}
+
+	err = deleteKey(s.Store, k)
+	if err != nil {
+		return err
+	}
+
+	s.tx.record(e)
+	return nil
+}
+
+// Truncate deletes all the key value pairs of the store and records them.
+func (s *undoStore) Truncate() error {
+	if s.tx.active == 0 {
+		return s.Store.Truncate()
+	}
+
+	kvs, err := storeContent(s.Store)
+	if err != nil {
+		return err
+	}
+
+	err = s.Store.Truncate()
+	if err != nil {
+		return err
+	}
+
+	s.tx.record(undoEntry{store: s.name, kvs: kvs})
+	return nil
+}
+
+// entry returns an entry restoring the current value of k.
+func (s *undoStore) entry(k []byte) (undoEntry, error) {
+	e := undoEntry{
+		store: s.name,
+		key:   append([]byte{}, k...),
+	}
+
+	v, ok, err := lookupKey(s.Store, k)
+	if err != nil {
+		return e, err
+	}
+	if ok {
+		e.existed = true
+		e.value = append([]byte{}, v...)
+	}
+
+	return e, nil
+}
+
+// lookupKey returns the value of k and whether it exists.
+// The key is looked up with a cursor rather than with Get, which some engines, like Bolt,
+// can't tell apart from missing keys when their value is empty, like index entries.
+func lookupKey(st engine.Store, k []byte) ([]byte, bool, error) {
+	var value []byte
+	var ok bool
+	err := st.AscendGreaterOrEqual(k, func(key, v []byte) error {
+		if bytes.Equal(key, k) {
+			ok = true
+			value = v
+		}
+		return errStopLookup
+	})
+	if err != nil && err != errStopLookup {
+		return nil, false, err
+	}
+
+	return value, ok, nil
+}
+
+// errStopLookup stops the iteration used by lookupKey.
+var errStopLookup = errors.New("stop")
+
+// deleteKey deletes k from the store. If not found, returns engine.ErrKeyNotFound.
+// The engines that can't tell keys with an empty value apart from missing keys
+// refuse to delete them, so their value is replaced before deleting them.
+func deleteKey(st engine.Store, k []byte) error {
+	err := st.Delete(k)
+	if err != engine.ErrKeyNotFound {
+		return err
+	}
+
+	_, ok, err := lookupKey(st, k)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return engine.ErrKeyNotFound
+	}
+
+	err = st.Put(k, []byte{0})
+	if err != nil {
+		return err
+	}
+
+	return st.Delete(k)
+}
+
+// storeContent returns a copy of all the key value pairs of a store.
+func storeContent(st engine.Store) ([][2][]byte, error) {
+	var kvs [][2][]byte
+
+	err := st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+		kvs = append(kvs, [2][]byte{append([]byte{}, k...), append([]byte{}, v...)})
+		return nil
+	})
+
+	return kvs, err
+}
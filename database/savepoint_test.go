@@ -0,0 +1,281 @@
+package database_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine"
+	"github.com/asdine/genji/engine/badgerengine"
+	"github.com/asdine/genji/engine/boltengine"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/dgraph-io/badger/v2"
+	"github.com/stretchr/testify/require"
+)
+
+type testEngine struct {
+	name    string
+	builder func() (engine.Engine, func())
+}
+
+// savepointEngines returns engines that implement savepoints and engines that don't.
+func savepointEngines(t *testing.T) []testEngine {
+	return []testEngine{
+		// the memory engine implements savepoints
+		{"Memory", func() (engine.Engine, func()) { return memoryengine.NewEngine(), func() {} }},
+		// the other engines don't, the changes are undone by the database
+		{"Badger", func() (engine.Engine, func()) {
+			ng, err := badgerengine.NewEngine(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+			require.NoError(t, err)
+			return ng, func() {}
+		}},
+		{"Bolt", func() (engine.Engine, func()) {
+			dir, err := ioutil.TempDir("", "genji")
+			require.NoError(t, err)
+			ng, err := boltengine.NewEngine(filepath.Join(dir, "test.db"), 0600, nil)
+			require.NoError(t, err)
+			return ng, func() { os.RemoveAll(dir) }
+		}},
+	}
+}
+
+func TestTxSavepoints(t *testing.T) {
+	engines := savepointEngines(t)
+
+	for _, ng := range engines {
+		t.Run(ng.name, func(t *testing.T) {
+			e, cleanup := ng.builder()
+			defer cleanup()
+			db, err := database.New(e, nil)
+			require.NoError(t, err)
+			defer db.Close()
+
+			tx, err := db.Begin(true)
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			err = tx.CreateTable("test", nil)
+			require.NoError(t, err)
+
+			insert := func(a int64) {
+				tb, err := tx.GetTable("test")
+				require.NoError(t, err)
+				_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt64Value(a)))
+				require.NoError(t, err)
+			}
+
+			count := func() int {
+				tb, err := tx.GetTable("test")
+				require.NoError(t, err)
+				var n int
+				err = tb.Iterate(func(d document.Document) error {
+					n++
+					return nil
+				})
+				require.NoError(t, err)
+				return n
+			}
+
+			insert(1)
+			require.NoError(t, tx.Savepoint("a"))
+			insert(2)
+			require.NoError(t, tx.Savepoint("b"))
+			insert(3)
+			err = tx.CreateTable("other", nil)
+			require.NoError(t, err)
+			err = tx.DropTable("test")
+			require.NoError(t, err)
+
+			// rolling back to b restores the table and cancels the third insertion
+			require.NoError(t, tx.RollbackTo("b"))
+			require.Equal(t, 2, count())
+			_, err = tx.GetTable("other")
+			require.Equal(t, database.ErrTableNotFound, err)
+
+			// b can be rolled back to again
+			insert(4)
+			require.NoError(t, tx.RollbackTo("b"))
+			require.Equal(t, 2, count())
+
+			// rolling back to a releases b
+			require.NoError(t, tx.RollbackTo("a"))
+			require.Equal(t, 1, count())
+			require.Equal(t, database.ErrSavepointNotFound, tx.RollbackTo("b"))
+
+			// releasing a keeps the changes
+			insert(5)
+			require.NoError(t, tx.Release("a"))
+			require.Equal(t, database.ErrSavepointNotFound, tx.Release("a"))
+			require.Equal(t, 2, count())
+
+			// savepoints with the same name hide each other
+			require.NoError(t, tx.Savepoint("c"))
+			insert(6)
+			require.NoError(t, tx.Savepoint("c"))
+			insert(7)
+			require.NoError(t, tx.RollbackTo("c"))
+			require.Equal(t, 3, count())
+			require.NoError(t, tx.Release("c"))
+			require.NoError(t, tx.RollbackTo("c"))
+			require.Equal(t, 2, count())
+
+			require.NoError(t, tx.Commit())
+
+			tx, err = db.Begin(false)
+			require.NoError(t, err)
+			defer tx.Rollback()
+			require.Equal(t, 2, count())
+		})
+	}
+}
+
+func TestTxSavepointsIndexes(t *testing.T) {
+	for _, ng := range savepointEngines(t) {
+		t.Run(ng.name, func(t *testing.T) {
+			e, cleanup := ng.builder()
+			defer cleanup()
+			db, err := database.New(e, nil)
+			require.NoError(t, err)
+			defer db.Close()
+
+			tx, err := db.Begin(true)
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			err = tx.CreateTable("test", nil)
+			require.NoError(t, err)
+			err = tx.CreateIndex(database.IndexConfig{
+				IndexName: "idx_test_a",
+				TableName: "test",
+				Paths:     []document.ValuePath{document.NewValuePath("a")},
+			})
+			require.NoError(t, err)
+			tb, err := tx.GetTable("test")
+			require.NoError(t, err)
+			_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt64Value(1)))
+			require.NoError(t, err)
+
+			// indexValues returns the values of the index
+			indexValues := func() []float64 {
+				idx, err := tx.GetIndex("idx_test_a")
+				require.NoError(t, err)
+
+				var values []float64
+				err = idx.AscendGreaterOrEqual(nil, func(v document.Value, k []byte) error {
+					values = append(values, v.V.(float64))
+					return nil
+				})
+				require.NoError(t, err)
+				return values
+			}
+
+			require.NoError(t, tx.Savepoint("s1"))
+			_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt64Value(2)))
+			require.NoError(t, err)
+			require.Equal(t, []float64{1, 2}, indexValues())
+
+			require.NoError(t, tx.RollbackTo("s1"))
+			require.Equal(t, []float64{1}, indexValues())
+
+			// the indexed document is deleted and restored
+			var keys [][]byte
+			err = tb.Iterate(func(d document.Document) error {
+				keys = append(keys, append([]byte{}, d.(document.Keyer).Key()...))
+				return nil
+			})
+			require.NoError(t, err)
+			for _, k := range keys {
+				require.NoError(t, tb.Delete(k))
+			}
+			require.Empty(t, indexValues())
+
+			require.NoError(t, tx.RollbackTo("s1"))
+			require.Equal(t, []float64{1}, indexValues())
+
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
+
+// failingEngine creates stores which fail to delete keys once fail is set.
+type failingEngine struct {
+	engine.Engine
+	fail *bool
+}
+
+func (e failingEngine) Begin(writable bool) (engine.Transaction, error) {
+	tx, err := e.Engine.Begin(writable)
+	if err != nil {
+		return nil, err
+	}
+
+	return failingTransaction{Transaction: tx, fail: e.fail}, nil
+}
+
+type failingTransaction struct {
+	engine.Transaction
+	fail *bool
+}
+
+func (t failingTransaction) GetStore(name string) (engine.Store, error) {
+	st, err := t.Transaction.GetStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return failingStore{Store: st, fail: t.fail}, nil
+}
+
+type failingStore struct {
+	engine.Store
+	fail *bool
+}
+
+func (s failingStore) Delete(k []byte) error {
+	if *s.fail {
+		return errors.New("delete failed")
+	}
+
+	return s.Store.Delete(k)
+}
+
+func TestTxSavepointsFailedRollback(t *testing.T) {
+	var fail bool
+	db, err := database.New(failingEngine{Engine: memoryengine.NewEngine(), fail: &fail}, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	err = tx.CreateTable("test", nil)
+	require.NoError(t, err)
+	tb, err := tx.GetTable("test")
+	require.NoError(t, err)
+
+	require.NoError(t, tx.Savepoint("s1"))
+	for i := int64(0); i < 3; i++ {
+		_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt64Value(i)))
+		require.NoError(t, err)
+	}
+
+	// the insertions can't be undone
+	fail = true
+	require.Error(t, tx.RollbackTo("s1"))
+
+	// the partially undone transaction can't be committed
+	fail = false
+	require.Error(t, tx.RollbackTo("s1"))
+	require.Error(t, tx.Commit())
+
+	tx, err = db.Begin(false)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.GetTable("test")
+	require.Equal(t, database.ErrTableNotFound, err)
+}
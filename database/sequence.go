@@ -0,0 +1,120 @@
+package database
+
+import (
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+	"github.com/asdine/genji/engine"
+)
+
+var sequenceStoreName = "__genji.sequences"
+
+// SequenceConfig holds the configuration and the state of a sequence.
+type SequenceConfig struct {
+	Name string
+	// Value added to the current value of the sequence to produce the next one.
+	IncrementBy int64
+	// First value returned by the sequence.
+	Start int64
+	// Last value returned by the sequence, if Called is true.
+	LastValue int64
+	Called    bool
+}
+
+// CreateSequence creates a sequence with the given configuration.
+// If IncrementBy is zero, the sequence is incremented by one.
+// If a sequence with the same name already exists, returns ErrSequenceAlreadyExists.
+func (tx Transaction) CreateSequence(cfg SequenceConfig) error {
+	_, err := tx.seqStore.Get(cfg.Name)
+	if err == nil {
+		return ErrSequenceAlreadyExists
+	}
+	if err != ErrSequenceNotFound {
+		return err
+	}
+
+	if cfg.IncrementBy == 0 {
+		cfg.IncrementBy = 1
+	}
+	cfg.LastValue = 0
+	cfg.Called = false
+
+	return tx.seqStore.Replace(&cfg)
+}
+
+// GetSequence returns a sequence by name.
+func (tx Transaction) GetSequence(name string) (*SequenceConfig, error) {
+	return tx.seqStore.Get(name)
+}
+
+// DropSequence deletes a sequence.
+func (tx Transaction) DropSequence(name string) error {
+	return tx.seqStore.Delete(name)
+}
+
+// NextValue increments the sequence and returns its new value.
+// The new state of the sequence is stored in the transaction, which must be writable.
+func (tx Transaction) NextValue(name string) (int64, error) {
+	cfg, err := tx.seqStore.Get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if cfg.Called {
+		cfg.LastValue += cfg.IncrementBy
+	} else {
+		cfg.LastValue = cfg.Start
+		cfg.Called = true
+	}
+
+	err = tx.seqStore.Replace(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	return cfg.LastValue, nil
+}
+
+type sequenceStore struct {
+	st engine.Store
+}
+
+func (s *sequenceStore) Replace(cfg *SequenceConfig) error {
+	doc, err := document.NewFromStruct(cfg)
+	if err != nil {
+		return err
+	}
+
+	v, err := encoding.EncodeDocument(doc)
+	if err != nil {
+		return err
+	}
+
+	return s.st.Put([]byte(cfg.Name), v)
+}
+
+func (s *sequenceStore) Get(name string) (*SequenceConfig, error) {
+	v, err := s.st.Get([]byte(name))
+	if err == engine.ErrKeyNotFound {
+		return nil, ErrSequenceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg SequenceConfig
+	err = document.StructScan(encoding.EncodedDocument(v), &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func (s *sequenceStore) Delete(name string) error {
+	err := s.st.Delete([]byte(name))
+	if err == engine.ErrKeyNotFound {
+		return ErrSequenceNotFound
+	}
+
+	return err
+}
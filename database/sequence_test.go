@@ -0,0 +1,71 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxSequences(t *testing.T) {
+	t.Run("Should return the values of the sequence", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateSequence(database.SequenceConfig{Name: "seq", Start: 10, IncrementBy: -5})
+		require.NoError(t, err)
+
+		err = tx.CreateSequence(database.SequenceConfig{Name: "seq"})
+		require.Equal(t, database.ErrSequenceAlreadyExists, err)
+
+		for _, expected := range []int64{10, 5, 0, -5} {
+			v, err := tx.NextValue("seq")
+			require.NoError(t, err)
+			require.Equal(t, expected, v)
+		}
+
+		seq, err := tx.GetSequence("seq")
+		require.NoError(t, err)
+		require.Equal(t, int64(-5), seq.LastValue)
+	})
+
+	t.Run("Should increment by one by default", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateSequence(database.SequenceConfig{Name: "seq"})
+		require.NoError(t, err)
+
+		for _, expected := range []int64{0, 1, 2} {
+			v, err := tx.NextValue("seq")
+			require.NoError(t, err)
+			require.Equal(t, expected, v)
+		}
+	})
+
+	t.Run("Should drop the sequence", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateSequence(database.SequenceConfig{Name: "seq"})
+		require.NoError(t, err)
+
+		err = tx.DropSequence("seq")
+		require.NoError(t, err)
+
+		_, err = tx.NextValue("seq")
+		require.Equal(t, database.ErrSequenceNotFound, err)
+
+		err = tx.DropSequence("seq")
+		require.Equal(t, database.ErrSequenceNotFound, err)
+	})
+
+	t.Run("Should not be listed as a table", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		tables, err := tx.ListTables()
+		require.NoError(t, err)
+		require.Empty(t, tables)
+	})
+}
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+	"github.com/asdine/genji/engine"
+	"github.com/asdine/genji/index"
+)
+
+var statsStoreName = "__genji.stats"
+
+// TableStats holds statistics about the content of a table and of its indexes.
+// They are gathered by the Analyze method of the transaction and are not updated
+// when the table is modified.
+type TableStats struct {
+	TableName string
+	// Number of documents of the table.
+	RowCount int64
+	Indexes  []IndexStats
+}
+
+// GetIndexStats returns the statistics of an index, or nil if the index hasn't been analyzed.
+func (s *TableStats) GetIndexStats(indexName string) *IndexStats {
+	for i := range s.Indexes {
+		if s.Indexes[i].IndexName == indexName {
+			return &s.Indexes[i]
+		}
+	}
+
+	return nil
+}
+
+// IndexStats holds statistics about the values of an index.
+type IndexStats struct {
+	IndexName string
+	// Number of distinct values of every prefix of the indexed fields:
+	// the first count is the number of distinct values of the first field,
+	// the second one the number of distinct pairs of values of the first two fields, etc.
+	// Indexes on a single field have only one count.
+	DistinctCounts []int64
+}
+
+// Analyze gathers statistics about the content of a table and its indexes,
+// and stores them. They are used by the query planner to estimate the number of documents
+// read by every way of running a query.
+func (tx Transaction) Analyze(tableName string) error {
+	t, err := tx.GetTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	stats := TableStats{
+		TableName: tableName,
+	}
+
+	err = t.Store.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+		stats.RowCount++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	indexes, err := t.Indexes()
+	if err != nil {
+		return err
+	}
+
+	// sort indexes by name to always store them in the same order
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		idx := indexes[name]
+
+		is, err := analyzeIndex(&idx)
+		if err != nil {
+			return err
+		}
+
+		stats.Indexes = append(stats.Indexes, is)
+	}
+
+	return tx.statsStore.Replace(&stats)
+}
+
+// analyzeIndex counts the distinct values of every prefix of the indexed fields.
+// Since indexes are sorted, equal values are contiguous.
+func analyzeIndex(idx *Index) (IndexStats, error) {
+	stats := IndexStats{
+		IndexName:      idx.IndexName,
+		DistinctCounts: make([]int64, len(idx.Paths)),
+	}
+
+	var prev [][]byte
+	err := idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+		values := document.ValueBuffer{val}
+		if len(idx.Paths) > 1 {
+			a, err := val.ConvertToArray()
+			if err != nil {
+				return err
+			}
+
+			values = values[:0]
+			err = a.Iterate(func(i int, v document.Value) error {
+				values = values.Append(v)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		cur := make([][]byte, len(values))
+		for i, v := range values {
+			data, err := index.EncodeFieldToIndexValue(v)
+			if err != nil {
+				return err
+			}
+
+			cur[i] = append([]byte{byte(index.NewTypeFromValueType(v.Type))}, data...)
+		}
+
+		// the prefixes that contain the first value that differs from
+		// the previous entry are new
+		i := 0
+		if prev != nil {
+			for i < len(cur) && bytes.Equal(cur[i], prev[i]) {
+				i++
+			}
+		}
+		for ; i < len(cur); i++ {
+			stats.DistinctCounts[i]++
+		}
+
+		prev = cur
+		return nil
+	})
+
+	return stats, err
+}
+
+// Stats returns the statistics of the table gathered by the last call to Analyze.
+// If the table has never been analyzed, it returns nil.
+func (t *Table) Stats() (*TableStats, error) {
+	return t.tx.statsStore.Get(t.name)
+}
+
+type statsStore struct {
+	st engine.Store
+}
+
+func (s *statsStore) Replace(stats *TableStats) error {
+	doc, err := document.NewFromStruct(stats)
+	if err != nil {
+		return err
+	}
+
+	v, err := encoding.EncodeDocument(doc)
+	if err != nil {
+		return err
+	}
+
+	return s.st.Put([]byte(stats.TableName), v)
+}
+
+func (s *statsStore) Get(tableName string) (*TableStats, error) {
+	v, err := s.st.Get([]byte(tableName))
+	if err == engine.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stats TableStats
+	err = document.StructScan(encoding.EncodedDocument(v), &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func (s *statsStore) Delete(tableName string) error {
+	err := s.st.Delete([]byte(tableName))
+	if err == engine.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// DeleteIndex removes the statistics of an index from the statistics of its table.
+func (s *statsStore) DeleteIndex(tableName, indexName string) error {
+	stats, err := s.Get(tableName)
+	if err != nil || stats == nil {
+		return err
+	}
+
+	for i := range stats.Indexes {
+		if stats.Indexes[i].IndexName == indexName {
+			stats.Indexes = append(stats.Indexes[:i], stats.Indexes[i+1:]...)
+			return s.Replace(stats)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxAnalyze(t *testing.T) {
+	t.Run("Should store the statistics of the table and its indexes", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		err = tx.CreateIndex(database.IndexConfig{
+			IndexName: "idx_a", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("a")},
+		})
+		require.NoError(t, err)
+		err = tx.CreateIndex(database.IndexConfig{
+			IndexName: "idx_a_b", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("a"), document.NewValuePath("b")},
+		})
+		require.NoError(t, err)
+
+		stats, err := tb.Stats()
+		require.NoError(t, err)
+		require.Nil(t, stats)
+
+		for _, v := range [][2]int64{{1, 1}, {1, 2}, {1, 2}, {2, 1}} {
+			_, err = tb.Insert(document.NewFieldBuffer().
+				Add("a", document.NewInt64Value(v[0])).
+				Add("b", document.NewInt64Value(v[1])))
+			require.NoError(t, err)
+		}
+		_, err = tb.Insert(document.NewFieldBuffer().Add("c", document.NewInt64Value(1)))
+		require.NoError(t, err)
+
+		err = tx.Analyze("test")
+		require.NoError(t, err)
+
+		stats, err = tb.Stats()
+		require.NoError(t, err)
+		require.Equal(t, &database.TableStats{
+			TableName: "test",
+			RowCount:  5,
+			Indexes: []database.IndexStats{
+				{IndexName: "idx_a", DistinctCounts: []int64{3}},
+				{IndexName: "idx_a_b", DistinctCounts: []int64{3, 4}},
+			},
+		}, stats)
+
+		err = tx.DropIndex("idx_a")
+		require.NoError(t, err)
+
+		stats, err = tb.Stats()
+		require.NoError(t, err)
+		require.Nil(t, stats.GetIndexStats("idx_a"))
+		require.NotNil(t, stats.GetIndexStats("idx_a_b"))
+
+		err = tx.DropTable("test")
+		require.NoError(t, err)
+		err = tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		tb, err = tx.GetTable("test")
+		require.NoError(t, err)
+
+		stats, err = tb.Stats()
+		require.NoError(t, err)
+		require.Nil(t, stats)
+	})
+
+	t.Run("Should fail if the table doesn't exist", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.Analyze("test")
+		require.Equal(t, database.ErrTableNotFound, err)
+	})
+}
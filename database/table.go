@@ -89,22 +89,78 @@ func (t *Table) generateKey(d document.Document) ([]byte, error) {
 		return encoding.EncodeValue(v)
 	}
 
-	t.tx.db.mu.Lock()
-	defer t.tx.db.mu.Unlock()
+	db := t.tx.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	cfg, err = t.cfgStore.Get(t.name)
+	// a transaction begun before a restore doesn't share its leases,
+	// which might be based on the previous content of the table.
+	shared := t.tx.generation == db.generation
+
+	var l *keyLease
+	if shared {
+		l = db.keyLeases[t.name]
+	}
+	if l == nil || l.next > l.max {
+		l, err = t.leaseKeys(l)
+		if err != nil {
+			return nil, err
+		}
+		if shared {
+			db.keyLeases[t.name] = l
+		}
+	}
+
+	key = encoding.EncodeInt64(l.next)
+	l.next++
+	return key, nil
+}
+
+// keyLeaseSize is the number of keys reserved at once for a table without primary key.
+const keyLeaseSize = 64
+
+// A keyLease is a range of keys reserved in memory for a table without primary key,
+// so that its configuration isn't rewritten on every insertion.
+type keyLease struct {
+	next, max int64
+}
+
+// leaseKeys reserves the keys following the last reserved one, by storing
+// the last key of the new lease in the configuration of the table.
+// Keys might have been taken from a lease that was reserved by a transaction
+// that was rolled back, so the new lease also starts after the last key of the table.
+func (t *Table) leaseKeys(prev *keyLease) (*keyLease, error) {
+	cfg, err := t.cfgStore.Get(t.name)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg.LastKey++
-	key = encoding.EncodeInt64(cfg.LastKey)
+	last := cfg.LastKey
+	if prev != nil && prev.max > last {
+		last = prev.max
+	}
+
+	err = t.Store.DescendLessOrEqual(nil, func(k, v []byte) error {
+		n, err := encoding.DecodeInt64(k)
+		if err != nil {
+			return err
+		}
+		if n > last {
+			last = n
+		}
+		return errStop
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+
+	cfg.LastKey = last + keyLeaseSize
 	err = t.cfgStore.Replace(t.name, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return key, nil
+	return &keyLease{next: last + 1, max: cfg.LastKey}, nil
 }
 
 func getParentValue(d document.Document, p document.ValuePath) (document.Value, error) {
@@ -120,9 +176,10 @@ func getParentValue(d document.Document, p document.ValuePath) (document.Value,
 }
 
 // validateConstraints check the table configuration for constraints and validates the document
-// against them. If the types defined by the constraints are different than the ones found in
+// against them. Missing fields with a default value are added to the document.
+// If the types defined by the constraints are different than the ones found in
 // the document, the fields are converted to these types when possible. if the conversion
-// fails, an error is returned.
+// fails, or if a CHECK constraint isn't satisfied, an error is returned.
 func (t *Table) validateConstraints(d document.Document) (document.Document, error) {
 	cfg, err := t.Config()
 	if err != nil {
@@ -145,14 +202,14 @@ func (t *Table) validateConstraints(d document.Document) (document.Document, err
 	}
 
 	if pk != nil {
-		err = validateConstraint(&fb, pk)
+		err = t.applyConstraint(&fb, pk)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	for _, fc := range cfg.FieldConstraints {
-		err := validateConstraint(&fb, &fc)
+		err := t.applyConstraint(&fb, &fc)
 		if err != nil {
 			return nil, err
 		}
@@ -161,9 +218,95 @@ func (t *Table) validateConstraints(d document.Document) (document.Document, err
 	return &fb, err
 }
 
+// applyConstraint sets the default value of the field if it is missing,
+// then converts and validates it.
+func (t *Table) applyConstraint(fb *document.FieldBuffer, c *FieldConstraint) error {
+	if c.DefaultValue != "" {
+		err := t.setDefaultValue(fb, c)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := validateConstraint(fb, c)
+	if err != nil {
+		return err
+	}
+
+	if c.Check != "" {
+		return t.check(fb, c)
+	}
+
+	return nil
+}
+
+func (t *Table) setDefaultValue(fb *document.FieldBuffer, c *FieldConstraint) error {
+	_, err := c.Path.GetValue(fb)
+	if err != document.ErrFieldNotFound {
+		return nil
+	}
+
+	e, err := t.tx.parseConstraintExpr(c.DefaultValue)
+	if err != nil {
+		return err
+	}
+
+	v, err := e.Eval(t.tx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot evaluate the default value of field %q: %v", c.Path, err)
+	}
+
+	return fb.SetPath(c.Path, v)
+}
+
+// check evaluates the CHECK constraint of the field against the document.
+// Like in SQL, the constraint is satisfied if the result is true or NULL.
+// Like for indexes, a missing field is evaluated as a NULL value.
+func (t *Table) check(fb *document.FieldBuffer, c *FieldConstraint) error {
+	e, err := t.tx.parseConstraintExpr(c.Check)
+	if err != nil {
+		return err
+	}
+
+	d := fb
+	_, err = c.Path.GetValue(fb)
+	if err == document.ErrFieldNotFound || err == document.ErrValueNotFound {
+		// evaluate a copy, to leave the field missing in the stored document.
+		// If the path can't be set, the expression sees the field as missing.
+		var nfb document.FieldBuffer
+		err = nfb.Copy(fb)
+		if err != nil {
+			return err
+		}
+		if nfb.SetPath(c.Path, document.NewNullValue()) == nil {
+			d = &nfb
+		}
+	} else if err != nil {
+		return err
+	}
+
+	v, err := e.Eval(t.tx, d)
+	if err == document.ErrFieldNotFound || (err == nil && (v.Type == document.NullValue || v.IsTruthy())) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("field %q violates its CHECK constraint (%s)", c.Path, c.Check)
+}
+
 func validateConstraint(d document.Document, c *FieldConstraint) error {
 	// get the parent buffer
 	parent, err := getParentValue(d, c.Path)
+	if err == document.ErrFieldNotFound {
+		// the parent of the field is missing, and so is the field
+		if c.IsNotNull {
+			return fmt.Errorf("field %q is required and must be not null", c.Path)
+		}
+
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -266,47 +409,136 @@ func (t *Table) Insert(d document.Document) ([]byte, error) {
 		return nil, err
 	}
 
-	_, err = t.Store.Get(key)
+	err = t.insert(key, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// insert stores the validated document d under the given key and indexes it.
+func (t *Table) insert(key []byte, d document.Document) error {
+	_, err := t.Store.Get(key)
 	if err == nil {
-		return nil, ErrDuplicateDocument
+		return ErrDuplicateDocument
+	}
+
+	err = t.checkReferences(key, d)
+	if err != nil {
+		return err
 	}
 
 	v, err := encoding.EncodeDocument(d)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to encode document")
+		return errors.Wrap(err, "failed to encode document")
 	}
 
 	err = t.Store.Put(key, v)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	indexes, err := t.Indexes()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	for _, idx := range indexes {
-		v, err := idx.Path.GetValue(d)
+		ok, err := idx.covers(t.tx, d)
 		if err != nil {
-			v = document.NewNullValue()
+			return err
+		}
+		if !ok {
+			continue
 		}
 
-		err = idx.Set(v, key)
+		err = idx.Set(idx.value(d), key)
 		if err != nil {
 			if err == index.ErrDuplicate {
-				return nil, ErrDuplicateDocument
+				return ErrDuplicateDocument
 			}
 
-			return nil, err
+			return err
 		}
 	}
 
-	return key, nil
+	return nil
+}
+
+// InsertOrConflict works like Insert, unless d has the same primary key or the same value
+// for one of the unique indexes as an existing document. In that case, d is not inserted,
+// conflict is set to true and the key of the existing document is returned.
+// The constraints of the table are validated, and the key of d generated, only once.
+func (t *Table) InsertOrConflict(d document.Document) (key []byte, conflict bool, err error) {
+	d, err = t.validateConstraints(d)
+	if err != nil {
+		return nil, false, err
+	}
+
+	cfg, err := t.Config()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// generated keys never conflict, they are only generated if d can be inserted
+	if cfg.GetPrimaryKey() != nil {
+		key, err = t.generateKey(d)
+		if err != nil {
+			return nil, false, err
+		}
+
+		_, err = t.Store.Get(key)
+		if err == nil {
+			return key, true, nil
+		}
+		if err != engine.ErrKeyNotFound {
+			return nil, false, err
+		}
+	}
+
+	indexes, err := t.Indexes()
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, idx := range indexes {
+		if !idx.Unique {
+			continue
+		}
+
+		ok, err := idx.covers(t.tx, d)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			continue
+		}
+
+		k, err := idx.lookup(idx.value(d))
+		if err != nil || k != nil {
+			return k, k != nil, err
+		}
+	}
+
+	if key == nil {
+		key, err = t.generateKey(d)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	err = t.insert(key, d)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return key, false, nil
 }
 
 // Delete a document by key.
-// Indexes are automatically updated.
+// Indexes are automatically updated. The documents referencing it through foreign keys
+// are handled according to the ON DELETE action of each foreign key.
 func (t *Table) Delete(key []byte) error {
 	d, err := t.GetDocument(key)
 	if err != nil {
@@ -319,22 +551,207 @@ func (t *Table) Delete(key []byte) error {
 	}
 
 	for _, idx := range indexes {
-		v, err := idx.Path.GetValue(d)
+		ok, err := idx.covers(t.tx, d)
 		if err != nil {
 			return err
 		}
+		if !ok {
+			continue
+		}
+
+		err = idx.Delete(idx.value(d), key)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = t.Store.Delete(key)
+	if err != nil {
+		return err
+	}
+
+	// the document is deleted first so that cycles of cascading deletions end
+	return t.deleteReferences(key)
+}
+
+// checkReferences makes sure the documents referenced by the foreign keys of d exist.
+func (t *Table) checkReferences(key []byte, d document.Document) error {
+	cfg, err := t.Config()
+	if err != nil {
+		return err
+	}
+
+	for i := range cfg.FieldConstraints {
+		err = t.checkReference(key, d, &cfg.FieldConstraints[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkReference makes sure the document referenced by the field of d exists,
+// if the field constraint is a foreign key. Missing and null fields reference nothing.
+func (t *Table) checkReference(key []byte, d document.Document, fc *FieldConstraint) error {
+	fk := fc.References
+	if fk.TableName == "" {
+		return nil
+	}
+
+	v, err := fc.Path.GetValue(d)
+	if err == document.ErrFieldNotFound || err == document.ErrValueNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if v.Type == document.NullValue {
+		return nil
+	}
+
+	ref, err := t.tx.GetTable(fk.TableName)
+	if err != nil {
+		return err
+	}
+
+	refCfg, err := ref.Config()
+	if err != nil {
+		return err
+	}
+
+	refKey, err := encodePrimaryKey(refCfg.GetPrimaryKey(), v)
+	if err != nil {
+		return err
+	}
+
+	// documents can reference themselves
+	if fk.TableName == t.name && bytes.Equal(refKey, key) {
+		return nil
+	}
+
+	_, err = ref.Store.Get(refKey)
+	if err == engine.ErrKeyNotFound {
+		return fmt.Errorf("field %q references a missing document of table %q", fc.Path, fk.TableName)
+	}
+
+	return err
+}
+
+// encodePrimaryKey converts v to the type of the primary key and encodes it.
+func encodePrimaryKey(pk *FieldConstraint, v document.Value) ([]byte, error) {
+	if pk == nil {
+		return nil, errors.New("referenced table has no primary key")
+	}
+
+	if pk.Type != 0 {
+		var err error
+		v, err = v.ConvertTo(pk.Type)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return encoding.EncodeValue(v)
+}
+
+// deleteReferences applies the ON DELETE action of the foreign keys
+// to the documents referencing the deleted document.
+func (t *Table) deleteReferences(key []byte) error {
+	refs, err := t.tx.referencesTo(t.name)
+	if err != nil || len(refs) == 0 {
+		return err
+	}
+
+	cfg, err := t.Config()
+	if err != nil {
+		return err
+	}
+	pk := cfg.GetPrimaryKey()
+
+	for _, r := range refs {
+		rt, err := t.tx.GetTable(r.tableName)
+		if err != nil {
+			return err
+		}
+
+		// the keys are collected first since the table is modified afterwards
+		var keys [][]byte
+		err = rt.Iterate(func(d document.Document) error {
+			v, err := r.fc.Path.GetValue(d)
+			if err == document.ErrFieldNotFound || err == document.ErrValueNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if v.Type == document.NullValue {
+				return nil
+			}
+
+			k, err := encodePrimaryKey(pk, v)
+			if err != nil || !bytes.Equal(k, key) {
+				return nil
+			}
 
-		err = idx.Delete(v, key)
+			keys = append(keys, append([]byte{}, d.(document.Keyer).Key()...))
+			return nil
+		})
 		if err != nil {
 			return err
 		}
+
+		if len(keys) == 0 {
+			continue
+		}
+
+		switch r.fc.References.OnDelete {
+		case Cascade:
+			for _, k := range keys {
+				err = rt.Delete(k)
+				// the document might have been deleted by a cycle of cascading deletions
+				if err != nil && err != ErrDocumentNotFound {
+					return err
+				}
+			}
+		case SetNull:
+			for _, k := range keys {
+				d, err := rt.GetDocument(k)
+				if err == ErrDocumentNotFound {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				var fb document.FieldBuffer
+				err = fb.Copy(d)
+				if err != nil {
+					return err
+				}
+
+				err = fb.DeletePath(r.fc.Path)
+				if err != nil {
+					return err
+				}
+
+				err = rt.Replace(k, &fb)
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("document is referenced by field %q of table %q", r.fc.Path, r.tableName)
+		}
 	}
 
-	return t.Store.Delete(key)
+	return nil
 }
 
 // Replace a document by key.
 // An error is returned if the key doesn't exist.
+// The document is validated against the constraints of the table, like during an insertion,
+// and its primary key, if any, can't be changed.
 // Indexes are automatically updated.
 func (t *Table) Replace(key []byte, d document.Document) error {
 	indexes, err := t.Indexes()
@@ -352,14 +769,43 @@ func (t *Table) replace(indexes map[string]Index, key []byte, d document.Documen
 		return err
 	}
 
+	d, err = t.validateConstraints(d)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := t.Config()
+	if err != nil {
+		return err
+	}
+
+	if cfg.GetPrimaryKey() != nil {
+		k, err := t.generateKey(d)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(k, key) {
+			return errors.New("primary key cannot be modified")
+		}
+	}
+
+	err = t.checkReferences(key, d)
+	if err != nil {
+		return err
+	}
+
 	// remove key from indexes
 	for _, idx := range indexes {
-		v, err := idx.Path.GetValue(old)
+		ok, err := idx.covers(t.tx, old)
 		if err != nil {
 			return err
 		}
+		if !ok {
+			continue
+		}
 
-		err = idx.Delete(v, key)
+		err = idx.Delete(idx.value(old), key)
 		if err != nil {
 			return err
 		}
@@ -379,13 +825,20 @@ func (t *Table) replace(indexes map[string]Index, key []byte, d document.Documen
 
 	// update indexes
 	for _, idx := range indexes {
-		v, err := idx.Path.GetValue(d)
+		ok, err := idx.covers(t.tx, d)
 		if err != nil {
+			return err
+		}
+		if !ok {
 			continue
 		}
 
-		err = idx.Set(v, key)
+		err = idx.Set(idx.value(d), key)
 		if err != nil {
+			if err == index.ErrDuplicate {
+				return ErrDuplicateDocument
+			}
+
 			return err
 		}
 	}
@@ -403,7 +856,9 @@ func (t *Table) TableName() string {
 	return t.name
 }
 
-// Indexes returns a map of all the indexes of a table.
+// Indexes returns a map of all the indexes of a table, by indexed paths.
+// The paths of indexes on multiple fields are separated by commas, i.e. "a, b.c".
+// The paths of partial indexes are followed by their predicate, i.e. "a WHERE b IS NULL".
 func (t *Table) Indexes() (map[string]Index, error) {
 	s, err := t.tx.Tx.GetStore(indexStoreName)
 	if err != nil {
@@ -440,21 +895,12 @@ func (t *Table) Indexes() (map[string]Index, error) {
 				return err
 			}
 
-			var idx index.Index
-			if opts.Unique {
-				idx = index.NewUniqueIndex(t.tx.Tx, opts.IndexName)
-			} else {
-				idx = index.NewListIndex(t.tx.Tx, opts.IndexName)
-			}
-
-			indexes[opts.Path.String()] = Index{
-				Index:     idx,
-				IndexName: opts.IndexName,
-				TableName: opts.TableName,
-				Path:      opts.Path,
-				Unique:    opts.Unique,
+			name := pathsString(opts.Paths)
+			if opts.Where != "" {
+				name += " WHERE " + opts.Where
 			}
 
+			indexes[name] = *newIndex(t.tx.Tx, opts)
 			return nil
 		})
 	if err != nil {
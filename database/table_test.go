@@ -8,6 +8,7 @@ import (
 	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/document/encoding"
+	"github.com/asdine/genji/engine/memoryengine"
 	"github.com/stretchr/testify/require"
 )
 
@@ -221,7 +222,7 @@ func TestTableInsert(t *testing.T) {
 		require.NoError(t, err)
 
 		err = tx.CreateIndex(database.IndexConfig{
-			IndexName: "idxFoo", TableName: "test", Path: document.NewValuePath("foo"),
+			IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")},
 		})
 		require.NoError(t, err)
 		idx, err := tx.GetIndex("idxFoo")
@@ -266,8 +267,8 @@ func TestTableInsert(t *testing.T) {
 
 		err := tx.CreateTable("test", &database.TableConfig{
 			FieldConstraints: []database.FieldConstraint{
-				{[]string{"foo"}, document.Int32Value, false, false},
-				{[]string{"bar"}, document.Int8Value, false, false},
+				{Path: []string{"foo"}, Type: document.Int32Value},
+				{Path: []string{"bar"}, Type: document.Int8Value},
 			},
 		})
 		require.NoError(t, err)
@@ -303,7 +304,7 @@ func TestTableInsert(t *testing.T) {
 
 		err := tx.CreateTable("test1", &database.TableConfig{
 			FieldConstraints: []database.FieldConstraint{
-				{[]string{"foo"}, 0, false, true},
+				{Path: []string{"foo"}, IsNotNull: true},
 			},
 		})
 		require.NoError(t, err)
@@ -312,7 +313,7 @@ func TestTableInsert(t *testing.T) {
 
 		err = tx.CreateTable("test2", &database.TableConfig{
 			FieldConstraints: []database.FieldConstraint{
-				{[]string{"foo"}, document.Int32Value, false, true},
+				{Path: []string{"foo"}, Type: document.Int32Value, IsNotNull: true},
 			},
 		})
 		require.NoError(t, err)
@@ -341,7 +342,7 @@ func TestTableInsert(t *testing.T) {
 
 		err := tx.CreateTable("test1", &database.TableConfig{
 			FieldConstraints: []database.FieldConstraint{
-				{[]string{"foo", "1"}, 0, false, true},
+				{Path: []string{"foo", "1"}, IsNotNull: true},
 			},
 		})
 		require.NoError(t, err)
@@ -359,6 +360,60 @@ func TestTableInsert(t *testing.T) {
 	})
 }
 
+// TestTableGeneratedKeys verifies the keys generated for tables without primary key.
+func TestTableGeneratedKeys(t *testing.T) {
+	db, err := database.New(memoryengine.NewEngine(), nil)
+	require.NoError(t, err)
+
+	insert := func(t *testing.T, n int, commit bool) []byte {
+		tx, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		var key []byte
+		for i := 0; i < n; i++ {
+			key, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewIntValue(i)))
+			require.NoError(t, err)
+		}
+
+		if commit {
+			require.NoError(t, tx.Commit())
+		}
+		return key
+	}
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+	err = tx.CreateTable("test", nil)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	t.Run("Should reserve keys by batches", func(t *testing.T) {
+		key := insert(t, 3, true)
+		require.Equal(t, encoding.EncodeInt64(3), key)
+
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Equal(t, int64(64), cfg.LastKey)
+	})
+
+	t.Run("Should not reuse keys after a rollback", func(t *testing.T) {
+		// the lease reserved by this transaction is rolled back
+		insert(t, 70, false)
+		key := insert(t, 1, true)
+		require.Equal(t, encoding.EncodeInt64(74), key)
+	})
+}
+
 // TestTableDelete verifies Delete behaviour.
 func TestTableDelete(t *testing.T) {
 	t.Run("Should fail if not found", func(t *testing.T) {
@@ -397,6 +452,35 @@ func TestTableDelete(t *testing.T) {
 		_, err = res.GetByField("fieldc")
 		require.Error(t, err)
 	})
+
+	t.Run("Should remove documents without the indexed field from the index", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+
+		err = tx.CreateIndex(database.IndexConfig{
+			IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")},
+		})
+		require.NoError(t, err)
+		idx, err := tx.GetIndex("idxFoo")
+		require.NoError(t, err)
+
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		key, err := tb.Insert(newDocument())
+		require.NoError(t, err)
+
+		err = tb.Delete(key)
+		require.NoError(t, err)
+
+		err = idx.AscendGreaterOrEqual(nil, func(val document.Value, k []byte) error {
+			return errors.New("should not iterate")
+		})
+		require.NoError(t, err)
+	})
 }
 
 // TestTableReplace verifies Replace behaviour.
@@ -447,6 +531,242 @@ func TestTableReplace(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, "c", string(f.V.([]byte)))
 	})
+
+	t.Run("Should validate the constraints of the table", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: []string{"id"}, Type: document.Int32Value, IsPrimaryKey: true},
+				{Path: []string{"a"}, Type: document.Int32Value, IsNotNull: true},
+			},
+		})
+		require.NoError(t, err)
+
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		key, err := tb.Insert(document.NewFieldBuffer().
+			Add("id", document.NewInt64Value(1)).
+			Add("a", document.NewInt64Value(1)))
+		require.NoError(t, err)
+
+		// a is converted
+		err = tb.Replace(key, document.NewFieldBuffer().
+			Add("id", document.NewInt64Value(1)).
+			Add("a", document.NewFloat64Value(2)))
+		require.NoError(t, err)
+		d, err := tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err := d.GetByField("a")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt32Value(2), v)
+
+		// a is required
+		err = tb.Replace(key, document.NewFieldBuffer().
+			Add("id", document.NewInt64Value(1)))
+		require.Error(t, err)
+
+		// the primary key can't change
+		err = tb.Replace(key, document.NewFieldBuffer().
+			Add("id", document.NewInt64Value(2)).
+			Add("a", document.NewInt64Value(1)))
+		require.Error(t, err)
+	})
+}
+
+// TestTableInsertOrConflict verifies InsertOrConflict behaviour.
+func TestTableInsertOrConflict(t *testing.T) {
+	tx, cleanup := newTestDB(t)
+	defer cleanup()
+
+	err := tx.CreateTable("test", &database.TableConfig{
+		FieldConstraints: []database.FieldConstraint{
+			{Path: []string{"id"}, Type: document.Int32Value, IsPrimaryKey: true},
+		},
+	})
+	require.NoError(t, err)
+
+	err = tx.CreateIndex(database.IndexConfig{
+		IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")}, Unique: true,
+	})
+	require.NoError(t, err)
+
+	tb, err := tx.GetTable("test")
+	require.NoError(t, err)
+
+	key, err := tb.Insert(document.NewFieldBuffer().
+		Add("id", document.NewInt64Value(1)).
+		Add("foo", document.NewTextValue("a")))
+	require.NoError(t, err)
+
+	t.Run("Should return the key of the document with the same primary key", func(t *testing.T) {
+		k, conflict, err := tb.InsertOrConflict(document.NewFieldBuffer().
+			Add("id", document.NewFloat64Value(1)).
+			Add("foo", document.NewTextValue("b")))
+		require.NoError(t, err)
+		require.True(t, conflict)
+		require.Equal(t, key, k)
+	})
+
+	t.Run("Should return the key of the document with the same unique value", func(t *testing.T) {
+		k, conflict, err := tb.InsertOrConflict(document.NewFieldBuffer().
+			Add("id", document.NewInt64Value(2)).
+			Add("foo", document.NewTextValue("a")))
+		require.NoError(t, err)
+		require.True(t, conflict)
+		require.Equal(t, key, k)
+	})
+
+	t.Run("Should insert the document if there is no conflict", func(t *testing.T) {
+		k, conflict, err := tb.InsertOrConflict(document.NewFieldBuffer().
+			Add("id", document.NewInt64Value(2)).
+			Add("foo", document.NewTextValue("b")))
+		require.NoError(t, err)
+		require.False(t, conflict)
+
+		d, err := tb.GetDocument(k)
+		require.NoError(t, err)
+		v, err := d.GetByField("foo")
+		require.NoError(t, err)
+		require.Equal(t, document.NewTextValue("b"), v)
+	})
+}
+
+// TestTableForeignKeys verifies that foreign keys are enforced by Insert, Replace and Delete.
+func TestTableForeignKeys(t *testing.T) {
+	setup := func(t *testing.T, action database.ForeignKeyAction) (*database.Table, *database.Table, func()) {
+		tx, cleanup := newTestDB(t)
+
+		err := tx.CreateTable("authors", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: []string{"id"}, Type: document.Int64Value, IsPrimaryKey: true},
+			},
+		})
+		require.NoError(t, err)
+
+		err = tx.CreateTable("books", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: []string{"authorId"}, Type: document.Int64Value, References: database.ForeignKey{TableName: "authors", OnDelete: action}},
+			},
+		})
+		require.NoError(t, err)
+
+		authors, err := tx.GetTable("authors")
+		require.NoError(t, err)
+		books, err := tx.GetTable("books")
+		require.NoError(t, err)
+
+		for i := 1; i <= 2; i++ {
+			_, err = authors.Insert(document.NewFieldBuffer().Add("id", document.NewIntValue(i)))
+			require.NoError(t, err)
+		}
+
+		return authors, books, cleanup
+	}
+
+	countBooks := func(t *testing.T, books *database.Table) (count, withAuthor int) {
+		err := books.Iterate(func(d document.Document) error {
+			count++
+			if _, err := d.GetByField("authorId"); err == nil {
+				withAuthor++
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		return
+	}
+
+	t.Run("Should set the path to the primary key of the referenced table", func(t *testing.T) {
+		_, books, cleanup := setup(t, database.Restrict)
+		defer cleanup()
+
+		cfg, err := books.Config()
+		require.NoError(t, err)
+		require.Equal(t, document.NewValuePath("id"), cfg.FieldConstraints[0].References.Path)
+	})
+
+	t.Run("Should fail if the referenced document doesn't exist", func(t *testing.T) {
+		_, books, cleanup := setup(t, database.Restrict)
+		defer cleanup()
+
+		// the value is converted to the type of the primary key
+		key, err := books.Insert(document.NewFieldBuffer().Add("authorId", document.NewFloat64Value(1)))
+		require.NoError(t, err)
+
+		_, err = books.Insert(document.NewFieldBuffer().Add("authorId", document.NewIntValue(3)))
+		require.EqualError(t, err, `field "authorId" references a missing document of table "authors"`)
+
+		err = books.Replace(key, document.NewFieldBuffer().Add("authorId", document.NewIntValue(3)))
+		require.Error(t, err)
+
+		// documents without the field reference nothing
+		_, err = books.Insert(document.NewFieldBuffer().Add("title", document.NewTextValue("foo")))
+		require.NoError(t, err)
+	})
+
+	t.Run("Should prevent the deletion of referenced documents", func(t *testing.T) {
+		authors, books, cleanup := setup(t, database.Restrict)
+		defer cleanup()
+
+		_, err := books.Insert(document.NewFieldBuffer().Add("authorId", document.NewIntValue(1)))
+		require.NoError(t, err)
+
+		err = authors.Delete(encoding.EncodeInt64(1))
+		require.EqualError(t, err, `document is referenced by field "authorId" of table "books"`)
+
+		err = authors.Delete(encoding.EncodeInt64(2))
+		require.NoError(t, err)
+	})
+
+	t.Run("Should delete the referencing documents", func(t *testing.T) {
+		authors, books, cleanup := setup(t, database.Cascade)
+		defer cleanup()
+
+		for i := 1; i <= 3; i++ {
+			_, err := books.Insert(document.NewFieldBuffer().Add("authorId", document.NewIntValue(i%2+1)))
+			require.NoError(t, err)
+		}
+
+		err := authors.Delete(encoding.EncodeInt64(2))
+		require.NoError(t, err)
+
+		count, _ := countBooks(t, books)
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("Should remove the referencing fields", func(t *testing.T) {
+		authors, books, cleanup := setup(t, database.SetNull)
+		defer cleanup()
+
+		for i := 1; i <= 3; i++ {
+			_, err := books.Insert(document.NewFieldBuffer().Add("authorId", document.NewIntValue(i%2+1)))
+			require.NoError(t, err)
+		}
+
+		err := authors.Delete(encoding.EncodeInt64(2))
+		require.NoError(t, err)
+
+		count, withAuthor := countBooks(t, books)
+		require.Equal(t, 3, count)
+		require.Equal(t, 1, withAuthor)
+	})
+
+	t.Run("Should fail if the referenced table has no primary key", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("authors", nil)
+		require.NoError(t, err)
+
+		err = tx.CreateTable("books", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: []string{"authorId"}, References: database.ForeignKey{TableName: "authors"}},
+			},
+		})
+		require.Error(t, err)
+	})
 }
 
 // TestTableTruncate verifies Truncate behaviour.
@@ -509,21 +829,21 @@ func TestTableIndexes(t *testing.T) {
 			Unique:    true,
 			IndexName: "idx1a",
 			TableName: "test1",
-			Path:      document.NewValuePath("a"),
+			Paths:     []document.ValuePath{document.NewValuePath("a")},
 		})
 		require.NoError(t, err)
 		err = tx.CreateIndex(database.IndexConfig{
 			Unique:    false,
 			IndexName: "idx1b",
 			TableName: "test1",
-			Path:      document.NewValuePath("b"),
+			Paths:     []document.ValuePath{document.NewValuePath("b")},
 		})
 		require.NoError(t, err)
 		err = tx.CreateIndex(database.IndexConfig{
 			Unique:    false,
 			IndexName: "ifx2a",
 			TableName: "test2",
-			Path:      document.NewValuePath("a"),
+			Paths:     []document.ValuePath{document.NewValuePath("a")},
 		})
 		require.NoError(t, err)
 
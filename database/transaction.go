@@ -1,6 +1,8 @@
 package database
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
 	"github.com/asdine/genji/document"
@@ -21,10 +23,19 @@ var (
 // and read/write can be used to read, create, delete and modify tables.
 type Transaction struct {
 	db         *Database
+	ctx        context.Context
 	Tx         engine.Transaction
 	writable   bool
 	tcfgStore  *tableConfigStore
 	indexStore *indexStore
+	statsStore *statsStore
+	seqStore   *sequenceStore
+	// generation of the database when the transaction began.
+	generation int64
+	// savepoints of the transaction, shared by its copies.
+	savepoints *[]savepoint
+	// constraint expressions already parsed, by source.
+	exprs map[string]ConstraintExpr
 }
 
 // Rollback the transaction. Can be used safely after commit.
@@ -33,10 +44,37 @@ func (tx *Transaction) Rollback() error {
 }
 
 // Commit the transaction.
+// If the context of the transaction is done, the transaction is rolled back and ctx.Err() is returned.
+// If the engine detects a conflict with another transaction, it returns ErrConflict.
 func (tx *Transaction) Commit() error {
+	err := tx.Context().Err()
+	if err != nil {
+		tx.Tx.Rollback()
+		return err
+	}
+
 	return tx.Tx.Commit()
 }
 
+// Context returns the context of the transaction.
+// Operations which read many documents should stop once it is done.
+func (tx *Transaction) Context() context.Context {
+	if tx.ctx == nil {
+		return context.Background()
+	}
+
+	return tx.ctx
+}
+
+// WithContext returns a copy of the transaction whose context is ctx.
+// The copy shares the underlying engine transaction, whose own context
+// still applies, which allows to bound a single query of a longer transaction.
+func (tx *Transaction) WithContext(ctx context.Context) *Transaction {
+	c := *tx
+	c.ctx = ctx
+	return &c
+}
+
 // Writable indicates if the transaction is writable or not.
 func (tx *Transaction) Writable() bool {
 	return tx.writable
@@ -54,7 +92,7 @@ func (tx *Transaction) Promote() error {
 		return err
 	}
 
-	newTransaction, err := tx.db.Begin(true)
+	newTransaction, err := tx.db.BeginTx(tx.Context(), true)
 	if err != nil {
 		return err
 	}
@@ -69,6 +107,19 @@ func (tx Transaction) CreateTable(name string, cfg *TableConfig) error {
 	if cfg == nil {
 		cfg = new(TableConfig)
 	}
+
+	for i := range cfg.FieldConstraints {
+		err := tx.validateForeignKey(name, cfg, &cfg.FieldConstraints[i])
+		if err != nil {
+			return err
+		}
+
+		err = tx.validateConstraintExprs(&cfg.FieldConstraints[i])
+		if err != nil {
+			return err
+		}
+	}
+
 	err := tx.tcfgStore.Insert(name, *cfg)
 	if err != nil {
 		return err
@@ -103,28 +154,473 @@ func (tx Transaction) GetTable(name string) (*Table, error) {
 }
 
 // DropTable deletes a table from the database.
+// Tables referenced by the foreign keys of other tables can't be dropped.
 func (tx Transaction) DropTable(name string) error {
-	err := tx.indexStore.st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+	refs, err := tx.referencesTo(name)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if ref.tableName != name {
+			return fmt.Errorf("table %q is referenced by field %q of table %q", name, ref.fc.Path, ref.tableName)
+		}
+	}
+
+	// the indexes are dropped once the iteration is over,
+	// since dropping them modifies the store being read.
+	var indexes []string
+	err = tx.indexStore.st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
 		var opts IndexConfig
 		err := document.StructScan(encoding.EncodedDocument(v), &opts)
 		if err != nil {
 			return err
 		}
 
-		return tx.DropIndex(opts.IndexName)
+		if opts.TableName == name {
+			indexes = append(indexes, opts.IndexName)
+		}
+		return nil
 	})
 	if err != nil {
 		return err
 	}
 
+	for _, indexName := range indexes {
+		err = tx.DropIndex(indexName)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = tx.tcfgStore.Delete(name)
 	if err != nil {
 		return err
 	}
 
+	err = tx.statsStore.Delete(name)
+	if err != nil {
+		return err
+	}
+
+	tx.db.releaseKeys(name)
+
 	return tx.Tx.DropStore(name)
 }
 
+// RenameTable renames a table, along with the references of its indexes, statistics
+// and of the foreign keys of other tables.
+// If a table with the new name already exists, returns ErrTableAlreadyExists.
+func (tx Transaction) RenameTable(oldName, newName string) error {
+	cfg, err := tx.tcfgStore.Get(oldName)
+	if err != nil {
+		return err
+	}
+
+	refs, err := tx.referencesTo(oldName)
+	if err != nil {
+		return err
+	}
+
+	err = tx.tcfgStore.Insert(newName, *cfg)
+	if err != nil {
+		return err
+	}
+
+	err = tx.tcfgStore.Delete(oldName)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		tableName := ref.tableName
+		if tableName == oldName {
+			tableName = newName
+		}
+
+		refCfg, err := tx.tcfgStore.Get(tableName)
+		if err != nil {
+			return err
+		}
+
+		for i := range refCfg.FieldConstraints {
+			if refCfg.FieldConstraints[i].References.TableName == oldName {
+				refCfg.FieldConstraints[i].References.TableName = newName
+			}
+		}
+
+		err = tx.tcfgStore.Replace(tableName, refCfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	// stores can't be renamed, the documents are copied to a new store.
+	err = tx.Tx.CreateStore(newName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create table %q", newName)
+	}
+
+	src, err := tx.Tx.GetStore(oldName)
+	if err != nil {
+		return err
+	}
+
+	dst, err := tx.Tx.GetStore(newName)
+	if err != nil {
+		return err
+	}
+
+	err = iterateInBatches(src, func(keys, values [][]byte) error {
+		for i := range keys {
+			err := dst.Put(keys[i], values[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Tx.DropStore(oldName)
+	if err != nil {
+		return err
+	}
+
+	tx.db.releaseKeys(oldName)
+
+	// index stores are named after the index, only their configuration refers to the table.
+	var indexes []IndexConfig
+	err = tx.indexStore.st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+		var opts IndexConfig
+		err := document.StructScan(encoding.EncodedDocument(v), &opts)
+		if err != nil {
+			return err
+		}
+
+		if opts.TableName == oldName {
+			indexes = append(indexes, opts)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, opts := range indexes {
+		err = tx.indexStore.Delete(opts.IndexName)
+		if err != nil {
+			return err
+		}
+
+		opts.TableName = newName
+		err = tx.indexStore.Insert(opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	stats, err := tx.statsStore.Get(oldName)
+	if err != nil || stats == nil {
+		return err
+	}
+
+	err = tx.statsStore.Delete(oldName)
+	if err != nil {
+		return err
+	}
+
+	stats.TableName = newName
+	return tx.statsStore.Replace(stats)
+}
+
+// AddFieldConstraint adds a constraint to the configuration of a table.
+// Existing documents are validated against the new constraint and their field converted
+// to the type of the constraint, or set to its default value. If any of them doesn't satisfy it,
+// an error is returned before the table is modified.
+// Primary keys can't be added to an existing table.
+func (tx Transaction) AddFieldConstraint(tableName string, fc FieldConstraint) error {
+	if fc.IsPrimaryKey {
+		return errors.New("cannot add a primary key to an existing table")
+	}
+
+	t, err := tx.GetTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := t.Config()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cfg.FieldConstraints {
+		if c.Path.String() == fc.Path.String() {
+			return fmt.Errorf("field %q already has a constraint", fc.Path)
+		}
+	}
+
+	err = tx.validateForeignKey(tableName, cfg, &fc)
+	if err != nil {
+		return err
+	}
+
+	err = tx.validateConstraintExprs(&fc)
+	if err != nil {
+		return err
+	}
+
+	// make sure every document satisfies the constraint before modifying anything
+	err = iterateInBatches(t.Store, func(keys, values [][]byte) error {
+		for i := range keys {
+			var fb document.FieldBuffer
+			err := fb.Copy(encoding.EncodedDocument(values[i]))
+			if err != nil {
+				return err
+			}
+
+			err = t.applyConstraint(&fb, &fc)
+			if err != nil {
+				return err
+			}
+
+			// looking up the referenced documents requires reading other stores
+			err = t.checkReference(keys[i], &fb, &fc)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg.FieldConstraints = append(cfg.FieldConstraints, fc)
+	err = tx.tcfgStore.Replace(tableName, cfg)
+	if err != nil {
+		return err
+	}
+
+	if fc.Type == 0 && fc.DefaultValue == "" {
+		return nil
+	}
+
+	// convert the existing documents and set their default values
+	indexes, err := t.Indexes()
+	if err != nil {
+		return err
+	}
+
+	return iterateInBatches(t.Store, func(keys, values [][]byte) error {
+		for i := range keys {
+			err := t.replace(indexes, keys[i], encoding.EncodedDocument(values[i]))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DropFieldConstraint removes the constraint on the given path from the configuration of a table.
+// The documents are not modified. The primary key can't be removed.
+func (tx Transaction) DropFieldConstraint(tableName string, path document.ValuePath) error {
+	cfg, err := tx.tcfgStore.Get(tableName)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range cfg.FieldConstraints {
+		if c.Path.String() != path.String() {
+			continue
+		}
+
+		if c.IsPrimaryKey {
+			return errors.New("cannot drop the primary key of a table")
+		}
+
+		cfg.FieldConstraints = append(cfg.FieldConstraints[:i], cfg.FieldConstraints[i+1:]...)
+		return tx.tcfgStore.Replace(tableName, cfg)
+	}
+
+	return fmt.Errorf("field %q has no constraint", path)
+}
+
+// validateForeignKey makes sure the table referenced by the field constraint exists
+// and sets the path of the reference to the primary key of that table, if not specified.
+// The constraint is part of the configuration of the given table, which might not
+// exist yet.
+func (tx Transaction) validateForeignKey(tableName string, cfg *TableConfig, fc *FieldConstraint) error {
+	fk := &fc.References
+	if fk.TableName == "" {
+		return nil
+	}
+
+	refCfg := cfg
+	if fk.TableName != tableName {
+		var err error
+		refCfg, err = tx.tcfgStore.Get(fk.TableName)
+		if err == ErrTableNotFound {
+			return fmt.Errorf("field %q references an unknown table %q", fc.Path, fk.TableName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	pk := refCfg.GetPrimaryKey()
+	if pk == nil {
+		return fmt.Errorf("field %q references table %q which has no primary key", fc.Path, fk.TableName)
+	}
+
+	if len(fk.Path) == 0 {
+		fk.Path = pk.Path
+	} else if fk.Path.String() != pk.Path.String() {
+		return fmt.Errorf("field %q must reference the primary key of table %q", fc.Path, fk.TableName)
+	}
+
+	if fk.OnDelete == SetNull && fc.IsNotNull {
+		return fmt.Errorf("field %q can't be set to null on delete, it is required", fc.Path)
+	}
+
+	return nil
+}
+
+// validateConstraintExprs parses the DEFAULT and CHECK expressions of the field constraint.
+// The default value is evaluated once, to make sure it doesn't reference any field
+// and that it can be converted to the type of the field.
+func (tx Transaction) validateConstraintExprs(fc *FieldConstraint) error {
+	if fc.Check != "" {
+		_, err := tx.parseConstraintExpr(fc.Check)
+		if err != nil {
+			return err
+		}
+	}
+
+	if fc.DefaultValue == "" {
+		return nil
+	}
+
+	e, err := tx.parseConstraintExpr(fc.DefaultValue)
+	if err != nil {
+		return err
+	}
+
+	// the evaluation can have side effects, like incrementing a sequence
+	err = tx.Savepoint(defaultValueSavepoint)
+	if err != nil {
+		return err
+	}
+
+	v, err := e.Eval(&tx, noFieldDocument{})
+	if err == nil && fc.Type != 0 {
+		_, err = v.ConvertTo(fc.Type)
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid default value for field %q: %v", fc.Path, err)
+	}
+
+	rerr := tx.RollbackTo(defaultValueSavepoint)
+	if rerr == nil {
+		rerr = tx.Release(defaultValueSavepoint)
+	}
+	if err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// defaultValueSavepoint is the savepoint created to evaluate default values.
+const defaultValueSavepoint = "__genji.default"
+
+// noFieldDocument is the document against which default values are evaluated,
+// since they can't reference any field.
+type noFieldDocument struct{}
+
+func (noFieldDocument) GetByField(field string) (document.Value, error) {
+	return document.Value{}, errors.New("fields can't be referenced")
+}
+
+func (noFieldDocument) Iterate(func(field string, value document.Value) error) error {
+	return errors.New("fields can't be referenced")
+}
+
+// reference is a field constraint referencing another table.
+type reference struct {
+	tableName string
+	fc        FieldConstraint
+}
+
+// referencesTo returns the foreign keys referencing the given table.
+func (tx Transaction) referencesTo(tableName string) ([]reference, error) {
+	var refs []reference
+
+	err := tx.tcfgStore.st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+		var cfg TableConfig
+		err := document.StructScan(encoding.EncodedDocument(v), &cfg)
+		if err != nil {
+			return err
+		}
+
+		for _, fc := range cfg.FieldConstraints {
+			if fc.References.TableName == tableName {
+				refs = append(refs, reference{tableName: string(k), fc: fc})
+			}
+		}
+		return nil
+	})
+
+	return refs, err
+}
+
+// iterateInBatches reads the store by batches of at most batchSize key-value pairs
+// and calls fn with a copy of each batch once it has been read. This allows
+// modifying the stores of the transaction, which can't be done while iterating.
+func iterateInBatches(st engine.Store, fn func(keys, values [][]byte) error) error {
+	var pivot []byte
+
+	for {
+		keys := make([][]byte, 0, batchSize)
+		values := make([][]byte, 0, batchSize)
+
+		err := st.AscendGreaterOrEqual(pivot, func(k, v []byte) error {
+			keys = append(keys, append([]byte{}, k...))
+			values = append(values, append([]byte{}, v...))
+			if len(keys) == batchSize {
+				return errStop
+			}
+			return nil
+		})
+		if err != nil && err != errStop {
+			return err
+		}
+
+		if len(keys) > 0 {
+			err = fn(keys, values)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(keys) < batchSize {
+			return nil
+		}
+
+		// resume right after the last key of the batch
+		pivot = append(keys[len(keys)-1], 0)
+	}
+}
+
+// batchSize is the number of key-value pairs read at once by iterateInBatches.
+const batchSize = 100
+
 // ListTables lists all the tables.
 func (tx Transaction) ListTables() ([]string, error) {
 	stores, err := tx.Tx.ListStores("")
@@ -135,7 +631,7 @@ func (tx Transaction) ListTables() ([]string, error) {
 	tables := make([]string, 0, len(stores))
 
 	for _, st := range stores {
-		if st == indexStoreName || st == tableConfigStoreName {
+		if st == indexStoreName || st == tableConfigStoreName || st == statsStoreName || st == sequenceStoreName {
 			continue
 		}
 		if strings.HasPrefix(st, index.StorePrefix) {
@@ -155,7 +651,47 @@ type IndexConfig struct {
 
 	IndexName string
 	TableName string
-	Path      document.ValuePath
+	// Paths of the indexed fields. Indexes on more than one field
+	// are sorted by the first field, then by the second, etc.
+	Paths []document.ValuePath
+	// Where is the predicate of a partial index. If set,
+	// only the documents satisfying it are indexed.
+	Where string
+}
+
+// indexConfig is used to scan an IndexConfig without calling its ScanDocument method.
+type indexConfig IndexConfig
+
+// ScanDocument implements the document.Scanner interface.
+// Indexes created before the support of composite indexes store their only path
+// in a "path" field, which is decoded as the first and only element of Paths.
+func (i *IndexConfig) ScanDocument(d document.Document) error {
+	err := document.StructScan(d, (*indexConfig)(i))
+	if err != nil || len(i.Paths) > 0 {
+		return err
+	}
+
+	v, err := d.GetByField("path")
+	if err == document.ErrFieldNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	a, err := v.ConvertToArray()
+	if err != nil {
+		return err
+	}
+
+	var path document.ValuePath
+	err = document.SliceScan(a, &path)
+	if err != nil {
+		return err
+	}
+
+	i.Paths = []document.ValuePath{path}
+	return nil
 }
 
 // CreateIndex creates an index with the given name.
@@ -166,6 +702,13 @@ func (tx Transaction) CreateIndex(opts IndexConfig) error {
 		return err
 	}
 
+	if opts.Where != "" {
+		_, err = tx.parseConstraintExpr(opts.Where)
+		if err != nil {
+			return err
+		}
+	}
+
 	return tx.indexStore.Insert(opts)
 }
 
@@ -176,20 +719,7 @@ func (tx Transaction) GetIndex(name string) (*Index, error) {
 		return nil, err
 	}
 
-	var idx index.Index
-	if opts.Unique {
-		idx = index.NewUniqueIndex(tx.Tx, opts.IndexName)
-	} else {
-		idx = index.NewListIndex(tx.Tx, opts.IndexName)
-	}
-
-	return &Index{
-		Index:     idx,
-		IndexName: opts.IndexName,
-		TableName: opts.TableName,
-		Path:      opts.Path,
-		Unique:    opts.Unique,
-	}, nil
+	return newIndex(tx.Tx, *opts), nil
 }
 
 // DropIndex deletes an index from the database.
@@ -203,14 +733,12 @@ func (tx Transaction) DropIndex(name string) error {
 		return err
 	}
 
-	var idx index.Index
-	if opts.Unique {
-		idx = index.NewUniqueIndex(tx.Tx, opts.IndexName)
-	} else {
-		idx = index.NewListIndex(tx.Tx, opts.IndexName)
+	err = tx.statsStore.DeleteIndex(opts.TableName, name)
+	if err != nil {
+		return err
 	}
 
-	return idx.Truncate()
+	return newIndex(tx.Tx, *opts).Truncate()
 }
 
 // ReIndex truncates and recreates selected index from scratch.
@@ -231,12 +759,12 @@ func (tx Transaction) ReIndex(indexName string) error {
 	}
 
 	return tb.Iterate(func(d document.Document) error {
-		v, err := idx.Path.GetValue(d)
-		if err != nil {
+		ok, err := idx.covers(&tx, d)
+		if err != nil || !ok {
 			return err
 		}
 
-		return idx.Set(v, d.(document.Keyer).Key())
+		return idx.Set(idx.value(d), d.(document.Keyer).Key())
 	})
 }
 
@@ -281,3 +809,23 @@ func (tx *Transaction) getIndexStore() (*indexStore, error) {
 		st: st,
 	}, nil
 }
+
+func (tx *Transaction) getStatsStore() (*statsStore, error) {
+	st, err := tx.Tx.GetStore(statsStoreName)
+	if err != nil {
+		return nil, err
+	}
+	return &statsStore{
+		st: st,
+	}, nil
+}
+
+func (tx *Transaction) getSequenceStore() (*sequenceStore, error) {
+	st, err := tx.Tx.GetStore(sequenceStoreName)
+	if err != nil {
+		return nil, err
+	}
+	return &sequenceStore{
+		st: st,
+	}, nil
+}
@@ -1,17 +1,19 @@
 package database_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine"
 	"github.com/asdine/genji/engine/memoryengine"
 	"github.com/asdine/genji/index"
 	"github.com/stretchr/testify/require"
 )
 
 func newTestDB(t testing.TB) (*database.Transaction, func()) {
-	db, err := database.New(memoryengine.NewEngine())
+	db, err := database.New(memoryengine.NewEngine(), nil)
 	require.NoError(t, err)
 
 	tx, err := db.Begin(true)
@@ -42,7 +44,7 @@ func TestTxCreateIndex(t *testing.T) {
 		require.NoError(t, err)
 
 		err = tx.CreateIndex(database.IndexConfig{
-			IndexName: "idxFoo", TableName: "test", Path: document.NewValuePath("foo"),
+			IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")},
 		})
 		require.NoError(t, err)
 		idx, err := tx.GetIndex("idxFoo")
@@ -58,12 +60,12 @@ func TestTxCreateIndex(t *testing.T) {
 		require.NoError(t, err)
 
 		err = tx.CreateIndex(database.IndexConfig{
-			IndexName: "idxFoo", TableName: "test", Path: document.NewValuePath("foo"),
+			IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")},
 		})
 		require.NoError(t, err)
 
 		err = tx.CreateIndex(database.IndexConfig{
-			IndexName: "idxFoo", TableName: "test", Path: document.NewValuePath("foo"),
+			IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")},
 		})
 		require.Equal(t, database.ErrIndexAlreadyExists, err)
 	})
@@ -73,7 +75,7 @@ func TestTxCreateIndex(t *testing.T) {
 		defer cleanup()
 
 		err := tx.CreateIndex(database.IndexConfig{
-			IndexName: "idxFoo", TableName: "test", Path: document.NewValuePath("foo"),
+			IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")},
 		})
 		require.Equal(t, database.ErrTableNotFound, err)
 	})
@@ -88,7 +90,7 @@ func TestTxDropTable(t *testing.T) {
 		require.NoError(t, err)
 
 		err = tx.CreateIndex(database.IndexConfig{
-			IndexName: "idxFoo", TableName: "test", Path: document.NewValuePath("foo"),
+			IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")},
 		})
 		require.NoError(t, err)
 
@@ -102,7 +104,7 @@ func TestTxDropTable(t *testing.T) {
 		require.NoError(t, err)
 
 		err = tx.CreateIndex(database.IndexConfig{
-			IndexName: "idxFoo", TableName: "test", Path: document.NewValuePath("foo"),
+			IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")},
 		})
 		require.NoError(t, err)
 	})
@@ -114,6 +116,38 @@ func TestTxDropTable(t *testing.T) {
 		err := tx.DropTable("foo")
 		require.Equal(t, database.ErrTableNotFound, err)
 	})
+
+	t.Run("Should fail if the table is referenced", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		createReferencedTables(t, tx)
+
+		err := tx.DropTable("authors")
+		require.EqualError(t, err, `table "authors" is referenced by field "authorId" of table "books"`)
+
+		err = tx.DropTable("books")
+		require.NoError(t, err)
+
+		err = tx.DropTable("authors")
+		require.NoError(t, err)
+	})
+}
+
+func createReferencedTables(t *testing.T, tx *database.Transaction) {
+	err := tx.CreateTable("authors", &database.TableConfig{
+		FieldConstraints: []database.FieldConstraint{
+			{Path: []string{"id"}, Type: document.Int64Value, IsPrimaryKey: true},
+		},
+	})
+	require.NoError(t, err)
+
+	err = tx.CreateTable("books", &database.TableConfig{
+		FieldConstraints: []database.FieldConstraint{
+			{Path: []string{"authorId"}, References: database.ForeignKey{TableName: "authors"}},
+		},
+	})
+	require.NoError(t, err)
 }
 
 func TestTxDropIndex(t *testing.T) {
@@ -125,7 +159,7 @@ func TestTxDropIndex(t *testing.T) {
 		require.NoError(t, err)
 
 		err = tx.CreateIndex(database.IndexConfig{
-			IndexName: "idxFoo", TableName: "test", Path: document.NewValuePath("foo"),
+			IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")},
 		})
 		require.NoError(t, err)
 
@@ -145,6 +179,180 @@ func TestTxDropIndex(t *testing.T) {
 	})
 }
 
+func TestTxRenameTable(t *testing.T) {
+	t.Run("Should rename a table, its documents and indexes", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+
+		err = tx.CreateIndex(database.IndexConfig{
+			IndexName: "idxFoo", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")},
+		})
+		require.NoError(t, err)
+
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		// more documents than a batch
+		for i := 0; i < 150; i++ {
+			_, err = tb.Insert(document.NewFieldBuffer().Add("foo", document.NewIntValue(i)))
+			require.NoError(t, err)
+		}
+
+		err = tx.RenameTable("test", "test2")
+		require.NoError(t, err)
+
+		_, err = tx.GetTable("test")
+		require.Equal(t, database.ErrTableNotFound, err)
+
+		tb, err = tx.GetTable("test2")
+		require.NoError(t, err)
+
+		var count int
+		err = tb.Iterate(func(d document.Document) error {
+			count++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 150, count)
+
+		idx, err := tx.GetIndex("idxFoo")
+		require.NoError(t, err)
+		require.Equal(t, "test2", idx.TableName)
+
+		indexes, err := tb.Indexes()
+		require.NoError(t, err)
+		require.Len(t, indexes, 1)
+	})
+
+	t.Run("Should fail if the new name is taken", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		err = tx.CreateTable("test2", nil)
+		require.NoError(t, err)
+
+		err = tx.RenameTable("test", "test2")
+		require.Equal(t, database.ErrTableAlreadyExists, err)
+	})
+
+	t.Run("Should fail if it doesn't exist", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.RenameTable("test", "test2")
+		require.Equal(t, database.ErrTableNotFound, err)
+	})
+
+	t.Run("Should update the foreign keys referencing the table", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		createReferencedTables(t, tx)
+
+		err := tx.RenameTable("authors", "writers")
+		require.NoError(t, err)
+
+		tb, err := tx.GetTable("books")
+		require.NoError(t, err)
+
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Equal(t, "writers", cfg.FieldConstraints[0].References.TableName)
+	})
+}
+
+func TestTxAddFieldConstraint(t *testing.T) {
+	t.Run("Should convert existing documents", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		key, err := tb.Insert(document.NewFieldBuffer().Add("foo", document.NewFloat64Value(10)))
+		require.NoError(t, err)
+
+		err = tx.AddFieldConstraint("test", database.FieldConstraint{Path: document.NewValuePath("foo"), Type: document.Int32Value})
+		require.NoError(t, err)
+
+		d, err := tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err := d.GetByField("foo")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt32Value(10), v)
+
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Len(t, cfg.FieldConstraints, 1)
+
+		err = tx.AddFieldConstraint("test", database.FieldConstraint{Path: document.NewValuePath("foo"), Type: document.Int64Value})
+		require.Error(t, err)
+	})
+
+	t.Run("Should fail without modifying anything", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		key, err := tb.Insert(document.NewFieldBuffer().Add("foo", document.NewFloat64Value(10)))
+		require.NoError(t, err)
+		_, err = tb.Insert(document.NewFieldBuffer().Add("bar", document.NewFloat64Value(10)))
+		require.NoError(t, err)
+
+		err = tx.AddFieldConstraint("test", database.FieldConstraint{Path: document.NewValuePath("foo"), Type: document.Int32Value, IsNotNull: true})
+		require.Error(t, err)
+
+		d, err := tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err := d.GetByField("foo")
+		require.NoError(t, err)
+		require.Equal(t, document.NewFloat64Value(10), v)
+
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Empty(t, cfg.FieldConstraints)
+	})
+}
+
+func TestTxDropFieldConstraint(t *testing.T) {
+	tx, cleanup := newTestDB(t)
+	defer cleanup()
+
+	err := tx.CreateTable("test", &database.TableConfig{
+		FieldConstraints: []database.FieldConstraint{
+			{Path: []string{"id"}, Type: document.Int32Value, IsPrimaryKey: true},
+			{Path: []string{"a", "b"}, Type: document.Int32Value, IsNotNull: true},
+		},
+	})
+	require.NoError(t, err)
+
+	err = tx.DropFieldConstraint("test", document.NewValuePath("id"))
+	require.Error(t, err)
+
+	err = tx.DropFieldConstraint("test", document.NewValuePath("a.b"))
+	require.NoError(t, err)
+
+	err = tx.DropFieldConstraint("test", document.NewValuePath("a.b"))
+	require.Error(t, err)
+
+	tb, err := tx.GetTable("test")
+	require.NoError(t, err)
+	cfg, err := tb.Config()
+	require.NoError(t, err)
+	require.Len(t, cfg.FieldConstraints, 1)
+}
+
 func TestTxReIndex(t *testing.T) {
 	newTestTableFn := func(t *testing.T) (*database.Transaction, *database.Table, func()) {
 		tx, cleanup := newTestDB(t)
@@ -164,13 +372,13 @@ func TestTxReIndex(t *testing.T) {
 		err = tx.CreateIndex(database.IndexConfig{
 			IndexName: "a",
 			TableName: "test",
-			Path:      document.NewValuePath("a"),
+			Paths:     []document.ValuePath{document.NewValuePath("a")},
 		})
 		require.NoError(t, err)
 		err = tx.CreateIndex(database.IndexConfig{
 			IndexName: "b",
 			TableName: "test",
-			Path:      document.NewValuePath("b"),
+			Paths:     []document.ValuePath{document.NewValuePath("b")},
 		})
 		require.NoError(t, err)
 
@@ -256,13 +464,13 @@ func TestReIndexAll(t *testing.T) {
 		err = tx.CreateIndex(database.IndexConfig{
 			IndexName: "t1a",
 			TableName: "test1",
-			Path:      document.NewValuePath("a"),
+			Paths:     []document.ValuePath{document.NewValuePath("a")},
 		})
 		require.NoError(t, err)
 		err = tx.CreateIndex(database.IndexConfig{
 			IndexName: "t2a",
 			TableName: "test2",
-			Path:      document.NewValuePath("a"),
+			Paths:     []document.ValuePath{document.NewValuePath("a")},
 		})
 		require.NoError(t, err)
 
@@ -323,7 +531,7 @@ func TestTxListTables(t *testing.T) {
 		err = tx.CreateIndex(database.IndexConfig{
 			IndexName: "name",
 			TableName: "a",
-			Path:      document.NewValuePath("foo"),
+			Paths:     []document.ValuePath{document.NewValuePath("foo")},
 		})
 		require.NoError(t, err)
 
@@ -339,3 +547,38 @@ func TestTxListTables(t *testing.T) {
 		require.Equal(t, []string{"a", "b"}, list)
 	})
 }
+
+// engineWithoutContext hides the BeginContext method of an engine.
+type engineWithoutContext struct {
+	engine.Engine
+}
+
+func TestTxContextWithoutContextBeginner(t *testing.T) {
+	db, err := database.New(engineWithoutContext{memoryengine.NewEngine()}, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = db.BeginTx(ctx, true)
+	require.Equal(t, context.Canceled, err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	tx, err := db.BeginTx(ctx, true)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	err = tx.CreateTable("test", nil)
+	require.NoError(t, err)
+
+	// the transaction can't be committed once its context is done
+	cancel()
+	require.Equal(t, context.Canceled, tx.Commit())
+
+	tx, err = db.Begin(false)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.GetTable("test")
+	require.Equal(t, database.ErrTableNotFound, err)
+}
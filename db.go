@@ -1,17 +1,21 @@
 package genji
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"time"
 
 	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/engine"
-	"github.com/asdine/genji/engine/badgerengine"
 	"github.com/asdine/genji/engine/boltengine"
+	"github.com/asdine/genji/engine/memoryengine"
 	"github.com/asdine/genji/sql/parser"
 	"github.com/asdine/genji/sql/query"
-	"github.com/dgraph-io/badger/v2"
 )
 
 // Open creates a Genji database at the given path.
@@ -23,7 +27,7 @@ func Open(path string) (*DB, error) {
 
 	switch path {
 	case ":memory:":
-		ng, err = badgerengine.NewEngine(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		ng = memoryengine.NewEngine()
 	default:
 		ng, err = boltengine.NewEngine(path, 0660, nil)
 	}
@@ -41,7 +45,9 @@ type DB struct {
 
 // New initializes the DB using the given engine.
 func New(ng engine.Engine) (*DB, error) {
-	db, err := database.New(ng)
+	db, err := database.New(ng, &database.Options{
+		ParseConstraintExpr: parser.ParseConstraintExpr,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -56,10 +62,31 @@ func (db *DB) Close() error {
 	return db.DB.Close()
 }
 
+// Backup writes a consistent snapshot of the whole database to w, using a read-only transaction.
+// The backup can be restored to a database using any engine.
+func (db *DB) Backup(w io.Writer) error {
+	return db.DB.Backup(w)
+}
+
+// Restore replaces the content of the database by a backup created by Backup.
+// If the backup is invalid, returns database.ErrInvalidBackup and the database is not modified.
+// The backup is restored in a single transaction, its size is limited by the engine.
+func (db *DB) Restore(r io.Reader) error {
+	return db.DB.Restore(r)
+}
+
 // Begin starts a new transaction.
 // The returned transaction must be closed either by calling Rollback or Commit.
 func (db *DB) Begin(writable bool) (*Tx, error) {
-	tx, err := db.DB.Begin(writable)
+	return db.BeginTx(context.Background(), writable)
+}
+
+// BeginTx starts a new transaction bound to ctx.
+// Once ctx is canceled or its deadline is exceeded, the queries run within the transaction
+// stop and fail with ctx.Err(), and the transaction can only be rolled back.
+// The returned transaction must be closed either by calling Rollback or Commit.
+func (db *DB) BeginTx(ctx context.Context, writable bool) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, writable)
 	if err != nil {
 		return nil, err
 	}
@@ -96,9 +123,65 @@ func (db *DB) Update(fn func(tx *Tx) error) error {
 	return tx.Commit()
 }
 
+// RetryPolicy controls how UpdateWithRetry runs a transaction again after a conflict.
+// Zero fields are replaced by the values of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// Maximum number of times the transaction is run.
+	MaxAttempts int
+	// Time to wait before the first retry. It is doubled after every attempt.
+	InitialBackoff time.Duration
+	// Maximum time to wait between two attempts.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the policy used for the fields of a RetryPolicy that are not set.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    10,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     100 * time.Millisecond,
+}
+
+// UpdateWithRetry works like Update but runs fn in a new transaction every time the commit
+// fails with database.ErrConflict, waiting longer between each attempt.
+// Since fn can be called more than once, it must not have side effects outside of the transaction.
+// Other errors are returned immediately. If the transaction still conflicts after
+// policy.MaxAttempts attempts, the last conflict error is returned.
+func (db *DB) UpdateWithRetry(fn func(tx *Tx) error, policy RetryPolicy) error {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.Update(fn)
+		if !errors.Is(err, database.ErrConflict) || attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+		// the jitter prevents conflicting transactions from being retried at the same time
+		time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)))
+		backoff *= 2
+	}
+}
+
 // Exec a query against the database without returning the result.
 func (db *DB) Exec(q string, args ...interface{}) error {
-	res, err := db.Query(q, args...)
+	return db.ExecContext(context.Background(), q, args...)
+}
+
+// ExecContext executes a query against the database without returning the result.
+// The query stops once ctx is done.
+func (db *DB) ExecContext(ctx context.Context, q string, args ...interface{}) error {
+	res, err := db.QueryContext(ctx, q, args...)
 	if err != nil {
 		return err
 	}
@@ -109,18 +192,32 @@ func (db *DB) Exec(q string, args ...interface{}) error {
 // Query the database and return the result.
 // The returned result must always be closed after usage.
 func (db *DB) Query(q string, args ...interface{}) (*query.Result, error) {
+	return db.QueryContext(context.Background(), q, args...)
+}
+
+// QueryContext queries the database and returns the result.
+// The query, including the iteration of the result, stops once ctx is done.
+// The returned result must always be closed after usage.
+func (db *DB) QueryContext(ctx context.Context, q string, args ...interface{}) (*query.Result, error) {
 	pq, err := parser.ParseQuery(q)
 	if err != nil {
 		return nil, err
 	}
 
-	return pq.Run(db.DB, argsToNamedValues(args))
+	return pq.RunContext(ctx, db.DB, argsToNamedValues(args))
 }
 
 // QueryDocument runs the query and returns the first document.
 // If the query returns no error, QueryDocument returns ErrDocumentNotFound.
 func (db *DB) QueryDocument(q string, args ...interface{}) (document.Document, error) {
-	res, err := db.Query(q, args...)
+	return db.QueryDocumentContext(context.Background(), q, args...)
+}
+
+// QueryDocumentContext runs the query and returns the first document.
+// The query stops once ctx is done.
+// If the query returns no error, QueryDocumentContext returns ErrDocumentNotFound.
+func (db *DB) QueryDocumentContext(ctx context.Context, q string, args ...interface{}) (document.Document, error) {
+	res, err := db.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -182,18 +279,33 @@ type Tx struct {
 // Query the database withing the transaction and returns the result.
 // Closing the returned result after usage is not mandatory.
 func (tx *Tx) Query(q string, args ...interface{}) (*query.Result, error) {
+	return tx.QueryContext(tx.Context(), q, args...)
+}
+
+// QueryContext queries the database within the transaction and returns the result.
+// The query, including the iteration of the result, stops once either ctx
+// or the context of the transaction is done.
+// Closing the returned result after usage is not mandatory.
+func (tx *Tx) QueryContext(ctx context.Context, q string, args ...interface{}) (*query.Result, error) {
 	pq, err := parser.ParseQuery(q)
 	if err != nil {
 		return nil, err
 	}
 
-	return pq.Exec(tx.Transaction, argsToNamedValues(args), false)
+	return pq.ExecContext(ctx, tx.Transaction, argsToNamedValues(args), false)
 }
 
 // QueryDocument runs the query and returns the first document.
 // If the query returns no error, QueryDocument returns ErrDocumentNotFound.
 func (tx *Tx) QueryDocument(q string, args ...interface{}) (document.Document, error) {
-	res, err := tx.Query(q, args...)
+	return tx.QueryDocumentContext(tx.Context(), q, args...)
+}
+
+// QueryDocumentContext runs the query and returns the first document.
+// The query stops once either ctx or the context of the transaction is done.
+// If the query returns no error, QueryDocumentContext returns ErrDocumentNotFound.
+func (tx *Tx) QueryDocumentContext(ctx context.Context, q string, args ...interface{}) (document.Document, error) {
+	res, err := tx.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -212,7 +324,13 @@ func (tx *Tx) QueryDocument(q string, args ...interface{}) (document.Document, e
 
 // Exec a query against the database within tx and without returning the result.
 func (tx *Tx) Exec(q string, args ...interface{}) error {
-	res, err := tx.Query(q, args...)
+	return tx.ExecContext(tx.Context(), q, args...)
+}
+
+// ExecContext executes a query against the database within tx and without returning the result.
+// The query stops once either ctx or the context of the transaction is done.
+func (tx *Tx) ExecContext(ctx context.Context, q string, args ...interface{}) error {
+	res, err := tx.QueryContext(ctx, q, args...)
 	if err != nil {
 		return err
 	}
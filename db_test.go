@@ -1,6 +1,7 @@
 package genji_test
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"testing"
@@ -8,6 +9,8 @@ import (
 	"github.com/asdine/genji"
 	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine/badgerengine"
+	"github.com/dgraph-io/badger/v2"
 	"github.com/stretchr/testify/require"
 )
 
@@ -116,3 +119,172 @@ func TestQueryDocument(t *testing.T) {
 		require.Nil(t, r)
 	})
 }
+
+func TestQueryContext(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Update(func(tx *genji.Tx) error {
+		err := tx.Exec("CREATE TABLE test")
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < 100; i++ {
+			err = tx.Exec("INSERT INTO test (a) VALUES (?)", i)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	t.Run("Should fail if the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := db.QueryContext(ctx, "SELECT * FROM test")
+		require.Equal(t, context.Canceled, err)
+
+		err = db.ExecContext(ctx, "INSERT INTO test (a) VALUES (1000)")
+		require.Equal(t, context.Canceled, err)
+
+		_, err = db.BeginTx(ctx, false)
+		require.Equal(t, context.Canceled, err)
+	})
+
+	for _, q := range []string{"SELECT * FROM test", "SELECT * FROM test WHERE a >= 0 ORDER BY a DESC", "SELECT COUNT(*) FROM test GROUP BY a"} {
+		t.Run("Should stop the iteration/"+q, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			res, err := db.QueryContext(ctx, q)
+			require.NoError(t, err)
+			defer res.Close()
+
+			cancel()
+			err = res.Iterate(func(d document.Document) error {
+				return nil
+			})
+			require.Equal(t, context.Canceled, err)
+		})
+	}
+
+	t.Run("Should stop a query run within a transaction", func(t *testing.T) {
+		tx, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var n int
+		res, err := tx.QueryContext(ctx, "SELECT * FROM test")
+		require.NoError(t, err)
+		err = res.Iterate(func(d document.Document) error {
+			n++
+			if n == 10 {
+				cancel()
+			}
+			return nil
+		})
+		require.Equal(t, context.Canceled, err)
+		require.Equal(t, 10, n)
+
+		// the transaction is still usable
+		err = tx.Exec("DELETE FROM test WHERE a >= 50")
+		require.NoError(t, err)
+		err = tx.Commit()
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("SELECT COUNT(*) AS n FROM test")
+		require.NoError(t, err)
+		err = document.Scan(d, &n)
+		require.NoError(t, err)
+		require.Equal(t, 50, n)
+	})
+}
+
+func TestUpdateWithRetry(t *testing.T) {
+	ng, err := badgerengine.NewEngine(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	db, err := genji.New(ng)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test; INSERT INTO test (a) VALUES (1)")
+	require.NoError(t, err)
+
+	// increment reads a, calls before and then writes a + 1.
+	increment := func(tx *genji.Tx, before func() error) error {
+		d, err := tx.QueryDocument("SELECT a FROM test")
+		if err != nil {
+			return err
+		}
+		var a int
+		err = document.Scan(d, &a)
+		if err != nil {
+			return err
+		}
+
+		err = before()
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec("UPDATE test SET a = ?", a+1)
+	}
+
+	t.Run("Should return ErrConflict", func(t *testing.T) {
+		err := db.Update(func(tx *genji.Tx) error {
+			return increment(tx, func() error {
+				return db.Exec("UPDATE test SET a = 10")
+			})
+		})
+		require.Equal(t, database.ErrConflict, err)
+	})
+
+	t.Run("Should retry on conflict", func(t *testing.T) {
+		var attempts int
+		err := db.UpdateWithRetry(func(tx *genji.Tx) error {
+			attempts++
+			return increment(tx, func() error {
+				if attempts > 1 {
+					return nil
+				}
+				return db.Exec("UPDATE test SET a = 100")
+			})
+		}, genji.RetryPolicy{})
+		require.NoError(t, err)
+		require.Equal(t, 2, attempts)
+
+		d, err := db.QueryDocument("SELECT a FROM test")
+		require.NoError(t, err)
+		var a int
+		err = document.Scan(d, &a)
+		require.NoError(t, err)
+		require.Equal(t, 101, a)
+	})
+
+	t.Run("Should stop after MaxAttempts", func(t *testing.T) {
+		var attempts int
+		err := db.UpdateWithRetry(func(tx *genji.Tx) error {
+			attempts++
+			return increment(tx, func() error {
+				return db.Exec("UPDATE test SET a = 100")
+			})
+		}, genji.RetryPolicy{MaxAttempts: 3})
+		require.Equal(t, database.ErrConflict, err)
+		require.Equal(t, 3, attempts)
+	})
+
+	t.Run("Should not retry other errors", func(t *testing.T) {
+		var attempts int
+		err := db.UpdateWithRetry(func(tx *genji.Tx) error {
+			attempts++
+			return tx.Exec("INSERT INTO unknown (a) VALUES (1)")
+		}, genji.RetryPolicy{})
+		require.Equal(t, database.ErrTableNotFound, err)
+		require.Equal(t, 1, attempts)
+	})
+}
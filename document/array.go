@@ -12,6 +12,10 @@ import (
 // the index wasn't found in the array.
 var ErrValueNotFound = errors.New("value not found")
 
+// ErrIndexOutOfRange is returned when setting a value of an array at an index
+// greater than or equal to its length.
+var ErrIndexOutOfRange = errors.New("array index out of range")
+
 // An Array contains a set of values.
 type Array interface {
 	// Iterate goes through all the values of the array and calls the given function by passing each one of them.
@@ -85,7 +89,7 @@ func (vb *ValueBuffer) Copy(a Array) error {
 		return err
 	}
 
-	for _, v := range *vb {
+	for i, v := range *vb {
 		switch v.Type {
 		case DocumentValue:
 			var buf FieldBuffer
@@ -94,7 +98,7 @@ func (vb *ValueBuffer) Copy(a Array) error {
 				return err
 			}
 
-			*vb = vb.Append(NewDocumentValue(&buf))
+			(*vb)[i] = NewDocumentValue(&buf)
 		case ArrayValue:
 			var buf ValueBuffer
 			err = buf.Copy(v.V.(Array))
@@ -102,7 +106,7 @@ func (vb *ValueBuffer) Copy(a Array) error {
 				return err
 			}
 
-			*vb = vb.Append(NewArrayValue(&buf))
+			(*vb)[i] = NewArrayValue(&buf)
 		}
 	}
 
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"reflect"
 	"strconv"
@@ -265,6 +266,162 @@ func (fb *FieldBuffer) Replace(field string, v Value) error {
 	return ErrFieldNotFound
 }
 
+// SetPath sets the value at the given path, replacing it if it already exists.
+// Missing intermediate documents are created. If a value of the path is an array,
+// the next chunk of the path must be the index of an existing value, otherwise
+// it returns ErrIndexOutOfRange.
+func (fb *FieldBuffer) SetPath(p ValuePath, v Value) error {
+	if len(p) == 0 {
+		return errors.New("empty valuepath")
+	}
+
+	if len(p) == 1 {
+		fb.Set(p[0], v)
+		return nil
+	}
+
+	parent, err := fb.GetByField(p[0])
+	if err == ErrFieldNotFound {
+		parent = NewDocumentValue(NewFieldBuffer())
+	} else if err != nil {
+		return err
+	}
+
+	parent, err = setValueAtPath(parent, p[1:], v)
+	if err != nil {
+		return err
+	}
+
+	fb.Set(p[0], parent)
+	return nil
+}
+
+// DeletePath removes the value at the given path. If the path refers to
+// a value of an array, the following values are shifted.
+// It returns ErrFieldNotFound if there is no value at that path.
+func (fb *FieldBuffer) DeletePath(p ValuePath) error {
+	if len(p) == 0 {
+		return errors.New("empty valuepath")
+	}
+
+	if len(p) == 1 {
+		return fb.Delete(p[0])
+	}
+
+	parent, err := fb.GetByField(p[0])
+	if err != nil {
+		return err
+	}
+
+	parent, err = deleteValueAtPath(parent, p[1:])
+	if err != nil {
+		return err
+	}
+
+	return fb.Replace(p[0], parent)
+}
+
+// setValueAtPath sets v at the path p of the given document or array and returns
+// the modified document or array.
+func setValueAtPath(parent Value, p ValuePath, v Value) (Value, error) {
+	switch parent.Type {
+	case DocumentValue:
+		fb, err := fieldBufferOf(parent)
+		if err != nil {
+			return parent, err
+		}
+
+		err = fb.SetPath(p, v)
+		return NewDocumentValue(fb), err
+	case ArrayValue:
+		vb, err := valueBufferOf(parent)
+		if err != nil {
+			return parent, err
+		}
+
+		i, err := strconv.Atoi(p[0])
+		if err != nil {
+			return parent, fmt.Errorf("invalid array index %q", p[0])
+		}
+		if i < 0 || i >= len(*vb) {
+			return parent, ErrIndexOutOfRange
+		}
+
+		if len(p) == 1 {
+			(*vb)[i] = v
+		} else {
+			(*vb)[i], err = setValueAtPath((*vb)[i], p[1:], v)
+			if err != nil {
+				return parent, err
+			}
+		}
+
+		return NewArrayValue(vb), nil
+	}
+
+	return parent, fmt.Errorf("cannot set field %q of a value of type %s", p[0], parent.Type)
+}
+
+// deleteValueAtPath removes the value at the path p of the given document or array
+// and returns the modified document or array.
+func deleteValueAtPath(parent Value, p ValuePath) (Value, error) {
+	switch parent.Type {
+	case DocumentValue:
+		fb, err := fieldBufferOf(parent)
+		if err != nil {
+			return parent, err
+		}
+
+		err = fb.DeletePath(p)
+		return NewDocumentValue(fb), err
+	case ArrayValue:
+		vb, err := valueBufferOf(parent)
+		if err != nil {
+			return parent, err
+		}
+
+		i, err := strconv.Atoi(p[0])
+		if err != nil || i < 0 || i >= len(*vb) {
+			return parent, ErrFieldNotFound
+		}
+
+		if len(p) == 1 {
+			*vb = append((*vb)[:i], (*vb)[i+1:]...)
+		} else {
+			(*vb)[i], err = deleteValueAtPath((*vb)[i], p[1:])
+			if err != nil {
+				return parent, err
+			}
+		}
+
+		return NewArrayValue(vb), nil
+	}
+
+	return parent, ErrFieldNotFound
+}
+
+// fieldBufferOf returns the FieldBuffer of a document value, copying the document if it isn't one.
+func fieldBufferOf(v Value) (*FieldBuffer, error) {
+	if fb, ok := v.V.(*FieldBuffer); ok {
+		return fb, nil
+	}
+
+	var fb FieldBuffer
+	err := fb.Copy(v.V.(Document))
+	return &fb, err
+}
+
+// valueBufferOf returns the ValueBuffer of an array value, copying the array if it isn't one.
+func valueBufferOf(v Value) (*ValueBuffer, error) {
+	if vb, ok := v.V.(*ValueBuffer); ok {
+		return vb, nil
+	}
+
+	var vb ValueBuffer
+	err := vb.Copy(v.V.(Array))
+	return &vb, err
+}
+
 // Copy deep copies every value of the document to the buffer.
 // If a value is a document or an array, it will be stored as a FieldBuffer or ValueBuffer respectively.
 func (fb *FieldBuffer) Copy(d Document) error {
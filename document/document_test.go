@@ -129,6 +129,42 @@ func TestFieldBuffer(t *testing.T) {
 		require.Error(t, err)
 	})
 
+	t.Run("SetPath", func(t *testing.T) {
+		var buf document.FieldBuffer
+		err := json.Unmarshal([]byte(`{"a": 1, "b": {"c": [1, {"d": 2}]}}`), &buf)
+		require.NoError(t, err)
+
+		require.NoError(t, buf.SetPath(document.NewValuePath("a"), document.NewInt64Value(10)))
+		require.NoError(t, buf.SetPath(document.NewValuePath("b.c.0"), document.NewInt64Value(11)))
+		require.NoError(t, buf.SetPath(document.NewValuePath("b.c.1.e"), document.NewInt64Value(12)))
+		require.NoError(t, buf.SetPath(document.NewValuePath("f.g.h"), document.NewInt64Value(13)))
+
+		data, err := json.Marshal(&buf)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"a": 10, "b": {"c": [11, {"d": 2, "e": 12}]}, "f": {"g": {"h": 13}}}`, string(data))
+
+		require.Equal(t, document.ErrIndexOutOfRange, buf.SetPath(document.NewValuePath("b.c.2"), document.NewInt64Value(14)))
+		require.Error(t, buf.SetPath(document.NewValuePath("a.b"), document.NewInt64Value(14)))
+	})
+
+	t.Run("DeletePath", func(t *testing.T) {
+		var buf document.FieldBuffer
+		err := json.Unmarshal([]byte(`{"a": 1, "b": {"c": [1, {"d": 2}, 3]}}`), &buf)
+		require.NoError(t, err)
+
+		require.NoError(t, buf.DeletePath(document.NewValuePath("a")))
+		require.NoError(t, buf.DeletePath(document.NewValuePath("b.c.1.d")))
+		require.NoError(t, buf.DeletePath(document.NewValuePath("b.c.0")))
+
+		data, err := json.Marshal(&buf)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"b": {"c": [{}, 3]}}`, string(data))
+
+		require.Equal(t, document.ErrFieldNotFound, buf.DeletePath(document.NewValuePath("a")))
+		require.Equal(t, document.ErrFieldNotFound, buf.DeletePath(document.NewValuePath("b.c.5")))
+		require.Equal(t, document.ErrFieldNotFound, buf.DeletePath(document.NewValuePath("b.d.e")))
+	})
+
 	t.Run("UnmarshalJSON", func(t *testing.T) {
 		tests := []struct {
 			name     string
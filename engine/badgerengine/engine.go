@@ -3,6 +3,7 @@ package badgerengine
 
 import (
 	"bytes"
+	"context"
 
 	"github.com/asdine/genji/engine"
 	"github.com/dgraph-io/badger/v2"
@@ -33,9 +34,21 @@ func NewEngine(opt badger.Options) (*Engine, error) {
 
 // Begin creates a transaction using Badger's transaction API.
 func (e *Engine) Begin(writable bool) (engine.Transaction, error) {
+	return e.BeginContext(context.Background(), writable)
+}
+
+// BeginContext creates a transaction bound to ctx.
+// It implements the engine.ContextBeginner interface.
+func (e *Engine) BeginContext(ctx context.Context, writable bool) (engine.Transaction, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
 	tx := e.DB.NewTransaction(writable)
 
 	return &Transaction{
+		ctx:      ctx,
 		tx:       tx,
 		writable: writable,
 	}, nil
@@ -48,6 +61,7 @@ func (e *Engine) Close() error {
 
 // A Transaction uses Badger's transactions.
 type Transaction struct {
+	ctx       context.Context
 	tx        *badger.Txn
 	writable  bool
 	discarded bool
@@ -62,6 +76,8 @@ func (t *Transaction) Rollback() error {
 }
 
 // Commit the transaction.
+// If the context of the transaction is done, the transaction is rolled back and ctx.Err() is returned.
+// If the transaction conflicts with another one, it returns engine.ErrConflict.
 func (t *Transaction) Commit() error {
 	if t.discarded {
 		return badger.ErrDiscardedTxn
@@ -71,8 +87,19 @@ func (t *Transaction) Commit() error {
 		return engine.ErrTransactionReadOnly
 	}
 
+	err := t.ctx.Err()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
 	t.discarded = true
-	return t.tx.Commit()
+	err = t.tx.Commit()
+	if err == badger.ErrConflict {
+		return engine.ErrConflict
+	}
+
+	return err
 }
 
 func buildStoreKey(name string) []byte {
@@ -96,9 +123,14 @@ func buildStorePrefixKey(name string) []byte {
 
 // GetStore returns a store by name.
 func (t *Transaction) GetStore(name string) (engine.Store, error) {
+	err := t.ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
 	key := buildStoreKey(name)
 
-	_, err := t.tx.Get(key)
+	_, err = t.tx.Get(key)
 	if err != nil {
 		if err == badger.ErrKeyNotFound {
 			return nil, engine.ErrStoreNotFound
@@ -110,6 +142,7 @@ func (t *Transaction) GetStore(name string) (engine.Store, error) {
 	pkey := buildStorePrefixKey(name)
 
 	return &Store{
+		ctx:      t.ctx,
 		tx:       t.tx,
 		prefix:   pkey,
 		writable: t.writable,
@@ -124,8 +157,13 @@ func (t *Transaction) CreateStore(name string) error {
 		return engine.ErrTransactionReadOnly
 	}
 
+	err := t.ctx.Err()
+	if err != nil {
+		return err
+	}
+
 	key := buildStoreKey(name)
-	_, err := t.tx.Get(key)
+	_, err = t.tx.Get(key)
 	if err == nil {
 		return engine.ErrStoreAlreadyExists
 	}
@@ -162,6 +200,11 @@ func (t *Transaction) DropStore(name string) error {
 
 // ListStores returns a list of all the store names.
 func (t *Transaction) ListStores(prefix string) ([]string, error) {
+	err := t.ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
 	var names []string
 
 	p := buildStoreKey(prefix)
@@ -29,6 +29,47 @@ func TestBadgerEngine(t *testing.T) {
 	enginetest.TestSuite(t, builder(t))
 }
 
+func TestBadgerEngineConflict(t *testing.T) {
+	ng, cleanup := builder(t)()
+	defer cleanup()
+	defer ng.Close()
+
+	tx, err := ng.Begin(true)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	err = tx.CreateStore("test")
+	require.NoError(t, err)
+	err = tx.Commit()
+	require.NoError(t, err)
+
+	// both transactions read and write the same key
+	update := func() (engine.Transaction, error) {
+		tx, err := ng.Begin(true)
+		if err != nil {
+			return nil, err
+		}
+		st, err := tx.GetStore("test")
+		if err != nil {
+			return nil, err
+		}
+		_, err = st.Get([]byte("foo"))
+		if err != engine.ErrKeyNotFound {
+			return nil, err
+		}
+		return tx, st.Put([]byte("foo"), []byte("FOO"))
+	}
+
+	tx1, err := update()
+	require.NoError(t, err)
+	defer tx1.Rollback()
+	tx2, err := update()
+	require.NoError(t, err)
+	defer tx2.Rollback()
+
+	require.NoError(t, tx1.Commit())
+	require.Equal(t, engine.ErrConflict, tx2.Commit())
+}
+
 func BenchmarkBadgerEngineStorePut(b *testing.B) {
 	enginetest.BenchmarkStorePut(b, builder(b))
 }
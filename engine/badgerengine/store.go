@@ -2,6 +2,7 @@ package badgerengine
 
 import (
 	"bytes"
+	"context"
 	"errors"
 
 	"github.com/asdine/genji/engine"
@@ -10,6 +11,7 @@ import (
 
 // A Store is an implementation of the engine.Store interface.
 type Store struct {
+	ctx      context.Context
 	tx       *badger.Txn
 	prefix   []byte
 	writable bool
@@ -34,11 +36,21 @@ func (s *Store) Put(k, v []byte) error {
 		return errors.New("cannot store empty key")
 	}
 
+	err := s.ctx.Err()
+	if err != nil {
+		return err
+	}
+
 	return s.tx.Set(buildKey(s.prefix, k), v)
 }
 
 // Get returns a value associated with the given key. If not found, returns engine.ErrKeyNotFound.
 func (s *Store) Get(k []byte) ([]byte, error) {
+	err := s.ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
 	it, err := s.tx.Get(buildKey(s.prefix, k))
 	if err != nil {
 		if err == badger.ErrKeyNotFound {
@@ -57,8 +69,13 @@ func (s *Store) Delete(k []byte) error {
 		return engine.ErrTransactionReadOnly
 	}
 
+	err := s.ctx.Err()
+	if err != nil {
+		return err
+	}
+
 	key := buildKey(s.prefix, k)
-	_, err := s.tx.Get(key)
+	_, err = s.tx.Get(key)
 	if err != nil {
 		if err == badger.ErrKeyNotFound {
 			return engine.ErrKeyNotFound
@@ -83,9 +100,14 @@ func (s *Store) AscendGreaterOrEqual(pivot []byte, fn func(k, v []byte) error) e
 
 	seek := buildKey(s.prefix, pivot)
 	for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+		err := s.ctx.Err()
+		if err != nil {
+			return err
+		}
+
 		item := it.Item()
 
-		err := item.Value(func(v []byte) error {
+		err = item.Value(func(v []byte) error {
 			return fn(bytes.TrimPrefix(item.Key(), prefix), v)
 		})
 		if err != nil {
@@ -111,6 +133,11 @@ func (s *Store) DescendLessOrEqual(pivot []byte, fn func(k, v []byte) error) err
 	seek := buildKey(s.prefix, append(pivot, 0xFF))
 
 	for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+		err := s.ctx.Err()
+		if err != nil {
+			return err
+		}
+
 		item := it.Item()
 
 		v, err := item.ValueCopy(nil)
@@ -133,7 +160,12 @@ func (s *Store) Truncate() error {
 		return engine.ErrTransactionReadOnly
 	}
 
-	_, err := s.tx.Get(buildStoreKey(s.name))
+	err := s.ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.tx.Get(buildStoreKey(s.name))
 	if err == badger.ErrKeyNotFound {
 		return engine.ErrStoreNotFound
 	}
@@ -141,7 +173,8 @@ func (s *Store) Truncate() error {
 	it := s.tx.NewIterator(badger.DefaultIteratorOptions)
 	defer it.Close()
 
-	prefix := buildStorePrefixKey(s.name)
+	// the separator prevents from deleting the keys of stores whose names start with this one
+	prefix := buildKey(s.prefix, nil)
 	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
 		err = s.tx.Delete(it.Item().Key())
 		if err != nil {
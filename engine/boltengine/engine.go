@@ -3,6 +3,7 @@ package boltengine
 
 import (
 	"bytes"
+	"context"
 	"os"
 
 	"github.com/asdine/genji/engine"
@@ -32,12 +33,26 @@ func NewEngine(path string, mode os.FileMode, opts *bolt.Options) (*Engine, erro
 
 // Begin creates a transaction using Bolt's transaction API.
 func (e *Engine) Begin(writable bool) (engine.Transaction, error) {
+	return e.BeginContext(context.Background(), writable)
+}
+
+// BeginContext creates a transaction bound to ctx.
+// Bolt doesn't support cancellation, it blocks until any other read/write transaction is closed,
+// even if ctx is canceled.
+// It implements the engine.ContextBeginner interface.
+func (e *Engine) BeginContext(ctx context.Context, writable bool) (engine.Transaction, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := e.DB.Begin(writable)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Transaction{
+		ctx:      ctx,
 		tx:       tx,
 		writable: writable,
 	}, nil
@@ -50,6 +65,7 @@ func (e *Engine) Close() error {
 
 // A Transaction uses Bolt's transactions.
 type Transaction struct {
+	ctx      context.Context
 	tx       *bolt.Tx
 	writable bool
 }
@@ -65,12 +81,24 @@ func (t *Transaction) Rollback() error {
 }
 
 // Commit the transaction.
+// If the context of the transaction is done, the transaction is rolled back and ctx.Err() is returned.
 func (t *Transaction) Commit() error {
+	err := t.ctx.Err()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
 	return t.tx.Commit()
 }
 
 // GetStore returns a store by name. The store uses a Bolt bucket.
 func (t *Transaction) GetStore(name string) (engine.Store, error) {
+	err := t.ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
 	bname := []byte(name)
 	b := t.tx.Bucket(bname)
 	if b == nil {
@@ -78,6 +106,7 @@ func (t *Transaction) GetStore(name string) (engine.Store, error) {
 	}
 
 	return &Store{
+		ctx:    t.ctx,
 		bucket: b,
 		tx:     t.tx,
 		name:   bname,
@@ -91,7 +120,12 @@ func (t *Transaction) CreateStore(name string) error {
 		return engine.ErrTransactionReadOnly
 	}
 
-	_, err := t.tx.CreateBucket([]byte(name))
+	err := t.ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	_, err = t.tx.CreateBucket([]byte(name))
 	if err == bolt.ErrBucketExists {
 		return engine.ErrStoreAlreadyExists
 	}
@@ -105,7 +139,12 @@ func (t *Transaction) DropStore(name string) error {
 		return engine.ErrTransactionReadOnly
 	}
 
-	err := t.tx.DeleteBucket([]byte(name))
+	err := t.ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	err = t.tx.DeleteBucket([]byte(name))
 	if err == bolt.ErrBucketNotFound {
 		return engine.ErrStoreNotFound
 	}
@@ -115,9 +154,14 @@ func (t *Transaction) DropStore(name string) error {
 
 // ListStores returns a list of all the store names.
 func (t *Transaction) ListStores(prefix string) ([]string, error) {
+	err := t.ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
 	var names []string
 	p := []byte(prefix)
-	err := t.tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+	err = t.tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
 		if bytes.HasPrefix(name, p) {
 			names = append(names, string(name))
 		}
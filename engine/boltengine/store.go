@@ -2,6 +2,7 @@ package boltengine
 
 import (
 	"bytes"
+	"context"
 
 	"github.com/asdine/genji/engine"
 	bolt "go.etcd.io/bbolt"
@@ -9,6 +10,7 @@ import (
 
 // A Store is an implementation of the engine.Store interface using a bucket.
 type Store struct {
+	ctx    context.Context
 	bucket *bolt.Bucket
 	tx     *bolt.Tx
 	name   []byte
@@ -20,11 +22,21 @@ func (s *Store) Put(k, v []byte) error {
 		return engine.ErrTransactionReadOnly
 	}
 
+	err := s.ctx.Err()
+	if err != nil {
+		return err
+	}
+
 	return s.bucket.Put(k, v)
 }
 
 // Get returns a value associated with the given key. If not found, returns engine.ErrKeyNotFound.
 func (s *Store) Get(k []byte) ([]byte, error) {
+	err := s.ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
 	v := s.bucket.Get(k)
 	if v == nil {
 		return nil, engine.ErrKeyNotFound
@@ -39,6 +51,11 @@ func (s *Store) Delete(k []byte) error {
 		return engine.ErrTransactionReadOnly
 	}
 
+	err := s.ctx.Err()
+	if err != nil {
+		return err
+	}
+
 	v := s.bucket.Get(k)
 	if v == nil {
 		return engine.ErrKeyNotFound
@@ -53,7 +70,12 @@ func (s *Store) Delete(k []byte) error {
 func (s *Store) AscendGreaterOrEqual(pivot []byte, fn func(k, v []byte) error) error {
 	c := s.bucket.Cursor()
 	for k, v := c.Seek(pivot); k != nil; k, v = c.Next() {
-		err := fn(k, v)
+		err := s.ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		err = fn(k, v)
 		if err != nil {
 			return err
 		}
@@ -83,7 +105,12 @@ func (s *Store) DescendLessOrEqual(pivot []byte, fn func(k, v []byte) error) err
 	}
 
 	for k != nil {
-		err := fn(k, v)
+		err := s.ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		err = fn(k, v)
 		if err != nil {
 			return err
 		}
@@ -99,7 +126,12 @@ func (s *Store) Truncate() error {
 		return engine.ErrTransactionReadOnly
 	}
 
-	err := s.tx.DeleteBucket(s.name)
+	err := s.ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	err = s.tx.DeleteBucket(s.name)
 	if err != nil {
 		return err
 	}
@@ -2,6 +2,7 @@
 package engine
 
 import (
+	"context"
 	"errors"
 )
 
@@ -19,6 +20,11 @@ var (
 
 	// ErrKeyNotFound is returned when the targeted key doesn't exist.
 	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrConflict must be returned by Commit when the transaction read or modified data
+	// that was modified by another transaction committed in the meantime.
+	// None of the changes are committed and the transaction can be retried.
+	ErrConflict = errors.New("transaction conflict")
 )
 
 // An Engine is responsible for storing data.
@@ -34,6 +40,18 @@ type Engine interface {
 	Close() error
 }
 
+// A ContextBeginner is an Engine whose transactions can be bound to a context.
+// Engines should implement it if they can stop their operations early,
+// otherwise Genji only checks the context between the operations of a transaction.
+type ContextBeginner interface {
+	Engine
+
+	// BeginContext works like Begin but the transaction is bound to ctx: once ctx is canceled
+	// or its deadline is exceeded, the methods of the transaction and of its stores,
+	// iterations included, must return ctx.Err(), except for Rollback which must still succeed.
+	BeginContext(ctx context.Context, writable bool) (Transaction, error)
+}
+
 // A Transaction provides methods for managing the collection of stores and the transaction itself.
 // The transaction is either read-only or read/write. Read-only transactions can be used to read stores
 // and read/write ones can be used to read, create, delete and modify stores.
@@ -57,6 +75,27 @@ type Transaction interface {
 	ListStores(prefix string) ([]string, error)
 }
 
+// A Savepointer is a Transaction which can cancel part of its changes.
+// Transactions should implement it if their engine can do it efficiently,
+// otherwise Genji records the changes made after a savepoint in order to undo them.
+type Savepointer interface {
+	Transaction
+
+	// Savepoint marks the current state of the transaction.
+	Savepoint() (Savepoint, error)
+}
+
+// A Savepoint is a state of a transaction, created by a Savepointer.
+// Savepoints are nested: Genji releases the savepoints created after a savepoint
+// before rolling back to it or releasing it.
+type Savepoint interface {
+	// Rollback cancels any change made to the transaction since the savepoint was created.
+	// The savepoint remains valid and can be rolled back to again.
+	Rollback() error
+	// Release the savepoint, keeping the changes made since it was created.
+	Release() error
+}
+
 // A Store manages key value pairs. It is an abstraction on top of any data structure that can provide
 // random read, random write, and ordered sequential read.
 type Store interface {
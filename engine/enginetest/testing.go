@@ -4,6 +4,7 @@ package enginetest
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"testing"
@@ -31,6 +32,7 @@ func TestSuite(t *testing.T, builder Builder) {
 	}{
 		{"Engine", TestEngine},
 		{"Transaction/Commit-Rollback", TestTransactionCommitRollback},
+		{"Transaction/Context", TestTransactionContext},
 		{"Transaction/Store", TestTransactionStore},
 		{"Transaction/CreateStore", TestTransactionCreateStore},
 		{"Transaction/DropStore", TestTransactionDropStore},
@@ -309,6 +311,129 @@ func TestTransactionCommitRollback(t *testing.T, builder Builder) {
 	})
 }
 
+// TestTransactionContext verifies that transactions stop working once their context is done.
+// It is skipped if the engine doesn't implement the engine.ContextBeginner interface.
+func TestTransactionContext(t *testing.T, builder Builder) {
+	// contextBeginner returns the engine created by the builder if it implements engine.ContextBeginner.
+	contextBeginner := func(t *testing.T) (engine.ContextBeginner, func()) {
+		ng, cleanup := builder()
+		cb, ok := ng.(engine.ContextBeginner)
+		if !ok {
+			cleanup()
+			t.Skip("engine doesn't implement engine.ContextBeginner")
+		}
+
+		return cb, cleanup
+	}
+
+	t.Run("Begin should fail if the context is done", func(t *testing.T) {
+		ng, cleanup := contextBeginner(t)
+		defer cleanup()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := ng.BeginContext(ctx, false)
+		require.Equal(t, context.Canceled, err)
+
+		_, err = ng.BeginContext(ctx, true)
+		require.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("Operations should fail once the context is done", func(t *testing.T) {
+		ng, cleanup := contextBeginner(t)
+		defer cleanup()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tx, err := ng.BeginContext(ctx, true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		err = tx.CreateStore("store")
+		require.NoError(t, err)
+		st, err := tx.GetStore("store")
+		require.NoError(t, err)
+		err = st.Put([]byte("foo"), []byte("FOO"))
+		require.NoError(t, err)
+
+		cancel()
+
+		_, err = tx.GetStore("store")
+		require.Equal(t, context.Canceled, err)
+		err = tx.CreateStore("other")
+		require.Equal(t, context.Canceled, err)
+		_, err = st.Get([]byte("foo"))
+		require.Equal(t, context.Canceled, err)
+		err = st.Put([]byte("bar"), []byte("BAR"))
+		require.Equal(t, context.Canceled, err)
+		err = st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+			return errors.New("should not iterate")
+		})
+		require.Equal(t, context.Canceled, err)
+
+		err = tx.Commit()
+		require.Equal(t, context.Canceled, err)
+		require.NoError(t, tx.Rollback())
+
+		// the changes must have been rolled back
+		tx, err = ng.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+		_, err = tx.GetStore("store")
+		require.Equal(t, engine.ErrStoreNotFound, err)
+	})
+
+	t.Run("Iterations should stop once the context is done", func(t *testing.T) {
+		ng, cleanup := contextBeginner(t)
+		defer cleanup()
+
+		tx, err := ng.Begin(true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		err = tx.CreateStore("store")
+		require.NoError(t, err)
+		st, err := tx.GetStore("store")
+		require.NoError(t, err)
+		for i := 1; i <= 10; i++ {
+			err := st.Put([]byte{uint8(i)}, []byte{uint8(i)})
+			require.NoError(t, err)
+		}
+		err = tx.Commit()
+		require.NoError(t, err)
+
+		for _, desc := range []bool{false, true} {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			tx, err := ng.BeginContext(ctx, false)
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			st, err := tx.GetStore("store")
+			require.NoError(t, err)
+
+			iterate := st.AscendGreaterOrEqual
+			if desc {
+				iterate = st.DescendLessOrEqual
+			}
+
+			var i int
+			err = iterate(nil, func(k, v []byte) error {
+				i++
+				if i == 3 {
+					cancel()
+				}
+				return nil
+			})
+			require.Equal(t, context.Canceled, err)
+			require.Equal(t, 3, i)
+		}
+	})
+}
+
 // TestTransactionCreateStore verifies CreateStore behaviour.
 func TestTransactionCreateStore(t *testing.T, builder Builder) {
 	t.Run("Should create a store", func(t *testing.T) {
@@ -841,6 +966,34 @@ func TestStoreTruncate(t *testing.T, builder Builder) {
 		})
 		require.NoError(t, err)
 	})
+
+	t.Run("Should not truncate stores whose names start with the name of the store", func(t *testing.T) {
+		ng, cleanup := builder()
+		defer cleanup()
+
+		tx, err := ng.Begin(true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		err = tx.CreateStore("test")
+		require.NoError(t, err)
+		err = tx.CreateStore("test2")
+		require.NoError(t, err)
+
+		st2, err := tx.GetStore("test2")
+		require.NoError(t, err)
+		err = st2.Put([]byte("foo"), []byte("FOO"))
+		require.NoError(t, err)
+
+		st, err := tx.GetStore("test")
+		require.NoError(t, err)
+		err = st.Truncate()
+		require.NoError(t, err)
+
+		v, err := st2.Get([]byte("foo"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("FOO"), v)
+	})
 }
 
 // TestQueries test simple queries against the engine.
@@ -1,18 +1,305 @@
+// Package memoryengine implements an in-memory engine.
+// It doesn't depend on any other storage engine and is cheap to create,
+// which makes it well suited for tests and temporary databases.
 package memoryengine
 
 import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
 	"github.com/asdine/genji/engine"
-	"github.com/asdine/genji/engine/badgerengine"
-	"github.com/dgraph-io/badger/v2"
 )
 
-// NewEngine creates a badger engine which stores data in memory.
-func NewEngine() engine.Engine {
-	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
-	ng, err := badgerengine.NewEngine(opts)
+var (
+	errEngineClosed = errors.New("engine closed")
+	errTxClosed     = errors.New("transaction closed")
+)
+
+// Engine is a simple in-memory engine. Each store is an ordered tree.
+// Read/write transactions are serialized: only one can be opened at a time
+// and Begin blocks until the current one is committed or rolled back.
+// Read-only transactions never block and read a snapshot of the data
+// as it was when they were opened.
+type Engine struct {
+	// writer holds a value while a read/write transaction is opened.
+	writer chan struct{}
+
+	// mu protects the fields below.
+	mu     sync.RWMutex
+	stores map[string]*node
+	closed bool
+
+	// last identifier assigned to the owner of the nodes of a transaction.
+	// It is only used by the read/write transactions and protected by writer.
+	lastOwner uint64
+}
+
+// NewEngine creates an in-memory engine.
+func NewEngine() *Engine {
+	return &Engine{
+		writer: make(chan struct{}, 1),
+		stores: make(map[string]*node),
+	}
+}
+
+// Begin creates a transaction. Only one read/write transaction can be opened at a time,
+// Begin blocks until the current one is closed.
+func (e *Engine) Begin(writable bool) (engine.Transaction, error) {
+	return e.BeginContext(context.Background(), writable)
+}
+
+// BeginContext creates a transaction bound to ctx. If ctx is canceled while waiting
+// for the current read/write transaction to be closed, it returns ctx.Err().
+// It implements the engine.ContextBeginner interface.
+func (e *Engine) BeginContext(ctx context.Context, writable bool) (engine.Transaction, error) {
+	err := ctx.Err()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	if writable {
+		select {
+		case e.writer <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.closed {
+		if writable {
+			<-e.writer
+		}
+		return nil, errEngineClosed
+	}
+
+	tx := Transaction{
+		ng:       e,
+		ctx:      ctx,
+		stores:   e.stores,
+		writable: writable,
+	}
+
+	if writable {
+		// the committed stores are shared by the read-only transactions,
+		// the transaction must work on its own copy.
+		tx.stores = copyStores(e.stores)
+		tx.renewOwner()
+	}
+
+	return &tx, nil
+}
+
+func copyStores(stores map[string]*node) map[string]*node {
+	c := make(map[string]*node, len(stores))
+	for name, root := range stores {
+		c[name] = root
+	}
+	return c
+}
+
+// Close the engine. Transactions can no longer be created.
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return errEngineClosed
+	}
+
+	e.closed = true
+	return nil
+}
+
+// A Transaction works on a snapshot of the stores of the engine.
+// The changes made by read/write transactions are applied to their own copy of the stores,
+// which replaces the stores of the engine on commit.
+type Transaction struct {
+	ng       *Engine
+	ctx      context.Context
+	stores   map[string]*node
+	writable bool
+	done     bool
+	// nodes owned by the transaction can be modified in place.
+	owner uint64
+}
+
+// check returns an error if the transaction is closed or if its context is done.
+func (t *Transaction) check() error {
+	if t.done {
+		return errTxClosed
+	}
+
+	return t.ctx.Err()
+}
+
+// renewOwner makes sure the current nodes of the transaction are never modified in place.
+// It must be called before handing out the nodes of the transaction, for example to iterate on them.
+func (t *Transaction) renewOwner() {
+	if !t.writable {
+		return
+	}
+
+	t.ng.lastOwner++
+	t.owner = t.ng.lastOwner
+}
+
+// Rollback the transaction. Can be used safely after commit.
+func (t *Transaction) Rollback() error {
+	if t.done {
+		return nil
+	}
+
+	t.done = true
+	t.stores = nil
+	if t.writable {
+		<-t.ng.writer
+	}
+
+	return nil
+}
+
+// Commit the transaction.
+// If the context of the transaction is done, the transaction is rolled back and ctx.Err() is returned.
+func (t *Transaction) Commit() error {
+	if t.done {
+		return errTxClosed
+	}
+
+	if !t.writable {
+		return engine.ErrTransactionReadOnly
 	}
 
-	return ng
+	err := t.ctx.Err()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	t.ng.mu.Lock()
+	t.ng.stores = t.stores
+	t.ng.mu.Unlock()
+
+	t.done = true
+	t.stores = nil
+	<-t.ng.writer
+	return nil
+}
+
+// GetStore returns a store by name.
+func (t *Transaction) GetStore(name string) (engine.Store, error) {
+	err := t.check()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := t.stores[name]; !ok {
+		return nil, engine.ErrStoreNotFound
+	}
+
+	return &Store{
+		tx:   t,
+		name: name,
+	}, nil
+}
+
+// CreateStore creates a store.
+// If the store already exists, returns engine.ErrStoreAlreadyExists.
+func (t *Transaction) CreateStore(name string) error {
+	err := t.check()
+	if err != nil {
+		return err
+	}
+
+	if !t.writable {
+		return engine.ErrTransactionReadOnly
+	}
+
+	if _, ok := t.stores[name]; ok {
+		return engine.ErrStoreAlreadyExists
+	}
+
+	t.stores[name] = nil
+	return nil
+}
+
+// DropStore deletes the store and all its keys.
+func (t *Transaction) DropStore(name string) error {
+	err := t.check()
+	if err != nil {
+		return err
+	}
+
+	if !t.writable {
+		return engine.ErrTransactionReadOnly
+	}
+
+	if _, ok := t.stores[name]; !ok {
+		return engine.ErrStoreNotFound
+	}
+
+	delete(t.stores, name)
+	return nil
+}
+
+// ListStores returns a list of all the store names.
+func (t *Transaction) ListStores(prefix string) ([]string, error) {
+	err := t.check()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range t.stores {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Savepoint marks the current state of the transaction.
+// It implements the engine.Savepointer interface.
+func (t *Transaction) Savepoint() (engine.Savepoint, error) {
+	err := t.check()
+	if err != nil {
+		return nil, err
+	}
+
+	// the saved trees must not be modified by the next changes
+	t.renewOwner()
+
+	return &savepoint{
+		tx:     t,
+		stores: copyStores(t.stores),
+	}, nil
+}
+
+// A savepoint keeps the roots of the trees of a transaction at a given time.
+type savepoint struct {
+	tx     *Transaction
+	stores map[string]*node
+}
+
+// Rollback restores the saved trees.
+func (s *savepoint) Rollback() error {
+	if s.tx.done {
+		return errTxClosed
+	}
+
+	s.tx.stores = copyStores(s.stores)
+	s.tx.renewOwner()
+	return nil
+}
+
+// Release does nothing, the saved trees are simply forgotten.
+func (s *savepoint) Release() error {
+	return nil
 }
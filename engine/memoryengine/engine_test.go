@@ -0,0 +1,120 @@
+package memoryengine_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asdine/genji/engine"
+	"github.com/asdine/genji/engine/enginetest"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/stretchr/testify/require"
+)
+
+func builder() (engine.Engine, func()) {
+	ng := memoryengine.NewEngine()
+	return ng, func() { ng.Close() }
+}
+
+func TestMemoryEngine(t *testing.T) {
+	enginetest.TestSuite(t, builder)
+}
+
+func TestTransactionSnapshot(t *testing.T) {
+	ng := memoryengine.NewEngine()
+	defer ng.Close()
+
+	tx, err := ng.Begin(true)
+	require.NoError(t, err)
+	err = tx.CreateStore("test")
+	require.NoError(t, err)
+	st, err := tx.GetStore("test")
+	require.NoError(t, err)
+	err = st.Put([]byte("a"), []byte("A"))
+	require.NoError(t, err)
+	err = tx.Commit()
+	require.NoError(t, err)
+
+	rtx, err := ng.Begin(false)
+	require.NoError(t, err)
+	defer rtx.Rollback()
+	rst, err := rtx.GetStore("test")
+	require.NoError(t, err)
+
+	wtx, err := ng.Begin(true)
+	require.NoError(t, err)
+	defer wtx.Rollback()
+	wst, err := wtx.GetStore("test")
+	require.NoError(t, err)
+	err = wst.Put([]byte("a"), []byte("B"))
+	require.NoError(t, err)
+	err = wst.Put([]byte("b"), []byte("B"))
+	require.NoError(t, err)
+	err = wtx.Commit()
+	require.NoError(t, err)
+
+	// the read-only transaction must not see the committed changes
+	v, err := rst.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("A"), v)
+	_, err = rst.Get([]byte("b"))
+	require.Equal(t, engine.ErrKeyNotFound, err)
+
+	// modifying the store during an iteration must not affect it
+	wtx, err = ng.Begin(true)
+	require.NoError(t, err)
+	defer wtx.Rollback()
+	wst, err = wtx.GetStore("test")
+	require.NoError(t, err)
+
+	var keys []string
+	err = wst.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+		keys = append(keys, string(k))
+		err := wst.Delete(k)
+		if err != nil {
+			return err
+		}
+		return wst.Put(append([]byte("c"), k...), v)
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, keys)
+
+	keys = nil
+	err = wst.DescendLessOrEqual(nil, func(k, v []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cb", "ca"}, keys)
+}
+
+func TestBeginTimeout(t *testing.T) {
+	ng := memoryengine.NewEngine()
+	defer ng.Close()
+
+	tx, err := ng.Begin(true)
+	require.NoError(t, err)
+
+	// read-only transactions don't wait for the opened read/write transaction
+	rtx, err := ng.Begin(false)
+	require.NoError(t, err)
+	require.NoError(t, rtx.Rollback())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ng.BeginContext(ctx, true)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	require.NoError(t, tx.Rollback())
+	tx, err = ng.Begin(true)
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+}
+
+func BenchmarkMemoryEngineStorePut(b *testing.B) {
+	enginetest.BenchmarkStorePut(b, builder)
+}
+
+func BenchmarkMemoryEngineTableScan(b *testing.B) {
+	enginetest.BenchmarkStoreScan(b, builder)
+}
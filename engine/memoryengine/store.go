@@ -0,0 +1,144 @@
+package memoryengine
+
+import (
+	"errors"
+
+	"github.com/asdine/genji/engine"
+)
+
+// A Store is an implementation of the engine.Store interface using an ordered tree.
+type Store struct {
+	tx   *Transaction
+	name string
+}
+
+// root returns the root of the tree of the store.
+func (s *Store) root() (*node, error) {
+	err := s.tx.check()
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := s.tx.stores[s.name]
+	if !ok {
+		return nil, engine.ErrStoreNotFound
+	}
+
+	return root, nil
+}
+
+// writableRoot returns the root of the tree of the store
+// and ensures the transaction is writable.
+func (s *Store) writableRoot() (*node, error) {
+	root, err := s.root()
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.tx.writable {
+		return nil, engine.ErrTransactionReadOnly
+	}
+
+	return root, nil
+}
+
+// Put stores a key value pair. If it already exists, it overrides it.
+func (s *Store) Put(k, v []byte) error {
+	root, err := s.writableRoot()
+	if err != nil {
+		return err
+	}
+
+	if len(k) == 0 {
+		return errors.New("cannot store empty key")
+	}
+
+	// the caller is free to reuse k and v
+	k = append([]byte(nil), k...)
+	v = append([]byte(nil), v...)
+
+	s.tx.stores[s.name] = put(root, k, v, s.tx.owner)
+	return nil
+}
+
+// Get returns a value associated with the given key. If not found, returns engine.ErrKeyNotFound.
+// The returned slice must not be modified.
+func (s *Store) Get(k []byte) ([]byte, error) {
+	root, err := s.root()
+	if err != nil {
+		return nil, err
+	}
+
+	n := get(root, k)
+	if n == nil {
+		return nil, engine.ErrKeyNotFound
+	}
+
+	return n.value, nil
+}
+
+// Delete a record by key. If not found, returns engine.ErrKeyNotFound.
+func (s *Store) Delete(k []byte) error {
+	root, err := s.writableRoot()
+	if err != nil {
+		return err
+	}
+
+	if get(root, k) == nil {
+		return engine.ErrKeyNotFound
+	}
+
+	s.tx.stores[s.name] = remove(root, k, s.tx.owner)
+	return nil
+}
+
+// Truncate deletes all the records of the store.
+func (s *Store) Truncate() error {
+	_, err := s.writableRoot()
+	if err != nil {
+		return err
+	}
+
+	s.tx.stores[s.name] = nil
+	return nil
+}
+
+// AscendGreaterOrEqual seeks for the pivot and then goes through all the subsequent key value pairs in increasing order and calls the given function for each pair.
+// If the given function returns an error, the iteration stops and returns that error.
+// If the pivot is nil, starts from the beginning.
+// The store can be modified by fn, the iteration is not affected by these changes.
+func (s *Store) AscendGreaterOrEqual(pivot []byte, fn func(k, v []byte) error) error {
+	root, err := s.root()
+	if err != nil {
+		return err
+	}
+
+	s.tx.renewOwner()
+	return ascend(root, pivot, s.checkEach(fn))
+}
+
+// DescendLessOrEqual seeks for the pivot and then goes through all the subsequent key value pairs in descreasing order and calls the given function for each pair.
+// If the given function returns an error, the iteration stops and returns that error.
+// If the pivot is nil, starts from the end.
+// The store can be modified by fn, the iteration is not affected by these changes.
+func (s *Store) DescendLessOrEqual(pivot []byte, fn func(k, v []byte) error) error {
+	root, err := s.root()
+	if err != nil {
+		return err
+	}
+
+	s.tx.renewOwner()
+	return descend(root, pivot, s.checkEach(fn))
+}
+
+// checkEach returns a function that calls fn if the context of the transaction is not done.
+func (s *Store) checkEach(fn func(k, v []byte) error) func(k, v []byte) error {
+	return func(k, v []byte) error {
+		err := s.tx.ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		return fn(k, v)
+	}
+}
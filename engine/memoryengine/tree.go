@@ -0,0 +1,185 @@
+package memoryengine
+
+import (
+	"bytes"
+)
+
+// A node of a treap, a binary search tree ordered by key and
+// a heap ordered by priority, which keeps the tree balanced.
+// Nodes are never modified once visible outside of the transaction
+// that created them, which allows transactions to share them:
+// a transaction only modifies in place the nodes it owns and copies the others.
+type node struct {
+	key, value  []byte
+	left, right *node
+	priority    uint32
+	owner       uint64
+}
+
+// priority derives the priority of a node from its key, using the FNV-1a hash.
+func priority(k []byte) uint32 {
+	h := uint32(2166136261)
+	for _, c := range k {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	return h
+}
+
+// mutable returns a node that can be modified by the given owner,
+// copying n if necessary.
+func (n *node) mutable(owner uint64) *node {
+	if n.owner == owner {
+		return n
+	}
+
+	c := *n
+	c.owner = owner
+	return &c
+}
+
+// get returns the node associated with the given key, or nil if not found.
+func get(n *node, k []byte) *node {
+	for n != nil {
+		switch c := bytes.Compare(k, n.key); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n
+		}
+	}
+
+	return nil
+}
+
+// put adds or replaces a key value pair and returns the new root of the tree.
+func put(n *node, k, v []byte, owner uint64) *node {
+	if n == nil {
+		return &node{key: k, value: v, priority: priority(k), owner: owner}
+	}
+
+	n = n.mutable(owner)
+	switch c := bytes.Compare(k, n.key); {
+	case c < 0:
+		n.left = put(n.left, k, v, owner)
+		if n.left.priority > n.priority {
+			l := n.left
+			n.left = l.right
+			l.right = n
+			return l
+		}
+	case c > 0:
+		n.right = put(n.right, k, v, owner)
+		if n.right.priority > n.priority {
+			r := n.right
+			n.right = r.left
+			r.left = n
+			return r
+		}
+	default:
+		n.value = v
+	}
+
+	return n
+}
+
+// remove deletes the given key, which must be present in the tree,
+// and returns the new root of the tree.
+func remove(n *node, k []byte, owner uint64) *node {
+	switch c := bytes.Compare(k, n.key); {
+	case c < 0:
+		n = n.mutable(owner)
+		n.left = remove(n.left, k, owner)
+	case c > 0:
+		n = n.mutable(owner)
+		n.right = remove(n.right, k, owner)
+	default:
+		return merge(n.left, n.right, owner)
+	}
+
+	return n
+}
+
+// merge joins two trees whose keys of a are all lower than the keys of b.
+func merge(a, b *node, owner uint64) *node {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	if a.priority > b.priority {
+		a = a.mutable(owner)
+		a.right = merge(a.right, b, owner)
+		return a
+	}
+
+	b = b.mutable(owner)
+	b.left = merge(a, b.left, owner)
+	return b
+}
+
+// ascend calls fn for every node whose key is greater than or equal to the pivot, in increasing order.
+// If the pivot is nil, it starts from the lowest key.
+func ascend(n *node, pivot []byte, fn func(k, v []byte) error) error {
+	var stack []*node
+
+	for n != nil {
+		if len(pivot) == 0 || bytes.Compare(n.key, pivot) >= 0 {
+			stack = append(stack, n)
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+
+	for len(stack) > 0 {
+		n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		err := fn(n.key, n.value)
+		if err != nil {
+			return err
+		}
+
+		for n = n.right; n != nil; n = n.left {
+			stack = append(stack, n)
+		}
+	}
+
+	return nil
+}
+
+// descend calls fn for every node whose key is less than or equal to the pivot, in decreasing order.
+// If the pivot is nil, it starts from the highest key.
+func descend(n *node, pivot []byte, fn func(k, v []byte) error) error {
+	var stack []*node
+
+	for n != nil {
+		if len(pivot) == 0 || bytes.Compare(n.key, pivot) <= 0 {
+			stack = append(stack, n)
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+
+	for len(stack) > 0 {
+		n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		err := fn(n.key, n.value)
+		if err != nil {
+			return err
+		}
+
+		for n = n.left; n != nil; n = n.right {
+			stack = append(stack, n)
+		}
+	}
+
+	return nil
+}
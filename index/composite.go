@@ -0,0 +1,309 @@
+package index
+
+import (
+	"errors"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine"
+)
+
+// CompositeIndex is an index on multiple fields. The values it is given must be arrays
+// containing one value per indexed field, and it returns arrays of the same length.
+//
+// Unlike single field indexes, all the values are stored in the same store.
+// Each array is encoded as a tuple in which every value is prefixed by its index type,
+// so that tuples are sorted by their first value, then by their second value, etc.
+// In non unique indexes, the tuple is followed by a separator and the key.
+// Values of different types are sorted following the order of their index types.
+// Documents and arrays are indexed as NULL values.
+//
+// A pivot can contain fewer values than there are indexed fields: it then seeks
+// for the first tuple starting with these values.
+type CompositeIndex struct {
+	tx     engine.Transaction
+	name   string
+	unique bool
+}
+
+// NewCompositeIndex creates an index on multiple fields. If unique is true,
+// a tuple can only be associated with exactly one key, otherwise it
+// is associated with a list of keys.
+func NewCompositeIndex(tx engine.Transaction, idxName string, unique bool) *CompositeIndex {
+	return &CompositeIndex{
+		tx:     tx,
+		name:   idxName,
+		unique: unique,
+	}
+}
+
+// Set associates a tuple with a key.
+// If the index is unique and the association already exists, it returns ErrDuplicate.
+func (i *CompositeIndex) Set(val document.Value, key []byte) error {
+	tuple, err := encodeTupleValue(val)
+	if err != nil {
+		return err
+	}
+
+	st, err := i.getOrCreateStore()
+	if err != nil {
+		return err
+	}
+
+	if !i.unique {
+		return st.Put(appendKey(tuple, key), nil)
+	}
+
+	_, err = st.Get(tuple)
+	if err == nil {
+		return ErrDuplicate
+	}
+	if err != engine.ErrKeyNotFound {
+		return err
+	}
+
+	return st.Put(tuple, key)
+}
+
+// Delete all the references to the key from the index.
+func (i *CompositeIndex) Delete(val document.Value, key []byte) error {
+	tuple, err := encodeTupleValue(val)
+	if err != nil {
+		return err
+	}
+
+	st, err := i.getOrCreateStore()
+	if err != nil {
+		return err
+	}
+
+	if !i.unique {
+		tuple = appendKey(tuple, key)
+	}
+
+	return st.Delete(tuple)
+}
+
+// AscendGreaterOrEqual seeks for the pivot and then goes through all the subsequent key value pairs in increasing order and calls the given function for each pair.
+// If the given function returns an error, the iteration stops and returns that error.
+// If the pivot is nil, starts from the beginning.
+func (i *CompositeIndex) AscendGreaterOrEqual(pivot *Pivot, fn func(val document.Value, key []byte) error) error {
+	st, seek, err := i.seek(pivot)
+	if err != nil || st == nil {
+		return err
+	}
+
+	return st.AscendGreaterOrEqual(seek, func(k, v []byte) error {
+		return i.decode(k, v, fn)
+	})
+}
+
+// DescendLessOrEqual seeks for the pivot and then goes through all the subsequent key value pairs in descreasing order and calls the given function for each pair.
+// If the given function returns an error, the iteration stops and returns that error.
+// If the pivot is nil, starts from the end.
+func (i *CompositeIndex) DescendLessOrEqual(pivot *Pivot, fn func(val document.Value, key []byte) error) error {
+	st, seek, err := i.seek(pivot)
+	if err != nil || st == nil {
+		return err
+	}
+
+	if len(seek) > 0 {
+		// ensure the pivot is bigger than the tuples starting with it so they don't get skipped.
+		seek = append(seek, 0xFF)
+	}
+
+	return st.DescendLessOrEqual(seek, func(k, v []byte) error {
+		return i.decode(k, v, fn)
+	})
+}
+
+// Truncate deletes all the index data.
+func (i *CompositeIndex) Truncate() error {
+	_, err := i.tx.GetStore(i.storeName())
+	if err == engine.ErrStoreNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return i.tx.DropStore(i.storeName())
+}
+
+func (i *CompositeIndex) storeName() string {
+	return StorePrefix + i.name
+}
+
+func (i *CompositeIndex) getOrCreateStore() (engine.Store, error) {
+	st, err := i.tx.GetStore(i.storeName())
+	if err == nil {
+		return st, nil
+	}
+
+	if err != engine.ErrStoreNotFound {
+		return nil, err
+	}
+
+	err = i.tx.CreateStore(i.storeName())
+	if err != nil {
+		return nil, err
+	}
+
+	return i.tx.GetStore(i.storeName())
+}
+
+// seek returns the store of the index and the encoded pivot.
+// If the store doesn't exist, it returns a nil store.
+func (i *CompositeIndex) seek(pivot *Pivot) (engine.Store, []byte, error) {
+	st, err := i.tx.GetStore(i.storeName())
+	if err == engine.ErrStoreNotFound {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pivot == nil {
+		return st, nil, nil
+	}
+
+	seek, err := encodeTupleValue(pivot.Value)
+	return st, seek, err
+}
+
+func (i *CompositeIndex) decode(k, v []byte, fn func(val document.Value, key []byte) error) error {
+	values, n, err := decodeTuple(k)
+	if err != nil {
+		return err
+	}
+
+	key := v
+	if !i.unique {
+		// skip the separator
+		key = k[n+1:]
+	}
+
+	return fn(document.NewArrayValue(values), key)
+}
+
+func appendKey(tuple, key []byte) []byte {
+	buf := make([]byte, 0, len(tuple)+len(key)+1)
+	buf = append(buf, tuple...)
+	buf = append(buf, separator)
+	return append(buf, key...)
+}
+
+var errNotATuple = errors.New("composite indexes only accept arrays")
+
+func encodeTupleValue(val document.Value) ([]byte, error) {
+	if val.Type != document.ArrayValue {
+		return nil, errNotATuple
+	}
+
+	a, err := val.ConvertToArray()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf []byte
+	err = a.Iterate(func(_ int, v document.Value) error {
+		buf, err = appendTupleValue(buf, v)
+		return err
+	})
+
+	return buf, err
+}
+
+// appendTupleValue appends the index type of v, followed by its encoded value.
+// Bytes are escaped and terminated so that a value is never the prefix
+// of another: 0x00 is encoded as 0x00 0xFF and the end of the value as 0x00 0x01.
+func appendTupleValue(buf []byte, v document.Value) ([]byte, error) {
+	t := NewTypeFromValueType(v.Type)
+	buf = append(buf, byte(t))
+
+	switch t {
+	case Null:
+		return buf, nil
+	case Bytes:
+		b, err := v.ConvertToBlob()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range b {
+			if c == 0x00 {
+				buf = append(buf, 0x00, 0xFF)
+				continue
+			}
+			buf = append(buf, c)
+		}
+
+		return append(buf, 0x00, 0x01), nil
+	}
+
+	data, err := EncodeFieldToIndexValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(buf, data...), nil
+}
+
+// decodeTuple decodes the values of a tuple until it reaches the end of the data
+// or the separator preceding the key. It returns the number of bytes read.
+func decodeTuple(data []byte) (document.ValueBuffer, int, error) {
+	var values document.ValueBuffer
+
+	n := 0
+	for n < len(data) {
+		t := Type(data[n])
+
+		switch t {
+		case Null:
+			values = values.Append(document.NewNullValue())
+			n++
+		case Bool, Float:
+			size := 1
+			if t == Float {
+				size = 8
+			}
+			if n+1+size > len(data) {
+				return nil, 0, errors.New("invalid tuple")
+			}
+
+			v, err := decodeIndexValueToField(t, data[n+1:n+1+size])
+			if err != nil {
+				return nil, 0, err
+			}
+			values = values.Append(v)
+			n += 1 + size
+		case Bytes:
+			var b []byte
+			i := n + 1
+			for {
+				if i+1 >= len(data) {
+					return nil, 0, errors.New("invalid tuple")
+				}
+
+				if data[i] != 0x00 {
+					b = append(b, data[i])
+					i++
+					continue
+				}
+
+				if data[i+1] == 0x01 {
+					break
+				}
+				b = append(b, 0x00)
+				i += 2
+			}
+			values = values.Append(document.NewBlobValue(b))
+			n = i + 2
+		case Type(separator):
+			return values, n, nil
+		default:
+			return nil, 0, errors.New("invalid tuple")
+		}
+	}
+
+	return values, n, nil
+}
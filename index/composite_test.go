@@ -0,0 +1,164 @@
+package index_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/asdine/genji/index"
+	"github.com/stretchr/testify/require"
+)
+
+func getCompositeIndex(t testing.TB, unique bool) (*index.CompositeIndex, func()) {
+	ng := memoryengine.NewEngine()
+	tx, err := ng.Begin(true)
+	require.NoError(t, err)
+
+	return index.NewCompositeIndex(tx, "foo", unique), func() {
+		tx.Rollback()
+	}
+}
+
+func tuple(values ...document.Value) document.Value {
+	return document.NewArrayValue(document.NewValueBuffer(values...))
+}
+
+func TestCompositeIndex(t *testing.T) {
+	for _, unique := range []bool{true, false} {
+		text := fmt.Sprintf("Unique: %v, ", unique)
+
+		t.Run(text+"Set non array value fails", func(t *testing.T) {
+			idx, cleanup := getCompositeIndex(t, unique)
+			defer cleanup()
+
+			require.Error(t, idx.Set(document.NewIntValue(10), []byte("key")))
+		})
+
+		t.Run(text+"Should iterate in tuple order", func(t *testing.T) {
+			idx, cleanup := getCompositeIndex(t, unique)
+			defer cleanup()
+
+			require.NoError(t, idx.Set(tuple(document.NewTextValue("b"), document.NewIntValue(1)), []byte("k1")))
+			require.NoError(t, idx.Set(tuple(document.NewTextValue("a"), document.NewIntValue(2)), []byte("k2")))
+			require.NoError(t, idx.Set(tuple(document.NewTextValue("a\x00"), document.NewIntValue(0)), []byte("k3")))
+			require.NoError(t, idx.Set(tuple(document.NewTextValue("a"), document.NewTextValue("x")), []byte("k4")))
+			require.NoError(t, idx.Set(tuple(document.NewTextValue("a"), document.NewNullValue()), []byte("k5")))
+			require.NoError(t, idx.Set(tuple(document.NewIntValue(10), document.NewBoolValue(true)), []byte("k6")))
+
+			var keys []string
+			err := idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"k6", "k5", "k2", "k4", "k3", "k1"}, keys)
+
+			keys = keys[:0]
+			err = idx.DescendLessOrEqual(nil, func(val document.Value, key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"k1", "k3", "k4", "k2", "k5", "k6"}, keys)
+		})
+
+		t.Run(text+"Should decode values", func(t *testing.T) {
+			idx, cleanup := getCompositeIndex(t, unique)
+			defer cleanup()
+
+			require.NoError(t, idx.Set(tuple(document.NewTextValue("a\x00b"), document.NewIntValue(2), document.NewBoolValue(true), document.NewNullValue()), []byte("key")))
+
+			err := idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+				require.Equal(t, tuple(document.NewBlobValue([]byte("a\x00b")), document.NewFloat64Value(2), document.NewBoolValue(true), document.NewNullValue()), val)
+				require.Equal(t, []byte("key"), key)
+				return nil
+			})
+			require.NoError(t, err)
+		})
+
+		t.Run(text+"With a prefix pivot, should iterate over the tuples starting with it", func(t *testing.T) {
+			idx, cleanup := getCompositeIndex(t, unique)
+			defer cleanup()
+
+			for i := 0; i < 3; i++ {
+				for j := 0; j < 3; j++ {
+					require.NoError(t, idx.Set(tuple(document.NewIntValue(i), document.NewIntValue(j)), []byte{'a' + byte(i), 'a' + byte(j)}))
+				}
+			}
+
+			var keys []string
+			err := idx.AscendGreaterOrEqual(&index.Pivot{Value: tuple(document.NewIntValue(1))}, func(val document.Value, key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"ba", "bb", "bc", "ca", "cb", "cc"}, keys)
+
+			keys = keys[:0]
+			err = idx.DescendLessOrEqual(&index.Pivot{Value: tuple(document.NewIntValue(1))}, func(val document.Value, key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"bc", "bb", "ba", "ac", "ab", "aa"}, keys)
+
+			keys = keys[:0]
+			err = idx.AscendGreaterOrEqual(&index.Pivot{Value: tuple(document.NewIntValue(1), document.NewIntValue(2))}, func(val document.Value, key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"bc", "ca", "cb", "cc"}, keys)
+		})
+
+		t.Run(text+"Delete", func(t *testing.T) {
+			idx, cleanup := getCompositeIndex(t, unique)
+			defer cleanup()
+
+			require.NoError(t, idx.Set(tuple(document.NewIntValue(1), document.NewIntValue(2)), []byte("k1")))
+			require.NoError(t, idx.Set(tuple(document.NewIntValue(1), document.NewIntValue(3)), []byte("k2")))
+			require.NoError(t, idx.Delete(tuple(document.NewIntValue(1), document.NewIntValue(2)), []byte("k1")))
+
+			var keys []string
+			err := idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"k2"}, keys)
+
+			require.NoError(t, idx.Truncate())
+			err = idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+				t.FailNow()
+				return nil
+			})
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("Unique: true, Duplicate", func(t *testing.T) {
+		idx, cleanup := getCompositeIndex(t, true)
+		defer cleanup()
+
+		require.NoError(t, idx.Set(tuple(document.NewIntValue(1), document.NewIntValue(2)), []byte("k1")))
+		require.NoError(t, idx.Set(tuple(document.NewIntValue(1), document.NewIntValue(3)), []byte("k2")))
+		require.Equal(t, index.ErrDuplicate, idx.Set(tuple(document.NewIntValue(1), document.NewIntValue(2)), []byte("k3")))
+	})
+
+	t.Run("Unique: false, Same tuple", func(t *testing.T) {
+		idx, cleanup := getCompositeIndex(t, false)
+		defer cleanup()
+
+		require.NoError(t, idx.Set(tuple(document.NewIntValue(1), document.NewIntValue(2)), []byte("k1")))
+		require.NoError(t, idx.Set(tuple(document.NewIntValue(1), document.NewIntValue(2)), []byte("k2")))
+
+		var keys []string
+		err := idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"k1", "k2"}, keys)
+	})
+}
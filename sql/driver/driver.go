@@ -101,7 +101,7 @@ func (c *conn) Begin() (driver.Tx, error) {
 	return c.BeginTx(context.Background(), driver.TxOptions{})
 }
 
-// BeginTx starts and returns a new transaction.
+// BeginTx starts and returns a new transaction bound to ctx.
 // It uses the ReadOnly option to determine whether to start a read-only or read/write transaction.
 // If the Isolation option is non zero, an error is returned.
 func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
@@ -117,7 +117,7 @@ func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 		c.nonPromotable = true
 	}
 
-	c.tx, err = c.db.Begin(false)
+	c.tx, err = c.db.BeginTx(ctx, false)
 	return c, err
 }
 
@@ -178,21 +178,15 @@ func (s stmt) CheckNamedValue(nv *driver.NamedValue) error {
 // ExecContext executes a query that doesn't return rows, such
 // as an INSERT or UPDATE.
 func (s stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
-	}
-
 	var res *query.Result
 	var err error
 
 	// if calling ExecContext within a transaction, use it,
 	// otherwise use DB.
 	if s.tx != nil {
-		res, err = s.q.Exec(s.tx.Transaction, args, s.nonPromotable)
+		res, err = s.q.ExecContext(ctx, s.tx.Transaction, args, s.nonPromotable)
 	} else {
-		res, err = s.q.Run(s.db.DB, args)
+		res, err = s.q.RunContext(ctx, s.db.DB, args)
 	}
 
 	if err != nil {
@@ -212,21 +206,16 @@ func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
 // QueryContext executes a query that may return rows, such as a
 // SELECT.
 func (s stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
-	}
-
 	var res *query.Result
 	var err error
 
 	// if calling QueryContext within a transaction, use it,
 	// otherwise use DB.
+	// The query stops once ctx is done, including while iterating over the rows.
 	if s.tx != nil {
-		res, err = s.q.Exec(s.tx.Transaction, args, s.nonPromotable)
+		res, err = s.q.ExecContext(ctx, s.tx.Transaction, args, s.nonPromotable)
 	} else {
-		res, err = s.q.Run(s.db.DB, args)
+		res, err = s.q.RunContext(ctx, s.db.DB, args)
 	}
 
 	if err != nil {
@@ -240,11 +229,21 @@ func (s stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (drive
 
 	lastStmt := s.q.Statements[len(s.q.Statements)-1]
 
-	slct, ok := lastStmt.(query.SelectStmt)
-	if ok && len(slct.Selectors) > 0 {
-		rs.fields = make([]string, len(slct.Selectors))
-		for i := range slct.Selectors {
-			rs.fields[i] = slct.Selectors[i].Name()
+	var selectors []query.ResultField
+	switch t := lastStmt.(type) {
+	case query.ExplainStmt:
+		// the plan returned by EXPLAIN is scanned as a whole document
+		rs.fields = []string{"*"}
+	case query.SelectStmt:
+		selectors = t.Selectors
+	case query.InsertStmt:
+		selectors = t.Returning
+	}
+
+	if len(selectors) > 0 {
+		rs.fields = make([]string, len(selectors))
+		for i := range selectors {
+			rs.fields[i] = selectors[i].Name()
 		}
 	}
 
@@ -199,6 +199,51 @@ func TestDriver(t *testing.T) {
 		require.Equal(t, 12, count)
 	})
 
+	t.Run("Explain", func(t *testing.T) {
+		rows, err := db.Query("EXPLAIN SELECT * FROM test WHERE a > 5")
+		require.NoError(t, err)
+		defer rows.Close()
+
+		var plan struct {
+			Table string
+			Scan  string
+			Sort  bool
+		}
+		require.True(t, rows.Next())
+		err = rows.Scan(Scanner(&plan))
+		require.NoError(t, err)
+		require.Equal(t, "test", plan.Table)
+		require.Equal(t, "table", plan.Scan)
+		require.False(t, plan.Sort)
+		require.False(t, rows.Next())
+		require.NoError(t, rows.Err())
+	})
+
+	t.Run("Insert returning", func(t *testing.T) {
+		_, err := db.Exec("CREATE TABLE inserted")
+		require.NoError(t, err)
+
+		rows, err := db.Query("INSERT INTO inserted (a, b) VALUES (1, 'foo'), (2, 'bar') RETURNING pk(), b")
+		require.NoError(t, err)
+		defer rows.Close()
+
+		columns, err := rows.Columns()
+		require.NoError(t, err)
+		require.Equal(t, []string{"pk()", "b"}, columns)
+
+		var count int
+		for rows.Next() {
+			var pk int
+			var b string
+			err = rows.Scan(&pk, &b)
+			require.NoError(t, err)
+			count++
+			require.Equal(t, count, pk)
+		}
+		require.NoError(t, rows.Err())
+		require.Equal(t, 2, count)
+	})
+
 	t.Run("Multiple queries in read only transaction", func(t *testing.T) {
 		tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
 		require.NoError(t, err)
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"github.com/asdine/genji/sql/query"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// parseAlterStatement parses an alter string and returns a Statement AST object.
+// This function assumes the ALTER token has already been consumed.
+func (p *Parser) parseAlterStatement() (query.Statement, error) {
+	// Parse "TABLE".
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.TABLE {
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"TABLE"}, pos)
+	}
+
+	// Parse table name
+	tableName, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	tok, pos, lit := p.ScanIgnoreWhitespace()
+	switch tok {
+	case scanner.RENAME:
+		return p.parseAlterTableRenameStatement(tableName)
+	case scanner.ADD_KEYWORD:
+		return p.parseAlterTableAddFieldStatement(tableName)
+	case scanner.DROP:
+		return p.parseAlterTableDropFieldStatement(tableName)
+	}
+
+	return nil, newParseError(scanner.Tokstr(tok, lit), []string{"RENAME", "ADD", "DROP"}, pos)
+}
+
+// parseAlterTableRenameStatement parses the rest of an ALTER TABLE ... RENAME TO statement.
+// This function assumes the ALTER TABLE table_name RENAME tokens have already been consumed.
+func (p *Parser) parseAlterTableRenameStatement(tableName string) (query.AlterTableRenameStmt, error) {
+	stmt := query.AlterTableRenameStmt{TableName: tableName}
+	var err error
+
+	// Parse "TO".
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.TO {
+		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"TO"}, pos)
+	}
+
+	// Parse new table name
+	stmt.NewTableName, err = p.parseIdent()
+	if err != nil {
+		return stmt, err
+	}
+
+	return stmt, nil
+}
+
+// parseAlterTableAddFieldStatement parses the rest of an ALTER TABLE ... ADD FIELD statement.
+// This function assumes the ALTER TABLE table_name ADD tokens have already been consumed.
+func (p *Parser) parseAlterTableAddFieldStatement(tableName string) (query.AlterTableAddFieldStmt, error) {
+	stmt := query.AlterTableAddFieldStmt{TableName: tableName}
+	var err error
+
+	// Parse "FIELD".
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.FIELD {
+		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"FIELD"}, pos)
+	}
+
+	// Parse field path, type and constraints
+	stmt.Constraint.Path, err = p.parseFieldRef()
+	if err != nil {
+		return stmt, err
+	}
+
+	stmt.Constraint.Type = p.parseType()
+
+	err = p.parseFieldConstraint(&stmt.Constraint)
+	if err != nil {
+		return stmt, err
+	}
+
+	return stmt, nil
+}
+
+// parseAlterTableDropFieldStatement parses the rest of an ALTER TABLE ... DROP FIELD statement.
+// This function assumes the ALTER TABLE table_name DROP tokens have already been consumed.
+func (p *Parser) parseAlterTableDropFieldStatement(tableName string) (query.AlterTableDropFieldStmt, error) {
+	stmt := query.AlterTableDropFieldStmt{TableName: tableName}
+	var err error
+
+	// Parse "FIELD".
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.FIELD {
+		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"FIELD"}, pos)
+	}
+
+	// Parse field path
+	stmt.Path, err = p.parseFieldRef()
+	if err != nil {
+		return stmt, err
+	}
+
+	return stmt, nil
+}
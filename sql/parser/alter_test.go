@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/sql/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserAlter(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected query.Statement
+		errored  bool
+	}{
+		{"Rename", "ALTER TABLE foo RENAME TO bar", query.AlterTableRenameStmt{TableName: "foo", NewTableName: "bar"}, false},
+		{"Rename without TO", "ALTER TABLE foo RENAME bar", nil, true},
+		{"Add field", "ALTER TABLE foo ADD FIELD a.b", query.AlterTableAddFieldStmt{
+			TableName:  "foo",
+			Constraint: database.FieldConstraint{Path: document.NewValuePath("a.b")},
+		}, false},
+		{"Add field with type", "ALTER TABLE foo ADD FIELD a INTEGER NOT NULL", query.AlterTableAddFieldStmt{
+			TableName:  "foo",
+			Constraint: database.FieldConstraint{Path: document.NewValuePath("a"), Type: document.Int64Value, IsNotNull: true},
+		}, false},
+		{"Add without FIELD", "ALTER TABLE foo ADD a INTEGER", nil, true},
+		{"Drop field", "ALTER TABLE foo DROP FIELD a.b", query.AlterTableDropFieldStmt{TableName: "foo", Path: document.NewValuePath("a.b")}, false},
+		{"Drop without path", "ALTER TABLE foo DROP FIELD", nil, true},
+		{"Without TABLE", "ALTER foo RENAME TO bar", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := ParseQuery(test.s)
+			if test.errored {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, q.Statements, 1)
+			require.EqualValues(t, test.expected, q.Statements[0])
+		})
+	}
+}
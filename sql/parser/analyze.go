@@ -0,0 +1,23 @@
+package parser
+
+import (
+	"github.com/asdine/genji/sql/query"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// parseAnalyzeStatement parses an analyze string and returns a Statement AST object.
+// This function assumes the ANALYZE token has already been consumed.
+func (p *Parser) parseAnalyzeStatement() (query.AnalyzeStmt, error) {
+	var stmt query.AnalyzeStmt
+
+	// The table name is optional, all the tables are analyzed if it is omitted.
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.IDENT {
+		p.Unscan()
+		return stmt, nil
+	}
+	p.Unscan()
+
+	var err error
+	stmt.TableName, err = p.parseIdent()
+	return stmt, err
+}
@@ -0,0 +1,34 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/sql/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserAnalyze(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected query.Statement
+		errored  bool
+	}{
+		{"All tables", "ANALYZE", query.AnalyzeStmt{}, false},
+		{"One table", "ANALYZE test", query.AnalyzeStmt{TableName: "test"}, false},
+		{"Multiple tables", "ANALYZE a, b", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := ParseQuery(test.s)
+			if test.errored {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, q.Statements, 1)
+			require.EqualValues(t, test.expected, q.Statements[0])
+		})
+	}
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/sql/query"
@@ -23,9 +24,11 @@ func (p *Parser) parseCreateStatement() (query.Statement, error) {
 		return p.parseCreateIndexStatement(true)
 	case scanner.INDEX:
 		return p.parseCreateIndexStatement(false)
+	case scanner.SEQUENCE:
+		return p.parseCreateSequenceStatement()
 	}
 
-	return nil, newParseError(scanner.Tokstr(tok, lit), []string{"TABLE", "INDEX"}, pos)
+	return nil, newParseError(scanner.Tokstr(tok, lit), []string{"TABLE", "INDEX", "SEQUENCE"}, pos)
 }
 
 // parseCreateTableStatement parses a create table string and returns a Statement AST object.
@@ -156,6 +159,52 @@ func (p *Parser) parseFieldConstraint(fc *database.FieldConstraint) error {
 			}
 
 			fc.IsNotNull = true
+		case scanner.DEFAULT:
+			// if it already has a default value we return an error
+			if fc.DefaultValue != "" {
+				return newParseError(scanner.Tokstr(tok, lit), []string{"CONSTRAINT", ")"}, pos)
+			}
+
+			_, expr, err := p.parseExpr()
+			if err != nil {
+				return err
+			}
+
+			fc.DefaultValue = expr
+		case scanner.CHECK:
+			// if it already has a check we return an error
+			if fc.Check != "" {
+				return newParseError(scanner.Tokstr(tok, lit), []string{"CONSTRAINT", ")"}, pos)
+			}
+
+			// Parse "("
+			if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.LPAREN {
+				return newParseError(scanner.Tokstr(tok, lit), []string{"("}, pos)
+			}
+
+			_, expr, err := p.parseExpr()
+			if err != nil {
+				return err
+			}
+
+			// Parse ")"
+			if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
+				return newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
+			}
+
+			fc.Check = expr
+		case scanner.REFERENCES:
+			// if it's already a foreign key we return an error
+			if fc.References.TableName != "" {
+				return newParseError(scanner.Tokstr(tok, lit), []string{"CONSTRAINT", ")"}, pos)
+			}
+
+			fk, err := p.parseForeignKey()
+			if err != nil {
+				return err
+			}
+
+			fc.References = fk
 		default:
 			p.Unscan()
 			return nil
@@ -163,6 +212,61 @@ func (p *Parser) parseFieldConstraint(fc *database.FieldConstraint) error {
 	}
 }
 
+// parseForeignKey parses the table and primary key referenced by a field,
+// followed by an optional ON DELETE clause.
+// This function assumes the REFERENCES token has already been consumed.
+func (p *Parser) parseForeignKey() (database.ForeignKey, error) {
+	var fk database.ForeignKey
+	var err error
+
+	fk.TableName, err = p.parseIdent()
+	if err != nil {
+		return fk, err
+	}
+
+	// Parse optional primary key path
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.LPAREN {
+		fk.Path, err = p.parseFieldRef()
+		if err != nil {
+			return fk, err
+		}
+
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
+			return fk, newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
+		}
+	} else {
+		p.Unscan()
+	}
+
+	// Parse optional "ON DELETE"
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.ON {
+		p.Unscan()
+		return fk, nil
+	}
+
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.DELETE {
+		return fk, newParseError(scanner.Tokstr(tok, lit), []string{"DELETE"}, pos)
+	}
+
+	switch tok, pos, lit := p.ScanIgnoreWhitespace(); tok {
+	case scanner.RESTRICT:
+		fk.OnDelete = database.Restrict
+	case scanner.CASCADE:
+		fk.OnDelete = database.Cascade
+	case scanner.SET:
+		// Parse "NULL"
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.NULL {
+			return fk, newParseError(scanner.Tokstr(tok, lit), []string{"NULL"}, pos)
+		}
+
+		fk.OnDelete = database.SetNull
+	default:
+		return fk, newParseError(scanner.Tokstr(tok, lit), []string{"RESTRICT", "CASCADE", "SET"}, pos)
+	}
+
+	return fk, nil
+}
+
 // parseCreateIndexStatement parses a create index string and returns a Statement AST object.
 // This function assumes the CREATE INDEX or CREATE UNIQUE INDEX tokens have already been consumed.
 func (p *Parser) parseCreateIndexStatement(unique bool) (query.CreateIndexStmt, error) {
@@ -214,11 +318,100 @@ func (p *Parser) parseCreateIndexStatement(unique bool) (query.CreateIndexStmt,
 		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"("}, pos)
 	}
 
-	if len(paths) != 1 {
-		return stmt, &ParseError{Message: "indexes on more than one field are not supported"}
+	stmt.Paths = paths
+
+	// Parse optional predicate of a partial index
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.WHERE {
+		p.Unscan()
+		return stmt, nil
+	}
+
+	params := p.orderedParams + p.namedParams
+	_, stmt.Where, err = p.parseExpr()
+	if err != nil {
+		return stmt, err
 	}
 
-	stmt.Path = paths[0]
+	// the predicate is stored with the index, it can't depend on the parameters of the query
+	if p.orderedParams+p.namedParams != params {
+		return stmt, &ParseError{Message: "the predicate of an index can't contain parameters"}
+	}
 
 	return stmt, nil
 }
+
+// parseCreateSequenceStatement parses a create sequence string and returns a Statement AST object.
+// This function assumes the CREATE SEQUENCE tokens have already been consumed.
+func (p *Parser) parseCreateSequenceStatement() (query.CreateSequenceStmt, error) {
+	var err error
+	stmt := query.CreateSequenceStmt{
+		IncrementBy: 1,
+		Start:       1,
+	}
+
+	// Parse IF NOT EXISTS
+	stmt.IfNotExists, err = p.parseIfNotExists()
+	if err != nil {
+		return stmt, err
+	}
+
+	// Parse sequence name
+	stmt.SequenceName, err = p.parseIdent()
+	if err != nil {
+		return stmt, err
+	}
+
+	// Parse the options, in any order
+	var hasIncrement, hasStart bool
+	for {
+		tok, pos, lit := p.ScanIgnoreWhitespace()
+		switch {
+		case tok == scanner.INCREMENT && !hasIncrement:
+			// Parse optional "BY"
+			if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.BY {
+				p.Unscan()
+			}
+
+			stmt.IncrementBy, err = p.parseInteger()
+			if err != nil {
+				return stmt, err
+			}
+
+			if stmt.IncrementBy == 0 {
+				return stmt, &ParseError{Message: "the increment of a sequence can't be zero", Pos: pos}
+			}
+			hasIncrement = true
+		case tok == scanner.START && !hasStart:
+			// Parse optional "WITH"
+			if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.WITH {
+				p.Unscan()
+			}
+
+			stmt.Start, err = p.parseInteger()
+			if err != nil {
+				return stmt, err
+			}
+			hasStart = true
+		case tok == scanner.INCREMENT || tok == scanner.START:
+			return stmt, &ParseError{Message: fmt.Sprintf("%s specified more than once", lit), Pos: pos}
+		default:
+			p.Unscan()
+			return stmt, nil
+		}
+	}
+}
+
+// parseInteger parses an integer literal.
+func (p *Parser) parseInteger() (int64, error) {
+	tok, pos, lit := p.ScanIgnoreWhitespace()
+	if tok != scanner.INTEGER {
+		return 0, newParseError(scanner.Tokstr(tok, lit), []string{"integer"}, pos)
+	}
+
+	v, err := strconv.ParseInt(lit, 10, 64)
+	if err != nil {
+		return 0, &ParseError{Message: "unable to parse integer", Pos: pos}
+	}
+
+	return v, nil
+}
@@ -89,6 +89,51 @@ func TestParserCreateTable(t *testing.T) {
 			}, false},
 		{"With multiple primary keys", "CREATE TABLE test(foo PRIMARY KEY, bar PRIMARY KEY)",
 			query.CreateTableStmt{}, true},
+		{"With default", "CREATE TABLE test(foo INT64 DEFAULT 0 NOT NULL, bar DEFAULT 'hello')",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					FieldConstraints: []database.FieldConstraint{
+						{Path: []string{"foo"}, Type: document.Int64Value, IsNotNull: true, DefaultValue: "0"},
+						{Path: []string{"bar"}, DefaultValue: "'hello'"},
+					},
+				},
+			}, false},
+		{"With default twice", "CREATE TABLE test(foo DEFAULT 1 DEFAULT 2)",
+			query.CreateTableStmt{}, true},
+		{"With check", "CREATE TABLE test(age INT8 CHECK (age >= 0 AND age < 120))",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					FieldConstraints: []database.FieldConstraint{
+						{Path: []string{"age"}, Type: document.Int8Value, Check: "age >= 0 AND age < 120"},
+					},
+				},
+			}, false},
+		{"With check without parentheses", "CREATE TABLE test(age CHECK age >= 0)",
+			query.CreateTableStmt{}, true},
+		{"With references", "CREATE TABLE test(authorId INT REFERENCES authors, bookId REFERENCES books(id) ON DELETE CASCADE NOT NULL)",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					FieldConstraints: []database.FieldConstraint{
+						{Path: []string{"authorId"}, Type: document.Int64Value, References: database.ForeignKey{TableName: "authors"}},
+						{Path: []string{"bookId"}, IsNotNull: true, References: database.ForeignKey{TableName: "books", Path: []string{"id"}, OnDelete: database.Cascade}},
+					},
+				},
+			}, false},
+		{"With references and on delete set null", "CREATE TABLE test(a REFERENCES b ON DELETE SET NULL, c REFERENCES d ON DELETE RESTRICT)",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					FieldConstraints: []database.FieldConstraint{
+						{Path: []string{"a"}, References: database.ForeignKey{TableName: "b", OnDelete: database.SetNull}},
+						{Path: []string{"c"}, References: database.ForeignKey{TableName: "d", OnDelete: database.Restrict}},
+					},
+				},
+			}, false},
+		{"With references and unknown action", "CREATE TABLE test(a REFERENCES b ON DELETE NOTHING)",
+			query.CreateTableStmt{}, true},
 	}
 
 	for _, test := range tests {
@@ -112,11 +157,45 @@ func TestParserCreateIndex(t *testing.T) {
 		expected query.Statement
 		errored  bool
 	}{
-		{"Basic", "CREATE INDEX idx ON test (foo)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Path: document.NewValuePath("foo")}, false},
-		{"If not exists", "CREATE INDEX IF NOT EXISTS idx ON test (foo.bar.1)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Path: document.NewValuePath("foo.bar.1"), IfNotExists: true}, false},
-		{"Unique", "CREATE UNIQUE INDEX IF NOT EXISTS idx ON test (foo.3.baz)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Path: document.NewValuePath("foo.3.baz"), IfNotExists: true, Unique: true}, false},
+		{"Basic", "CREATE INDEX idx ON test (foo)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")}}, false},
+		{"If not exists", "CREATE INDEX IF NOT EXISTS idx ON test (foo.bar.1)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo.bar.1")}, IfNotExists: true}, false},
+		{"Unique", "CREATE UNIQUE INDEX IF NOT EXISTS idx ON test (foo.3.baz)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo.3.baz")}, IfNotExists: true, Unique: true}, false},
 		{"No fields", "CREATE INDEX idx ON test", nil, true},
-		{"More than 1 field", "CREATE INDEX idx ON test (foo, bar)", nil, true},
+		{"Partial", "CREATE INDEX idx ON test (foo) WHERE deletedAt IS NULL AND foo > 10",
+			query.CreateIndexStmt{IndexName: "idx", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo")}, Where: "deletedAt IS NULL AND foo > 10"}, false},
+		{"Partial with params", "CREATE INDEX idx ON test (foo) WHERE foo > ?", nil, true},
+		{"More than 1 field", "CREATE INDEX idx ON test (foo, bar.baz)",
+			query.CreateIndexStmt{IndexName: "idx", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo"), document.NewValuePath("bar.baz")}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := ParseQuery(test.s)
+			if test.errored {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, q.Statements, 1)
+			require.EqualValues(t, test.expected, q.Statements[0])
+		})
+	}
+}
+
+func TestParserCreateSequence(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected query.Statement
+		errored  bool
+	}{
+		{"Basic", "CREATE SEQUENCE seq", query.CreateSequenceStmt{SequenceName: "seq", IncrementBy: 1, Start: 1}, false},
+		{"If not exists", "CREATE SEQUENCE IF NOT EXISTS seq", query.CreateSequenceStmt{SequenceName: "seq", IfNotExists: true, IncrementBy: 1, Start: 1}, false},
+		{"With options", "CREATE SEQUENCE seq START WITH 100 INCREMENT BY -2", query.CreateSequenceStmt{SequenceName: "seq", IncrementBy: -2, Start: 100}, false},
+		{"With options without keywords", "CREATE SEQUENCE seq INCREMENT 10 START 0", query.CreateSequenceStmt{SequenceName: "seq", IncrementBy: 10, Start: 0}, false},
+		{"Zero increment", "CREATE SEQUENCE seq INCREMENT BY 0", nil, true},
+		{"Option twice", "CREATE SEQUENCE seq START 1 START 2", nil, true},
+		{"Not an integer", "CREATE SEQUENCE seq START 1.5", nil, true},
 	}
 
 	for _, test := range tests {
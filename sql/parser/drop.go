@@ -14,9 +14,11 @@ func (p *Parser) parseDropStatement() (query.Statement, error) {
 		return p.parseDropTableStatement()
 	case scanner.INDEX:
 		return p.parseDropIndexStatement()
+	case scanner.SEQUENCE:
+		return p.parseDropSequenceStatement()
 	}
 
-	return nil, newParseError(scanner.Tokstr(tok, lit), []string{"TABLE", "INDEX"}, pos)
+	return nil, newParseError(scanner.Tokstr(tok, lit), []string{"TABLE", "INDEX", "SEQUENCE"}, pos)
 }
 
 // parseDropTableStatement parses a drop table string and returns a Statement AST object.
@@ -70,3 +72,29 @@ func (p *Parser) parseDropIndexStatement() (query.DropIndexStmt, error) {
 
 	return stmt, nil
 }
+
+// parseDropSequenceStatement parses a drop sequence string and returns a Statement AST object.
+// This function assumes the DROP SEQUENCE tokens have already been consumed.
+func (p *Parser) parseDropSequenceStatement() (query.DropSequenceStmt, error) {
+	var stmt query.DropSequenceStmt
+	var err error
+
+	// Parse "IF"
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.IF {
+		// Parse "EXISTS"
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.EXISTS {
+			return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"EXISTS"}, pos)
+		}
+		stmt.IfExists = true
+	} else {
+		p.Unscan()
+	}
+
+	// Parse sequence name
+	stmt.SequenceName, err = p.parseIdent()
+	if err != nil {
+		return stmt, err
+	}
+
+	return stmt, nil
+}
@@ -18,6 +18,8 @@ func TestParserDrop(t *testing.T) {
 		{"Drop table If not exists", "DROP TABLE IF EXISTS test", query.DropTableStmt{TableName: "test", IfExists: true}, false},
 		{"Drop index", "DROP INDEX test", query.DropIndexStmt{IndexName: "test"}, false},
 		{"Drop index if exists", "DROP INDEX IF EXISTS test", query.DropIndexStmt{IndexName: "test", IfExists: true}, false},
+		{"Drop sequence", "DROP SEQUENCE test", query.DropSequenceStmt{SequenceName: "test"}, false},
+		{"Drop sequence if exists", "DROP SEQUENCE IF EXISTS test", query.DropSequenceStmt{SequenceName: "test", IfExists: true}, false},
 	}
 
 	for _, test := range tests {
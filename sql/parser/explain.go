@@ -0,0 +1,21 @@
+package parser
+
+import (
+	"github.com/asdine/genji/sql/query"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// parseExplainStatement parses an explain string and returns a Statement AST object.
+// This function assumes the EXPLAIN token has already been consumed.
+func (p *Parser) parseExplainStatement() (query.ExplainStmt, error) {
+	var stmt query.ExplainStmt
+
+	// Only SELECT statements use the query planner.
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.SELECT {
+		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"SELECT"}, pos)
+	}
+
+	var err error
+	stmt.Statement, err = p.parseSelectStatement()
+	return stmt, err
+}
@@ -0,0 +1,40 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/sql/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserExplain(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected query.Statement
+		errored  bool
+	}{
+		{"Explain select", "EXPLAIN SELECT * FROM test WHERE a = 1", query.ExplainStmt{
+			Statement: query.SelectStmt{
+				Selectors: []query.ResultField{query.Wildcard{}},
+				TableName: "test",
+				WhereExpr: query.Eq(query.FieldSelector([]string{"a"}), query.IntValue(1)),
+			},
+		}, false},
+		{"Explain delete", "EXPLAIN DELETE FROM test", nil, true},
+		{"Explain alone", "EXPLAIN", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := ParseQuery(test.s)
+			if test.errored {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, q.Statements, 1)
+			require.EqualValues(t, test.expected, q.Statements[0])
+		})
+	}
+}
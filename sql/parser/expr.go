@@ -3,6 +3,7 @@ package parser
 import (
 	"bytes"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -23,11 +24,16 @@ type operator interface {
 // parseExpr parses an expression.
 func (p *Parser) parseExpr() (query.Expr, string, error) {
 	// enable the expression buffer to store the literal representation
-	// of the parsed expression
-	if p.buf == nil {
-		p.buf = new(bytes.Buffer)
-		defer func() { p.buf = nil }()
-	}
+	// of the parsed expression. If the expression is part of another one,
+	// i.e. in a subquery, its representation is then added to the outer buffer.
+	outer := p.buf
+	p.buf = new(bytes.Buffer)
+	defer func() {
+		if outer != nil {
+			outer.Write(p.buf.Bytes())
+		}
+		p.buf = outer
+	}()
 
 	var err error
 	// Dummy root node.
@@ -45,6 +51,12 @@ func (p *Parser) parseExpr() (query.Expr, string, error) {
 	for {
 		// If the next token is NOT an operator then return the expression.
 		op, _, _ := p.ScanIgnoreWhitespace()
+		if op == scanner.NOT && p.scanToken(scanner.IN) {
+			op = scanner.NIN
+		}
+		if op == scanner.IS && p.scanToken(scanner.NOT) {
+			op = scanner.ISN
+		}
 		if !op.IsOperator() {
 			p.Unscan()
 			return root.RightHand(), strings.TrimSpace(p.buf.String()), nil
@@ -52,10 +64,21 @@ func (p *Parser) parseExpr() (query.Expr, string, error) {
 
 		var rhs query.Expr
 
-		if rhs, err = p.parseUnaryExpr(); err != nil {
+		if scanner.IsRegexOp(op) {
+			// Parse a regular expression.
+			rhs, err = p.parseRegex()
+		} else {
+			rhs, err = p.parseUnaryExpr()
+		}
+		if err != nil {
 			return nil, "", err
 		}
 
+		// the right operand of IN is always a list, even with a single element
+		if par, ok := rhs.(query.Parentheses); ok && (op == scanner.IN || op == scanner.NIN) {
+			rhs = query.LiteralExprList{par.E}
+		}
+
 		// Find the right spot in the tree to add the new expression by
 		// descending the RHS of the expression tree until we reach the last
 		// BinaryExpr or a BinaryExpr whose RHS has an operator with
@@ -86,6 +109,14 @@ func opToExpr(op scanner.Token, lhs, rhs query.Expr) query.Expr {
 		return query.Lt(lhs, rhs)
 	case scanner.LTE:
 		return query.Lte(lhs, rhs)
+	case scanner.EQREGEX:
+		return query.EqRegex(lhs, rhs)
+	case scanner.NEQREGEX:
+		return query.NeqRegex(lhs, rhs)
+	case scanner.IN:
+		return query.In(lhs, rhs)
+	case scanner.NIN:
+		return query.NotIn(lhs, rhs)
 	case scanner.AND:
 		return query.And(lhs, rhs)
 	case scanner.OR:
@@ -106,11 +137,35 @@ func opToExpr(op scanner.Token, lhs, rhs query.Expr) query.Expr {
 		return query.BitwiseOr(lhs, rhs)
 	case scanner.BITWISEXOR:
 		return query.BitwiseXor(lhs, rhs)
+	case scanner.IS:
+		return query.Is(lhs, rhs)
+	case scanner.ISN:
+		return query.IsNot(lhs, rhs)
 	}
 
 	panic(fmt.Sprintf("unknown operator %q", op))
 }
 
+// scanToken reports whether the next non-whitespace token is tok.
+// If not, the scanned tokens are pushed back onto the buffer.
+func (p *Parser) scanToken(tok scanner.Token) bool {
+	n := 1
+	t, _, _ := p.Scan()
+	if t == scanner.WS {
+		t, _, _ = p.Scan()
+		n++
+	}
+
+	if t == tok {
+		return true
+	}
+
+	for i := 0; i < n; i++ {
+		p.Unscan()
+	}
+	return false
+}
+
 // parseUnaryExpr parses an non-binary expression.
 func (p *Parser) parseUnaryExpr() (query.Expr, error) {
 	tok, pos, lit := p.ScanIgnoreWhitespace()
@@ -118,6 +173,12 @@ func (p *Parser) parseUnaryExpr() (query.Expr, error) {
 	case scanner.CAST:
 		p.Unscan()
 		return p.parseCastExpression()
+	case scanner.NOT:
+		e, err := p.parseUnaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return query.Not(e), nil
 	case scanner.IDENT:
 		// if the next token is a left parenthesis, this is a function
 		if tok1, _, _ := p.Scan(); tok1 == scanner.LPAREN {
@@ -184,13 +245,50 @@ func (p *Parser) parseUnaryExpr() (query.Expr, error) {
 		p.Unscan()
 		return p.parseExprList(scanner.LSBRACKET, scanner.RSBRACKET)
 	case scanner.LPAREN:
+		// if the next token is SELECT, this is a subquery
+		if tok1, _, _ := p.ScanIgnoreWhitespace(); tok1 == scanner.SELECT {
+			stmt, err := p.parseSubquery()
+			if err != nil {
+				return nil, err
+			}
+
+			return &query.Subquery{Stmt: stmt}, nil
+		}
 		p.Unscan()
-		return p.parseExprList(scanner.LPAREN, scanner.RPAREN)
+		list, err := p.parseExprListItems(scanner.RPAREN)
+		if err != nil {
+			return nil, err
+		}
+
+		// a single expression enclosed in parentheses is not a list
+		if len(list) == 1 {
+			return query.Parentheses{E: list[0]}, nil
+		}
+		return list, nil
 	default:
 		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"identifier", "string", "number", "bool"}, pos)
 	}
 }
 
+// parseRegex parses a regular expression literal in the form /pattern/.
+func (p *Parser) parseRegex() (query.Expr, error) {
+	ti := p.s.ScanRegex()
+	if p.buf != nil {
+		p.buf.WriteString(ti.Raw)
+	}
+
+	if ti.Tok != scanner.REGEX {
+		return nil, newParseError(scanner.Tokstr(ti.Tok, ti.Lit), []string{"regex"}, ti.Pos)
+	}
+
+	re, err := regexp.Compile(ti.Lit)
+	if err != nil {
+		return nil, &ParseError{Message: err.Error(), Pos: ti.Pos}
+	}
+
+	return query.RegexValue{Regexp: re}, nil
+}
+
 // parseIdent parses an identifier.
 func (p *Parser) parseIdent() (string, error) {
 	tok, pos, lit := p.ScanIgnoreWhitespace()
@@ -375,6 +473,17 @@ LOOP:
 			}
 			lit = lit[1:]
 			fieldRef = append(fieldRef, lit)
+		case scanner.LSBRACKET:
+			// an array index can also be written between brackets, i.e. tags[2]
+			tok, pos, lit := p.Scan()
+			if tok != scanner.INTEGER {
+				return nil, newParseError(scanner.Tokstr(tok, lit), []string{"array index"}, pos)
+			}
+			fieldRef = append(fieldRef, lit)
+
+			if tok, pos, lit := p.Scan(); tok != scanner.RSBRACKET {
+				return nil, newParseError(scanner.Tokstr(tok, lit), []string{"]"}, pos)
+			}
 		default:
 			p.Unscan()
 			break LOOP
@@ -390,6 +499,12 @@ func (p *Parser) parseExprList(leftToken, rightToken scanner.Token) (query.Liter
 		return nil, newParseError(scanner.Tokstr(tok, lit), []string{leftToken.String()}, pos)
 	}
 
+	return p.parseExprListItems(rightToken)
+}
+
+// parseExprListItems parses the expressions of a list and the token closing it.
+// This function assumes the token opening the list has already been consumed.
+func (p *Parser) parseExprListItems(rightToken scanner.Token) (query.LiteralExprList, error) {
 	var exprList query.LiteralExprList
 	var expr query.Expr
 	var err error
@@ -417,6 +532,22 @@ func (p *Parser) parseExprList(leftToken, rightToken scanner.Token) (query.Liter
 	return exprList, nil
 }
 
+// parseSubquery parses a select statement enclosed in parentheses.
+// This function assumes the ( and SELECT tokens have already been consumed.
+func (p *Parser) parseSubquery() (query.SelectStmt, error) {
+	stmt, err := p.parseSelectStatement()
+	if err != nil {
+		return stmt, err
+	}
+
+	// Parse ) token.
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
+		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
+	}
+
+	return stmt, nil
+}
+
 // parseFunction parses a function call.
 // a function is an identifier followed by a parenthesis,
 // an optional coma-separated list of expressions and a closing parenthesis.
@@ -433,9 +564,19 @@ func (p *Parser) parseFunction() (query.Expr, error) {
 	}
 
 	// Check if the function is called without arguments.
-	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.RPAREN {
+	tok, _, _ := p.ScanIgnoreWhitespace()
+	if tok == scanner.RPAREN {
 		return query.GetFunc(fname)
 	}
+
+	// Check if the function is called with a wildcard, i.e. COUNT(*).
+	if tok == scanner.MUL {
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
+			return nil, newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
+		}
+
+		return query.GetFunc(fname, query.Wildcard{})
+	}
 	p.Unscan()
 
 	var exprs []query.Expr
@@ -449,9 +590,13 @@ func (p *Parser) parseFunction() (query.Expr, error) {
 
 		exprs = append(exprs, expr)
 
-		if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.COMMA {
-			p.Unscan()
+		tok, pos, lit := p.ScanIgnoreWhitespace()
+		switch tok {
+		case scanner.COMMA:
+		case scanner.RPAREN:
 			return query.GetFunc(fname, exprs...)
+		default:
+			return nil, newParseError(scanner.Tokstr(tok, lit), []string{",", ")"}, pos)
 		}
 	}
 }
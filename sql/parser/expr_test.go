@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -95,7 +96,7 @@ func TestParserExpr(t *testing.T) {
 				query.BoolValue(true),
 				query.KVPairs{query.KVPair{K: "a", V: query.IntValue(1)}},
 				query.FieldSelector{"a", "b", "c"},
-				query.LiteralExprList{query.IntValue(-1)},
+				query.Parentheses{E: query.IntValue(-1)},
 				query.LiteralExprList{query.IntValue(-1)},
 			}, false},
 		{"list with parentheses: missing parenthese", `(1, true, {a: 1}, a.b.c, (-1)`, nil, true},
@@ -106,7 +107,7 @@ func TestParserExpr(t *testing.T) {
 				query.BoolValue(true),
 				query.KVPairs{query.KVPair{K: "a", V: query.IntValue(1)}},
 				query.FieldSelector{"a", "b", "c"},
-				query.LiteralExprList{query.IntValue(-1)},
+				query.Parentheses{E: query.IntValue(-1)},
 				query.LiteralExprList{query.IntValue(-1)},
 			}, false},
 		{"list with brackets: missing bracket", `[1, true, {a: 1}, a.b.c, (-1), [-1]`, nil, true},
@@ -118,6 +119,38 @@ func TestParserExpr(t *testing.T) {
 		{">=", "age >= 10", query.Gte(query.FieldSelector([]string{"age"}), query.IntValue(10)), false},
 		{"<", "age < 10", query.Lt(query.FieldSelector([]string{"age"}), query.IntValue(10)), false},
 		{"<=", "age <= 10", query.Lte(query.FieldSelector([]string{"age"}), query.IntValue(10)), false},
+		{"=~", "name =~ /^ab.*/", query.EqRegex(query.FieldSelector([]string{"name"}), query.RegexValue{Regexp: regexp.MustCompile("^ab.*")}), false},
+		{"!~", "name !~ /^ab.*/", query.NeqRegex(query.FieldSelector([]string{"name"}), query.RegexValue{Regexp: regexp.MustCompile("^ab.*")}), false},
+		{"=~ with escaped slash", `path =~/^\/usr\//`, query.EqRegex(query.FieldSelector([]string{"path"}), query.RegexValue{Regexp: regexp.MustCompile("^/usr/")}), false},
+		{"=~ without regex", "name =~ 'ab'", nil, true},
+		{"=~ with bad regex", "name =~ /a(b/", nil, true},
+		{"IN", "age IN (1, 2)", query.In(query.FieldSelector([]string{"age"}), query.LiteralExprList{query.IntValue(1), query.IntValue(2)}), false},
+		{"IN with param", "age IN ?", query.In(query.FieldSelector([]string{"age"}), query.PositionalParam(1)), false},
+		{"NOT IN", "age NOT IN (1, 2)", query.NotIn(query.FieldSelector([]string{"age"}), query.LiteralExprList{query.IntValue(1), query.IntValue(2)}), false},
+		{"NOT IN precedence", "age NOT IN [1] AND a", query.And(query.NotIn(query.FieldSelector([]string{"age"}), query.LiteralExprList{query.IntValue(1)}), query.FieldSelector([]string{"a"})), false},
+		{"IS", "age IS NULL", query.Is(query.FieldSelector([]string{"age"}), query.NullValue()), false},
+		{"IS NOT", "age IS NOT NULL", query.IsNot(query.FieldSelector([]string{"age"}), query.NullValue()), false},
+		{"NOT", "NOT age", query.Not(query.FieldSelector([]string{"age"})), false},
+		{"NOT precedence", "NOT age = 10 AND NOT NOT a",
+			query.And(
+				query.Not(query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10))),
+				query.Not(query.Not(query.FieldSelector([]string{"a"}))),
+			), false},
+		{"NOT without operand", "NOT", nil, true},
+		{"NOT with parentheses", "NOT (age = 10 OR a) AND b",
+			query.And(
+				query.Not(query.Parentheses{E: query.Or(
+					query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10)),
+					query.FieldSelector([]string{"a"}),
+				)}),
+				query.FieldSelector([]string{"b"}),
+			), false},
+		{"parentheses precedence", "(age + 1) * 2 = (a OR b)",
+			query.Eq(
+				query.Mul(query.Parentheses{E: query.Add(query.FieldSelector([]string{"age"}), query.IntValue(1))}, query.IntValue(2)),
+				query.Parentheses{E: query.Or(query.FieldSelector([]string{"a"}), query.FieldSelector([]string{"b"}))},
+			), false},
+		{"IN with parentheses", "age IN (1)", query.In(query.FieldSelector([]string{"age"}), query.LiteralExprList{query.IntValue(1)}), false},
 		{"+", "age + 10", query.Add(query.FieldSelector([]string{"age"}), query.IntValue(10)), false},
 		{"-", "age - 10", query.Sub(query.FieldSelector([]string{"age"}), query.IntValue(10)), false},
 		{"*", "age * 10", query.Mul(query.FieldSelector([]string{"age"}), query.IntValue(10)), false},
@@ -151,7 +184,34 @@ func TestParserExpr(t *testing.T) {
 			), false},
 		{"with NULL", "age > NULL", query.Gt(query.FieldSelector([]string{"age"}), query.NullValue()), false},
 		{"pk() function", "pk()", &query.PKFunc{}, false},
+		{"COUNT(*) function", "COUNT(*)", &query.CountFunc{Wildcard: true}, false},
+		{"COUNT() function", "count(a.b)", &query.CountFunc{Expr: query.FieldSelector([]string{"a", "b"})}, false},
+		{"SUM() function", "SUM(a + 1)", &query.SumFunc{Expr: query.Add(query.FieldSelector([]string{"a"}), query.IntValue(1))}, false},
+		{"MIN() function", "MIN(a)", &query.MinFunc{Expr: query.FieldSelector([]string{"a"})}, false},
+		{"MAX() function", "MAX(a)", &query.MaxFunc{Expr: query.FieldSelector([]string{"a"})}, false},
+		{"AVG() function", "AVG(a)", &query.AvgFunc{Expr: query.FieldSelector([]string{"a"})}, false},
+		{"SUM(*) function", "SUM(*)", nil, true},
+		{"function with missing parenthesis", "SUM(a", nil, true},
+		{"function with too many arguments", "MAX(a, b)", nil, true},
 		{"CAST", "CAST(a.b.1.0 AS TEXT)", query.Cast{Expr: query.FieldSelector([]string{"a", "b", "1", "0"}), ConvertTo: document.TextValue}, false},
+
+		// subqueries
+		{"subquery", "(SELECT MAX(a) FROM test)",
+			&query.Subquery{Stmt: query.SelectStmt{
+				Selectors: []query.ResultField{query.ResultFieldExpr{Expr: &query.MaxFunc{Expr: query.FieldSelector([]string{"a"})}, ExprName: "MAX(a)"}},
+				TableName: "test",
+			}}, false},
+		{"IN subquery", "a IN ( SELECT b FROM test WHERE c = 1)",
+			query.In(query.FieldSelector([]string{"a"}), &query.Subquery{Stmt: query.SelectStmt{
+				Selectors: []query.ResultField{query.ResultFieldExpr{Expr: query.FieldSelector([]string{"b"}), ExprName: "b"}},
+				TableName: "test",
+				WhereExpr: query.Eq(query.FieldSelector([]string{"c"}), query.IntValue(1)),
+			}, List: true}), false},
+		{"subquery in an expression", "a > (SELECT 1) + 1",
+			query.Gt(query.FieldSelector([]string{"a"}), query.Add(&query.Subquery{Stmt: query.SelectStmt{
+				Selectors: []query.ResultField{query.ResultFieldExpr{Expr: query.IntValue(1), ExprName: "1"}},
+			}}, query.IntValue(1))), false},
+		{"subquery with missing parenthesis", "(SELECT a FROM test", nil, true},
 	}
 
 	for _, test := range tests {
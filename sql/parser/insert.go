@@ -31,8 +31,29 @@ func (p *Parser) parseInsertStatement() (query.InsertStmt, error) {
 		stmt.FieldNames = fields
 	}
 
-	// Parse VALUES (v1, v2, v3)
-	stmt.Values, err = p.parseValues()
+	// Parse SELECT ... or VALUES (v1, v2, v3)
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.SELECT {
+		slct, err := p.parseSelectStatement()
+		if err != nil {
+			return stmt, err
+		}
+		stmt.Select = &slct
+	} else {
+		p.Unscan()
+		stmt.Values, err = p.parseValues()
+		if err != nil {
+			return stmt, err
+		}
+	}
+
+	// Parse ON CONFLICT clause
+	stmt.OnConflict, err = p.parseOnConflict()
+	if err != nil {
+		return stmt, err
+	}
+
+	// Parse RETURNING result fields
+	stmt.Returning, err = p.parseReturning()
 	if err != nil {
 		return stmt, err
 	}
@@ -40,6 +61,52 @@ func (p *Parser) parseInsertStatement() (query.InsertStmt, error) {
 	return stmt, nil
 }
 
+// parseOnConflict parses the "ON CONFLICT DO NOTHING" or "ON CONFLICT DO UPDATE SET ..." clause
+// of the query, if it exists.
+func (p *Parser) parseOnConflict() (*query.OnConflictClause, error) {
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.ON {
+		p.Unscan()
+		return nil, nil
+	}
+
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.CONFLICT {
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"CONFLICT"}, pos)
+	}
+
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.DO {
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"DO"}, pos)
+	}
+
+	tok, pos, lit := p.ScanIgnoreWhitespace()
+	switch tok {
+	case scanner.NOTHING:
+		return &query.OnConflictClause{Action: scanner.NOTHING}, nil
+	case scanner.UPDATE:
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.SET {
+			return nil, newParseError(scanner.Tokstr(tok, lit), []string{"SET"}, pos)
+		}
+
+		pairs, err := p.parseSetClause()
+		if err != nil {
+			return nil, err
+		}
+
+		return &query.OnConflictClause{Action: scanner.UPDATE, Pairs: pairs}, nil
+	}
+
+	return nil, newParseError(scanner.Tokstr(tok, lit), []string{"NOTHING", "UPDATE"}, pos)
+}
+
+// parseReturning parses the "RETURNING" clause of the query, if it exists.
+func (p *Parser) parseReturning() ([]query.ResultField, error) {
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.RETURNING {
+		p.Unscan()
+		return nil, nil
+	}
+
+	return p.parseResultFields()
+}
+
 // parseFieldList parses a list of fields in the form: (field, field, ...), if exists
 func (p *Parser) parseFieldList() ([]string, bool, error) {
 	// Parse ( token.
@@ -67,7 +134,7 @@ func (p *Parser) parseFieldList() ([]string, bool, error) {
 func (p *Parser) parseValues() (query.LiteralExprList, error) {
 	// Check if the VALUES token exists.
 	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.VALUES {
-		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"VALUES"}, pos)
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"VALUES", "SELECT"}, pos)
 	}
 
 	var valuesList query.LiteralExprList
@@ -3,7 +3,9 @@ package parser
 import (
 	"testing"
 
+	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/sql/query"
+	"github.com/asdine/genji/sql/scanner"
 	"github.com/stretchr/testify/require"
 )
 
@@ -68,6 +70,75 @@ func TestParserInsert(t *testing.T) {
 					query.LiteralExprList{query.TextValue("e"), query.TextValue("f")},
 				},
 			}, false},
+		{"Select", "INSERT INTO test SELECT * FROM foo WHERE a < ?",
+			query.InsertStmt{
+				TableName: "test",
+				Select: &query.SelectStmt{
+					Selectors: []query.ResultField{query.Wildcard{}},
+					TableName: "foo",
+					WhereExpr: query.Lt(query.FieldSelector([]string{"a"}), query.PositionalParam(1)),
+				},
+			}, false},
+		{"Select / With columns", "INSERT INTO test (a, b) SELECT c, d FROM foo",
+			query.InsertStmt{
+				TableName:  "test",
+				FieldNames: []string{"a", "b"},
+				Select: &query.SelectStmt{
+					Selectors: []query.ResultField{
+						query.ResultFieldExpr{Expr: query.FieldSelector([]string{"c"}), ExprName: "c"},
+						query.ResultFieldExpr{Expr: query.FieldSelector([]string{"d"}), ExprName: "d"},
+					},
+					TableName: "foo",
+				},
+			}, false},
+		{"Returning", "INSERT INTO test (a) VALUES (1) RETURNING pk(), a AS b",
+			query.InsertStmt{
+				TableName:  "test",
+				FieldNames: []string{"a"},
+				Values: query.LiteralExprList{
+					query.LiteralExprList{query.IntValue(1)},
+				},
+				Returning: []query.ResultField{
+					query.ResultFieldExpr{Expr: &query.PKFunc{}, ExprName: "pk()"},
+					query.ResultFieldExpr{Expr: query.FieldSelector([]string{"a"}), ExprName: "b"},
+				},
+			}, false},
+		{"Select / Returning", "INSERT INTO test SELECT * FROM foo RETURNING *",
+			query.InsertStmt{
+				TableName: "test",
+				Select: &query.SelectStmt{
+					Selectors: []query.ResultField{query.Wildcard{}},
+					TableName: "foo",
+				},
+				Returning: []query.ResultField{query.Wildcard{}},
+			}, false},
+		{"Returning without fields", "INSERT INTO test VALUES {a: 1} RETURNING", nil, true},
+		{"On conflict do nothing", "INSERT INTO test (a) VALUES (1) ON CONFLICT DO NOTHING",
+			query.InsertStmt{
+				TableName:  "test",
+				FieldNames: []string{"a"},
+				Values: query.LiteralExprList{
+					query.LiteralExprList{query.IntValue(1)},
+				},
+				OnConflict: &query.OnConflictClause{Action: scanner.NOTHING},
+			}, false},
+		{"On conflict do update", "INSERT INTO test SELECT * FROM foo ON CONFLICT DO UPDATE SET a = excluded.a RETURNING *",
+			query.InsertStmt{
+				TableName: "test",
+				Select: &query.SelectStmt{
+					Selectors: []query.ResultField{query.Wildcard{}},
+					TableName: "foo",
+				},
+				OnConflict: &query.OnConflictClause{
+					Action: scanner.UPDATE,
+					Pairs: []query.UpdateSetPair{
+						{Path: document.NewValuePath("a"), Expr: query.FieldSelector([]string{"excluded", "a"})},
+					},
+				},
+				Returning: []query.ResultField{query.Wildcard{}},
+			}, false},
+		{"On conflict without action", "INSERT INTO test VALUES {a: 1} ON CONFLICT", nil, true},
+		{"On conflict do update without set", "INSERT INTO test VALUES {a: 1} ON CONFLICT DO UPDATE", nil, true},
 	}
 
 	for _, test := range tests {
@@ -6,11 +6,23 @@ import (
 	"io"
 	"strings"
 
+	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/sql/query"
 	"github.com/asdine/genji/sql/scanner"
 )
 
+// ParseConstraintExpr parses the expression of a DEFAULT or CHECK constraint, or the
+// predicate of a partial index. It is meant to be passed to database.New.
+func ParseConstraintExpr(s string) (database.ConstraintExpr, error) {
+	e, err := ParseExpr(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.ConstraintExpr{Expr: e}, nil
+}
+
 // Parser represents an Genji SQL Parser.
 type Parser struct {
 	s             *scanner.BufScanner
@@ -27,6 +39,22 @@ func NewParser(r io.Reader) *Parser {
 // ParseQuery parses a query string and returns its AST representation.
 func ParseQuery(s string) (query.Query, error) { return NewParser(strings.NewReader(s)).ParseQuery() }
 
+// ParseExpr parses an expression.
+func ParseExpr(s string) (query.Expr, error) {
+	p := NewParser(strings.NewReader(s))
+	e, _, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure the whole string was consumed.
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.EOF {
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"EOF"}, pos)
+	}
+
+	return e, nil
+}
+
 // ParseQuery parses a Genji SQL string and returns a Query.
 func (p *Parser) ParseQuery() (query.Query, error) {
 	var statements []query.Statement
@@ -68,10 +96,23 @@ func (p *Parser) ParseStatement() (query.Statement, error) {
 		return p.parseCreateStatement()
 	case scanner.DROP:
 		return p.parseDropStatement()
+	case scanner.EXPLAIN:
+		return p.parseExplainStatement()
+	case scanner.ANALYZE:
+		return p.parseAnalyzeStatement()
+	case scanner.ALTER:
+		return p.parseAlterStatement()
+	case scanner.SAVEPOINT:
+		return p.parseSavepointStatement()
+	case scanner.ROLLBACK:
+		return p.parseRollbackStatement()
+	case scanner.RELEASE:
+		return p.parseReleaseStatement()
 	}
 
 	return nil, newParseError(scanner.Tokstr(tok, lit), []string{
-		"SELECT", "DELETE", "UPDATE", "INSERT", "CREATE", "DROP",
+		"SELECT", "DELETE", "UPDATE", "INSERT", "CREATE", "DROP", "EXPLAIN", "ANALYZE", "ALTER",
+		"SAVEPOINT", "ROLLBACK", "RELEASE",
 	}, pos)
 }
 
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"github.com/asdine/genji/sql/query"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// parseSavepointStatement parses a savepoint string and returns a Statement AST object.
+// This function assumes the SAVEPOINT token has already been consumed.
+func (p *Parser) parseSavepointStatement() (query.SavepointStmt, error) {
+	var stmt query.SavepointStmt
+	var err error
+
+	// Parse savepoint name
+	stmt.SavepointName, err = p.parseIdent()
+	return stmt, err
+}
+
+// parseRollbackStatement parses a rollback to savepoint string and returns a Statement AST object.
+// This function assumes the ROLLBACK token has already been consumed.
+func (p *Parser) parseRollbackStatement() (query.RollbackToStmt, error) {
+	var stmt query.RollbackToStmt
+	var err error
+
+	// Parse "TO"
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.TO {
+		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"TO"}, pos)
+	}
+
+	// Parse optional "SAVEPOINT"
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.SAVEPOINT {
+		p.Unscan()
+	}
+
+	// Parse savepoint name
+	stmt.SavepointName, err = p.parseIdent()
+	return stmt, err
+}
+
+// parseReleaseStatement parses a release savepoint string and returns a Statement AST object.
+// This function assumes the RELEASE token has already been consumed.
+func (p *Parser) parseReleaseStatement() (query.ReleaseStmt, error) {
+	var stmt query.ReleaseStmt
+	var err error
+
+	// Parse optional "SAVEPOINT"
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.SAVEPOINT {
+		p.Unscan()
+	}
+
+	// Parse savepoint name
+	stmt.SavepointName, err = p.parseIdent()
+	return stmt, err
+}
@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/sql/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserSavepoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected query.Statement
+		errored  bool
+	}{
+		{"Savepoint", "SAVEPOINT foo", query.SavepointStmt{SavepointName: "foo"}, false},
+		{"Savepoint without name", "SAVEPOINT", nil, true},
+		{"Rollback to", "ROLLBACK TO foo", query.RollbackToStmt{SavepointName: "foo"}, false},
+		{"Rollback to savepoint", "ROLLBACK TO SAVEPOINT foo", query.RollbackToStmt{SavepointName: "foo"}, false},
+		{"Rollback without TO", "ROLLBACK foo", nil, true},
+		{"Release", "RELEASE foo", query.ReleaseStmt{SavepointName: "foo"}, false},
+		{"Release savepoint", "RELEASE SAVEPOINT foo", query.ReleaseStmt{SavepointName: "foo"}, false},
+		{"Release without name", "RELEASE SAVEPOINT", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := ParseQuery(test.s)
+			if test.errored {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, q.Statements, 1)
+			require.EqualValues(t, test.expected, q.Statements[0])
+		})
+	}
+}
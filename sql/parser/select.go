@@ -17,9 +17,8 @@ func (p *Parser) parseSelectStatement() (query.SelectStmt, error) {
 		return stmt, err
 	}
 
-	// Parse "FROM".
-	var found bool
-	stmt.TableName, found, err = p.parseFrom()
+	// Parse "FROM table|(SELECT ...) [[AS] alias] [JOIN ...]*".
+	found, err := p.parseFrom(&stmt)
 	if err != nil || !found {
 		return stmt, err
 	}
@@ -30,8 +29,20 @@ func (p *Parser) parseSelectStatement() (query.SelectStmt, error) {
 		return stmt, err
 	}
 
-	// Parse order by: "ORDER BY fieldRef [ASC|DESC]?"
-	stmt.OrderBy, stmt.OrderByDirection, err = p.parseOrderBy()
+	// Parse group by: "GROUP BY fieldRef"
+	stmt.GroupBy, err = p.parseGroupBy()
+	if err != nil {
+		return stmt, err
+	}
+
+	// Parse having: "HAVING EXPR"
+	stmt.HavingExpr, err = p.parseHaving()
+	if err != nil {
+		return stmt, err
+	}
+
+	// Parse order by: "ORDER BY fieldRef [ASC|DESC]? [, fieldRef [ASC|DESC]?]*"
+	stmt.OrderBy, err = p.parseOrderBy()
 	if err != nil {
 		return stmt, err
 	}
@@ -48,6 +59,12 @@ func (p *Parser) parseSelectStatement() (query.SelectStmt, error) {
 		return stmt, err
 	}
 
+	// Without joins, the documents are those of the table:
+	// fields prefixed by the alias refer to the fields of the document.
+	if len(stmt.Joins) == 0 && stmt.TableAlias != "" {
+		stripTableAlias(&stmt)
+	}
+
 	return stmt, nil
 }
 
@@ -104,42 +121,180 @@ func (p *Parser) parseResultField() (query.ResultField, error) {
 	return rf, nil
 }
 
-func (p *Parser) parseFrom() (string, bool, error) {
+func (p *Parser) parseFrom(stmt *query.SelectStmt) (bool, error) {
 	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.FROM {
 		p.Unscan()
-		return "", false, nil
+		return false, nil
 	}
 
-	// Parse table name
-	ident, err := p.parseIdent()
-	return ident, true, err
+	// Parse table name and alias, or a subquery: "(SELECT ...) [[AS] alias]"
+	var err error
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.LPAREN {
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.SELECT {
+			return true, newParseError(scanner.Tokstr(tok, lit), []string{"SELECT"}, pos)
+		}
+
+		sub, err := p.parseSubquery()
+		if err != nil {
+			return true, err
+		}
+		stmt.FromSubquery = &sub
+
+		stmt.TableAlias, err = p.parseAlias()
+	} else {
+		p.Unscan()
+		stmt.TableName, stmt.TableAlias, err = p.parseTableRef()
+	}
+	if err != nil {
+		return true, err
+	}
+
+	// Parse joined tables
+	for {
+		jc, found, err := p.parseJoin()
+		if err != nil || !found {
+			return true, err
+		}
+
+		stmt.Joins = append(stmt.Joins, jc)
+	}
 }
 
-func (p *Parser) parseOrderBy() (query.FieldSelector, scanner.Token, error) {
-	// parse ORDER token
-	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.ORDER {
+// parseTableRef parses a table name followed by an optional alias: "table [[AS] alias]".
+func (p *Parser) parseTableRef() (name, alias string, err error) {
+	name, err = p.parseIdent()
+	if err != nil {
+		return
+	}
+
+	alias, err = p.parseAlias()
+	return
+}
+
+// parseAlias parses an optional alias: "[[AS] alias]".
+func (p *Parser) parseAlias() (string, error) {
+	switch tok, _, lit := p.ScanIgnoreWhitespace(); tok {
+	case scanner.AS:
+		return p.parseIdent()
+	case scanner.IDENT:
+		return lit, nil
+	default:
+		p.Unscan()
+		return "", nil
+	}
+}
+
+// parseJoin parses a join clause: "[INNER | LEFT [OUTER]] JOIN table [[AS] alias] ON expr".
+func (p *Parser) parseJoin() (query.JoinClause, bool, error) {
+	var jc query.JoinClause
+
+	switch tok, _, _ := p.ScanIgnoreWhitespace(); tok {
+	case scanner.JOIN:
+		p.Unscan()
+		jc.Type = scanner.INNER
+	case scanner.INNER:
+		jc.Type = scanner.INNER
+	case scanner.LEFT:
+		jc.Type = scanner.LEFT
+
+		// parse optional OUTER token
+		if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.OUTER {
+			p.Unscan()
+		}
+	default:
+		p.Unscan()
+		return jc, false, nil
+	}
+
+	// parse JOIN token
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.JOIN {
+		return jc, true, newParseError(scanner.Tokstr(tok, lit), []string{"JOIN"}, pos)
+	}
+
+	var err error
+	jc.TableName, jc.TableAlias, err = p.parseTableRef()
+	if err != nil {
+		return jc, true, err
+	}
+
+	// parse ON token
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.ON {
+		return jc, true, newParseError(scanner.Tokstr(tok, lit), []string{"ON"}, pos)
+	}
+
+	jc.On, _, err = p.parseExpr()
+	return jc, true, err
+}
+
+func (p *Parser) parseGroupBy() (query.FieldSelector, error) {
+	// parse GROUP token
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.GROUP {
 		p.Unscan()
-		return nil, 0, nil
+		return nil, nil
 	}
 
 	// parse BY token
 	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.BY {
-		return nil, 0, newParseError(scanner.Tokstr(tok, lit), []string{"BY"}, pos)
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"BY"}, pos)
 	}
 
 	// parse field reference
 	ref, err := p.parseFieldRef()
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	// parse optional ASC or DESC
-	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.ASC || tok == scanner.DESC {
-		return query.FieldSelector(ref), tok, nil
+	return query.FieldSelector(ref), nil
+}
+
+func (p *Parser) parseHaving() (query.Expr, error) {
+	// parse HAVING token
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.HAVING {
+		p.Unscan()
+		return nil, nil
 	}
-	p.Unscan()
 
-	return query.FieldSelector(ref), 0, nil
+	e, _, err := p.parseExpr()
+	return e, err
+}
+
+func (p *Parser) parseOrderBy() ([]query.OrderByField, error) {
+	// parse ORDER token
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.ORDER {
+		p.Unscan()
+		return nil, nil
+	}
+
+	// parse BY token
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.BY {
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"BY"}, pos)
+	}
+
+	var fields []query.OrderByField
+	for {
+		// parse field reference
+		ref, err := p.parseFieldRef()
+		if err != nil {
+			return nil, err
+		}
+
+		f := query.OrderByField{Field: query.FieldSelector(ref)}
+
+		// parse optional ASC or DESC
+		if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.ASC || tok == scanner.DESC {
+			f.Direction = tok
+		} else {
+			p.Unscan()
+		}
+
+		fields = append(fields, f)
+
+		// parse other fields, if any
+		if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.COMMA {
+			p.Unscan()
+			return fields, nil
+		}
+	}
 }
 
 func (p *Parser) parseLimit() (query.Expr, error) {
@@ -163,3 +318,71 @@ func (p *Parser) parseOffset() (query.Expr, error) {
 	e, _, err := p.parseExpr()
 	return e, err
 }
+
+// stripTableAlias removes the alias of the table from the fields referenced by the statement,
+// i.e. t.a becomes a.
+func stripTableAlias(stmt *query.SelectStmt) {
+	alias := stmt.TableAlias
+
+	for i, rf := range stmt.Selectors {
+		if e, ok := rf.(query.ResultFieldExpr); ok {
+			e.Expr = stripAlias(e.Expr, alias)
+			stmt.Selectors[i] = e
+		}
+	}
+
+	stmt.WhereExpr = stripAlias(stmt.WhereExpr, alias)
+	stmt.HavingExpr = stripAlias(stmt.HavingExpr, alias)
+
+	if stmt.GroupBy != nil {
+		stmt.GroupBy = stripAlias(stmt.GroupBy, alias).(query.FieldSelector)
+	}
+
+	for i := range stmt.OrderBy {
+		stmt.OrderBy[i].Field = stripAlias(stmt.OrderBy[i].Field, alias).(query.FieldSelector)
+	}
+}
+
+// stripAlias removes the alias from the field selectors of e.
+// Operators and functions are modified in place.
+func stripAlias(e query.Expr, alias string) query.Expr {
+	switch t := e.(type) {
+	case query.FieldSelector:
+		if len(t) > 1 && t[0] == alias {
+			return t[1:]
+		}
+	case operator:
+		if l := t.LeftHand(); l != nil {
+			t.SetLeftHandExpr(stripAlias(l, alias))
+		}
+		if r := t.RightHand(); r != nil {
+			t.SetRightHandExpr(stripAlias(r, alias))
+		}
+	case query.Cast:
+		t.Expr = stripAlias(t.Expr, alias)
+		return t
+	case query.Parentheses:
+		t.E = stripAlias(t.E, alias)
+		return t
+	case query.LiteralExprList:
+		for i := range t {
+			t[i] = stripAlias(t[i], alias)
+		}
+	case query.KVPairs:
+		for i := range t {
+			t[i].V = stripAlias(t[i].V, alias)
+		}
+	case *query.CountFunc:
+		t.Expr = stripAlias(t.Expr, alias)
+	case *query.SumFunc:
+		t.Expr = stripAlias(t.Expr, alias)
+	case *query.AvgFunc:
+		t.Expr = stripAlias(t.Expr, alias)
+	case *query.MinFunc:
+		t.Expr = stripAlias(t.Expr, alias)
+	case *query.MaxFunc:
+		t.Expr = stripAlias(t.Expr, alias)
+	}
+
+	return e
+}
@@ -50,29 +50,57 @@ func TestParserSelect(t *testing.T) {
 				Selectors: []query.ResultField{query.Wildcard{}},
 				WhereExpr: query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10)),
 			}, false},
+		{"WithGroupBy", "SELECT a.b, COUNT(*) FROM test WHERE age = 10 GROUP BY a.b",
+			query.SelectStmt{
+				TableName: "test",
+				Selectors: []query.ResultField{
+					query.ResultFieldExpr{Expr: query.FieldSelector([]string{"a", "b"}), ExprName: "a.b"},
+					query.ResultFieldExpr{Expr: &query.CountFunc{Wildcard: true}, ExprName: "COUNT(*)"},
+				},
+				WhereExpr: query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10)),
+				GroupBy:   []string{"a", "b"},
+			}, false},
+		{"WithGroupBy and Having", "SELECT a FROM test GROUP BY a HAVING COUNT(*) > 10 ORDER BY a",
+			query.SelectStmt{
+				TableName:  "test",
+				Selectors:  []query.ResultField{query.ResultFieldExpr{Expr: query.FieldSelector([]string{"a"}), ExprName: "a"}},
+				GroupBy:    []string{"a"},
+				HavingExpr: query.Gt(&query.CountFunc{Wildcard: true}, query.IntValue(10)),
+				OrderBy:    []query.OrderByField{{Field: []string{"a"}}},
+			}, false},
+		{"WithGroupBy without BY", "SELECT a FROM test GROUP a", nil, true},
 		{"WithOrderBy", "SELECT * FROM test WHERE age = 10 ORDER BY a.b.c",
 			query.SelectStmt{
 				TableName: "test",
 				Selectors: []query.ResultField{query.Wildcard{}},
 				WhereExpr: query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10)),
-				OrderBy:   []string{"a", "b", "c"},
+				OrderBy:   []query.OrderByField{{Field: []string{"a", "b", "c"}}},
 			}, false},
 		{"WithOrderBy ASC", "SELECT * FROM test WHERE age = 10 ORDER BY a.b.c ASC",
 			query.SelectStmt{
-				TableName:        "test",
-				Selectors:        []query.ResultField{query.Wildcard{}},
-				WhereExpr:        query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10)),
-				OrderBy:          []string{"a", "b", "c"},
-				OrderByDirection: scanner.ASC,
+				TableName: "test",
+				Selectors: []query.ResultField{query.Wildcard{}},
+				WhereExpr: query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10)),
+				OrderBy:   []query.OrderByField{{Field: []string{"a", "b", "c"}, Direction: scanner.ASC}},
 			}, false},
 		{"WithOrderBy DESC", "SELECT * FROM test WHERE age = 10 ORDER BY a.b.c DESC",
 			query.SelectStmt{
-				TableName:        "test",
-				Selectors:        []query.ResultField{query.Wildcard{}},
-				WhereExpr:        query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10)),
-				OrderBy:          []string{"a", "b", "c"},
-				OrderByDirection: scanner.DESC,
+				TableName: "test",
+				Selectors: []query.ResultField{query.Wildcard{}},
+				WhereExpr: query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10)),
+				OrderBy:   []query.OrderByField{{Field: []string{"a", "b", "c"}, Direction: scanner.DESC}},
+			}, false},
+		{"WithOrderBy multiple fields", "SELECT * FROM test ORDER BY a DESC, b.c, d ASC",
+			query.SelectStmt{
+				TableName: "test",
+				Selectors: []query.ResultField{query.Wildcard{}},
+				OrderBy: []query.OrderByField{
+					{Field: []string{"a"}, Direction: scanner.DESC},
+					{Field: []string{"b", "c"}},
+					{Field: []string{"d"}, Direction: scanner.ASC},
+				},
 			}, false},
+		{"WithOrderBy trailing comma", "SELECT * FROM test ORDER BY a,", nil, true},
 		{"WithLimit", "SELECT * FROM test WHERE age = 10 LIMIT 20",
 			query.SelectStmt{
 				Selectors: []query.ResultField{query.Wildcard{}},
@@ -96,6 +124,58 @@ func TestParserSelect(t *testing.T) {
 				LimitExpr:  query.IntValue(10),
 			}, false},
 		{"WithOffsetThenLimit", "SELECT * FROM test WHERE age = 10 OFFSET 20 LIMIT 10", nil, true},
+		{"WithTableAlias", "SELECT t.a FROM test AS t WHERE t.b.c = 10 ORDER BY t.d",
+			query.SelectStmt{
+				Selectors:  []query.ResultField{query.ResultFieldExpr{Expr: query.FieldSelector([]string{"a"}), ExprName: "t.a"}},
+				TableName:  "test",
+				TableAlias: "t",
+				WhereExpr:  query.Eq(query.FieldSelector([]string{"b", "c"}), query.IntValue(10)),
+				OrderBy:    []query.OrderByField{{Field: []string{"d"}}},
+			}, false},
+		{"WithTableAlias without AS", "SELECT COUNT(t.a) FROM test t GROUP BY t.b",
+			query.SelectStmt{
+				Selectors:  []query.ResultField{query.ResultFieldExpr{Expr: &query.CountFunc{Expr: query.FieldSelector([]string{"a"})}, ExprName: "COUNT(t.a)"}},
+				TableName:  "test",
+				TableAlias: "t",
+				GroupBy:    query.FieldSelector([]string{"b"}),
+			}, false},
+		{"WithJoin", "SELECT u.name, o.total FROM users u JOIN orders AS o ON o.user_id = u.id WHERE o.total > 10",
+			query.SelectStmt{
+				Selectors: []query.ResultField{
+					query.ResultFieldExpr{Expr: query.FieldSelector([]string{"u", "name"}), ExprName: "u.name"},
+					query.ResultFieldExpr{Expr: query.FieldSelector([]string{"o", "total"}), ExprName: "o.total"},
+				},
+				TableName:  "users",
+				TableAlias: "u",
+				Joins: []query.JoinClause{
+					{Type: scanner.INNER, TableName: "orders", TableAlias: "o", On: query.Eq(query.FieldSelector([]string{"o", "user_id"}), query.FieldSelector([]string{"u", "id"}))},
+				},
+				WhereExpr: query.Gt(query.FieldSelector([]string{"o", "total"}), query.IntValue(10)),
+			}, false},
+		{"WithJoins", "SELECT * FROM a INNER JOIN b ON a.x = b.x LEFT OUTER JOIN c ON c.y = b.y LEFT JOIN d ON d.z = 1",
+			query.SelectStmt{
+				Selectors: []query.ResultField{query.Wildcard{}},
+				TableName: "a",
+				Joins: []query.JoinClause{
+					{Type: scanner.INNER, TableName: "b", On: query.Eq(query.FieldSelector([]string{"a", "x"}), query.FieldSelector([]string{"b", "x"}))},
+					{Type: scanner.LEFT, TableName: "c", On: query.Eq(query.FieldSelector([]string{"c", "y"}), query.FieldSelector([]string{"b", "y"}))},
+					{Type: scanner.LEFT, TableName: "d", On: query.Eq(query.FieldSelector([]string{"d", "z"}), query.IntValue(1))},
+				},
+			}, false},
+		{"WithJoin without ON", "SELECT * FROM a JOIN b", nil, true},
+		{"FromSubquery", "SELECT s.a FROM (SELECT a FROM test WHERE b = 1) AS s WHERE s.a > 2",
+			query.SelectStmt{
+				Selectors: []query.ResultField{query.ResultFieldExpr{Expr: query.FieldSelector([]string{"a"}), ExprName: "s.a"}},
+				FromSubquery: &query.SelectStmt{
+					Selectors: []query.ResultField{query.ResultFieldExpr{Expr: query.FieldSelector([]string{"a"}), ExprName: "a"}},
+					TableName: "test",
+					WhereExpr: query.Eq(query.FieldSelector([]string{"b"}), query.IntValue(1)),
+				},
+				TableAlias: "s",
+				WhereExpr:  query.Gt(query.FieldSelector([]string{"a"}), query.IntValue(2)),
+			}, false},
+		{"FromSubquery without SELECT", "SELECT * FROM (test)", nil, true},
+		{"WithLeft without JOIN", "SELECT * FROM a LEFT b ON a.x = b.x", nil, true},
 	}
 
 	for _, test := range tests {
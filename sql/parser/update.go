@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/sql/query"
 	"github.com/asdine/genji/sql/scanner"
 )
@@ -17,8 +18,16 @@ func (p *Parser) parseUpdateStatement() (query.UpdateStmt, error) {
 		return stmt, err
 	}
 
-	// Parse assignment: "SET field = EXPR".
-	stmt.Pairs, err = p.parseSetClause()
+	// Parse clause: SET or UNSET.
+	tok, pos, lit := p.ScanIgnoreWhitespace()
+	switch tok {
+	case scanner.SET:
+		stmt.Pairs, err = p.parseSetClause()
+	case scanner.UNSET:
+		stmt.UnsetFields, err = p.parseUnsetClause()
+	default:
+		err = newParseError(scanner.Tokstr(tok, lit), []string{"SET", "UNSET"}, pos)
+	}
 	if err != nil {
 		return stmt, err
 	}
@@ -33,13 +42,9 @@ func (p *Parser) parseUpdateStatement() (query.UpdateStmt, error) {
 }
 
 // parseSetClause parses the "SET" clause of the query.
-func (p *Parser) parseSetClause() (map[string]query.Expr, error) {
-	// Check if the SET token exists.
-	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.SET {
-		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"SET"}, pos)
-	}
-
-	pairs := make(map[string]query.Expr)
+// This function assumes the SET token has already been consumed.
+func (p *Parser) parseSetClause() ([]query.UpdateSetPair, error) {
+	var pairs []query.UpdateSetPair
 
 	firstPair := true
 	for {
@@ -52,10 +57,10 @@ func (p *Parser) parseSetClause() (map[string]query.Expr, error) {
 			}
 		}
 
-		// Scan the identifier for the field name.
-		tok, pos, lit := p.ScanIgnoreWhitespace()
-		if tok != scanner.IDENT {
-			return nil, newParseError(scanner.Tokstr(tok, lit), []string{"identifier"}, pos)
+		// Scan the path of the field.
+		path, err := p.parseFieldRef()
+		if err != nil {
+			return nil, err
 		}
 
 		// Scan the eq sign
@@ -68,10 +73,39 @@ func (p *Parser) parseSetClause() (map[string]query.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		pairs[lit] = expr
+		pairs = append(pairs, query.UpdateSetPair{Path: path, Expr: expr})
 
 		firstPair = false
 	}
 
 	return pairs, nil
 }
+
+// parseUnsetClause parses the "UNSET" clause of the query.
+// This function assumes the UNSET token has already been consumed.
+func (p *Parser) parseUnsetClause() ([]document.ValuePath, error) {
+	var paths []document.ValuePath
+
+	firstPath := true
+	for {
+		if !firstPath {
+			// Scan for a comma.
+			tok, _, _ := p.ScanIgnoreWhitespace()
+			if tok != scanner.COMMA {
+				p.Unscan()
+				break
+			}
+		}
+
+		// Scan the path of the field.
+		path, err := p.parseFieldRef()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+
+		firstPath = false
+	}
+
+	return paths, nil
+}
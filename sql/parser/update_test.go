@@ -3,6 +3,7 @@ package parser
 import (
 	"testing"
 
+	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/sql/query"
 	"github.com/stretchr/testify/require"
 )
@@ -17,22 +18,52 @@ func TestParserUdpate(t *testing.T) {
 		{"No cond", "UPDATE test SET a = 1",
 			query.UpdateStmt{
 				TableName: "test",
-				Pairs: map[string]query.Expr{
-					"a": query.IntValue(1),
+				Pairs: []query.UpdateSetPair{
+					{Path: document.NewValuePath("a"), Expr: query.IntValue(1)},
 				},
 			},
 			false},
 		{"With cond", "UPDATE test SET a = 1, b = 2 WHERE age = 10",
 			query.UpdateStmt{
 				TableName: "test",
-				Pairs: map[string]query.Expr{
-					"a": query.IntValue(1),
-					"b": query.IntValue(2),
+				Pairs: []query.UpdateSetPair{
+					{Path: document.NewValuePath("a"), Expr: query.IntValue(1)},
+					{Path: document.NewValuePath("b"), Expr: query.IntValue(2)},
 				},
 				WhereExpr: query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10)),
 			},
 			false},
+		{"Paths", "UPDATE test SET a.b = a.b + 1, c.0 = 2",
+			query.UpdateStmt{
+				TableName: "test",
+				Pairs: []query.UpdateSetPair{
+					{Path: document.NewValuePath("a.b"), Expr: query.Add(query.FieldSelector([]string{"a", "b"}), query.IntValue(1))},
+					{Path: document.NewValuePath("c.0"), Expr: query.IntValue(2)},
+				},
+			},
+			false},
+		{"Bracket indexes", "UPDATE test SET tags[2] = 'x', a.b[0].c = tags[1]",
+			query.UpdateStmt{
+				TableName: "test",
+				Pairs: []query.UpdateSetPair{
+					{Path: document.NewValuePath("tags.2"), Expr: query.TextValue("x")},
+					{Path: document.NewValuePath("a.b.0.c"), Expr: query.FieldSelector([]string{"tags", "1"})},
+				},
+			},
+			false},
+		{"Unset", "UPDATE test UNSET a, b.c.1 WHERE age = 10",
+			query.UpdateStmt{
+				TableName:   "test",
+				UnsetFields: []document.ValuePath{document.NewValuePath("a"), document.NewValuePath("b.c.1")},
+				WhereExpr:   query.Eq(query.FieldSelector([]string{"age"}), query.IntValue(10)),
+			},
+			false},
 		{"Trailing comma", "UPDATE test SET a = 1, WHERE age = 10", nil, true},
+		{"Unset trailing comma", "UPDATE test UNSET a, WHERE age = 10", nil, true},
+		{"Unset value", "UPDATE test UNSET a = 1", nil, true},
+		{"Bracket without index", "UPDATE test SET tags[] = 1", nil, true},
+		{"Bracket with field", "UPDATE test SET tags[a] = 1", nil, true},
+		{"Unclosed bracket", "UPDATE test SET tags[1 = 1", nil, true},
 		{"No SET", "UPDATE test WHERE age = 10", nil, true},
 		{"No pair", "UPDATE test SET WHERE age = 10", nil, true},
 		{"query.Field only", "UPDATE test SET a WHERE age = 10", nil, true},
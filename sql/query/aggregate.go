@@ -0,0 +1,477 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+	"github.com/asdine/genji/index"
+)
+
+// An AggregatorBuilder is an aggregate function. It creates an Aggregator
+// every time a stream is aggregated.
+// When evaluated, it returns the result computed by its aggregator.
+type AggregatorBuilder interface {
+	Expr
+
+	Aggregator() Aggregator
+}
+
+// An Aggregator consumes the documents of a stream and computes
+// the result of an aggregate function.
+type Aggregator interface {
+	// Aggregate is called for every document of the stream.
+	Aggregate(stack EvalStack) error
+	// Result returns the result of the aggregation.
+	Result() (document.Value, error)
+}
+
+// aggregatedDocument is the document returned after aggregating a stream.
+// Aggregate functions read their result from it,
+// any other expression is evaluated against the first document of the stream.
+type aggregatedDocument struct {
+	document.Document
+
+	key     []byte
+	results map[AggregatorBuilder]document.Value
+}
+
+// Key returns the key of the first document of the stream.
+func (d *aggregatedDocument) Key() []byte {
+	return d.key
+}
+
+func aggregateResult(a AggregatorBuilder, stack EvalStack) (document.Value, error) {
+	if d, ok := stack.Document.(*aggregatedDocument); ok {
+		if v, ok := d.results[a]; ok {
+			return v, nil
+		}
+	}
+
+	return nilLitteral, errors.New("misuse of aggregate function")
+}
+
+// aggregateIterator consumes a stream and returns only one document
+// containing the result of every aggregate function.
+type aggregateIterator struct {
+	st       document.Stream
+	builders []AggregatorBuilder
+	stack    EvalStack
+}
+
+func (it aggregateIterator) Iterate(fn func(d document.Document) error) error {
+	var g *group
+
+	stack := it.stack
+	err := it.st.Iterate(func(d document.Document) error {
+		if g == nil {
+			var err error
+			g, err = newGroup(d, it.builders)
+			if err != nil {
+				return err
+			}
+		}
+
+		stack.Document = d
+		return g.aggregate(stack)
+	})
+	if err != nil {
+		return err
+	}
+
+	// an empty stream still returns one document
+	if g == nil {
+		g, err = newGroup(document.NewFieldBuffer(), it.builders)
+		if err != nil {
+			return err
+		}
+	}
+
+	d, err := g.document()
+	if err != nil {
+		return err
+	}
+
+	return fn(d)
+}
+
+// A group holds the aggregators of a set of documents,
+// as well as a copy of the first document of the set.
+type group struct {
+	first    document.Document
+	key      []byte
+	builders []AggregatorBuilder
+	aggs     []Aggregator
+}
+
+func newGroup(d document.Document, builders []AggregatorBuilder) (*group, error) {
+	// the document might not be valid after the iteration
+	data, err := encoding.EncodeDocument(d)
+	if err != nil {
+		return nil, err
+	}
+
+	g := group{
+		first:    encoding.EncodedDocument(data),
+		builders: builders,
+		aggs:     make([]Aggregator, len(builders)),
+	}
+
+	if k, ok := d.(document.Keyer); ok {
+		g.key = append([]byte{}, k.Key()...)
+	}
+
+	for i, b := range builders {
+		g.aggs[i] = b.Aggregator()
+	}
+
+	return &g, nil
+}
+
+func (g *group) aggregate(stack EvalStack) error {
+	for _, a := range g.aggs {
+		err := a.Aggregate(stack)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// document returns the result of the aggregation.
+func (g *group) document() (*aggregatedDocument, error) {
+	results := make(map[AggregatorBuilder]document.Value, len(g.aggs))
+
+	var err error
+	for i, a := range g.aggs {
+		results[g.builders[i]], err = a.Result()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &aggregatedDocument{
+		Document: g.first,
+		key:      g.key,
+		results:  results,
+	}, nil
+}
+
+// aggregatorBuilders returns the aggregate functions used by the given result fields.
+func aggregatorBuilders(rfs []ResultField) []AggregatorBuilder {
+	var builders []AggregatorBuilder
+
+	for _, rf := range rfs {
+		if re, ok := rf.(ResultFieldExpr); ok {
+			builders = collectAggregatorBuilders(re.Expr, builders)
+		}
+	}
+
+	return builders
+}
+
+func collectAggregatorBuilders(e Expr, builders []AggregatorBuilder) []AggregatorBuilder {
+	switch t := e.(type) {
+	case AggregatorBuilder:
+		return append(builders, t)
+	case interface {
+		LeftHand() Expr
+		RightHand() Expr
+	}:
+		if l := t.LeftHand(); l != nil {
+			builders = collectAggregatorBuilders(l, builders)
+		}
+		if r := t.RightHand(); r != nil {
+			builders = collectAggregatorBuilders(r, builders)
+		}
+	case Cast:
+		builders = collectAggregatorBuilders(t.Expr, builders)
+	case Parentheses:
+		builders = collectAggregatorBuilders(t.E, builders)
+	case LiteralExprList:
+		for _, e := range t {
+			builders = collectAggregatorBuilders(e, builders)
+		}
+	case KVPairs:
+		for _, kv := range t {
+			builders = collectAggregatorBuilders(kv.V, builders)
+		}
+	}
+
+	return builders
+}
+
+func aggregateFuncArg(name string, args []Expr) (Expr, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s() takes 1 argument", name)
+	}
+
+	if _, ok := args[0].(Wildcard); ok {
+		return nil, fmt.Errorf("%s(*) is not supported", name)
+	}
+
+	return args[0], nil
+}
+
+// CountFunc represents the COUNT() aggregate function.
+// COUNT(*) counts the documents of the stream, COUNT(expr) counts the documents
+// for which expr evaluates to a value other than NULL.
+type CountFunc struct {
+	Expr     Expr
+	Wildcard bool
+}
+
+// Eval returns the result of the aggregation.
+func (c *CountFunc) Eval(stack EvalStack) (document.Value, error) {
+	return aggregateResult(c, stack)
+}
+
+// Aggregator returns a counter.
+func (c *CountFunc) Aggregator() Aggregator {
+	return &countAggregator{fn: c}
+}
+
+type countAggregator struct {
+	fn    *CountFunc
+	count int64
+}
+
+func (c *countAggregator) Aggregate(stack EvalStack) error {
+	if c.fn.Wildcard {
+		c.count++
+		return nil
+	}
+
+	v, err := c.fn.Expr.Eval(stack)
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+
+	if err == nil && v.Type != document.NullValue {
+		c.count++
+	}
+
+	return nil
+}
+
+func (c *countAggregator) Result() (document.Value, error) {
+	return document.NewInt64Value(c.count), nil
+}
+
+// SumFunc represents the SUM() aggregate function.
+// It adds up all the numeric values and ignores the others.
+// If there are no numeric values, it returns NULL.
+type SumFunc struct {
+	Expr Expr
+}
+
+// Eval returns the result of the aggregation.
+func (s *SumFunc) Eval(stack EvalStack) (document.Value, error) {
+	return aggregateResult(s, stack)
+}
+
+// Aggregator returns an aggregator that sums values.
+func (s *SumFunc) Aggregator() Aggregator {
+	return &sumAggregator{expr: s.Expr, sum: nilLitteral}
+}
+
+type sumAggregator struct {
+	expr Expr
+	sum  document.Value
+}
+
+func (s *sumAggregator) Aggregate(stack EvalStack) error {
+	v, err := s.expr.Eval(stack)
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+	if err != nil || !v.Type.IsNumber() {
+		return nil
+	}
+
+	if s.sum.Type == document.NullValue {
+		s.sum = v
+		return nil
+	}
+
+	s.sum, err = s.sum.Add(v)
+	return err
+}
+
+func (s *sumAggregator) Result() (document.Value, error) {
+	return s.sum, nil
+}
+
+// AvgFunc represents the AVG() aggregate function.
+// It returns the average of all the numeric values as a float64 and ignores the others.
+// If there are no numeric values, it returns NULL.
+type AvgFunc struct {
+	Expr Expr
+}
+
+// Eval returns the result of the aggregation.
+func (s *AvgFunc) Eval(stack EvalStack) (document.Value, error) {
+	return aggregateResult(s, stack)
+}
+
+// Aggregator returns an aggregator that computes the average of values.
+func (s *AvgFunc) Aggregator() Aggregator {
+	return &avgAggregator{expr: s.Expr}
+}
+
+type avgAggregator struct {
+	expr  Expr
+	sum   float64
+	count int64
+}
+
+func (s *avgAggregator) Aggregate(stack EvalStack) error {
+	v, err := s.expr.Eval(stack)
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+	if err != nil || !v.Type.IsNumber() {
+		return nil
+	}
+
+	f, err := v.ConvertToFloat64()
+	if err != nil {
+		return err
+	}
+
+	s.sum += f
+	s.count++
+	return nil
+}
+
+func (s *avgAggregator) Result() (document.Value, error) {
+	if s.count == 0 {
+		return nilLitteral, nil
+	}
+
+	return document.NewFloat64Value(s.sum / float64(s.count)), nil
+}
+
+// MinFunc represents the MIN() aggregate function.
+// Values are ordered the same way they are in an index: booleans first,
+// then numbers, then texts and blobs. NULL values, documents and arrays are ignored.
+// If there are no values, it returns NULL.
+type MinFunc struct {
+	Expr Expr
+}
+
+// Eval returns the result of the aggregation.
+func (m *MinFunc) Eval(stack EvalStack) (document.Value, error) {
+	return aggregateResult(m, stack)
+}
+
+// Aggregator returns an aggregator that selects the smallest value.
+func (m *MinFunc) Aggregator() Aggregator {
+	return &minMaxAggregator{expr: m.Expr, min: true, v: nilLitteral}
+}
+
+// MaxFunc represents the MAX() aggregate function.
+// Values are ordered the same way they are in an index: booleans first,
+// then numbers, then texts and blobs. NULL values, documents and arrays are ignored.
+// If there are no values, it returns NULL.
+type MaxFunc struct {
+	Expr Expr
+}
+
+// Eval returns the result of the aggregation.
+func (m *MaxFunc) Eval(stack EvalStack) (document.Value, error) {
+	return aggregateResult(m, stack)
+}
+
+// Aggregator returns an aggregator that selects the largest value.
+func (m *MaxFunc) Aggregator() Aggregator {
+	return &minMaxAggregator{expr: m.Expr, v: nilLitteral}
+}
+
+type minMaxAggregator struct {
+	expr Expr
+	min  bool
+	v    document.Value
+}
+
+func (m *minMaxAggregator) Aggregate(stack EvalStack) error {
+	v, err := m.expr.Eval(stack)
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+	if err != nil || index.NewTypeFromValueType(v.Type) == index.Null {
+		return nil
+	}
+
+	if m.v.Type == document.NullValue {
+		m.v, err = copyValue(v)
+		return err
+	}
+
+	var ok bool
+	if m.min {
+		ok, err = isIndexOrderLesser(v, m.v)
+	} else {
+		ok, err = isIndexOrderLesser(m.v, v)
+	}
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		m.v, err = copyValue(v)
+	}
+
+	return err
+}
+
+func (m *minMaxAggregator) Result() (document.Value, error) {
+	return m.v, nil
+}
+
+// isIndexOrderLesser returns true if a is stored before b in an index.
+func isIndexOrderLesser(a, b document.Value) (bool, error) {
+	ta, tb := index.NewTypeFromValueType(a.Type), index.NewTypeFromValueType(b.Type)
+	if ta != tb {
+		return ta < tb, nil
+	}
+
+	return a.IsLesserThan(b)
+}
+
+// copyValue makes sure the returned value doesn't share memory
+// with the document it was read from.
+func copyValue(v document.Value) (document.Value, error) {
+	switch v.Type {
+	case document.TextValue:
+		s, err := v.ConvertToText()
+		if err != nil {
+			return v, err
+		}
+		return document.NewTextValue(s), nil
+	case document.BlobValue:
+		b, err := v.ConvertToBlob()
+		if err != nil {
+			return v, err
+		}
+		return document.NewBlobValue(append([]byte{}, b...)), nil
+	case document.DocumentValue:
+		var fb document.FieldBuffer
+		err := fb.Copy(v.V.(document.Document))
+		if err != nil {
+			return v, err
+		}
+		return document.NewDocumentValue(&fb), nil
+	case document.ArrayValue:
+		var vb document.ValueBuffer
+		err := vb.Copy(v.V.(document.Array))
+		if err != nil {
+			return v, err
+		}
+		return document.NewArrayValue(&vb), nil
+	}
+
+	return v, nil
+}
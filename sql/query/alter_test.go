@@ -0,0 +1,83 @@
+package query_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlter(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		fails    bool
+		expected string
+	}{
+		{"Rename", "ALTER TABLE test RENAME TO test2; SELECT * FROM test2", false,
+			`[{"a":1,"b":"x"},{"a":2.0,"b":"y"}]`},
+		{"Rename to existing table", "ALTER TABLE test RENAME TO other", true, ``},
+		{"Add field", "ALTER TABLE test ADD FIELD a INT32; SELECT * FROM test", false,
+			`[{"a":1,"b":"x"},{"a":2,"b":"y"}]`},
+		{"Add field / not null", "ALTER TABLE test ADD FIELD c NOT NULL", true, ``},
+		{"Add field / invalid conversion", "ALTER TABLE test ADD FIELD b INT32", true, ``},
+		{"Add field / primary key", "ALTER TABLE test ADD FIELD a PRIMARY KEY", true, ``},
+		{"Drop field", "ALTER TABLE other DROP FIELD c; INSERT INTO other (d) VALUES (1); SELECT * FROM other", false,
+			`[{"d":1}]`},
+		{"Drop unknown field", "ALTER TABLE test DROP FIELD c", true, ``},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.Open(":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec(`
+				CREATE TABLE test;
+				CREATE TABLE other (c INTEGER NOT NULL);
+				INSERT INTO test (a, b) VALUES (1, 'x'), (2.0, 'y');
+			`)
+			require.NoError(t, err)
+
+			st, err := db.Query(test.query)
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer st.Close()
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			require.NoError(t, err)
+			require.JSONEq(t, test.expected, buf.String())
+		})
+	}
+
+	t.Run("Constraints are enforced", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			CREATE INDEX idx_test_a ON test (a);
+			INSERT INTO test (a) VALUES (1);
+			ALTER TABLE test ADD FIELD a NOT NULL;
+			ALTER TABLE test RENAME TO test2;
+		`)
+		require.NoError(t, err)
+
+		err = db.Exec("INSERT INTO test2 (b) VALUES (1)")
+		require.Error(t, err)
+
+		d, err := db.QueryDocument("EXPLAIN SELECT * FROM test2 WHERE a = 1")
+		require.NoError(t, err)
+		v, err := d.GetByField("index")
+		require.NoError(t, err)
+		require.Equal(t, document.NewTextValue("idx_test_a"), v)
+	})
+}
@@ -0,0 +1,43 @@
+package query
+
+import (
+	"database/sql/driver"
+
+	"github.com/asdine/genji/database"
+)
+
+// AnalyzeStmt is a DSL that allows creating an ANALYZE query.
+// It gathers statistics about the content of a table and its indexes,
+// which are used by the query planner. If the table name is empty, all the tables are analyzed.
+type AnalyzeStmt struct {
+	TableName string
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt AnalyzeStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the Analyze statement in the given transaction.
+// It implements the Statement interface.
+func (stmt AnalyzeStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	if stmt.TableName != "" {
+		return res, tx.Analyze(stmt.TableName)
+	}
+
+	tables, err := tx.ListTables()
+	if err != nil {
+		return res, err
+	}
+
+	for _, name := range tables {
+		err = tx.Analyze(name)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,106 @@
+package query_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeStmt(t *testing.T) {
+	tests := []struct {
+		name     string
+		analyze  string
+		query    string
+		expected string
+	}{
+		{"Not analyzed", "", "EXPLAIN SELECT * FROM test WHERE b = true",
+			`{"table":"test","scan":"index","index":"idx_b","field":"b","op":"=","value":true,"sort":false}`},
+		{"Low selectivity", "ANALYZE test", "EXPLAIN SELECT * FROM test WHERE b = true",
+			`{"table":"test","scan":"table","sort":false}`},
+		{"High selectivity", "ANALYZE", "EXPLAIN SELECT * FROM test WHERE a = 1",
+			`{"table":"test","scan":"index","index":"idx_a","field":"a","op":"=","value":1,"sort":false}`},
+		{"Not analyzed, and", "", "EXPLAIN SELECT * FROM test WHERE a = 1 AND b = true",
+			`{"table":"test","scan":"intersection","scans":[{"scan":"index","index":"idx_a","field":"a","op":"=","value":1},{"scan":"index","index":"idx_b","field":"b","op":"=","value":true}],"sort":false}`},
+		{"And", "ANALYZE test", "EXPLAIN SELECT * FROM test WHERE a = 1 AND b = true",
+			`{"table":"test","scan":"index","index":"idx_a","field":"a","op":"=","value":1,"sort":false}`},
+		{"Primary key", "ANALYZE test", "EXPLAIN SELECT * FROM test WHERE b = true AND k = 1",
+			`{"table":"test","scan":"primary key","field":"k","op":"=","value":1,"sort":false}`},
+		{"Range", "ANALYZE test", "EXPLAIN SELECT * FROM test WHERE a > 1",
+			`{"table":"test","scan":"index","index":"idx_a","field":"a","bounds":[{"op":">","value":1}],"sort":false}`},
+		{"Or with low selectivity", "ANALYZE test", "EXPLAIN SELECT * FROM test WHERE a = 1 OR b = true",
+			`{"table":"test","scan":"table","sort":false}`},
+		{"Or", "ANALYZE test", "EXPLAIN SELECT * FROM test WHERE a = 1 OR a = 2",
+			`{"table":"test","scan":"union","scans":[{"scan":"index","index":"idx_a","field":"a","op":"=","value":1},{"scan":"index","index":"idx_a","field":"a","op":"=","value":2}],"sort":false}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.Open(":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec(`
+				CREATE TABLE test (k INTEGER PRIMARY KEY);
+				CREATE INDEX idx_a ON test (a);
+				CREATE INDEX idx_b ON test (b);
+			`)
+			require.NoError(t, err)
+
+			for i := 0; i < 20; i++ {
+				err = db.Exec(`INSERT INTO test (k, a, b) VALUES (?, ?, ?)`, i, i, i%2 == 0)
+				require.NoError(t, err)
+			}
+
+			if test.analyze != "" {
+				err = db.Exec(test.analyze)
+				require.NoError(t, err)
+			}
+
+			st, err := db.Query(test.query)
+			require.NoError(t, err)
+			defer st.Close()
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			require.NoError(t, err)
+			require.JSONEq(t, "["+test.expected+"]", buf.String())
+		})
+	}
+
+	t.Run("Empty table", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			CREATE INDEX idx_a ON test (a);
+			ANALYZE test;
+		`)
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			err = db.Exec(fmt.Sprintf("INSERT INTO test (a) VALUES (%d)", i))
+			require.NoError(t, err)
+		}
+
+		d, err := db.QueryDocument("EXPLAIN SELECT * FROM test WHERE a = 1")
+		require.NoError(t, err)
+		v, err := d.GetByField("scan")
+		require.NoError(t, err)
+		require.Equal(t, document.NewTextValue("index"), v)
+	})
+
+	t.Run("Table not found", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("ANALYZE test")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,144 @@
+package query
+
+import (
+	"math"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// The costs are relative to the cost of reading one document while scanning the table.
+const (
+	// reading a document while scanning the table or a range of primary keys.
+	docReadCost = 1.0
+	// reading an entry of an index.
+	indexEntryCost = 1.0
+	// fetching a document by key, after reading an index.
+	docFetchCost = 1.0
+)
+
+// Selectivities used when the statistics can't tell how many documents match a condition.
+const (
+	eqSelectivity           = 0.1
+	rangeSelectivity        = 1.0 / 3
+	boundedRangeSelectivity = 0.25
+	regexSelectivity        = 0.25
+)
+
+// estimateCost estimates the cost of reading the documents selected by f,
+// using the statistics of the table.
+func (qo *queryOptimizer) estimateCost(f *queryPlanField) float64 {
+	switch {
+	case f.union != nil:
+		var cost float64
+		for _, sub := range f.union {
+			cost += qo.estimateCost(sub)
+		}
+		return cost
+	case f.intersection != nil:
+		// only the keys of the indexes are read, then the documents selected by all of them are fetched.
+		var cost float64
+		for _, sub := range f.intersection {
+			cost += qo.estimateRows(sub) * indexEntryCost
+		}
+		return cost + qo.estimateRows(f)*docFetchCost
+	case f.isPrimaryKey:
+		return qo.estimateRows(f) * docReadCost
+	}
+
+	return qo.estimateRows(f) * (indexEntryCost + docFetchCost)
+}
+
+// scanCost returns the cost of reading the whole table.
+func (qo *queryOptimizer) scanCost() float64 {
+	return float64(qo.stats.RowCount) * docReadCost
+}
+
+// estimateRows estimates the number of documents selected by f.
+func (qo *queryOptimizer) estimateRows(f *queryPlanField) float64 {
+	n := float64(qo.stats.RowCount)
+
+	var rows float64
+	switch {
+	case f.union != nil:
+		for _, sub := range f.union {
+			rows += qo.estimateRows(sub)
+		}
+	case f.intersection != nil:
+		// the fields are considered independent
+		rows = n
+		for _, sub := range f.intersection {
+			rows *= qo.estimateRows(sub) / n
+		}
+	case f.composite != nil:
+		rows = n
+		if k := len(f.composite.eq); k > 0 {
+			rows = n * math.Pow(eqSelectivity, float64(k))
+			if is := qo.stats.GetIndexStats(f.composite.index.IndexName); is != nil && is.DistinctCounts[k-1] > 0 {
+				rows = n / float64(is.DistinctCounts[k-1])
+			}
+		}
+		if f.composite.bounds != nil {
+			rows *= boundsSelectivity(f.composite.bounds)
+		}
+	case f.op == scanner.EQ:
+		rows = qo.estimateEqualRows(f)
+	case f.op == scanner.IN:
+		rows = qo.estimateEqualRows(f) * qo.listLength(f.e)
+	case f.op == scanner.EQREGEX:
+		rows = n * regexSelectivity
+	default:
+		rows = n * boundsSelectivity(f.bounds)
+	}
+
+	return math.Min(rows, n)
+}
+
+// estimateEqualRows estimates the number of documents whose field is equal to a given value.
+func (qo *queryOptimizer) estimateEqualRows(f *queryPlanField) float64 {
+	if f.isPrimaryKey || f.uniqueIndex {
+		return 1
+	}
+
+	n := float64(qo.stats.RowCount)
+	if is := qo.stats.GetIndexStats(qo.indexes[f.indexedField.Name()].IndexName); is != nil && is.DistinctCounts[0] > 0 {
+		return n / float64(is.DistinctCounts[0])
+	}
+
+	return n * eqSelectivity
+}
+
+// listLength returns the number of values of the list compared to a field with IN.
+func (qo *queryOptimizer) listLength(e Expr) float64 {
+	if l, ok := e.(LiteralExprList); ok {
+		return float64(len(l))
+	}
+
+	v, err := e.Eval(EvalStack{Tx: qo.tx, Params: qo.args})
+	if err != nil || v.Type != document.ArrayValue {
+		return 1
+	}
+
+	a, err := v.ConvertToArray()
+	if err != nil {
+		return 1
+	}
+
+	var length float64
+	a.Iterate(func(i int, v document.Value) error {
+		length++
+		return nil
+	})
+
+	return length
+}
+
+// boundsSelectivity returns the selectivity of a range, depending on whether it has
+// both a lower and an upper bound.
+func boundsSelectivity(bounds []rangeBound) float64 {
+	if isBoundedRange(bounds) {
+		return boundedRangeSelectivity
+	}
+
+	return rangeSelectivity
+}
@@ -42,9 +42,11 @@ func (stmt CreateTableStmt) Run(tx *database.Transaction, args []driver.NamedVal
 type CreateIndexStmt struct {
 	IndexName   string
 	TableName   string
-	Path        document.ValuePath
+	Paths       []document.ValuePath
 	IfNotExists bool
 	Unique      bool
+	// Where is the predicate of a partial index.
+	Where string
 }
 
 // IsReadOnly always returns false. It implements the Statement interface.
@@ -65,7 +67,7 @@ func (stmt CreateIndexStmt) Run(tx *database.Transaction, args []driver.NamedVal
 		return res, errors.New("missing index name")
 	}
 
-	if len(stmt.Path) == 0 {
+	if len(stmt.Paths) == 0 {
 		return res, errors.New("missing path")
 	}
 
@@ -73,7 +75,8 @@ func (stmt CreateIndexStmt) Run(tx *database.Transaction, args []driver.NamedVal
 		Unique:    stmt.Unique,
 		IndexName: stmt.IndexName,
 		TableName: stmt.TableName,
-		Path:      stmt.Path,
+		Paths:     stmt.Paths,
+		Where:     stmt.Where,
 	})
 	if stmt.IfNotExists && err == database.ErrIndexAlreadyExists {
 		err = nil
@@ -81,3 +84,48 @@ func (stmt CreateIndexStmt) Run(tx *database.Transaction, args []driver.NamedVal
 
 	return res, err
 }
+
+// CreateSequenceStmt is a DSL that allows creating a full CREATE SEQUENCE statement.
+type CreateSequenceStmt struct {
+	SequenceName string
+	IfNotExists  bool
+	IncrementBy  int64
+	Start        int64
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt CreateSequenceStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the Create sequence statement in the given transaction.
+// It implements the Statement interface.
+func (stmt CreateSequenceStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	if stmt.SequenceName == "" {
+		return res, errors.New("missing sequence name")
+	}
+
+	err := tx.CreateSequence(database.SequenceConfig{
+		Name:        stmt.SequenceName,
+		IncrementBy: stmt.IncrementBy,
+		Start:       stmt.Start,
+	})
+	if stmt.IfNotExists && err == database.ErrSequenceAlreadyExists {
+		err = nil
+	}
+
+	return res, err
+}
+
+// ConstraintExpr wraps an expression so that it can be used by the DEFAULT and CHECK
+// constraints of a table. It implements the database.ConstraintExpr interface.
+type ConstraintExpr struct {
+	Expr Expr
+}
+
+// Eval evaluates the expression against the given document.
+func (c ConstraintExpr) Eval(tx *database.Transaction, d document.Document) (document.Value, error) {
+	return c.Expr.Eval(EvalStack{Tx: tx, Document: d})
+}
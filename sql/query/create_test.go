@@ -1,6 +1,7 @@
 package query_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/asdine/genji"
@@ -69,6 +70,174 @@ func TestCreateTable(t *testing.T) {
 		})
 		require.NoError(t, err)
 	})
+
+	t.Run("default and check", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test(a INTEGER PRIMARY KEY, createdAt INT64 DEFAULT 10 * 2, age INT8 CHECK (age >= 0), b.c DEFAULT 'foo');
+			INSERT INTO test (a, age) VALUES (1, 18);
+			INSERT INTO test (a, createdAt, age, b) VALUES (2, 5, 30, {c: 'bar'});
+		`)
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("SELECT createdAt, age, b FROM test WHERE a = 1")
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		err = document.ToJSON(&buf, d)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"createdAt": 20, "age": 18, "b": {"c": "foo"}}`, buf.String())
+
+		d, err = db.QueryDocument("SELECT createdAt, age, b FROM test WHERE a = 2")
+		require.NoError(t, err)
+		buf.Reset()
+		err = document.ToJSON(&buf, d)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"createdAt": 5, "age": 30, "b": {"c": "bar"}}`, buf.String())
+
+		err = db.Exec("INSERT INTO test (a, age) VALUES (3, -1)")
+		require.EqualError(t, err, `field "age" violates its CHECK constraint (age >= 0)`)
+
+		err = db.Exec("UPDATE test SET age = -1 WHERE a = 2")
+		require.EqualError(t, err, `field "age" violates its CHECK constraint (age >= 0)`)
+
+		// missing fields are checked as NULL values
+		err = db.Exec("INSERT INTO test (a) VALUES (3)")
+		require.EqualError(t, err, `field "age" violates its CHECK constraint (age >= 0)`)
+
+		err = db.Exec(`
+			CREATE TABLE other(a CHECK (a IS NOT NULL));
+			INSERT INTO other (b) VALUES (1);
+		`)
+		require.EqualError(t, err, `field "a" violates its CHECK constraint (a IS NOT NULL)`)
+	})
+
+	t.Run("invalid default values", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test(a DEFAULT b + 1)")
+		require.EqualError(t, err, `invalid default value for field "a": fields can't be referenced`)
+
+		err = db.Exec("CREATE TABLE test(a DEFAULT pk())")
+		require.EqualError(t, err, `invalid default value for field "a": no table specified`)
+
+		err = db.Exec("CREATE TABLE test(a INTEGER DEFAULT 'foo')")
+		require.EqualError(t, err, `invalid default value for field "a": can't convert "text" to int64`)
+
+		err = db.Exec("CREATE TABLE test(a INTEGER); ALTER TABLE test ADD FIELD b DEFAULT a")
+		require.EqualError(t, err, `invalid default value for field "b": fields can't be referenced`)
+
+		// validating a default value doesn't increment the sequence it uses
+		err = db.Exec(`
+			CREATE SEQUENCE seq;
+			CREATE TABLE other(id INTEGER PRIMARY KEY DEFAULT nextval('seq'));
+			INSERT INTO other (a) VALUES (1);
+		`)
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("SELECT id FROM other")
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		err = document.ToJSON(&buf, d)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"id": 1}`, buf.String())
+	})
+}
+
+func TestForeignKeys(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec(`
+		CREATE TABLE authors(id INTEGER PRIMARY KEY);
+		CREATE TABLE books(authorId INTEGER REFERENCES authors(id) ON DELETE CASCADE);
+		CREATE TABLE reviews(bookId REFERENCES books);
+	`)
+	require.EqualError(t, err, `field "bookId" references table "books" which has no primary key`)
+
+	err = db.Exec(`
+		CREATE TABLE reviews(authorId INTEGER REFERENCES authors);
+		INSERT INTO authors (id) VALUES (1), (2);
+		INSERT INTO books (title, authorId) VALUES ('a', 1), ('b', 2), ('c', 2);
+		INSERT INTO reviews (authorId) VALUES (2);
+	`)
+	require.NoError(t, err)
+
+	err = db.Exec("INSERT INTO books (title, authorId) VALUES ('d', 3)")
+	require.EqualError(t, err, `field "authorId" references a missing document of table "authors"`)
+
+	err = db.Exec("UPDATE books SET authorId = 3")
+	require.Error(t, err)
+
+	// reviews restrict the deletion
+	err = db.Exec("DELETE FROM authors WHERE id = 2")
+	require.EqualError(t, err, `document is referenced by field "authorId" of table "reviews"`)
+
+	err = db.Exec("DELETE FROM reviews; DELETE FROM authors WHERE id = 2")
+	require.NoError(t, err)
+
+	d, err := db.QueryDocument("SELECT COUNT(*) AS n FROM books")
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	err = document.ToJSON(&buf, d)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"n": 1}`, buf.String())
+}
+
+func TestGeneratedPrimaryKeys(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec(`
+		CREATE TABLE a(id TEXT PRIMARY KEY DEFAULT uuid());
+		CREATE TABLE b(id TEXT PRIMARY KEY DEFAULT ulid());
+		CREATE SEQUENCE seq START WITH 10 INCREMENT BY 5;
+		CREATE TABLE c(id INTEGER PRIMARY KEY DEFAULT nextval('seq'));
+		INSERT INTO a (n) VALUES (1), (2);
+		INSERT INTO b (n) VALUES (1), (2);
+		INSERT INTO c (n) VALUES (1), (2);
+		INSERT INTO c (id, n) VALUES (1, 3);
+	`)
+	require.NoError(t, err)
+
+	ids := func(table string) []string {
+		st, err := db.Query("SELECT id FROM " + table + " ORDER BY n")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var ids []string
+		err = st.Iterate(func(d document.Document) error {
+			v, err := d.GetByField("id")
+			if err != nil {
+				return err
+			}
+			ids = append(ids, v.String())
+			return nil
+		})
+		require.NoError(t, err)
+		return ids
+	}
+
+	uuids := ids("a")
+	require.Len(t, uuids, 2)
+	require.NotEqual(t, uuids[0], uuids[1])
+	require.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, uuids[0])
+
+	ulids := ids("b")
+	require.Len(t, ulids, 2)
+	require.NotEqual(t, ulids[0], ulids[1])
+	require.Regexp(t, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`, ulids[0])
+
+	require.Equal(t, []string{"10", "15", "1"}, ids("c"))
+
+	err = db.Exec("DROP SEQUENCE seq; INSERT INTO c (n) VALUES (4)")
+	require.Error(t, err)
 }
 
 func TestCreateIndex(t *testing.T) {
@@ -81,7 +250,8 @@ func TestCreateIndex(t *testing.T) {
 		{"If not exists", "CREATE INDEX IF NOT EXISTS idx ON test (foo.bar)", false},
 		{"Unique", "CREATE UNIQUE INDEX IF NOT EXISTS idx ON test (foo.1)", false},
 		{"No fields", "CREATE INDEX idx ON test", true},
-		{"More than 1 field", "CREATE INDEX idx ON test (foo, bar)", true},
+		{"More than 1 field", "CREATE INDEX idx ON test (foo, bar)", false},
+		{"Unique with more than 1 field", "CREATE UNIQUE INDEX idx ON test (foo, bar.1)", false},
 	}
 
 	for _, test := range tests {
@@ -102,3 +272,70 @@ func TestCreateIndex(t *testing.T) {
 		})
 	}
 }
+
+func TestPartialIndex(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec(`
+		CREATE TABLE test(id INTEGER PRIMARY KEY);
+		CREATE INDEX idx_a ON test (a);
+		CREATE INDEX idx_a_live ON test (a) WHERE deletedAt IS NULL;
+		CREATE UNIQUE INDEX idx_email ON test (email) WHERE email IS NOT NULL;
+		INSERT INTO test (id, a, email) VALUES (1, 1, 'a@a.com'), (2, 1, 'b@b.com'), (3, 2, null), (4, 1, null);
+		UPDATE test SET deletedAt = 10 WHERE id = 2;
+	`)
+	require.NoError(t, err)
+
+	query := func(q string) string {
+		st, err := db.Query(q)
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		return buf.String()
+	}
+
+	t.Run("Should only index the matching documents", func(t *testing.T) {
+		err := db.ViewTable("test", func(tx *genji.Tx, _ *database.Table) error {
+			idx, err := tx.GetIndex("idx_a_live")
+			if err != nil {
+				return err
+			}
+
+			var count int
+			err = idx.AscendGreaterOrEqual(nil, func(v document.Value, k []byte) error {
+				count++
+				return nil
+			})
+			require.Equal(t, 3, count)
+			return err
+		})
+		require.NoError(t, err)
+
+		// documents without email can share the same null value
+		err = db.Exec("INSERT INTO test (id, a) VALUES (5, 1)")
+		require.NoError(t, err)
+
+		err = db.Exec("INSERT INTO test (id, email) VALUES (6, 'a@a.com')")
+		require.Equal(t, database.ErrDuplicateDocument, err)
+	})
+
+	t.Run("Should use the index if the query implies the predicate", func(t *testing.T) {
+		require.JSONEq(t,
+			`[{"table":"test","scan":"index","index":"idx_a_live","field":"a","op":"=","value":1,"sort":false}]`,
+			query("EXPLAIN SELECT * FROM test WHERE a = 1 AND deletedAt IS NULL"))
+		require.JSONEq(t,
+			`[{"table":"test","scan":"index","index":"idx_a","field":"a","op":"=","value":1,"sort":false}]`,
+			query("EXPLAIN SELECT * FROM test WHERE a = 1"))
+		require.JSONEq(t,
+			`[{"table":"test","scan":"index","index":"idx_email","field":"email","op":"=","value":"b@b.com","sort":false}]`,
+			query("EXPLAIN SELECT * FROM test WHERE email = 'b@b.com'"))
+
+		require.JSONEq(t, `[{"id":1},{"id":4},{"id":5}]`, query("SELECT id FROM test WHERE a = 1 AND deletedAt IS NULL ORDER BY id"))
+		require.JSONEq(t, `[{"id":2}]`, query("SELECT id FROM test WHERE email = 'b@b.com'"))
+	})
+}
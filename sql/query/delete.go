@@ -35,7 +35,12 @@ func (stmt DeleteStmt) Run(tx *database.Transaction, args []driver.NamedValue) (
 		return res, errors.New("missing table name")
 	}
 
-	stack := EvalStack{Tx: tx, Params: args}
+	subqueries, err := runSubqueries(tx, args, stmt.WhereExpr)
+	if err != nil {
+		return res, err
+	}
+
+	stack := EvalStack{Tx: tx, Params: args, subqueries: subqueries}
 
 	t, err := tx.GetTable(stmt.TableName)
 	if err != nil {
@@ -62,3 +62,31 @@ func (stmt DropIndexStmt) Run(tx *database.Transaction, args []driver.NamedValue
 
 	return res, err
 }
+
+// DropSequenceStmt is a DSL that allows creating a DROP SEQUENCE query.
+type DropSequenceStmt struct {
+	SequenceName string
+	IfExists     bool
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt DropSequenceStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the DropSequence statement in the given transaction.
+// It implements the Statement interface.
+func (stmt DropSequenceStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	if stmt.SequenceName == "" {
+		return res, errors.New("missing sequence name")
+	}
+
+	err := tx.DropSequence(stmt.SequenceName)
+	if err == database.ErrSequenceNotFound && stmt.IfExists {
+		err = nil
+	}
+
+	return res, err
+}
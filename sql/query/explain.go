@@ -0,0 +1,263 @@
+package query
+
+import (
+	"database/sql/driver"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+)
+
+// ExplainStmt is a DSL that allows creating an EXPLAIN query.
+// It returns a document describing how the statement would be executed, without running it.
+type ExplainStmt struct {
+	Statement SelectStmt
+}
+
+// IsReadOnly always returns true. It implements the Statement interface.
+func (stmt ExplainStmt) IsReadOnly() bool {
+	return true
+}
+
+// Run returns a stream containing one document describing the query plan of the statement.
+// It implements the Statement interface.
+func (stmt ExplainStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	d, err := stmt.Statement.explain(tx, args)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{Stream: document.NewStream(document.NewIterator(d))}, nil
+}
+
+// explain describes the query plan of the statement. It contains the following fields:
+//   - table: the name of the table, or subquery: the description of the statement
+//     whose result is read instead of a table
+//   - alias and joins: if other tables are joined, the alias of the table and how
+//     the joined tables are read for every document
+//   - scan: how the documents are read, either "table", "primary key", "index",
+//     "union", "intersection", "subquery" or "none", along with the details of the scan
+//   - aggregate: how the documents are aggregated, if the query uses aggregate functions
+//   - sort: whether the documents need to be sorted after being read
+//   - limit and offset: if specified, only the first limit + offset documents
+//     are kept in memory during the sort
+func (stmt SelectStmt) explain(tx *database.Transaction, args []driver.NamedValue) (*document.FieldBuffer, error) {
+	fb := document.NewFieldBuffer()
+
+	if stmt.TableName == "" && stmt.FromSubquery == nil {
+		fb.Add("scan", document.NewTextValue("none"))
+		return fb, nil
+	}
+
+	stack := EvalStack{
+		Tx:     tx,
+		Params: args,
+	}
+
+	limit, offset, err := stmt.limitOffset(stack)
+	if err != nil {
+		return nil, err
+	}
+
+	qo, err := stmt.queryOptimizer(tx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.FromSubquery != nil {
+		sub, err := stmt.FromSubquery.explain(tx, args)
+		if err != nil {
+			return nil, err
+		}
+
+		fb.Add("subquery", document.NewDocumentValue(sub))
+	} else {
+		fb.Add("table", document.NewTextValue(stmt.TableName))
+	}
+
+	if len(qo.joins) > 0 {
+		fb.Add("alias", document.NewTextValue(qo.alias))
+		explainJoins(fb, qo.joins)
+	}
+
+	builders := stmt.aggregatorBuilders()
+
+	var sorted bool
+	if !stmt.isAggregated(builders) {
+		qo.orderBy = stmt.orderByFields()
+
+		sorted, err = qo.explainQuery(fb)
+	} else {
+		qo.groupBy = stmt.GroupBy
+		qo.having = stmt.HavingExpr
+
+		// aggregated documents are always sorted after the aggregation
+		sorted = len(stmt.OrderBy) == 0
+		err = qo.explainAggregation(fb, stmt.Selectors)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fb.Add("sort", document.NewBoolValue(!sorted))
+
+	if limit >= 0 {
+		fb.Add("limit", document.NewInt64Value(int64(limit)))
+	}
+
+	if offset > 0 {
+		fb.Add("offset", document.NewInt64Value(int64(offset)))
+	}
+
+	return fb, nil
+}
+
+// explainQuery describes the way optimizeQuery reads the documents.
+// It returns true if they are read in the order required by the query.
+func (qo *queryOptimizer) explainQuery(fb *document.FieldBuffer) (bool, error) {
+	qp := qo.buildQueryPlan()
+
+	if qp.scanTable {
+		scan := "table"
+		if qo.t == nil {
+			scan = "subquery"
+		}
+
+		fb.Add("scan", document.NewTextValue(scan))
+		return len(qo.orderBy) == 0, nil
+	}
+
+	err := qo.explainField(fb, qp.field)
+	if err != nil {
+		return false, err
+	}
+
+	if qp.sorted {
+		fb.Add("direction", document.NewTextValue(qo.orderBy[0].Direction.String()))
+	}
+
+	return len(qo.orderBy) == 0 || qp.sorted, nil
+}
+
+// explainAggregation describes the way optimizeAggregation reads and aggregates the documents.
+func (qo *queryOptimizer) explainAggregation(fb *document.FieldBuffer, selectors []ResultField) error {
+	if len(qo.groupBy) == 0 {
+		if _, ok := qo.minMaxIterator(selectors); ok && qo.having == nil {
+			fb.Add("aggregate", document.NewTextValue("min max"))
+			return nil
+		}
+
+		fb.Add("aggregate", document.NewTextValue("all"))
+		_, err := qo.explainQuery(fb)
+		return err
+	}
+
+	if _, ok := qo.orderedByGroupKey(); ok {
+		_, isIndexed := qo.indexes[qo.groupBy.Name()]
+
+		fb.Add("aggregate", document.NewTextValue("sorted group"))
+		return qo.explainField(fb, &queryPlanField{
+			indexedField: qo.groupBy,
+			isPrimaryKey: !isIndexed,
+		})
+	}
+
+	fb.Add("aggregate", document.NewTextValue("hash group"))
+	_, err := qo.explainQuery(fb)
+	return err
+}
+
+// explainField adds the description of the documents selected by f to fb.
+// The expressions compared to the fields are evaluated.
+func (qo *queryOptimizer) explainField(fb *document.FieldBuffer, f *queryPlanField) error {
+	stack := EvalStack{
+		Tx:         qo.tx,
+		Params:     qo.args,
+		subqueries: qo.subqueries,
+	}
+
+	switch {
+	case f.union != nil || f.intersection != nil:
+		fields, scan := f.union, "union"
+		if fields == nil {
+			fields, scan = f.intersection, "intersection"
+		}
+
+		var scans document.ValueBuffer
+		for _, sub := range fields {
+			sfb := document.NewFieldBuffer()
+			err := qo.explainField(sfb, sub)
+			if err != nil {
+				return err
+			}
+
+			scans = scans.Append(document.NewDocumentValue(sfb))
+		}
+
+		fb.Add("scan", document.NewTextValue(scan))
+		fb.Add("scans", document.NewArrayValue(scans))
+		return nil
+	case f.composite != nil:
+		var paths, values document.ValueBuffer
+		for _, p := range f.composite.index.Paths {
+			paths = paths.Append(document.NewTextValue(p.String()))
+		}
+
+		for _, e := range f.composite.eq {
+			v, err := e.Eval(stack)
+			if err != nil {
+				return err
+			}
+
+			values = values.Append(v)
+		}
+
+		fb.Add("scan", document.NewTextValue("index"))
+		fb.Add("index", document.NewTextValue(f.composite.index.IndexName))
+		fb.Add("fields", document.NewArrayValue(paths))
+		fb.Add("eq", document.NewArrayValue(values))
+
+		return explainBounds(fb, f.composite.bounds, stack)
+	case f.isPrimaryKey:
+		fb.Add("scan", document.NewTextValue("primary key"))
+	default:
+		fb.Add("scan", document.NewTextValue("index"))
+		fb.Add("index", document.NewTextValue(qo.indexes[f.indexedField.Name()].IndexName))
+	}
+
+	fb.Add("field", document.NewTextValue(f.indexedField.Name()))
+
+	if f.e != nil {
+		v, err := f.e.Eval(stack)
+		if err != nil {
+			return err
+		}
+
+		fb.Add("op", document.NewTextValue(f.op.String()))
+		fb.Add("value", v)
+	}
+
+	return explainBounds(fb, f.bounds, stack)
+}
+
+// explainBounds adds the list of bounds to fb, if any.
+func explainBounds(fb *document.FieldBuffer, bounds []rangeBound, stack EvalStack) error {
+	if bounds == nil {
+		return nil
+	}
+
+	var vb document.ValueBuffer
+	for _, b := range bounds {
+		v, err := b.e.Eval(stack)
+		if err != nil {
+			return err
+		}
+
+		bfb := document.NewFieldBuffer()
+		bfb.Add("op", document.NewTextValue(b.op.String()))
+		bfb.Add("value", v)
+		vb = vb.Append(document.NewDocumentValue(bfb))
+	}
+
+	fb.Add("bounds", document.NewArrayValue(vb))
+	return nil
+}
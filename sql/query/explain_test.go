@@ -0,0 +1,81 @@
+package query_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainStmt(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		fails    bool
+		expected string
+		params   []interface{}
+	}{
+		{"No table", "EXPLAIN SELECT 1", false, `{"scan":"none"}`, nil},
+		{"Table not found", "EXPLAIN SELECT * FROM foo", true, ``, nil},
+		{"No cond", "EXPLAIN SELECT * FROM test", false, `{"table":"test","scan":"table","sort":false}`, nil},
+		{"Field without index", "EXPLAIN SELECT * FROM test WHERE c = 1", false, `{"table":"test","scan":"table","sort":false}`, nil},
+		{"Eq on index", "EXPLAIN SELECT * FROM test WHERE a = 1", false,
+			`{"table":"test","scan":"index","index":"idx_a","field":"a","op":"=","value":1,"sort":false}`, nil},
+		{"Eq on pk", "EXPLAIN SELECT * FROM test WHERE k = ?", false,
+			`{"table":"test","scan":"primary key","field":"k","op":"=","value":10,"sort":false}`, []interface{}{10}},
+		{"In on index", "EXPLAIN SELECT * FROM test WHERE a IN (1, 2)", false,
+			`{"table":"test","scan":"index","index":"idx_a","field":"a","op":"IN","value":[1, 2],"sort":false}`, nil},
+		{"Range", "EXPLAIN SELECT * FROM test WHERE a > 1 AND 10 >= a", false,
+			`{"table":"test","scan":"index","index":"idx_a","field":"a","bounds":[{"op":">","value":1},{"op":"<=","value":10}],"sort":false}`, nil},
+		{"Or", "EXPLAIN SELECT * FROM test WHERE a = 1 OR k < 10", false,
+			`{"table":"test","scan":"union","scans":[{"scan":"index","index":"idx_a","field":"a","op":"=","value":1},{"scan":"primary key","field":"k","bounds":[{"op":"<","value":10}]}],"sort":false}`, nil},
+		{"And", "EXPLAIN SELECT * FROM test WHERE a = 1 AND b = 2", false,
+			`{"table":"test","scan":"intersection","scans":[{"scan":"index","index":"idx_a","field":"a","op":"=","value":1},{"scan":"index","index":"idx_b","field":"b","op":"=","value":2}],"sort":false}`, nil},
+		{"Composite index", "EXPLAIN SELECT * FROM test WHERE b = 1 AND c > 2", false,
+			`{"table":"test","scan":"index","index":"idx_b_c","fields":["b","c"],"eq":[1],"bounds":[{"op":">","value":2}],"sort":false}`, nil},
+		{"Order by indexed field", "EXPLAIN SELECT * FROM test ORDER BY a DESC LIMIT 10 OFFSET 5", false,
+			`{"table":"test","scan":"index","index":"idx_a","field":"a","direction":"DESC","sort":false,"limit":10,"offset":5}`, nil},
+		{"Order by other field", "EXPLAIN SELECT * FROM test WHERE a = 1 ORDER BY c LIMIT 10", false,
+			`{"table":"test","scan":"index","index":"idx_a","field":"a","op":"=","value":1,"sort":true,"limit":10}`, nil},
+		{"Min max", "EXPLAIN SELECT MIN(a), MAX(k) FROM test", false, `{"table":"test","aggregate":"min max","sort":false}`, nil},
+		{"Count", "EXPLAIN SELECT COUNT(*) FROM test WHERE a = 1", false,
+			`{"table":"test","aggregate":"all","scan":"index","index":"idx_a","field":"a","op":"=","value":1,"sort":false}`, nil},
+		{"Group by indexed field", "EXPLAIN SELECT COUNT(*) FROM test GROUP BY a", false,
+			`{"table":"test","aggregate":"sorted group","scan":"index","index":"idx_a","field":"a","sort":false}`, nil},
+		{"Group by other field", "EXPLAIN SELECT COUNT(*) AS n FROM test GROUP BY c ORDER BY n", false,
+			`{"table":"test","aggregate":"hash group","scan":"table","sort":true}`, nil},
+		{"Missing param", "EXPLAIN SELECT * FROM test WHERE a = ?", true, ``, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.Open(":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec(`
+				CREATE TABLE test (k INTEGER PRIMARY KEY);
+				CREATE INDEX idx_a ON test (a);
+				CREATE INDEX idx_b ON test (b);
+				CREATE INDEX idx_b_c ON test (b, c);
+				INSERT INTO test (k, a, b, c) VALUES (1, 1, 2, 3);
+			`)
+			require.NoError(t, err)
+
+			st, err := db.Query(test.query, test.params...)
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer st.Close()
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			require.NoError(t, err)
+			require.JSONEq(t, "["+test.expected+"]", buf.String())
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package query
 
 import (
+	"crypto/rand"
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/asdine/genji/database"
@@ -33,6 +36,12 @@ type EvalStack struct {
 	Document document.Document
 	Params   []driver.NamedValue
 	Cfg      *database.TableConfig
+
+	// results of the subqueries run before executing the statement.
+	subqueries subqueryResults
+	// configuration of the joined tables, by alias. If set, the document
+	// contains the documents of the tables, in fields named after their alias.
+	tables map[string]*database.TableConfig
 }
 
 // A LiteralValue represents a litteral value of any type defined by the value package.
@@ -100,6 +109,17 @@ func (l LiteralExprList) Eval(stack EvalStack) (document.Value, error) {
 	return document.NewArrayValue(values), nil
 }
 
+// Parentheses is an expression enclosed in parentheses.
+// It prevents its operators from being combined with the ones surrounding it.
+type Parentheses struct {
+	E Expr
+}
+
+// Eval calls the Eval method of the enclosed expression. It implements the Expr interface.
+func (p Parentheses) Eval(stack EvalStack) (document.Value, error) {
+	return p.E.Eval(stack)
+}
+
 // NamedParam is an expression which represents the name of a parameter.
 type NamedParam string
 
@@ -162,6 +182,10 @@ func (f FieldSelector) Eval(stack EvalStack) (document.Value, error) {
 		return nilLitteral, document.ErrFieldNotFound
 	}
 
+	if stack.tables != nil {
+		stack.Document = joinedDocument{Document: stack.Document, cfgs: stack.tables}
+	}
+
 	var v document.Value
 	var a document.Array
 	var err error
@@ -282,13 +306,33 @@ func Lte(a, b Expr) CmpOp {
 	return CmpOp{&simpleOperator{a, b, scanner.LTE}}
 }
 
+// In creates an expression that returns true if a is equal to one of the values of the array b.
+// If b is a subquery, a is compared to the values it returns.
+func In(a, b Expr) CmpOp {
+	if s, ok := b.(*Subquery); ok {
+		s.List = true
+	}
+
+	return CmpOp{&simpleOperator{a, b, scanner.IN}}
+}
+
+// NotIn creates an expression that returns true if a is not equal to any of the values of the array b.
+// If b is a subquery, a is compared to the values it returns.
+func NotIn(a, b Expr) CmpOp {
+	if s, ok := b.(*Subquery); ok {
+		s.List = true
+	}
+
+	return CmpOp{&simpleOperator{a, b, scanner.NIN}}
+}
+
 // Eval compares a and b together using the operator specified when constructing the CmpOp
 // and returns the result of the comparison.
 func (op CmpOp) Eval(ctx EvalStack) (document.Value, error) {
 	v1, err := op.a.Eval(ctx)
 	if err != nil {
 		if err == document.ErrFieldNotFound {
-			if op.Token == scanner.NEQ {
+			if op.Token == scanner.NEQ || op.Token == scanner.NIN {
 				return trueLitteral, nil
 			}
 			return falseLitteral, nil
@@ -300,7 +344,7 @@ func (op CmpOp) Eval(ctx EvalStack) (document.Value, error) {
 	v2, err := op.b.Eval(ctx)
 	if err != nil {
 		if err == document.ErrFieldNotFound {
-			if op.Token == scanner.NEQ {
+			if op.Token == scanner.NEQ || op.Token == scanner.NIN {
 				return trueLitteral, nil
 			}
 
@@ -332,11 +376,243 @@ func (op CmpOp) compare(l, r document.Value) (bool, error) {
 		return l.IsLesserThan(r)
 	case scanner.LTE:
 		return l.IsLesserThanOrEqual(r)
+	case scanner.IN:
+		return isIn(l, r)
+	case scanner.NIN:
+		ok, err := isIn(l, r)
+		return !ok, err
 	default:
 		panic(fmt.Sprintf("unknown token %v", op.Token))
 	}
 }
 
+// isIn returns true if v is equal to one of the values of the array.
+// If list is not an array, it returns false.
+func isIn(v, list document.Value) (bool, error) {
+	if list.Type != document.ArrayValue {
+		return false, nil
+	}
+
+	a, err := list.ConvertToArray()
+	if err != nil {
+		return false, err
+	}
+
+	var found bool
+	err = a.Iterate(func(i int, elem document.Value) error {
+		ok, err := v.IsEqual(elem)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			found = true
+			return errStop
+		}
+
+		return nil
+	})
+	if err != nil && err != errStop {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// A RegexValue is a compiled regular expression literal.
+type RegexValue struct {
+	*regexp.Regexp
+}
+
+// Eval returns the pattern of the regular expression as a text value.
+// It implements the Expr interface.
+func (r RegexValue) Eval(EvalStack) (document.Value, error) {
+	return document.NewTextValue(r.String()), nil
+}
+
+// A RegexOp is a regular expression matching operator.
+// If the right-hand side is not a RegexValue, it must evaluate to a text
+// value, which is compiled on first use and cached for subsequent evaluations.
+type RegexOp struct {
+	*simpleOperator
+
+	cache *regexCache
+}
+
+type regexCache struct {
+	mu      sync.Mutex
+	pattern string
+	re      *regexp.Regexp
+}
+
+// EqRegex creates an expression that returns true if a matches the regular expression b.
+func EqRegex(a, b Expr) RegexOp {
+	return RegexOp{&simpleOperator{a, b, scanner.EQREGEX}, new(regexCache)}
+}
+
+// NeqRegex creates an expression that returns true if a doesn't match the regular expression b.
+func NeqRegex(a, b Expr) RegexOp {
+	return RegexOp{&simpleOperator{a, b, scanner.NEQREGEX}, new(regexCache)}
+}
+
+// Eval matches a against the regular expression b.
+// Only text and blob values can match a regular expression.
+func (op RegexOp) Eval(ctx EvalStack) (document.Value, error) {
+	v, err := op.a.Eval(ctx)
+	if err != nil {
+		if err == document.ErrFieldNotFound {
+			if op.Token == scanner.NEQREGEX {
+				return trueLitteral, nil
+			}
+			return falseLitteral, nil
+		}
+
+		return falseLitteral, err
+	}
+
+	re, err := op.regexp(ctx)
+	if err != nil {
+		return falseLitteral, err
+	}
+
+	var ok bool
+	if v.Type == document.TextValue || v.Type == document.BlobValue {
+		b, err := v.ConvertToBlob()
+		if err != nil {
+			return falseLitteral, err
+		}
+		ok = re.Match(b)
+	}
+
+	if op.Token == scanner.NEQREGEX {
+		ok = !ok
+	}
+
+	if ok {
+		return trueLitteral, nil
+	}
+
+	return falseLitteral, nil
+}
+
+func (op RegexOp) regexp(ctx EvalStack) (*regexp.Regexp, error) {
+	if r, ok := op.b.(RegexValue); ok {
+		return r.Regexp, nil
+	}
+
+	v, err := op.b.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Type != document.TextValue {
+		return nil, fmt.Errorf("regular expression must be a text value, got %q", v.Type)
+	}
+
+	pattern, err := v.ConvertToText()
+	if err != nil {
+		return nil, err
+	}
+
+	op.cache.mu.Lock()
+	defer op.cache.mu.Unlock()
+
+	if op.cache.re == nil || op.cache.pattern != pattern {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		op.cache.pattern, op.cache.re = pattern, re
+	}
+
+	return op.cache.re, nil
+}
+
+// An IsOp is a comparison operator that considers missing fields as null values.
+type IsOp struct {
+	*simpleOperator
+}
+
+// Is creates an expression that returns true if a is equal to b.
+// Unlike Eq, a missing field is equal to NULL.
+func Is(a, b Expr) IsOp {
+	return IsOp{&simpleOperator{a, b, scanner.IS}}
+}
+
+// IsNot creates an expression that returns true if a is not equal to b.
+// Unlike Neq, a missing field is equal to NULL.
+func IsNot(a, b Expr) IsOp {
+	return IsOp{&simpleOperator{a, b, scanner.ISN}}
+}
+
+// Eval implements the Expr interface. Missing fields are evaluated to NULL
+// before comparing a and b.
+func (op IsOp) Eval(ctx EvalStack) (document.Value, error) {
+	v1, err := evalOrNull(op.a, ctx)
+	if err != nil {
+		return falseLitteral, err
+	}
+
+	v2, err := evalOrNull(op.b, ctx)
+	if err != nil {
+		return falseLitteral, err
+	}
+
+	ok, err := v1.IsEqual(v2)
+	if err != nil {
+		return falseLitteral, err
+	}
+
+	if op.Token == scanner.ISN {
+		ok = !ok
+	}
+
+	if ok {
+		return trueLitteral, nil
+	}
+
+	return falseLitteral, nil
+}
+
+func evalOrNull(e Expr, ctx EvalStack) (document.Value, error) {
+	v, err := e.Eval(ctx)
+	if err == document.ErrFieldNotFound {
+		return nilLitteral, nil
+	}
+
+	return v, err
+}
+
+// NotOp is the NOT unary operator.
+type NotOp struct {
+	*simpleOperator
+}
+
+// Not creates an expression that returns true if e is falsy.
+func Not(e Expr) NotOp {
+	return NotOp{&simpleOperator{nil, e, scanner.NOT}}
+}
+
+// Eval implements the Expr interface. It evaluates its operand and returns true
+// if it is falsy or if it is a missing field.
+func (op NotOp) Eval(ctx EvalStack) (document.Value, error) {
+	v, err := op.b.Eval(ctx)
+	if err != nil {
+		if err == document.ErrFieldNotFound {
+			return trueLitteral, nil
+		}
+
+		return falseLitteral, err
+	}
+
+	if v.IsTruthy() {
+		return falseLitteral, nil
+	}
+
+	return trueLitteral, nil
+}
+
 // AndOp is the And operator.
 type AndOp struct {
 	*simpleOperator
@@ -571,11 +847,67 @@ var functions = map[string]func(args ...Expr) (Expr, error){
 		}
 		return new(PKFunc), nil
 	},
+	"uuid": func(args ...Expr) (Expr, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("uuid() takes no arguments")
+		}
+		return new(UUIDFunc), nil
+	},
+	"ulid": func(args ...Expr) (Expr, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("ulid() takes no arguments")
+		}
+		return new(ULIDFunc), nil
+	},
+	"nextval": func(args ...Expr) (Expr, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("nextval() takes 1 argument")
+		}
+		return &NextValFunc{Expr: args[0]}, nil
+	},
+	"count": func(args ...Expr) (Expr, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("count() takes 1 argument")
+		}
+		if _, ok := args[0].(Wildcard); ok {
+			return &CountFunc{Wildcard: true}, nil
+		}
+		return &CountFunc{Expr: args[0]}, nil
+	},
+	"sum": func(args ...Expr) (Expr, error) {
+		e, err := aggregateFuncArg("sum", args)
+		if err != nil {
+			return nil, err
+		}
+		return &SumFunc{Expr: e}, nil
+	},
+	"avg": func(args ...Expr) (Expr, error) {
+		e, err := aggregateFuncArg("avg", args)
+		if err != nil {
+			return nil, err
+		}
+		return &AvgFunc{Expr: e}, nil
+	},
+	"min": func(args ...Expr) (Expr, error) {
+		e, err := aggregateFuncArg("min", args)
+		if err != nil {
+			return nil, err
+		}
+		return &MinFunc{Expr: e}, nil
+	},
+	"max": func(args ...Expr) (Expr, error) {
+		e, err := aggregateFuncArg("max", args)
+		if err != nil {
+			return nil, err
+		}
+		return &MaxFunc{Expr: e}, nil
+	},
 }
 
 // GetFunc return a function expression by name.
+// Function names are case insensitive.
 func GetFunc(name string, args ...Expr) (Expr, error) {
-	fn, ok := functions[name]
+	fn, ok := functions[strings.ToLower(name)]
 	if !ok {
 		return nil, fmt.Errorf("no such function: %q", name)
 	}
@@ -598,7 +930,101 @@ func (k PKFunc) Eval(ctx EvalStack) (document.Value, error) {
 		return pk.Path.GetValue(ctx.Document)
 	}
 
-	return encoding.DecodeValue(document.Int64Value, ctx.Document.(document.Keyer).Key())
+	kr, ok := ctx.Document.(document.Keyer)
+	if !ok {
+		return document.Value{}, errors.New("document has no primary key")
+	}
+
+	return encoding.DecodeValue(document.Int64Value, kr.Key())
+}
+
+// UUIDFunc represents the uuid() function.
+// It returns a random version 4 UUID, in its canonical text form.
+type UUIDFunc struct{}
+
+// Eval returns a new UUID.
+func (u UUIDFunc) Eval(ctx EvalStack) (document.Value, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	// set the version and the variant
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return document.NewTextValue(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])), nil
+}
+
+// ULIDFunc represents the ulid() function.
+// It returns a ULID, in its text form. ULIDs start with a timestamp in milliseconds
+// followed by random bits, so the ones generated in different milliseconds are sorted by time.
+type ULIDFunc struct{}
+
+// crockford is the alphabet of the base32 encoding of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Eval returns a new ULID.
+func (u ULIDFunc) Eval(ctx EvalStack) (document.Value, error) {
+	var b [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+
+	_, err := rand.Read(b[6:])
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	// encode the 128 bits in 26 characters of 5 bits, the first one having only 3 bits.
+	var text [26]byte
+	var acc uint16
+	var bits uint
+	n := len(text) - 1
+	for i := len(b) - 1; i >= 0; i-- {
+		acc |= uint16(b[i]) << bits
+		bits += 8
+		for bits >= 5 {
+			text[n] = crockford[acc&0x1f]
+			n--
+			acc >>= 5
+			bits -= 5
+		}
+	}
+	text[0] = crockford[acc&0x1f]
+
+	return document.NewTextValue(string(text[:])), nil
+}
+
+// NextValFunc represents the nextval() function.
+// It increments the sequence whose name is given and returns its new value.
+type NextValFunc struct {
+	Expr Expr
+}
+
+// Eval returns the next value of the sequence.
+func (n NextValFunc) Eval(ctx EvalStack) (document.Value, error) {
+	if ctx.Tx == nil {
+		return nilLitteral, errors.New("nextval() must be called within a transaction")
+	}
+
+	v, err := n.Expr.Eval(ctx)
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	if v.Type != document.TextValue {
+		return nilLitteral, fmt.Errorf("nextval() expects a sequence name, got %q", v.Type)
+	}
+
+	x, err := ctx.Tx.NextValue(string(v.V.([]byte)))
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	return document.NewInt64Value(x), nil
 }
 
 // Cast represents the CAST expression.
@@ -0,0 +1,369 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+	"github.com/asdine/genji/index"
+)
+
+// maxGroupsInMemory is the maximum number of groups the hash grouping
+// keeps in memory. Documents belonging to other groups are written to a temporary file
+// and grouped once the groups in memory have been returned.
+var maxGroupsInMemory = 10000
+
+// maxBufferedDocuments is the maximum number of documents a documentBuffer
+// keeps in memory. The following documents are written to a temporary file.
+var maxBufferedDocuments = 10000
+
+// groupKey returns the value of the group by field, encoded in a way that values
+// considered equal by an index have the same key. Missing fields are grouped with NULL values.
+func groupKey(groupBy FieldSelector, stack EvalStack) ([]byte, error) {
+	v, err := groupBy.Eval(stack)
+	if err != nil {
+		if err != document.ErrFieldNotFound {
+			return nil, err
+		}
+		v = document.NewNullValue()
+	}
+
+	data, err := index.EncodeFieldToIndexValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	t := index.NewTypeFromValueType(v.Type)
+	key := []byte{byte(t)}
+	// documents and arrays are stored with NULL values in indexes.
+	if t == index.Null {
+		key = append(key, byte(v.Type))
+	}
+
+	return append(key, data...), nil
+}
+
+// sortedGroupIterator groups documents of a stream that is ordered by the group key.
+// Since documents of the same group are contiguous, only one group is kept in memory.
+type sortedGroupIterator struct {
+	st       document.Stream
+	groupBy  FieldSelector
+	builders []AggregatorBuilder
+	stack    EvalStack
+}
+
+func (it sortedGroupIterator) Iterate(fn func(d document.Document) error) error {
+	var g *group
+	var gkey []byte
+
+	emit := func() error {
+		d, err := g.document()
+		if err != nil {
+			return err
+		}
+
+		return fn(d)
+	}
+
+	stack := it.stack
+	err := it.st.Iterate(func(d document.Document) error {
+		stack.Document = d
+
+		k, err := groupKey(it.groupBy, stack)
+		if err != nil {
+			return err
+		}
+
+		if g != nil && !bytes.Equal(k, gkey) {
+			err = emit()
+			if err != nil {
+				return err
+			}
+			g = nil
+		}
+
+		if g == nil {
+			g, err = newGroup(d, it.builders)
+			if err != nil {
+				return err
+			}
+			gkey = k
+		}
+
+		return g.aggregate(stack)
+	})
+	if err != nil {
+		return err
+	}
+
+	if g == nil {
+		return nil
+	}
+
+	return emit()
+}
+
+// hashGroupIterator groups documents of a stream in any order.
+// It keeps at most maxGroups groups in memory. The documents of the other groups
+// are spilled to a temporary file, which is grouped the same way
+// once the groups in memory have been returned.
+type hashGroupIterator struct {
+	st        document.Stream
+	groupBy   FieldSelector
+	builders  []AggregatorBuilder
+	stack     EvalStack
+	maxGroups int
+}
+
+func (it hashGroupIterator) Iterate(fn func(d document.Document) error) error {
+	return it.iterate(it.st, fn)
+}
+
+func (it hashGroupIterator) iterate(src document.Iterator, fn func(d document.Document) error) error {
+	groups := make(map[string]*group)
+	// keys in insertion order, to return groups in a deterministic order
+	var keys []string
+	var spill *spillFile
+
+	defer func() {
+		if spill != nil {
+			spill.Close()
+		}
+	}()
+
+	stack := it.stack
+	err := src.Iterate(func(d document.Document) error {
+		stack.Document = d
+
+		k, err := groupKey(it.groupBy, stack)
+		if err != nil {
+			return err
+		}
+
+		g, ok := groups[string(k)]
+		if !ok {
+			if len(groups) >= it.maxGroups {
+				if spill == nil {
+					spill, err = newSpillFile()
+					if err != nil {
+						return err
+					}
+				}
+
+				return spill.Write(d)
+			}
+
+			g, err = newGroup(d, it.builders)
+			if err != nil {
+				return err
+			}
+			groups[string(k)] = g
+			keys = append(keys, string(k))
+		}
+
+		return g.aggregate(stack)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		d, err := groups[k].document()
+		if err != nil {
+			return err
+		}
+
+		err = fn(d)
+		if err != nil {
+			return err
+		}
+	}
+
+	if spill == nil {
+		return nil
+	}
+
+	return it.iterate(spill, fn)
+}
+
+// spillFile is a temporary file storing encoded documents and their keys.
+// It implements the document.Iterator interface.
+type spillFile struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func newSpillFile() (*spillFile, error) {
+	f, err := ioutil.TempFile("", "genji-group-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &spillFile{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Write appends the key and the encoded document to the file.
+func (s *spillFile) Write(d document.Document) error {
+	var key []byte
+	if k, ok := d.(document.Keyer); ok {
+		key = k.Key()
+	}
+
+	data, err := encoding.EncodeDocument(d)
+	if err != nil {
+		return err
+	}
+
+	var buf [binary.MaxVarintLen64]byte
+	for _, b := range [][]byte{key, data} {
+		n := binary.PutUvarint(buf[:], uint64(len(b)))
+		_, err = s.w.Write(buf[:n])
+		if err != nil {
+			return err
+		}
+		_, err = s.w.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Iterate reads the documents of the file in the order they were written.
+func (s *spillFile) Iterate(fn func(d document.Document) error) error {
+	err := s.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(s.f)
+	for {
+		key, err := readSpilledBytes(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		data, err := readSpilledBytes(r)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&encodedDocumentWithKey{EncodedDocument: data, key: key})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes and removes the file.
+func (s *spillFile) Close() error {
+	err := s.f.Close()
+	if rerr := os.Remove(s.f.Name()); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// documentBuffer stores a copy of the documents written to it, to be read once
+// they have all been written. It keeps at most max documents in memory,
+// the following ones are written to a temporary file.
+// It implements the document.Iterator interface.
+type documentBuffer struct {
+	max   int
+	docs  []document.Document
+	spill *spillFile
+}
+
+// Write copies the document to the buffer.
+func (b *documentBuffer) Write(d document.Document) error {
+	if b.spill != nil || len(b.docs) >= b.max {
+		if b.spill == nil {
+			var err error
+			b.spill, err = newSpillFile()
+			if err != nil {
+				return err
+			}
+		}
+
+		return b.spill.Write(d)
+	}
+
+	var key []byte
+	if k, ok := d.(document.Keyer); ok {
+		key = append([]byte{}, k.Key()...)
+	}
+
+	data, err := encoding.EncodeDocument(d)
+	if err != nil {
+		return err
+	}
+
+	b.docs = append(b.docs, &encodedDocumentWithKey{EncodedDocument: data, key: key})
+	return nil
+}
+
+// Iterate reads the documents in the order they were written.
+func (b *documentBuffer) Iterate(fn func(d document.Document) error) error {
+	for _, d := range b.docs {
+		err := fn(d)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.spill == nil {
+		return nil
+	}
+
+	return b.spill.Iterate(fn)
+}
+
+// Close removes the temporary file, if any.
+func (b *documentBuffer) Close() error {
+	if b.spill == nil {
+		return nil
+	}
+
+	return b.spill.Close()
+}
+
+func readSpilledBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return b, err
+}
+
+// encodedDocumentWithKey is an encoded document that implements the document.Keyer interface.
+type encodedDocumentWithKey struct {
+	encoding.EncodedDocument
+
+	key []byte
+}
+
+func (d *encodedDocumentWithKey) Key() []byte {
+	return d.key
+}
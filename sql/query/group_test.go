@@ -0,0 +1,65 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashGroupIteratorSpill(t *testing.T) {
+	var docs []document.Document
+	for _, a := range []int{1, 2, 3, 1, 2, 3, 4, 4, 4} {
+		docs = append(docs, document.NewFieldBuffer().Add("a", document.NewIntValue(a)))
+	}
+
+	count := &CountFunc{Wildcard: true}
+	it := hashGroupIterator{
+		st:        document.NewStream(document.NewIterator(docs...)),
+		groupBy:   FieldSelector{"a"},
+		builders:  []AggregatorBuilder{count},
+		maxGroups: 2,
+	}
+
+	var groups [][2]int64
+	err := it.Iterate(func(d document.Document) error {
+		a, err := FieldSelector{"a"}.Eval(EvalStack{Document: d})
+		require.NoError(t, err)
+		c, err := count.Eval(EvalStack{Document: d})
+		require.NoError(t, err)
+
+		ai, err := a.ConvertToInt64()
+		require.NoError(t, err)
+		ci, err := c.ConvertToInt64()
+		require.NoError(t, err)
+
+		groups = append(groups, [2]int64{ai, ci})
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, [][2]int64{{1, 2}, {2, 2}, {3, 2}, {4, 3}}, groups)
+}
+
+func TestDocumentBufferSpill(t *testing.T) {
+	buf := documentBuffer{max: 2}
+	defer buf.Close()
+
+	for i := 0; i < 5; i++ {
+		err := buf.Write(document.NewFieldBuffer().Add("a", document.NewIntValue(i)))
+		require.NoError(t, err)
+	}
+	require.Len(t, buf.docs, 2)
+	require.NotNil(t, buf.spill)
+
+	var values []int64
+	err := buf.Iterate(func(d document.Document) error {
+		v, err := d.GetByField("a")
+		require.NoError(t, err)
+		i, err := v.ConvertToInt64()
+		require.NoError(t, err)
+		values = append(values, i)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int64{0, 1, 2, 3, 4}, values)
+}
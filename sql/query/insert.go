@@ -7,13 +7,32 @@ import (
 
 	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/sql/scanner"
 )
 
 // InsertStmt is a DSL that allows creating a full Insert query.
+// The documents are either built from Values or read from the result of Select.
+// If OnConflict is set, documents conflicting with an existing one are not inserted
+// and the action of the clause is taken instead.
+// If Returning is set, the result contains one document per inserted or updated document,
+// whose fields are evaluated against the document as it was stored.
 type InsertStmt struct {
 	TableName  string
 	FieldNames []string
 	Values     LiteralExprList
+	Select     *SelectStmt
+	OnConflict *OnConflictClause
+	Returning  []ResultField
+}
+
+// OnConflictClause describes what to do when a document has the same primary key
+// or the same value for a unique index as an existing document.
+// If Action is scanner.NOTHING, the document is skipped. If it is scanner.UPDATE,
+// the existing document is updated using Pairs, whose expressions are evaluated against it.
+// The document that couldn't be inserted can be referred to using the excluded field, i.e. excluded.a.
+type OnConflictClause struct {
+	Action scanner.Token
+	Pairs  []UpdateSetPair
 }
 
 // IsReadOnly always returns false. It implements the Statement interface.
@@ -30,7 +49,7 @@ func (stmt InsertStmt) Run(tx *database.Transaction, args []driver.NamedValue) (
 		return res, errors.New("missing table name")
 	}
 
-	if stmt.Values == nil {
+	if stmt.Values == nil && stmt.Select == nil {
 		return res, errors.New("values are empty")
 	}
 
@@ -44,19 +63,168 @@ func (stmt InsertStmt) Run(tx *database.Transaction, args []driver.NamedValue) (
 		Params: args,
 	}
 
-	if len(stmt.FieldNames) > 0 {
-		return stmt.insertExprList(t, stack)
+	ins := inserter{t: t, onConflict: stmt.OnConflict, stack: stack}
+	if len(stmt.Returning) > 0 {
+		cfg, err := t.Config()
+		if err != nil {
+			return res, err
+		}
+
+		ins.returning = stmt.Returning
+		ins.stack.Cfg = cfg
+	}
+
+	switch {
+	case stmt.Select != nil:
+		err = stmt.insertSelect(&ins, tx, args)
+	case len(stmt.FieldNames) > 0:
+		err = stmt.insertExprList(&ins, stack)
+	default:
+		err = stmt.insertDocuments(&ins, stack)
+	}
+	if err != nil {
+		return res, err
+	}
+
+	return ins.result(), nil
+}
+
+// inserter inserts documents in a table, handles conflicts and keeps the documents returned
+// by the RETURNING clause, if any.
+type inserter struct {
+	t             *database.Table
+	onConflict    *OnConflictClause
+	returning     []ResultField
+	stack         EvalStack
+	rowsAffected  driver.RowsAffected
+	lastInsertKey []byte
+	docs          []document.Document
+}
+
+func (ins *inserter) insert(d document.Document) error {
+	var key []byte
+	var err error
+
+	if ins.onConflict != nil {
+		var conflict bool
+		key, conflict, err = ins.t.InsertOrConflict(d)
+		if err != nil {
+			return err
+		}
+
+		if conflict {
+			return ins.resolve(key, d)
+		}
+	} else {
+		key, err = ins.t.Insert(d)
+		if err != nil {
+			return err
+		}
+	}
+
+	ins.lastInsertKey = key
+	ins.rowsAffected++
+
+	return ins.addReturned(key)
+}
+
+// resolve takes the action of the ON CONFLICT clause for the document d,
+// which conflicts with the document stored at the given key.
+func (ins *inserter) resolve(key []byte, d document.Document) error {
+	if ins.onConflict.Action == scanner.NOTHING {
+		return nil
+	}
+
+	old, err := ins.t.GetDocument(key)
+	if err != nil {
+		return err
+	}
+
+	var fb document.FieldBuffer
+	err = fb.Copy(old)
+	if err != nil {
+		return err
+	}
+
+	stack := ins.stack
+	stack.Document = excludedDocument{Document: old, excluded: d}
+
+	err = setPairs(&fb, ins.onConflict.Pairs, stack)
+	if err != nil {
+		return err
+	}
+
+	err = ins.t.Replace(key, &fb)
+	if err != nil {
+		return err
+	}
+
+	ins.rowsAffected++
+
+	return ins.addReturned(key)
+}
+
+// addReturned evaluates the RETURNING clause against the document stored at the given key.
+func (ins *inserter) addReturned(key []byte) error {
+	if len(ins.returning) == 0 {
+		return nil
+	}
+
+	// read the document as it was stored, after its fields were converted
+	stored, err := ins.t.GetDocument(key)
+	if err != nil {
+		return err
+	}
+
+	var fb document.FieldBuffer
+	err = fb.Copy(documentMask{
+		stack:        ins.stack,
+		r:            stored,
+		resultFields: ins.returning,
+	})
+	if err != nil {
+		return err
+	}
+
+	ins.docs = append(ins.docs, &fb)
+	return nil
+}
+
+func (ins *inserter) result() Result {
+	res := Result{
+		rowsAffected:  ins.rowsAffected,
+		lastInsertKey: ins.lastInsertKey,
+	}
+
+	if len(ins.returning) > 0 {
+		res.Stream = document.NewStream(document.NewIterator(ins.docs...))
 	}
 
-	return stmt.insertDocuments(t, stack)
+	return res
+}
+
+// excludedDocument is the document against which the expressions of ON CONFLICT DO UPDATE
+// are evaluated. Its fields are those of the existing document, except for the excluded field
+// which contains the document that couldn't be inserted.
+type excludedDocument struct {
+	document.Document
+
+	excluded document.Document
+}
+
+func (d excludedDocument) GetByField(field string) (document.Value, error) {
+	if field == "excluded" {
+		return document.NewDocumentValue(d.excluded), nil
+	}
+
+	return d.Document.GetByField(field)
 }
 
 type paramExtractor interface {
 	extract(params []driver.NamedValue) (interface{}, error)
 }
 
-func (stmt InsertStmt) insertDocuments(t *database.Table, stack EvalStack) (Result, error) {
-	var res Result
+func (stmt InsertStmt) insertDocuments(ins *inserter, stack EvalStack) error {
 	var err error
 
 	for _, doc := range stmt.Values {
@@ -68,7 +236,7 @@ func (stmt InsertStmt) insertDocuments(t *database.Table, stack EvalStack) (Resu
 		case paramExtractor:
 			v, err := tp.extract(stack.Params)
 			if err != nil {
-				return res, err
+				return err
 			}
 
 			var ok bool
@@ -76,74 +244,70 @@ func (stmt InsertStmt) insertDocuments(t *database.Table, stack EvalStack) (Resu
 			if !ok {
 				d, err = document.NewFromStruct(v)
 				if err != nil {
-					return res, err
+					return err
 				}
 			}
 		case LiteralValue:
 			v := document.Value(tp)
 
 			if v.Type != document.DocumentValue {
-				return res, fmt.Errorf("values must be a list of documents if field list is empty")
+				return fmt.Errorf("values must be a list of documents if field list is empty")
 			}
 
 			d, err = v.ConvertToDocument()
 			if err != nil {
-				return res, err
+				return err
 			}
 		case KVPairs:
 			v, err := tp.Eval(stack)
 			if err != nil {
-				return res, err
+				return err
 			}
 			d, err = v.ConvertToDocument()
 			if err != nil {
-				return res, err
+				return err
 			}
 		default:
-			return res, fmt.Errorf("values must be a list of documents if field list is empty")
+			return fmt.Errorf("values must be a list of documents if field list is empty")
 		}
 
-		res.lastInsertKey, err = t.Insert(d)
+		err = ins.insert(d)
 		if err != nil {
-			return res, err
+			return err
 		}
-
-		res.rowsAffected++
 	}
 
-	return res, nil
+	return nil
 }
 
-func (stmt InsertStmt) insertExprList(t *database.Table, stack EvalStack) (Result, error) {
-	var res Result
-
+func (stmt InsertStmt) insertExprList(ins *inserter, stack EvalStack) error {
 	// iterate over all of the documents (r1, r2, r3, ...)
 	for _, e := range stmt.Values {
 		var fb document.FieldBuffer
 
 		v, err := e.Eval(stack)
 		if err != nil {
-			return res, err
+			return err
 		}
 
 		// each document must be a list of expressions
 		// (e1, e2, e3, ...) or [e1, e2, e2, ....]
 		if v.Type != document.ArrayValue {
-			return res, errors.New("invalid values")
+			return errors.New("invalid values")
 		}
 
 		vlist, err := v.ConvertToArray()
 		if err != nil {
-			return res, err
+			return err
 		}
 
 		lenv, err := document.ArrayLength(vlist)
 		if err != nil {
-			return res, err
+			return err
 		}
 
 		if len(stmt.FieldNames) != lenv {
-			return res, fmt.Errorf("%d values for %d fields", lenv, len(stmt.FieldNames))
+			return fmt.Errorf("%d values for %d fields", lenv, len(stmt.FieldNames))
 		}
 
 		// iterate over each value
@@ -157,13 +321,59 @@ func (stmt InsertStmt) insertExprList(t *database.Table, stack EvalStack) (Resul
 			return nil
 		})
 
-		res.lastInsertKey, err = t.Insert(&fb)
+		err = ins.insert(&fb)
 		if err != nil {
-			return res, err
+			return err
 		}
+	}
+
+	return nil
+}
+
+// insertSelect inserts the documents returned by the Select statement as they are read.
+// If the Select statement reads the table the documents are inserted in, they are buffered
+// before being inserted, since a table can't be modified while being read.
+// If a field list is specified, the values of every document are assigned to these fields, in order.
+func (stmt InsertStmt) insertSelect(ins *inserter, tx *database.Transaction, args []driver.NamedValue) error {
+	res, err := stmt.Select.exec(tx, args)
+	if err != nil {
+		return err
+	}
+
+	var src document.Iterator = res
+	if stmt.Select.readsTable(stmt.TableName) {
+		buf := documentBuffer{max: maxBufferedDocuments}
+		defer buf.Close()
 
-		res.rowsAffected++
+		err = res.Iterate(buf.Write)
+		if err != nil {
+			return err
+		}
+		src = &buf
 	}
 
-	return res, nil
+	return src.Iterate(func(d document.Document) error {
+		if len(stmt.FieldNames) == 0 {
+			return ins.insert(d)
+		}
+
+		var fb document.FieldBuffer
+		var i int
+		err := d.Iterate(func(f string, v document.Value) error {
+			if i < len(stmt.FieldNames) {
+				fb.Add(stmt.FieldNames[i], v)
+			}
+			i++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if i != len(stmt.FieldNames) {
+			return fmt.Errorf("%d values for %d fields", i, len(stmt.FieldNames))
+		}
+
+		return ins.insert(&fb)
+	})
 }
@@ -128,4 +128,139 @@ func TestInsertStmt(t *testing.T) {
 		require.NoError(t, err)
 		require.JSONEq(t, `{"a": "a", "b-b": "b"}`, buf.String())
 	})
+
+	t.Run("with select", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE events;
+			CREATE TABLE archive;
+			CREATE INDEX idx_archive_ts ON archive (ts);
+			INSERT INTO events (ts, name) VALUES (1, 'a'), (2, 'b'), (3, 'c');
+			INSERT INTO archive SELECT * FROM events WHERE ts < ?;
+			INSERT INTO archive (ts, name) SELECT ts * 10, name FROM events WHERE ts = 3;
+			INSERT INTO events SELECT * FROM events;
+			INSERT INTO events SELECT ts, name FROM (SELECT * FROM events WHERE ts = 1) AS e;
+			INSERT INTO events SELECT a.ts AS ts, a.name AS name FROM archive a JOIN events e ON e.ts = a.ts WHERE a.ts = 2;
+		`, 3)
+		require.NoError(t, err)
+
+		res, err := db.Query("SELECT * FROM archive ORDER BY ts")
+		require.NoError(t, err)
+		defer res.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, res)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"ts":1,"name":"a"},{"ts":2,"name":"b"},{"ts":30,"name":"c"}]`, buf.String())
+
+		d, err := db.QueryDocument("SELECT COUNT(*) FROM events")
+		require.NoError(t, err)
+		v, err := d.GetByField("COUNT(*)")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt64Value(10), v)
+
+		err = db.Exec("INSERT INTO archive (ts) SELECT ts, name FROM events")
+		require.Error(t, err)
+	})
+
+	t.Run("with returning", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (id INTEGER PRIMARY KEY, price FLOAT64);
+			CREATE TABLE other;
+			INSERT INTO other (a) VALUES (1), (2);
+		`)
+		require.NoError(t, err)
+
+		res, err := db.Query("INSERT INTO test (id, price, name) VALUES (1, 10, 'foo'), (2, 20, 'bar') RETURNING pk(), price, name AS n")
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, res)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"pk()":1,"price":10.0,"n":"foo"},{"pk()":2,"price":20.0,"n":"bar"}]`, buf.String())
+		err = res.Close()
+		require.NoError(t, err)
+
+		res, err = db.Query("INSERT INTO other SELECT a + 10 AS a FROM other RETURNING pk(), *")
+		require.NoError(t, err)
+		defer res.Close()
+
+		buf.Reset()
+		err = document.IteratorToJSONArray(&buf, res)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"pk()":3,"a":11},{"pk()":4,"a":12}]`, buf.String())
+	})
+
+	t.Run("with on conflict", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (id INTEGER PRIMARY KEY);
+			CREATE UNIQUE INDEX idx_test_email ON test (email);
+			INSERT INTO test (id, email, n) VALUES (1, 'a@x', 1), (2, 'b@x', 1);
+		`)
+		require.NoError(t, err)
+
+		// conflicts on the primary key, then on the unique index
+		err = db.Exec("INSERT INTO test (id, email, n) VALUES (1, 'c@x', 10), (3, 'b@x', 10) ON CONFLICT DO NOTHING")
+		require.NoError(t, err)
+
+		res, err := db.Query("INSERT INTO test (id, email, n) VALUES (1, 'c@x', 5), (3, 'b@x', 7), (4, 'd@x', 1) ON CONFLICT DO UPDATE SET n = n + excluded.n, last = excluded.id RETURNING id, n, last")
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, res)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"id":1,"n":6,"last":1},{"id":2,"n":8,"last":3},{"id":4,"n":1,"last":null}]`, buf.String())
+
+		// closing the result commits the transaction
+		err = res.Close()
+		require.NoError(t, err)
+
+		res, err = db.Query("SELECT id, email, n FROM test")
+		require.NoError(t, err)
+		defer res.Close()
+
+		buf.Reset()
+		err = document.IteratorToJSONArray(&buf, res)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"id":1,"email":"a@x","n":6},{"id":2,"email":"b@x","n":8},{"id":4,"email":"d@x","n":1}]`, buf.String())
+
+		err = db.Exec("INSERT INTO test (id, email) VALUES (1, 'a@x')")
+		require.Equal(t, database.ErrDuplicateDocument, err)
+	})
+
+	t.Run("with on conflict and default values", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE SEQUENCE seq;
+			CREATE TABLE test (id INTEGER PRIMARY KEY DEFAULT nextval('seq'));
+			CREATE UNIQUE INDEX idx_test_email ON test (email);
+			INSERT INTO test (email) VALUES ('a@x');
+			INSERT INTO test (email) VALUES ('a@x'), ('b@x') ON CONFLICT DO NOTHING;
+		`)
+		require.NoError(t, err)
+
+		// the default value is evaluated once per document
+		res, err := db.Query("SELECT id, email FROM test")
+		require.NoError(t, err)
+		defer res.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, res)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"id":1,"email":"a@x"},{"id":3,"email":"b@x"}]`, buf.String())
+	})
 }
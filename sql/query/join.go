@@ -0,0 +1,360 @@
+package query
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// JoinClause is a table joined to the tables of a Select statement.
+// Type is either scanner.INNER or scanner.LEFT.
+type JoinClause struct {
+	Type       scanner.Token
+	TableName  string
+	TableAlias string
+	On         Expr
+}
+
+// joinTable holds what is needed to read the documents of a joined table
+// matching the documents selected so far.
+type joinTable struct {
+	qo    queryOptimizer
+	alias string
+	left  bool
+	on    Expr
+	// set if the ON condition compares an indexed field or the primary key
+	// of the table with an expression that can be evaluated before reading it.
+	lookup *queryPlanField
+	// the expression compared to the lookup field.
+	lookupExpr Expr
+}
+
+// newJoinTables prepares the tables joined to the table of the statement.
+// The tables are identified by their alias, which defaults to their name.
+func (stmt SelectStmt) newJoinTables(tx *database.Transaction, args []driver.NamedValue) ([]*joinTable, error) {
+	if len(stmt.Joins) == 0 {
+		return nil, nil
+	}
+
+	if stmt.tableAlias() == "" {
+		return nil, errors.New("a subquery must have an alias to be joined")
+	}
+
+	aliases := map[string]bool{
+		stmt.tableAlias(): true,
+	}
+
+	joins := make([]*joinTable, len(stmt.Joins))
+	for i, jc := range stmt.Joins {
+		alias := jc.TableAlias
+		if alias == "" {
+			alias = jc.TableName
+		}
+
+		if aliases[alias] {
+			return nil, fmt.Errorf("table name %q specified more than once", alias)
+		}
+
+		// the WHERE clause of the statement refers to the joined tables through their aliases,
+		// partial indexes are then never used by joins.
+		qo, err := newQueryOptimizer(tx, jc.TableName, nil)
+		if err != nil {
+			return nil, err
+		}
+		qo.args = args
+
+		j := joinTable{
+			qo:    qo,
+			alias: alias,
+			left:  jc.Type == scanner.LEFT,
+			on:    jc.On,
+		}
+		j.analyseOn(aliases)
+
+		aliases[alias] = true
+		joins[i] = &j
+	}
+
+	return joins, nil
+}
+
+// tableAlias returns the name used to refer to the table of the statement in a join.
+func (stmt SelectStmt) tableAlias() string {
+	if stmt.TableAlias != "" {
+		return stmt.TableAlias
+	}
+
+	return stmt.TableName
+}
+
+// analyseOn looks for an equality in the ON condition that can use an index
+// or the primary key of the joined table. The other side of the equality must be a field
+// of a table joined before, or a value.
+func (j *joinTable) analyseOn(aliases map[string]bool) {
+	var best *queryPlanField
+
+	for _, e := range andOperands(j.on) {
+		op, ok := e.(CmpOp)
+		if !ok || op.Token != scanner.EQ {
+			continue
+		}
+
+		for _, sides := range [2][2]Expr{{op.LeftHand(), op.RightHand()}, {op.RightHand(), op.LeftHand()}} {
+			fs, ok := sides[0].(FieldSelector)
+			if !ok || len(fs) < 2 || fs[0] != j.alias {
+				continue
+			}
+
+			if other, ok := sides[1].(FieldSelector); ok {
+				if !aliases[other[0]] {
+					continue
+				}
+			} else if !evaluatesToScalarOrParam(sides[1]) {
+				continue
+			}
+
+			f := j.qo.indexedField(fs[1:])
+			if f == nil || (best != nil && (best.uniqueIndex || !f.uniqueIndex)) {
+				continue
+			}
+
+			f.op = scanner.EQ
+			best = f
+			j.lookup = f
+			j.lookupExpr = sides[1]
+		}
+	}
+}
+
+// iterator returns the documents of the table that may match d, which contains
+// the documents selected so far. If the ON condition can't use an index, the whole table is read.
+func (j *joinTable) iterator(d document.Document) (document.Iterator, error) {
+	if j.lookup == nil {
+		return j.qo.t, nil
+	}
+
+	v, err := j.lookupExpr.Eval(EvalStack{
+		Tx:         j.qo.tx,
+		Document:   d,
+		Params:     j.qo.args,
+		subqueries: j.qo.subqueries,
+	})
+	if err == document.ErrFieldNotFound {
+		return document.NewIterator(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f := *j.lookup
+	f.e = LiteralValue(v)
+	return j.qo.fieldIterator(&f, scanner.ASC), nil
+}
+
+// joinIterator combines the documents of the table with the documents of the joined tables,
+// using nested loops. It returns documents containing one field per table, named after the alias
+// of the table. If a LEFT JOIN doesn't match any document, the field of the table is NULL.
+type joinIterator struct {
+	src   document.Iterator
+	alias string
+	joins []*joinTable
+	args  []driver.NamedValue
+	// configuration of the tables, by alias.
+	cfgs map[string]*database.TableConfig
+}
+
+// joinedTables returns the configuration of the table of the optimizer and of the tables
+// joined to it, by alias. It returns nil if there are no joined tables.
+func (qo *queryOptimizer) joinedTables() map[string]*database.TableConfig {
+	if len(qo.joins) == 0 {
+		return nil
+	}
+
+	cfgs := map[string]*database.TableConfig{
+		qo.alias: qo.cfg,
+	}
+	for _, j := range qo.joins {
+		cfgs[j.alias] = j.qo.cfg
+	}
+
+	return cfgs
+}
+
+func (it joinIterator) Iterate(fn func(d document.Document) error) error {
+	return it.src.Iterate(func(d document.Document) error {
+		fb := document.NewFieldBuffer()
+		fb.Add(it.alias, document.NewDocumentValue(d))
+
+		return it.join(joinedDocument{Document: fb, cfgs: it.cfgs}, 0, fn)
+	})
+}
+
+// join adds the documents of the i-th joined table matching the ON condition to jd
+// and calls fn once for every combination of the remaining tables.
+func (it joinIterator) join(jd joinedDocument, i int, fn func(d document.Document) error) error {
+	if i == len(it.joins) {
+		return fn(jd)
+	}
+
+	j := it.joins[i]
+
+	src, err := j.iterator(jd)
+	if err != nil {
+		return err
+	}
+
+	match := whereClause(j.on, EvalStack{
+		Tx:         j.qo.tx,
+		Params:     it.args,
+		subqueries: j.qo.subqueries,
+	})
+
+	var matched bool
+	err = src.Iterate(func(d document.Document) error {
+		cjd, err := jd.withTable(j.alias, document.NewDocumentValue(d))
+		if err != nil {
+			return err
+		}
+
+		ok, err := match(cjd)
+		if err != nil || !ok {
+			return err
+		}
+
+		matched = true
+		return it.join(cjd, i+1, fn)
+	})
+	if err != nil || matched || !j.left {
+		return err
+	}
+
+	cjd, err := jd.withTable(j.alias, document.NewNullValue())
+	if err != nil {
+		return err
+	}
+
+	return it.join(cjd, i+1, fn)
+}
+
+// joinedDocument holds the documents of the joined tables, in fields named after their alias.
+// A field which isn't prefixed by an alias is looked up in the document of every table:
+// it must either be declared by the field constraints of exactly one table,
+// or be found in exactly one document.
+type joinedDocument struct {
+	document.Document
+
+	// configuration of the tables, by alias.
+	cfgs map[string]*database.TableConfig
+}
+
+// withTable returns a copy of jd with a field holding the document of a table.
+func (jd joinedDocument) withTable(alias string, v document.Value) (joinedDocument, error) {
+	fb := document.NewFieldBuffer()
+	err := fb.ScanDocument(jd.Document)
+	if err != nil {
+		return jd, err
+	}
+
+	fb.Add(alias, v)
+	return joinedDocument{Document: fb, cfgs: jd.cfgs}, nil
+}
+
+// GetByField returns the document of the table with the given alias, or the value
+// of the field of the only table it belongs to. It returns an error if the field
+// belongs to more than one table or to none of them.
+func (jd joinedDocument) GetByField(field string) (document.Value, error) {
+	v, err := jd.Document.GetByField(field)
+	if err != document.ErrFieldNotFound {
+		return v, err
+	}
+
+	var table string
+	var missingTable bool
+	var verr error
+	err = jd.Document.Iterate(func(alias string, tv document.Value) error {
+		// the table wasn't matched by a LEFT JOIN
+		if tv.Type != document.DocumentValue {
+			missingTable = true
+			return nil
+		}
+
+		fv, ferr := tv.V.(document.Document).GetByField(field)
+		if ferr == document.ErrFieldNotFound && !declaresField(jd.cfgs[alias], field) {
+			return nil
+		}
+		if ferr != nil && ferr != document.ErrFieldNotFound {
+			return ferr
+		}
+
+		if table != "" {
+			return fmt.Errorf("ambiguous field %q, found in tables %q and %q", field, table, alias)
+		}
+
+		table = alias
+		v, verr = fv, ferr
+		return nil
+	})
+	if err != nil {
+		return document.Value{}, err
+	}
+
+	switch {
+	case table != "":
+		return v, verr
+	case missingTable:
+		return document.Value{}, document.ErrFieldNotFound
+	}
+
+	return document.Value{}, fmt.Errorf("unknown field %q", field)
+}
+
+// declaresField reports whether the field constraints of the table contain the given field.
+func declaresField(cfg *database.TableConfig, field string) bool {
+	if cfg == nil {
+		return false
+	}
+
+	for _, fc := range cfg.FieldConstraints {
+		if fc.Path[0] == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// explainJoins adds the description of the way the joined tables are read to fb.
+func explainJoins(fb *document.FieldBuffer, joins []*joinTable) {
+	var vb document.ValueBuffer
+	for _, j := range joins {
+		jfb := document.NewFieldBuffer()
+		jfb.Add("table", document.NewTextValue(j.qo.tableName))
+		jfb.Add("alias", document.NewTextValue(j.alias))
+
+		typ := scanner.INNER
+		if j.left {
+			typ = scanner.LEFT
+		}
+		jfb.Add("type", document.NewTextValue(typ.String()))
+
+		switch {
+		case j.lookup == nil:
+			jfb.Add("scan", document.NewTextValue("table"))
+		case j.lookup.isPrimaryKey:
+			jfb.Add("scan", document.NewTextValue("primary key"))
+			jfb.Add("field", document.NewTextValue(j.lookup.indexedField.Name()))
+		default:
+			jfb.Add("scan", document.NewTextValue("index"))
+			jfb.Add("index", document.NewTextValue(j.qo.indexes[j.lookup.indexedField.Name()].IndexName))
+			jfb.Add("field", document.NewTextValue(j.lookup.indexedField.Name()))
+		}
+
+		vb = vb.Append(document.NewDocumentValue(jfb))
+	}
+
+	fb.Add("joins", document.NewArrayValue(vb))
+}
@@ -0,0 +1,133 @@
+package query_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		fails    bool
+		expected string
+	}{
+		{"Inner", "SELECT u.name, o.total FROM users u JOIN orders o ON o.user_id = u.id", false,
+			`[{"u.name":"alice","o.total":10},{"u.name":"alice","o.total":20},{"u.name":"bob","o.total":5}]`},
+		{"Inner, swapped operands", "SELECT u.name, o.total FROM users AS u INNER JOIN orders AS o ON u.id = o.user_id", false,
+			`[{"u.name":"alice","o.total":10},{"u.name":"alice","o.total":20},{"u.name":"bob","o.total":5}]`},
+		{"Left", "SELECT u.name, o FROM users u LEFT JOIN orders o ON o.user_id = u.id AND o.total < 20", false,
+			`[{"u.name":"alice","o":{"id":1,"user_id":1,"total":10}},{"u.name":"bob","o":{"id":3,"user_id":2,"total":5}},{"u.name":"carol","o":null}]`},
+		{"Where and order by", "SELECT u.name, o.total FROM users u JOIN orders o ON o.user_id = u.id WHERE o.total > 5 ORDER BY o.total DESC", false,
+			`[{"u.name":"alice","o.total":20},{"u.name":"alice","o.total":10}]`},
+		{"Wildcard", "SELECT * FROM users u JOIN orders o ON o.user_id = u.id AND u.id = 2", false,
+			`[{"u":{"id":2,"name":"bob"},"o":{"id":3,"user_id":2,"total":5}}]`},
+		{"Primary key", "SELECT o.id, u.name FROM orders o JOIN users u ON u.id = o.user_id", false,
+			`[{"o.id":1,"u.name":"alice"},{"o.id":2,"u.name":"alice"},{"o.id":3,"u.name":"bob"}]`},
+		{"Table names", "SELECT users.name FROM users JOIN orders ON orders.user_id = users.id WHERE orders.total = 5", false,
+			`[{"users.name":"bob"}]`},
+		{"Group by", "SELECT u.name, COUNT(*) FROM users u JOIN orders o ON o.user_id = u.id GROUP BY u.name", false,
+			`[{"u.name":"alice","COUNT(*)":2},{"u.name":"bob","COUNT(*)":1}]`},
+		{"Unqualified fields", "SELECT name, total FROM users u JOIN orders o ON user_id = u.id WHERE total > 5 ORDER BY total", false,
+			`[{"name":"alice","total":10},{"name":"alice","total":20}]`},
+		{"Unqualified fields of a missing table", "SELECT name, total FROM users u LEFT JOIN orders o ON o.user_id = u.id AND o.total < 10", false,
+			`[{"name":"alice","total":null},{"name":"bob","total":5},{"name":"carol","total":null}]`},
+		{"Ambiguous field", "SELECT u.name FROM users u JOIN orders o ON o.user_id = u.id WHERE id = 1", true, ``},
+		{"Unknown field", "SELECT u.name FROM users u JOIN orders o ON o.user_id = u.id WHERE foo = 1", true, ``},
+		{"Unqualified group by", "SELECT name, COUNT(*) FROM users u JOIN orders o ON o.user_id = u.id GROUP BY name", false,
+			`[{"name":"alice","COUNT(*)":2},{"name":"bob","COUNT(*)":1}]`},
+		{"Unqualified having", "SELECT u.name FROM users u JOIN orders o ON o.user_id = u.id GROUP BY u.name HAVING name = 'bob'", false,
+			`[{"u.name":"bob"}]`},
+		{"Single table alias", "SELECT t.name FROM users t WHERE t.id = 3", false,
+			`[{"t.name":"carol"}]`},
+		{"Duplicate alias", "SELECT * FROM users JOIN users ON users.id = 1", true, ``},
+		{"Unknown table", "SELECT * FROM users u JOIN foo f ON f.id = u.id", true, ``},
+	}
+
+	for _, withIndex := range []bool{false, true} {
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%s/index=%v", test.name, withIndex), func(t *testing.T) {
+				db, err := genji.Open(":memory:")
+				require.NoError(t, err)
+				defer db.Close()
+
+				err = db.Exec(`
+					CREATE TABLE users (id INTEGER PRIMARY KEY);
+					CREATE TABLE orders;
+				`)
+				require.NoError(t, err)
+
+				if withIndex {
+					err = db.Exec("CREATE INDEX idx_orders_user_id ON orders (user_id)")
+					require.NoError(t, err)
+				}
+
+				err = db.Exec(`
+					INSERT INTO users (id, name) VALUES (1, 'alice'), (2, 'bob'), (3, 'carol');
+					INSERT INTO orders (id, user_id, total) VALUES (1, 1, 10), (2, 1, 20), (3, 2, 5);
+				`)
+				require.NoError(t, err)
+
+				st, err := db.Query(test.query)
+				if err == nil {
+					defer st.Close()
+				}
+				if test.fails {
+					if err == nil {
+						err = document.IteratorToJSONArray(new(bytes.Buffer), st)
+					}
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			})
+		}
+	}
+
+	t.Run("Explain", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE users (id INTEGER PRIMARY KEY);
+			CREATE TABLE orders;
+			CREATE TABLE tags;
+			CREATE INDEX idx_orders_user_id ON orders (user_id);
+		`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			query    string
+			expected string
+		}{
+			{"EXPLAIN SELECT * FROM users u JOIN orders o ON o.user_id = u.id",
+				`{"table":"users","alias":"u","joins":[{"table":"orders","alias":"o","type":"INNER","scan":"index","index":"idx_orders_user_id","field":"user_id"}],"scan":"table","sort":false}`},
+			{"EXPLAIN SELECT * FROM orders LEFT JOIN users ON users.id = orders.user_id WHERE orders.total > 10",
+				`{"table":"orders","alias":"orders","joins":[{"table":"users","alias":"users","type":"LEFT","scan":"primary key","field":"id"}],"scan":"table","sort":false}`},
+			{"EXPLAIN SELECT * FROM orders o JOIN tags t ON t.order_id = o.id",
+				`{"table":"orders","alias":"o","joins":[{"table":"tags","alias":"t","type":"INNER","scan":"table"}],"scan":"table","sort":false}`},
+		}
+
+		for _, test := range tests {
+			st, err := db.Query(test.query)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			st.Close()
+			require.NoError(t, err)
+			require.JSONEq(t, "["+test.expected+"]", buf.String())
+		}
+	})
+}
@@ -3,8 +3,12 @@ package query
 import (
 	"bytes"
 	"container/heap"
+	"context"
 	"database/sql/driver"
 	"errors"
+	"reflect"
+	"regexp/syntax"
+	"sort"
 
 	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
@@ -20,15 +24,41 @@ type queryPlan struct {
 	sorted    bool
 }
 
+// queryPlanField describes how to select the documents matching a part of the where clause,
+// either by reading an index or the primary key, or by combining the keys selected by other fields.
 type queryPlanField struct {
 	indexedField FieldSelector
 	op           scanner.Token
 	e            Expr
+	// set if the field is compared to one or more ranges, i.e. a > 1 AND a <= 10.
+	// The bounds are merged into a single range once evaluated.
+	bounds       []rangeBound
 	uniqueIndex  bool
 	isPrimaryKey bool
+	// set if an index on multiple fields is used,
+	// in which case the other fields are ignored.
+	composite *compositeRange
+	// set if the documents are selected by any (OR) or all (AND) of these fields.
+	union        []*queryPlanField
+	intersection []*queryPlanField
 }
 
-func newQueryOptimizer(tx *database.Transaction, tableName string) (qo queryOptimizer, err error) {
+// rangeBound is a lower or upper bound of a field, i.e. a > 10.
+type rangeBound struct {
+	op scanner.Token
+	e  Expr
+}
+
+// compositeRange describes the tuples of an index on multiple fields matching a query:
+// the first values of the tuples are equal to the eq expressions and, if there are bounds,
+// the next value is within the range they describe.
+type compositeRange struct {
+	index  database.Index
+	eq     []Expr
+	bounds []rangeBound
+}
+
+func newQueryOptimizer(tx *database.Transaction, tableName string, whereExpr Expr) (qo queryOptimizer, err error) {
 	t, err := tx.GetTable(tableName)
 	if err != nil {
 		return
@@ -39,116 +69,407 @@ func newQueryOptimizer(tx *database.Transaction, tableName string) (qo queryOpti
 		return
 	}
 
+	indexes, err = usableIndexes(tx, indexes, whereExpr)
+	if err != nil {
+		return
+	}
+
 	cfg, err := t.Config()
 	if err != nil {
 		return
 	}
 
+	stats, err := t.Stats()
+	if err != nil {
+		return
+	}
+
+	// the statistics of an empty table can't tell anything about
+	// the documents inserted since it was analyzed.
+	if stats != nil && stats.RowCount == 0 {
+		stats = nil
+	}
+
 	return queryOptimizer{
 		tx:        tx,
 		t:         t,
+		src:       t,
 		tableName: tableName,
+		whereExpr: whereExpr,
 		cfg:       cfg,
 		indexes:   indexes,
+		stats:     stats,
+	}, nil
+}
+
+// usableIndexes returns the indexes that can be used to run a query filtered by the given
+// WHERE clause, by indexed paths. Partial indexes only contain the documents satisfying
+// their predicate, so they are only usable if the WHERE clause implies it. In that case,
+// they are preferred over the full index on the same paths, since they are smaller.
+func usableIndexes(tx *database.Transaction, indexes map[string]database.Index, whereExpr Expr) (map[string]database.Index, error) {
+	usable := make(map[string]database.Index, len(indexes))
+
+	for _, idx := range indexes {
+		if idx.Where != "" {
+			continue
+		}
+
+		usable[idx.PathsString()] = idx
+	}
+
+	// sort partial indexes by name to always select the same index
+	var partial []database.Index
+	for _, idx := range indexes {
+		if idx.Where != "" {
+			partial = append(partial, idx)
+		}
+	}
+	sort.Slice(partial, func(i, j int) bool { return partial[i].IndexName < partial[j].IndexName })
+
+	selected := make(map[string]bool)
+	for _, idx := range partial {
+		name := idx.PathsString()
+		if selected[name] {
+			continue
+		}
+
+		e, err := idx.Predicate(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		ce, ok := e.(ConstraintExpr)
+		if !ok || !implies(whereExpr, ce.Expr) {
+			continue
+		}
+
+		usable[name] = idx
+		selected[name] = true
+	}
+
+	return usable, nil
+}
+
+// implies reports whether every document matching the condition a also matches b.
+// It is conservative: every operand of b must be one of the AND operands of a,
+// except for "field IS NOT NULL" which is also implied by the comparison
+// of the field with a literal that isn't NULL.
+func implies(a, b Expr) bool {
+	operands := andOperands(a)
+
+	for _, op := range andOperands(b) {
+		if !impliedByOperands(op, operands) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func impliedByOperands(e Expr, operands []Expr) bool {
+	for _, op := range operands {
+		if reflect.DeepEqual(e, op) {
+			return true
+		}
+	}
+
+	is, ok := e.(IsOp)
+	if !ok || is.Token != scanner.ISN {
+		return false
+	}
+
+	fs, ok := is.LeftHand().(FieldSelector)
+	if !ok {
+		return false
+	}
+	if lv, ok := is.RightHand().(LiteralValue); !ok || lv.Type != document.NullValue {
+		return false
+	}
+
+	for _, op := range operands {
+		cmp, ok := op.(CmpOp)
+		if !ok || cmp.Token == scanner.IN {
+			continue
+		}
+
+		ok, f, v := cmpOpCanUseIndex(&cmp)
+		if !ok || f.Name() != fs.Name() {
+			continue
+		}
+
+		if lv, ok := v.(LiteralValue); ok && lv.Type != document.NullValue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newSubqueryOptimizer returns an optimizer reading the result of a statement
+// instead of a table. Since it has no index, its documents are always scanned.
+func newSubqueryOptimizer(tx *database.Transaction, stmt SelectStmt, args []driver.NamedValue) (queryOptimizer, error) {
+	res, err := stmt.exec(tx, args)
+	if err != nil {
+		return queryOptimizer{}, err
+	}
+
+	return queryOptimizer{
+		tx:  tx,
+		src: res.Stream,
+		cfg: new(database.TableConfig),
 	}, nil
 }
 
-// queryOptimizer is a really dumb query optimizer. gotta start somewhere. please don't be mad at me.
+// queryOptimizer selects the way of reading a table that reads the fewest documents.
+// Without statistics, it prefers any usable index over a table scan.
 type queryOptimizer struct {
-	tx               *database.Transaction
-	t                *database.Table
-	tableName        string
-	whereExpr        Expr
-	args             []driver.NamedValue
-	cfg              *database.TableConfig
-	indexes          map[string]database.Index
-	orderBy          FieldSelector
-	orderByDirection scanner.Token
-	limit            int
-	offset           int
+	tx *database.Transaction
+	t  *database.Table
+	// documents read by a table scan, either the table or the result of a subquery,
+	// in which case t is nil.
+	src       document.Iterator
+	tableName string
+	whereExpr Expr
+	args      []driver.NamedValue
+	cfg       *database.TableConfig
+	indexes   map[string]database.Index
+	// statistics of the table, nil if it hasn't been analyzed.
+	// If set, the cost of every way of reading the table is estimated.
+	stats   *database.TableStats
+	orderBy []OrderByField
+	limit   int
+	offset  int
+	groupBy FieldSelector
+	having  Expr
+	// tables joined to the table. If set, the documents contain one field
+	// per table, named after its alias.
+	alias string
+	joins []*joinTable
+	// results of the subqueries of the statement.
+	subqueries subqueryResults
 }
 
 func (qo *queryOptimizer) optimizeQuery() (st document.Stream, err error) {
 	qp := qo.buildQueryPlan()
 
+	// only a query sorted by one field can read an index or the primary key in order
+	orderByDirection := scanner.ASC
+	if len(qo.orderBy) == 1 {
+		orderByDirection = qo.orderBy[0].Direction
+	}
+
 	switch {
+	case len(qo.joins) > 0:
+		st = document.NewStream(joinIterator{
+			src:   qo.src,
+			alias: qo.alias,
+			joins: qo.joins,
+			args:  qo.args,
+			cfgs:  qo.joinedTables(),
+		})
 	case qp.scanTable:
-		st = document.NewStream(qo.t)
-	case qp.field.isPrimaryKey:
-		if qp.field.e == nil {
-			st = document.NewStream(pkIterator{
-				tx:               qo.tx,
-				tb:               qo.t,
-				cfg:              qo.cfg,
-				args:             qo.args,
-				op:               qp.field.op,
-				e:                qp.field.e,
-				orderByDirection: qo.orderByDirection,
-			})
-			break
-		}
+		st = document.NewStream(qo.src)
+	default:
+		st = document.NewStream(qo.fieldIterator(qp.field, orderByDirection))
+	}
 
-		var v document.Value
-		v, err = qp.field.e.Eval(EvalStack{
-			Tx:     qo.tx,
-			Params: qo.args,
-		})
-		if err != nil {
-			return
+	st = st.Filter(whereClause(qo.whereExpr, EvalStack{
+		Tx:         qo.tx,
+		Params:     qo.args,
+		subqueries: qo.subqueries,
+	}))
+
+	if len(qo.orderBy) != 0 && !qp.sorted {
+		st, err = qo.sortIterator(st)
+	}
+
+	return
+}
+
+// fieldIterator returns an iterator that selects the documents described by f.
+func (qo *queryOptimizer) fieldIterator(f *queryPlanField, orderByDirection scanner.Token) scanIterator {
+	switch {
+	case f.union != nil || f.intersection != nil:
+		fields := f.union
+		if fields == nil {
+			fields = f.intersection
 		}
 
-		v, err := v.ConvertTo(qo.cfg.GetPrimaryKey().Type)
-		if err != nil {
-			st = document.NewStream(qo.t)
-			break
+		its := make([]scanIterator, len(fields))
+		for i := range fields {
+			its[i] = qo.fieldIterator(fields[i], scanner.ASC)
 		}
 
-		st = document.NewStream(pkIterator{
+		if f.union != nil {
+			return unionIterator{tb: qo.t, its: its}
+		}
+		return intersectionIterator{tb: qo.t, its: its}
+	case f.composite != nil:
+		return compositeIterator{
+			tx:   qo.tx,
+			tb:   qo.t,
+			args: qo.args,
+			r:    f.composite,
+		}
+	case f.isPrimaryKey:
+		return pkIterator{
 			tx:               qo.tx,
 			tb:               qo.t,
 			cfg:              qo.cfg,
 			args:             qo.args,
-			op:               qp.field.op,
-			e:                qp.field.e,
-			orderByDirection: qo.orderByDirection,
-			evalValue:        v,
+			op:               f.op,
+			e:                f.e,
+			bounds:           f.bounds,
+			orderByDirection: orderByDirection,
+		}
+	}
+
+	return indexIterator{
+		tx:               qo.tx,
+		tb:               qo.t,
+		args:             qo.args,
+		op:               f.op,
+		e:                f.e,
+		bounds:           f.bounds,
+		index:            qo.indexes[f.indexedField.Name()],
+		orderByDirection: orderByDirection,
+	}
+}
+
+// optimizeAggregation returns a stream of aggregated documents, which hold the result
+// of the aggregate functions. If there is no group by field, the stream contains only one document.
+func (qo *queryOptimizer) optimizeAggregation(selectors []ResultField, builders []AggregatorBuilder) (st document.Stream, err error) {
+	stack := EvalStack{
+		Tx:         qo.tx,
+		Params:     qo.args,
+		Cfg:        qo.cfg,
+		subqueries: qo.subqueries,
+		tables:     qo.joinedTables(),
+	}
+
+	switch {
+	case len(qo.groupBy) == 0:
+		if it, ok := qo.minMaxIterator(selectors); ok && qo.having == nil {
+			return document.NewStream(it), nil
+		}
+
+		st, err = qo.optimizeQuery()
+		if err != nil {
+			return
+		}
+
+		st = document.NewStream(aggregateIterator{
+			st:       st,
+			builders: builders,
+			stack:    stack,
 		})
 	default:
-		st = document.NewStream(indexIterator{
-			tx:               qo.tx,
-			tb:               qo.t,
-			args:             qo.args,
-			op:               qp.field.op,
-			e:                qp.field.e,
-			index:            qo.indexes[qp.field.indexedField.Name()],
-			orderByDirection: qo.orderByDirection,
+		var ok bool
+		st, ok = qo.orderedByGroupKey()
+		if ok {
+			st = document.NewStream(sortedGroupIterator{
+				st:       st,
+				groupBy:  qo.groupBy,
+				builders: builders,
+				stack:    stack,
+			})
+			break
+		}
+
+		st, err = qo.optimizeQuery()
+		if err != nil {
+			return
+		}
+
+		st = document.NewStream(hashGroupIterator{
+			st:        st,
+			groupBy:   qo.groupBy,
+			builders:  builders,
+			stack:     stack,
+			maxGroups: maxGroupsInMemory,
 		})
 	}
 
-	st = st.Filter(whereClause(qo.whereExpr, EvalStack{
-		Tx:     qo.tx,
-		Params: qo.args,
-	}))
+	if qo.having != nil {
+		st = st.Filter(whereClause(qo.having, stack))
+	}
 
-	if len(qo.orderBy) != 0 && !qp.sorted {
-		st, err = qo.sortIterator(st)
+	return st, nil
+}
+
+// orderedByGroupKey returns a stream of the documents matching the where clause, ordered by the
+// group by field, if it is indexed or if it is a typed primary key.
+func (qo *queryOptimizer) orderedByGroupKey() (document.Stream, bool) {
+	if len(qo.joins) > 0 {
+		return document.Stream{}, false
 	}
 
-	return
+	var it document.Iterator
+
+	if idx, ok := qo.indexes[qo.groupBy.Name()]; ok {
+		it = indexIterator{
+			tx:               qo.tx,
+			tb:               qo.t,
+			args:             qo.args,
+			index:            idx,
+			orderByDirection: scanner.ASC,
+		}
+	} else {
+		pk := qo.cfg.GetPrimaryKey()
+		if pk == nil || pk.Type == 0 || pk.Path.String() != qo.groupBy.Name() {
+			return document.Stream{}, false
+		}
+
+		it = pkIterator{
+			tx:               qo.tx,
+			tb:               qo.t,
+			cfg:              qo.cfg,
+			args:             qo.args,
+			orderByDirection: scanner.ASC,
+		}
+	}
+
+	return document.NewStream(it).Filter(whereClause(qo.whereExpr, EvalStack{
+		Tx:         qo.tx,
+		Params:     qo.args,
+		Cfg:        qo.cfg,
+		subqueries: qo.subqueries,
+	})), true
 }
 
 func (qo *queryOptimizer) buildQueryPlan() queryPlan {
 	var qp queryPlan
 
+	// the where clause of a join applies to the combined documents
+	if len(qo.joins) > 0 {
+		qp.scanTable = true
+		return qp
+	}
+
 	qp.field = qo.analyseExpr(qo.whereExpr)
+	// an equality on a primary key or a unique index selects at most one document
+	if qp.field == nil || !qp.field.uniqueIndex || qp.field.op != scanner.EQ {
+		f := qo.analyseCompositeIndexes(qo.whereExpr)
+		if f != nil && (qp.field == nil || qo.stats == nil || qo.estimateCost(f) < qo.estimateCost(qp.field)) {
+			qp.field = f
+		}
+	}
+
+	// reading an index that selects most of the documents is more expensive than reading the table
+	if qp.field != nil && qo.stats != nil && qo.estimateCost(qp.field) >= qo.scanCost() {
+		qp.field = nil
+	}
+
 	if qp.field == nil {
-		if len(qo.orderBy) != 0 {
-			_, ok := qo.indexes[qo.orderBy.Name()]
+		if len(qo.orderBy) == 1 {
+			fs := qo.orderBy[0].Field
+			_, ok := qo.indexes[fs.Name()]
 			pk := qo.cfg.GetPrimaryKey()
-			if ok || (pk != nil && pk.Path.String() == qo.orderBy.Name()) {
+			isPrimaryKey := pk != nil && pk.Path.String() == fs.Name()
+			if ok || isPrimaryKey {
 				qp.field = &queryPlanField{
-					indexedField: qo.orderBy,
-					isPrimaryKey: pk.Path.String() == qo.orderBy.Name(),
+					indexedField: fs,
+					isPrimaryKey: isPrimaryKey,
 				}
 				qp.sorted = true
 
@@ -165,232 +486,995 @@ func (qo *queryOptimizer) buildQueryPlan() queryPlan {
 // analyseExpr is a recursive function that scans each node the e Expr tree.
 // If it contains a comparison operator, it checks if this operator and its operands
 // can benefit from using an index. This check is done in the cmpOpCanUseIndex function.
-// If it contains an AND operator it checks if one of the operands can use an index.
+// If it contains AND operators, it selects the operand that can read the fewest documents,
+// merges the ranges of the same field and intersects the keys of equalities on different fields.
+// If it contains OR operators, the keys selected by each operand are merged, provided that all
+// of them can use an index.
 func (qo *queryOptimizer) analyseExpr(e Expr) *queryPlanField {
 	switch t := e.(type) {
 	case CmpOp:
 		ok, fs, e := cmpOpCanUseIndex(&t)
-		if !ok || !evaluatesToScalarOrParam(e) {
+		if !ok {
 			return nil
 		}
+		e = qo.subqueryValue(e)
 
-		idx, ok := qo.indexes[fs.Name()]
-		if ok {
-			return &queryPlanField{
-				indexedField: fs,
-				op:           t.Token,
-				e:            e,
-				uniqueIndex:  idx.Unique,
-			}
+		// IN requires one seek per value of the list, so it can't be considered
+		// as selective as an equality on a unique index.
+		isIn := t.Token == scanner.IN
+		if isIn {
+			ok = evaluatesToScalarOrParamList(e)
+		} else {
+			ok = evaluatesToScalarOrParam(e)
+		}
+		if !ok {
+			return nil
 		}
 
-		pk := qo.cfg.GetPrimaryKey()
-		if pk != nil && pk.Path.String() == fs.Name() {
-			return &queryPlanField{
-				indexedField: fs,
-				op:           t.Token,
-				e:            e,
-				uniqueIndex:  true,
-				isPrimaryKey: true,
-			}
+		f := qo.indexedField(fs)
+		if f == nil {
+			return nil
 		}
 
-		return nil
+		tok := t.Token
+		// expr OP field is turned into field OP' expr
+		if _, ok := t.LeftHand().(FieldSelector); !ok {
+			tok = swapCmpToken(tok)
+		}
 
-	case *AndOp:
-		nodeL := qo.analyseExpr(t.LeftHand())
-		nodeR := qo.analyseExpr(t.LeftHand())
+		switch tok {
+		case scanner.EQ:
+			f.op = tok
+			f.e = e
+		case scanner.IN:
+			f.op = tok
+			f.e = e
+			f.uniqueIndex = false
+		default:
+			f.bounds = []rangeBound{{tok, e}}
+			f.uniqueIndex = false
+		}
+
+		return f
 
-		if nodeL == nil && nodeR == nil {
+	case RegexOp:
+		ok, fs, e := regexOpCanUseIndex(&t)
+		if !ok {
 			return nil
 		}
 
-		if nodeL != nil && nodeL.uniqueIndex {
-			return nodeL
+		f := qo.indexedField(fs)
+		if f == nil {
+			return nil
 		}
 
-		if nodeR != nil && nodeR.uniqueIndex {
-			return nodeR
-		}
+		f.op = t.Token
+		f.e = e
+		f.uniqueIndex = false
+		return f
 
-		return nodeL
-	}
+	case IsOp:
+		// missing fields are indexed as null values,
+		// so a IS b can use an index the same way a = b does.
+		if t.Token != scanner.IS {
+			return nil
+		}
 
-	return nil
-}
+		return qo.analyseExpr(Eq(t.LeftHand(), t.RightHand()))
 
-func cmpOpCanUseIndex(cmp *CmpOp) (bool, FieldSelector, Expr) {
-	switch cmp.Token {
-	case scanner.EQ, scanner.GT, scanner.GTE, scanner.LT, scanner.LTE:
-	default:
-		return false, nil, nil
-	}
+	case Parentheses:
+		return qo.analyseExpr(t.E)
 
-	lf, leftIsField := cmp.LeftHand().(FieldSelector)
-	rf, rightIsField := cmp.RightHand().(FieldSelector)
+	case *AndOp:
+		return qo.analyseAndOperands(andOperands(t))
+
+	case *OrOp:
+		operands := orOperands(t)
+		fields := make([]*queryPlanField, 0, len(operands))
+		for _, e := range operands {
+			f := qo.analyseExpr(e)
+			// if one of the operands can't use an index, the table must be read anyway
+			if f == nil {
+				return nil
+			}
 
-	// field OP expr
-	if leftIsField && !rightIsField {
-		return true, lf, cmp.RightHand()
-	}
+			fields = append(fields, f)
+		}
 
-	// expr OP field
-	if rightIsField && !leftIsField {
-		return true, rf, cmp.LeftHand()
+		return &queryPlanField{union: fields}
 	}
 
-	return false, nil, nil
+	return nil
 }
 
-func evaluatesToScalarOrParam(e Expr) bool {
-	switch e.(type) {
-	case LiteralValue:
-		return true
-	case NamedParam, PositionalParam:
-		return true
+// indexedField returns a queryPlanField if the field is indexed or is the primary key.
+func (qo *queryOptimizer) indexedField(fs FieldSelector) *queryPlanField {
+	if idx, ok := qo.indexes[fs.Name()]; ok {
+		return &queryPlanField{
+			indexedField: fs,
+			uniqueIndex:  idx.Unique,
+		}
 	}
 
-	return false
-}
+	pk := qo.cfg.GetPrimaryKey()
+	if pk != nil && pk.Path.String() == fs.Name() {
+		return &queryPlanField{
+			indexedField: fs,
+			uniqueIndex:  true,
+			isPrimaryKey: true,
+		}
+	}
 
-type indexIterator struct {
-	tx               *database.Transaction
-	tb               *database.Table
-	args             []driver.NamedValue
-	index            index.Index
-	op               scanner.Token
-	e                Expr
-	orderByDirection scanner.Token
+	return nil
 }
 
-var errStop = errors.New("stop")
+// analyseAndOperands selects the documents matching all the operands of a tree of AND operators.
+func (qo *queryOptimizer) analyseAndOperands(operands []Expr) *queryPlanField {
+	var fields []*queryPlanField
 
-func (it indexIterator) Iterate(fn func(d document.Document) error) error {
-	if it.e == nil {
-		var err error
+	for _, e := range operands {
+		f := qo.analyseExpr(e)
+		if f == nil {
+			continue
+		}
 
-		if it.orderByDirection == scanner.DESC {
-			err = it.index.DescendLessOrEqual(nil, func(val document.Value, key []byte) error {
-				r, err := it.tb.GetDocument(key)
-				if err != nil {
-					return err
-				}
+		if f.uniqueIndex && f.op == scanner.EQ {
+			return f
+		}
 
-				return fn(r)
-			})
-		} else {
-			err = it.index.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
-				r, err := it.tb.GetDocument(key)
-				if err != nil {
-					return err
+		// the ranges of the same field are merged into one
+		if f.bounds != nil {
+			var merged bool
+			for _, g := range fields {
+				if g.bounds != nil && g.isPrimaryKey == f.isPrimaryKey && g.indexedField.Name() == f.indexedField.Name() {
+					g.bounds = append(g.bounds, f.bounds...)
+					merged = true
+					break
 				}
-
-				return fn(r)
-			})
+			}
+			if merged {
+				continue
+			}
 		}
 
-		return err
+		fields = append(fields, f)
 	}
 
-	v, err := it.e.Eval(EvalStack{
-		Tx:     it.tx,
-		Params: it.args,
-	})
-	if err != nil {
-		return err
+	if len(fields) == 0 {
+		return nil
 	}
 
-	if v.Type.IsNumber() {
-		v, err = v.ConvertTo(document.Float64Value)
-		if err != nil {
-			return err
+	// the keys of the equalities on different fields are intersected,
+	// reading the index entries is cheaper than reading documents that will be filtered out.
+	var eqs []*queryPlanField
+	names := make(map[string]bool)
+	for _, f := range fields {
+		if f.op != scanner.EQ && f.op != scanner.IN {
+			continue
+		}
+
+		if !names[f.indexedField.Name()] {
+			names[f.indexedField.Name()] = true
+			eqs = append(eqs, f)
 		}
 	}
+	var intersection *queryPlanField
+	if len(eqs) > 1 {
+		intersection = &queryPlanField{intersection: eqs}
+	}
 
-	switch it.op {
-	case scanner.EQ:
-		err = it.index.AscendGreaterOrEqual(&index.Pivot{Value: v}, func(val document.Value, key []byte) error {
-			ok, err := v.IsEqual(val)
-			if err != nil {
-				return err
+	if qo.stats != nil {
+		best := intersection
+		for _, f := range fields {
+			if best == nil || qo.estimateCost(f) < qo.estimateCost(best) {
+				best = f
 			}
+		}
 
-			if ok {
-				r, err := it.tb.GetDocument(key)
-				if err != nil {
-					return err
-				}
+		return best
+	}
 
-				return fn(r)
-			}
+	if intersection != nil {
+		return intersection
+	}
 
-			return errStop
-		})
+	best := fields[0]
+	for _, f := range fields[1:] {
+		if f.rank() < best.rank() {
+			best = f
+		}
+	}
+
+	return best
+}
+
+// rank estimates how selective a field is, from the most to the least selective.
+func (f *queryPlanField) rank() int {
+	switch {
+	case f.intersection != nil:
+		return 0
+	case f.op == scanner.EQ:
+		return 1
+	case f.op == scanner.IN:
+		return 2
+	case f.union != nil:
+		return 3
+	case f.bounds != nil:
+		if isBoundedRange(f.bounds) {
+			return 4
+		}
+		return 6
+	case f.op == scanner.EQREGEX:
+		return 5
+	}
+
+	return 7
+}
+
+// isBoundedRange returns true if the bounds contain both a lower and an upper bound.
+func isBoundedRange(bounds []rangeBound) bool {
+	var lower, upper bool
+	for _, b := range bounds {
+		switch b.op {
+		case scanner.GT, scanner.GTE:
+			lower = true
+		default:
+			upper = true
+		}
+	}
+
+	return lower && upper
+}
+
+// analyseCompositeIndexes looks for the index on multiple fields that can be used
+// to read the fewest documents. Such an index can be used if the where clause contains, joined
+// with AND operators, equalities on the first fields of the index and
+// optionally ranges on the next field, i.e. a = 1 AND b = 2 AND c > 3 for an index on (a, b, c, d).
+// Only indexes that can use at least two of their fields are selected.
+func (qo *queryOptimizer) analyseCompositeIndexes(e Expr) *queryPlanField {
+	eqs := make(map[string]Expr)
+	ranges := make(map[string][]rangeBound)
+
+	for _, op := range andOperands(e) {
+		if is, ok := op.(IsOp); ok && is.Token == scanner.IS {
+			op = Eq(is.LeftHand(), is.RightHand())
+		}
+
+		cmp, ok := op.(CmpOp)
+		if !ok {
+			continue
+		}
+
+		ok, fs, e := cmpOpCanUseIndex(&cmp)
+		if !ok || !evaluatesToScalarOrParam(e) {
+			continue
+		}
+
+		tok := cmp.Token
+		// expr OP field is turned into field OP' expr
+		if _, ok := cmp.LeftHand().(FieldSelector); !ok {
+			tok = swapCmpToken(tok)
+		}
+
+		switch tok {
+		case scanner.EQ:
+			if _, ok := eqs[fs.Name()]; !ok {
+				eqs[fs.Name()] = e
+			}
+		case scanner.GT, scanner.GTE, scanner.LT, scanner.LTE:
+			ranges[fs.Name()] = append(ranges[fs.Name()], rangeBound{tok, e})
+		}
+	}
+
+	if len(eqs) == 0 && len(ranges) == 0 {
+		return nil
+	}
+
+	// sort indexes by name to always select the same index
+	names := make([]string, 0, len(qo.indexes))
+	for name, idx := range qo.indexes {
+		if len(idx.Paths) > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var best *compositeRange
+	var bestScore int
+	for _, name := range names {
+		idx := qo.indexes[name]
+
+		r := compositeRange{index: idx}
+		for _, p := range idx.Paths {
+			e, ok := eqs[p.String()]
+			if !ok {
+				break
+			}
+			r.eq = append(r.eq, e)
+		}
+
+		score := len(r.eq)
+		if score < len(idx.Paths) {
+			if bounds, ok := ranges[idx.Paths[score].String()]; ok {
+				r.bounds = bounds
+				score++
+			}
+		}
+
+		if score >= 2 && score > bestScore {
+			best, bestScore = &r, score
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	return &queryPlanField{
+		composite:   best,
+		uniqueIndex: best.index.Unique && len(best.eq) == len(best.index.Paths),
+	}
+}
+
+// andOperands returns the operands of a tree of AND operators.
+func andOperands(e Expr) []Expr {
+	if and, ok := e.(*AndOp); ok {
+		return append(andOperands(and.LeftHand()), andOperands(and.RightHand())...)
+	}
+
+	if p, ok := e.(Parentheses); ok {
+		return andOperands(p.E)
+	}
+
+	if e == nil {
+		return nil
+	}
+
+	return []Expr{e}
+}
+
+// orOperands returns the operands of a tree of OR operators.
+func orOperands(e Expr) []Expr {
+	if or, ok := e.(*OrOp); ok {
+		return append(orOperands(or.LeftHand()), orOperands(or.RightHand())...)
+	}
+
+	if p, ok := e.(Parentheses); ok {
+		return orOperands(p.E)
+	}
+
+	return []Expr{e}
+}
+
+// swapCmpToken returns the operator to use when swapping the operands of a comparison.
+func swapCmpToken(tok scanner.Token) scanner.Token {
+	switch tok {
 	case scanner.GT:
+		return scanner.LT
+	case scanner.GTE:
+		return scanner.LTE
+	case scanner.LT:
+		return scanner.GT
+	case scanner.LTE:
+		return scanner.GTE
+	}
+
+	return tok
+}
+
+func cmpOpCanUseIndex(cmp *CmpOp) (bool, FieldSelector, Expr) {
+	switch cmp.Token {
+	case scanner.EQ, scanner.GT, scanner.GTE, scanner.LT, scanner.LTE:
+	case scanner.IN:
+		// only field IN list can use an index, expr IN field
+		// looks for a value inside of an array field.
+		lf, ok := cmp.LeftHand().(FieldSelector)
+		if !ok {
+			return false, nil, nil
+		}
+
+		return true, lf, cmp.RightHand()
+	default:
+		return false, nil, nil
+	}
+
+	lf, leftIsField := cmp.LeftHand().(FieldSelector)
+	rf, rightIsField := cmp.RightHand().(FieldSelector)
+
+	// field OP expr
+	if leftIsField && !rightIsField {
+		return true, lf, cmp.RightHand()
+	}
+
+	// expr OP field
+	if rightIsField && !leftIsField {
+		return true, rf, cmp.LeftHand()
+	}
+
+	return false, nil, nil
+}
+
+// regexOpCanUseIndex checks if the regex operator is in the form field =~ /^prefix.../.
+// If so, it returns the literal prefix every matching value must start with,
+// which can be used to run a prefix scan on an index.
+func regexOpCanUseIndex(op *RegexOp) (bool, FieldSelector, Expr) {
+	if op.Token != scanner.EQREGEX {
+		return false, nil, nil
+	}
+
+	fs, ok := op.LeftHand().(FieldSelector)
+	if !ok {
+		return false, nil, nil
+	}
+
+	re, ok := op.RightHand().(RegexValue)
+	if !ok {
+		return false, nil, nil
+	}
+
+	prefix, ok := anchoredLiteralPrefix(re.String())
+	if !ok {
+		return false, nil, nil
+	}
+
+	return true, fs, TextValue(prefix)
+}
+
+// anchoredLiteralPrefix returns the literal string any match of the pattern
+// must start with, if the pattern is anchored at the beginning of the text.
+func anchoredLiteralPrefix(pattern string) (string, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	re = re.Simplify()
+
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 || re.Sub[0].Op != syntax.OpBeginText {
+		return "", false
+	}
+
+	lit := re.Sub[1]
+	if lit.Op != syntax.OpLiteral || lit.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+
+	return string(lit.Rune), true
+}
+
+func evaluatesToScalarOrParam(e Expr) bool {
+	switch e.(type) {
+	case LiteralValue:
+		return true
+	case NamedParam, PositionalParam:
+		return true
+	}
+
+	return false
+}
+
+// evaluatesToScalarOrParamList returns true if e is a list of scalars or params,
+// an array, like the result of a subquery, or a param that may contain an array.
+func evaluatesToScalarOrParamList(e Expr) bool {
+	switch t := e.(type) {
+	case NamedParam, PositionalParam:
+		return true
+	case LiteralValue:
+		return t.Type == document.ArrayValue
+	case LiteralExprList:
+		for _, e := range t {
+			if !evaluatesToScalarOrParam(e) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+var errStop = errors.New("stop")
+
+// scanIterator reads the documents matching a part of the where clause.
+// It can also return only their keys, which can be combined with the keys returned
+// by other iterators before reading the documents.
+type scanIterator interface {
+	document.Iterator
+
+	iterateKeys(fn func(key []byte) error) error
+}
+
+// fetchDocuments calls fn for each document whose key is returned by it.
+func fetchDocuments(tb *database.Table, it scanIterator, fn func(d document.Document) error) error {
+	return it.iterateKeys(func(key []byte) error {
+		d, err := tb.GetDocument(key)
+		if err != nil {
+			return err
+		}
+
+		return fn(d)
+	})
+}
+
+// valueRange is the result of the evaluation of the bounds of a field.
+// min and max are nil if the range is unbounded on that side.
+type valueRange struct {
+	min, max                   *document.Value
+	minExclusive, maxExclusive bool
+	// empty is true if no value can be within all the bounds.
+	empty bool
+}
+
+// evalRange evaluates the bounds and merges them into a single range.
+// Values are converted using the convert function. If it returns false
+// for one of the values, the range can't be used to seek for values and evalRange returns false.
+func evalRange(bounds []rangeBound, stack EvalStack, convert func(document.Value) (document.Value, bool, error)) (valueRange, bool, error) {
+	var r valueRange
+
+	sameType := func(a, b document.Value) bool {
+		return index.NewTypeFromValueType(a.Type) == index.NewTypeFromValueType(b.Type)
+	}
+
+	for _, b := range bounds {
+		v, err := b.e.Eval(stack)
+		if err != nil {
+			return r, false, err
+		}
+
+		v, ok, err := convert(v)
+		if err != nil || !ok {
+			return r, false, err
+		}
+
+		switch b.op {
+		case scanner.GT, scanner.GTE:
+			exclusive := b.op == scanner.GT
+			if r.min == nil {
+				r.min, r.minExclusive = &v, exclusive
+				continue
+			}
+
+			// values of different types can't be compared
+			if !sameType(v, *r.min) {
+				r.empty = true
+				return r, true, nil
+			}
+
+			ok, err := r.min.IsLesserThan(v)
+			if err != nil {
+				return r, false, err
+			}
+			if ok {
+				r.min, r.minExclusive = &v, exclusive
+				continue
+			}
+
+			ok, err = r.min.IsEqual(v)
+			if err != nil {
+				return r, false, err
+			}
+			if ok && exclusive {
+				r.minExclusive = true
+			}
+		default:
+			exclusive := b.op == scanner.LT
+			if r.max == nil {
+				r.max, r.maxExclusive = &v, exclusive
+				continue
+			}
+
+			if !sameType(v, *r.max) {
+				r.empty = true
+				return r, true, nil
+			}
+
+			ok, err := v.IsLesserThan(*r.max)
+			if err != nil {
+				return r, false, err
+			}
+			if ok {
+				r.max, r.maxExclusive = &v, exclusive
+				continue
+			}
+
+			ok, err = r.max.IsEqual(v)
+			if err != nil {
+				return r, false, err
+			}
+			if ok && exclusive {
+				r.maxExclusive = true
+			}
+		}
+	}
+
+	if r.min == nil || r.max == nil {
+		return r, true, nil
+	}
+
+	if !sameType(*r.min, *r.max) {
+		r.empty = true
+		return r, true, nil
+	}
+
+	ok, err := r.max.IsLesserThan(*r.min)
+	if err != nil {
+		return r, false, err
+	}
+	if ok {
+		r.empty = true
+		return r, true, nil
+	}
+
+	ok, err = r.max.IsEqual(*r.min)
+	if err != nil {
+		return r, false, err
+	}
+	r.empty = ok && (r.minExclusive || r.maxExclusive)
+
+	return r, true, nil
+}
+
+// typ returns the index type of the values of the range.
+func (r valueRange) typ() index.Type {
+	if r.min != nil {
+		return index.NewTypeFromValueType(r.min.Type)
+	}
+
+	return index.NewTypeFromValueType(r.max.Type)
+}
+
+// excludesMin returns true if v is the lower bound and the range doesn't contain it.
+func (r valueRange) excludesMin(v document.Value) (bool, error) {
+	if r.min == nil || !r.minExclusive {
+		return false, nil
+	}
+
+	return r.min.IsEqual(v)
+}
+
+// exceedsMax returns true if v is greater than the upper bound of the range,
+// or equal to it if the range doesn't contain it.
+func (r valueRange) exceedsMax(v document.Value) (bool, error) {
+	if r.max == nil {
+		return false, nil
+	}
+
+	if r.maxExclusive {
+		return r.max.IsLesserThanOrEqual(v)
+	}
+
+	return r.max.IsLesserThan(v)
+}
+
+// toIndexValue converts v to the type used to store it in an index.
+// Null values, documents and arrays are all stored as null values in indexes,
+// so they can't be used to seek for a particular value.
+func toIndexValue(v document.Value) (document.Value, bool, error) {
+	if index.NewTypeFromValueType(v.Type) == index.Null {
+		return v, false, nil
+	}
+
+	if v.Type.IsNumber() {
+		v, err := v.ConvertTo(document.Float64Value)
+		return v, true, err
+	}
+
+	return v, true, nil
+}
+
+type indexIterator struct {
+	tx               *database.Transaction
+	tb               *database.Table
+	args             []driver.NamedValue
+	index            index.Index
+	op               scanner.Token
+	e                Expr
+	bounds           []rangeBound
+	orderByDirection scanner.Token
+}
+
+func (it indexIterator) Iterate(fn func(d document.Document) error) error {
+	return fetchDocuments(it.tb, it, fn)
+}
+
+func (it indexIterator) iterateKeys(fn func(key []byte) error) error {
+	visit := func(val document.Value, key []byte) error {
+		return fn(key)
+	}
+
+	if it.e == nil && it.bounds == nil {
+		if it.orderByDirection == scanner.DESC {
+			return it.index.DescendLessOrEqual(nil, visit)
+		}
+
+		return it.index.AscendGreaterOrEqual(nil, visit)
+	}
+
+	stack := EvalStack{
+		Tx:     it.tx,
+		Params: it.args,
+	}
+
+	var err error
+	if it.bounds != nil {
+		err = it.iterateRange(stack, fn)
+		if err != nil && err != errStop {
+			return err
+		}
+
+		return nil
+	}
+
+	v, err := it.e.Eval(stack)
+	if err != nil {
+		return err
+	}
+
+	if v.Type.IsNumber() {
+		v, err = v.ConvertTo(document.Float64Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch it.op {
+	case scanner.EQ:
+		err = it.ascendEqual(v, fn)
+	case scanner.IN:
+		err = it.iterateIn(v, fn)
+	case scanner.EQREGEX:
+		var prefix []byte
+		prefix, err = v.ConvertToBlob()
+		if err != nil {
+			return err
+		}
+
 		err = it.index.AscendGreaterOrEqual(&index.Pivot{Value: v}, func(val document.Value, key []byte) error {
-			ok, err := v.IsEqual(val)
+			b, err := val.ConvertToBlob()
 			if err != nil {
 				return err
 			}
 
+			if !bytes.HasPrefix(b, prefix) {
+				return errStop
+			}
+
+			return fn(key)
+		})
+	}
+
+	if err != nil && err != errStop {
+		return err
+	}
+
+	return nil
+}
+
+// iterateRange calls fn for every key whose indexed value is within the bounds of the iterator.
+// Since indexes store values of different types in different stores, only the values of the type
+// of the bounds are read.
+func (it indexIterator) iterateRange(stack EvalStack, fn func(key []byte) error) error {
+	r, ok, err := evalRange(it.bounds, stack, toIndexValue)
+	if err != nil {
+		return err
+	}
+
+	// the bounds can't be used to seek, read the whole index
+	if !ok {
+		return it.index.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+			return fn(key)
+		})
+	}
+
+	if r.empty {
+		return nil
+	}
+
+	var pivot *index.Pivot
+	if r.min != nil {
+		pivot = &index.Pivot{Value: *r.min}
+	} else {
+		pivot = index.EmptyPivot(r.max.Type)
+	}
+
+	return it.index.AscendGreaterOrEqual(pivot, func(val document.Value, key []byte) error {
+		ok, err := r.excludesMin(val)
+		if err != nil || ok {
+			return err
+		}
+
+		ok, err = r.exceedsMax(val)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return errStop
+		}
+
+		return fn(key)
+	})
+}
+
+// ascendEqual calls fn for every key whose indexed value is equal to v.
+func (it indexIterator) ascendEqual(v document.Value, fn func(key []byte) error) error {
+	err := it.index.AscendGreaterOrEqual(&index.Pivot{Value: v}, func(val document.Value, key []byte) error {
+		ok, err := v.IsEqual(val)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return fn(key)
+		}
+
+		return errStop
+	})
+	if err == errStop {
+		return nil
+	}
+
+	return err
+}
+
+// iterateIn runs one index seek per distinct value of the list.
+func (it indexIterator) iterateIn(list document.Value, fn func(key []byte) error) error {
+	if list.Type != document.ArrayValue {
+		return nil
+	}
+
+	a, err := list.ConvertToArray()
+	if err != nil {
+		return err
+	}
+
+	var seen []document.Value
+	return a.Iterate(func(i int, v document.Value) error {
+		var err error
+		if v.Type.IsNumber() {
+			v, err = v.ConvertTo(document.Float64Value)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, s := range seen {
+			ok, err := s.IsEqual(v)
+			if err != nil {
+				return err
+			}
 			if ok {
 				return nil
 			}
+		}
+		seen = append(seen, v)
+
+		return it.ascendEqual(v, fn)
+	})
+}
+
+// compositeIterator iterates over the documents of an index on multiple fields
+// whose tuples are within the given range.
+type compositeIterator struct {
+	tx   *database.Transaction
+	tb   *database.Table
+	args []driver.NamedValue
+	r    *compositeRange
+}
+
+func (it compositeIterator) Iterate(fn func(d document.Document) error) error {
+	return fetchDocuments(it.tb, it, fn)
+}
+
+func (it compositeIterator) iterateKeys(fn func(key []byte) error) error {
+	stack := EvalStack{
+		Tx:     it.tx,
+		Params: it.args,
+	}
+
+	// the values can't be used to seek, read the whole index
+	readAll := func() error {
+		return it.r.index.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+			return fn(key)
+		})
+	}
+
+	var pivot document.ValueBuffer
+	for _, e := range it.r.eq {
+		v, err := e.Eval(stack)
+		if err != nil {
+			return err
+		}
+
+		// null values are stored like documents and arrays
+		if v.Type != document.NullValue {
+			var ok bool
+			v, ok, err = toIndexValue(v)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return readAll()
+			}
+		}
+
+		pivot = pivot.Append(v)
+	}
+
+	var r valueRange
+	if it.r.bounds != nil {
+		var ok bool
+		var err error
+		r, ok, err = evalRange(it.r.bounds, stack, toIndexValue)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return readAll()
+		}
+		if r.empty {
+			return nil
+		}
+
+		// ranges without lower bound start at the first tuple of the prefix
+		// and skip the values of other types.
+		if r.min != nil {
+			pivot = pivot.Append(*r.min)
+		}
+	}
+
+	n := len(it.r.eq)
+
+	err := it.r.index.AscendGreaterOrEqual(&index.Pivot{Value: document.NewArrayValue(pivot)}, func(val document.Value, key []byte) error {
+		a, err := val.ConvertToArray()
+		if err != nil {
+			return err
+		}
 
-			r, err := it.tb.GetDocument(key)
+		for i := 0; i < n; i++ {
+			v, err := a.GetByIndex(i)
 			if err != nil {
 				return err
 			}
 
-			return fn(r)
-		})
-	case scanner.GTE:
-		err = it.index.AscendGreaterOrEqual(&index.Pivot{Value: v}, func(val document.Value, key []byte) error {
-			r, err := it.tb.GetDocument(key)
+			ok, err := pivot[i].IsEqual(v)
 			if err != nil {
 				return err
 			}
+			if !ok {
+				return errStop
+			}
+		}
 
-			return fn(r)
-		})
-	case scanner.LT:
-		err = it.index.AscendGreaterOrEqual(index.EmptyPivot(v.Type), func(val document.Value, key []byte) error {
-			ok, err := v.IsLesserThanOrEqual(val)
+		if it.r.bounds != nil {
+			v, err := a.GetByIndex(n)
 			if err != nil {
 				return err
 			}
 
-			if ok {
+			vt := index.NewTypeFromValueType(v.Type)
+			if vt < r.typ() {
+				return nil
+			}
+			if vt > r.typ() {
 				return errStop
 			}
 
-			r, err := it.tb.GetDocument(key)
-			if err != nil {
+			ok, err := r.excludesMin(v)
+			if err != nil || ok {
 				return err
 			}
 
-			return fn(r)
-		})
-	case scanner.LTE:
-		err = it.index.AscendGreaterOrEqual(index.EmptyPivot(v.Type), func(val document.Value, key []byte) error {
-			ok, err := v.IsLesserThan(val)
+			ok, err = r.exceedsMax(v)
 			if err != nil {
 				return err
 			}
-
 			if ok {
 				return errStop
 			}
+		}
 
-			r, err := it.tb.GetDocument(key)
-			if err != nil {
-				return err
-			}
-
-			return fn(r)
-		})
-	}
-
+		return fn(key)
+	})
 	if err != nil && err != errStop {
 		return err
 	}
@@ -405,34 +1489,176 @@ type pkIterator struct {
 	args             []driver.NamedValue
 	op               scanner.Token
 	e                Expr
+	bounds           []rangeBound
 	orderByDirection scanner.Token
-	evalValue        document.Value
 }
 
 func (it pkIterator) Iterate(fn func(d document.Document) error) error {
-	if it.e == nil {
-		var err error
+	return it.iterate(func(key, val []byte) error {
+		return fn(&encodedDocumentWithKey{EncodedDocument: val, key: key})
+	})
+}
+
+func (it pkIterator) iterateKeys(fn func(key []byte) error) error {
+	return it.iterate(func(key, val []byte) error {
+		return fn(key)
+	})
+}
 
+func (it pkIterator) iterate(fn func(key, val []byte) error) error {
+	if it.e == nil && it.bounds == nil {
 		if it.orderByDirection == scanner.DESC {
-			err = it.tb.Store.DescendLessOrEqual(nil, func(k []byte, v []byte) error {
-				return fn(encoding.EncodedDocument(v))
-			})
-		} else {
-			err = it.tb.Store.AscendGreaterOrEqual(nil, func(k []byte, v []byte) error {
-				return fn(encoding.EncodedDocument(v))
+			return it.tb.Store.DescendLessOrEqual(nil, fn)
+		}
+
+		return it.tb.Store.AscendGreaterOrEqual(nil, fn)
+	}
+
+	stack := EvalStack{
+		Tx:     it.tx,
+		Params: it.args,
+	}
+
+	var err error
+	switch {
+	case it.bounds != nil:
+		err = it.iterateRange(stack, fn)
+	case it.op == scanner.IN:
+		err = it.iterateIn(stack, fn)
+	default:
+		var v document.Value
+		v, err = it.e.Eval(stack)
+		if err != nil {
+			return err
+		}
+
+		v, err = v.ConvertTo(it.cfg.GetPrimaryKey().Type)
+		if err != nil {
+			return it.tb.Store.AscendGreaterOrEqual(nil, fn)
+		}
+
+		var data []byte
+		data, err = encoding.EncodeValue(v)
+		if err != nil {
+			return err
+		}
+
+		switch it.op {
+		case scanner.EQ:
+			var val []byte
+			val, err = it.tb.Store.Get(data)
+			if err == engine.ErrKeyNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			return fn(data, val)
+		case scanner.EQREGEX:
+			err = it.tb.Store.AscendGreaterOrEqual(data, func(key, val []byte) error {
+				if !bytes.HasPrefix(key, data) {
+					return errStop
+				}
+
+				return fn(key, val)
 			})
 		}
+	}
 
+	if err != nil && err != errStop {
 		return err
 	}
 
-	data, err := encoding.EncodeValue(it.evalValue)
+	return nil
+}
+
+// iterateRange reads the documents whose primary key is within the bounds of the iterator.
+// Bounds that can't be converted to the type of the primary key can't be used to seek,
+// in which case the whole table is read.
+func (it pkIterator) iterateRange(stack EvalStack, fn func(key, val []byte) error) error {
+	pk := it.cfg.GetPrimaryKey()
+
+	r, ok, err := evalRange(it.bounds, stack, func(v document.Value) (document.Value, bool, error) {
+		v, err := v.ConvertTo(pk.Type)
+		return v, err == nil, nil
+	})
 	if err != nil {
 		return err
 	}
+	if !ok {
+		return it.tb.Store.AscendGreaterOrEqual(nil, fn)
+	}
+	if r.empty {
+		return nil
+	}
+
+	var min, max []byte
+	if r.min != nil {
+		min, err = encoding.EncodeValue(*r.min)
+		if err != nil {
+			return err
+		}
+	}
+	if r.max != nil {
+		max, err = encoding.EncodeValue(*r.max)
+		if err != nil {
+			return err
+		}
+	}
+
+	return it.tb.Store.AscendGreaterOrEqual(min, func(key, val []byte) error {
+		if r.minExclusive && bytes.Equal(key, min) {
+			return nil
+		}
+
+		if max != nil {
+			cmp := bytes.Compare(key, max)
+			if cmp > 0 || (cmp == 0 && r.maxExclusive) {
+				return errStop
+			}
+		}
+
+		return fn(key, val)
+	})
+}
+
+// iterateIn fetches the documents whose primary key is one of the values of the evaluated list.
+// Values that can't be converted to the type of the primary key can't match any document and are skipped.
+func (it pkIterator) iterateIn(stack EvalStack, fn func(key, val []byte) error) error {
+	list, err := it.e.Eval(stack)
+	if err != nil {
+		return err
+	}
+
+	if list.Type != document.ArrayValue {
+		return nil
+	}
+
+	a, err := list.ConvertToArray()
+	if err != nil {
+		return err
+	}
+
+	pk := it.cfg.GetPrimaryKey()
+	seen := make(map[string]struct{})
+
+	return a.Iterate(func(i int, v document.Value) error {
+		v, err := v.ConvertTo(pk.Type)
+		if err != nil {
+			return nil
+		}
+
+		data, err := encoding.EncodeValue(v)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := seen[string(data)]; ok {
+			return nil
+		}
+		seen[string(data)] = struct{}{}
 
-	switch it.op {
-	case scanner.EQ:
 		val, err := it.tb.Store.Get(data)
 		if err != nil {
 			if err == engine.ErrKeyNotFound {
@@ -441,55 +1667,240 @@ func (it pkIterator) Iterate(fn func(d document.Document) error) error {
 
 			return err
 		}
-		return fn(encoding.EncodedDocument(val))
-	case scanner.GT:
-		err = it.tb.Store.AscendGreaterOrEqual(data, func(key, val []byte) error {
-			if bytes.Equal(data, val) {
+
+		return fn(data, val)
+	})
+}
+
+// unionIterator returns the documents selected by any of its iterators.
+// Documents selected by multiple iterators are returned only once.
+type unionIterator struct {
+	tb  *database.Table
+	its []scanIterator
+}
+
+func (it unionIterator) Iterate(fn func(d document.Document) error) error {
+	return fetchDocuments(it.tb, it, fn)
+}
+
+func (it unionIterator) iterateKeys(fn func(key []byte) error) error {
+	seen := make(map[string]struct{})
+
+	for _, sub := range it.its {
+		err := sub.iterateKeys(func(key []byte) error {
+			if _, ok := seen[string(key)]; ok {
 				return nil
 			}
+			seen[string(key)] = struct{}{}
 
-			return fn(encoding.EncodedDocument(val))
-		})
-	case scanner.GTE:
-		err = it.tb.Store.AscendGreaterOrEqual(data, func(key, val []byte) error {
-			return fn(encoding.EncodedDocument(val))
+			return fn(key)
 		})
-	case scanner.LT:
-		err = it.tb.Store.AscendGreaterOrEqual(nil, func(key, val []byte) error {
-			if bytes.Compare(data, val) <= 0 {
-				return errStop
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// intersectionIterator returns the documents selected by all of its iterators.
+// The keys returned by every iterator but the last one are kept in memory.
+type intersectionIterator struct {
+	tb  *database.Table
+	its []scanIterator
+}
+
+func (it intersectionIterator) Iterate(fn func(d document.Document) error) error {
+	return fetchDocuments(it.tb, it, fn)
+}
+
+func (it intersectionIterator) iterateKeys(fn func(key []byte) error) error {
+	var keys map[string]struct{}
+
+	for _, sub := range it.its[:len(it.its)-1] {
+		next := make(map[string]struct{})
+		err := sub.iterateKeys(func(key []byte) error {
+			if _, ok := keys[string(key)]; ok || keys == nil {
+				next[string(key)] = struct{}{}
 			}
 
-			return fn(encoding.EncodedDocument(val))
+			return nil
 		})
-	case scanner.LTE:
-		err = it.tb.Store.AscendGreaterOrEqual(nil, func(key, val []byte) error {
-			if bytes.Compare(data, val) < 0 {
-				return errStop
+		if err != nil {
+			return err
+		}
+
+		keys = next
+		if len(keys) == 0 {
+			return nil
+		}
+	}
+
+	return it.its[len(it.its)-1].iterateKeys(func(key []byte) error {
+		if _, ok := keys[string(key)]; !ok {
+			return nil
+		}
+		delete(keys, string(key))
+
+		return fn(key)
+	})
+}
+
+// minMaxIterator returns an iterator that computes the MIN and MAX aggregate functions
+// by reading an index or the primary key in order, instead of scanning the whole table.
+// It returns false if one of the result fields is not a MIN or MAX function of an indexed field
+// or of a typed primary key.
+func (qo *queryOptimizer) minMaxIterator(selectors []ResultField) (document.Iterator, bool) {
+	if len(qo.joins) > 0 {
+		return nil, false
+	}
+
+	var funcs []AggregatorBuilder
+
+	for _, rf := range selectors {
+		re, ok := rf.(ResultFieldExpr)
+		if !ok {
+			return nil, false
+		}
+
+		var e Expr
+		switch t := re.Expr.(type) {
+		case *MinFunc:
+			e = t.Expr
+		case *MaxFunc:
+			e = t.Expr
+		default:
+			return nil, false
+		}
+
+		fs, ok := e.(FieldSelector)
+		if !ok {
+			return nil, false
+		}
+
+		if _, ok := qo.indexes[fs.Name()]; !ok {
+			pk := qo.cfg.GetPrimaryKey()
+			if pk == nil || pk.Type == 0 || pk.Path.String() != fs.Name() {
+				return nil, false
 			}
+		}
 
-			return fn(encoding.EncodedDocument(val))
-		})
+		funcs = append(funcs, re.Expr.(AggregatorBuilder))
+	}
+
+	return minMaxIterator{qo: qo, funcs: funcs}, true
+}
+
+type minMaxIterator struct {
+	qo    *queryOptimizer
+	funcs []AggregatorBuilder
+}
+
+func (it minMaxIterator) Iterate(fn func(d document.Document) error) error {
+	results := make(map[AggregatorBuilder]document.Value, len(it.funcs))
+
+	for _, f := range it.funcs {
+		var v document.Value
+		var err error
+
+		switch t := f.(type) {
+		case *MinFunc:
+			v, err = it.qo.firstValue(t.Expr.(FieldSelector), false)
+		case *MaxFunc:
+			v, err = it.qo.firstValue(t.Expr.(FieldSelector), true)
+		}
+		if err != nil {
+			return err
+		}
+
+		results[f] = v
+	}
+
+	return fn(&aggregatedDocument{
+		Document: document.NewFieldBuffer(),
+		results:  results,
+	})
+}
+
+// firstValue reads the index or the primary key associated with the field in ascending
+// or descending order and returns the value of the first document matching the where clause.
+// Null values are skipped. If no document matches, it returns NULL.
+func (qo *queryOptimizer) firstValue(fs FieldSelector, desc bool) (document.Value, error) {
+	stack := EvalStack{
+		Tx:         qo.tx,
+		Params:     qo.args,
+		Cfg:        qo.cfg,
+		subqueries: qo.subqueries,
+	}
+	match := whereClause(qo.whereExpr, stack)
+
+	res := nilLitteral
+	visit := func(d document.Document) error {
+		ok, err := match(d)
+		if err != nil || !ok {
+			return err
+		}
+
+		stack.Document = d
+		v, err := fs.Eval(stack)
+		if err != nil {
+			return err
+		}
+
+		res, err = copyValue(v)
+		if err != nil {
+			return err
+		}
+
+		return errStop
 	}
 
+	var err error
+	if idx, ok := qo.indexes[fs.Name()]; ok {
+		iterate := idx.AscendGreaterOrEqual
+		if desc {
+			iterate = idx.DescendLessOrEqual
+		}
+
+		err = iterate(nil, func(val document.Value, key []byte) error {
+			if val.Type == document.NullValue {
+				return nil
+			}
+
+			d, err := qo.t.GetDocument(key)
+			if err != nil {
+				return err
+			}
+
+			return visit(d)
+		})
+	} else {
+		iterate := qo.t.Store.AscendGreaterOrEqual
+		if desc {
+			iterate = qo.t.Store.DescendLessOrEqual
+		}
+
+		err = iterate(nil, func(k, v []byte) error {
+			return visit(encoding.EncodedDocument(v))
+		})
+	}
 	if err != nil && err != errStop {
-		return err
+		return nilLitteral, err
 	}
 
-	return nil
+	return res, nil
 }
 
 // sortIterator operates a partial sort on the iterator using a heap.
 // This ensures a O(n+klog n) time complexity
 // with k being the limit of the query, or the sum of the limit + offset, when both offset and limit are used.
 // if there are no limit or offsets, k = n, the number of elements in the table.
-// If the sorting is in ascending order, a min-heap will be used
-// otherwise a max-heap will be used instead.
+// Each document is associated with the tuple of the encoded values of the order by fields,
+// tuples are compared field by field, using the direction of each field.
 // Once the heap is filled entirely with the content of the table a stream is returned.
-// During iteration, the stream will pop the k-smallest or k-largest elements, depending on
-// the chosen sorting order (ASC or DESC).
+// During iteration, the stream will pop the k-smallest elements, according to that comparison.
 // This function is not memory efficient as it's loading the entire table in memory before
-// returning the k-smallest or k-largest elements.
+// returning the k-smallest elements.
 func (qo *queryOptimizer) sortIterator(it document.Iterator) (st document.Stream, err error) {
 	k := 0
 	if qo.limit != -1 {
@@ -499,29 +1910,38 @@ func (qo *queryOptimizer) sortIterator(it document.Iterator) (st document.Stream
 		}
 	}
 
-	path := document.ValuePath(qo.orderBy)
-
-	var h heap.Interface
-	if qo.orderByDirection == scanner.ASC {
-		h = new(minHeap)
-	} else {
-		h = new(maxHeap)
+	paths := make([]document.ValuePath, len(qo.orderBy))
+	h := sortHeap{
+		desc: make([]bool, len(qo.orderBy)),
+	}
+	for i, f := range qo.orderBy {
+		paths[i] = document.ValuePath(f.Field)
+		h.desc[i] = f.Direction == scanner.DESC
 	}
 
-	heap.Init(h)
+	heap.Init(&h)
 
+	ctx := qo.tx.Context()
 	err = it.Iterate(func(d document.Document) error {
-		v, err := path.GetValue(d)
-		if err != nil && err != document.ErrFieldNotFound {
+		err := ctx.Err()
+		if err != nil {
 			return err
 		}
-		if err == document.ErrFieldNotFound {
-			v = document.NewNullValue()
-		}
 
-		value, err := index.EncodeFieldToIndexValue(v)
-		if err != nil {
-			return err
+		values := make([][]byte, len(paths))
+		for i, path := range paths {
+			v, err := path.GetValue(d)
+			if err != nil && err != document.ErrFieldNotFound {
+				return err
+			}
+			if err == document.ErrFieldNotFound {
+				v = document.NewNullValue()
+			}
+
+			values[i], err = index.EncodeFieldToIndexValue(v)
+			if err != nil {
+				return err
+			}
 		}
 
 		data, err := encoding.EncodeDocument(d)
@@ -529,9 +1949,9 @@ func (qo *queryOptimizer) sortIterator(it document.Iterator) (st document.Stream
 			return err
 		}
 
-		heap.Push(h, heapNode{
-			value: value,
-			data:  data,
+		heap.Push(&h, heapNode{
+			values: values,
+			data:   data,
 		})
 
 		return nil
@@ -540,20 +1960,26 @@ func (qo *queryOptimizer) sortIterator(it document.Iterator) (st document.Stream
 		return
 	}
 
-	st = document.NewStream(&sortedIterator{h, k})
+	st = document.NewStream(&sortedIterator{qo.tx.Context(), &h, k})
 
 	return
 }
 
 type sortedIterator struct {
-	h heap.Interface
-	k int
+	ctx context.Context
+	h   heap.Interface
+	k   int
 }
 
 func (s *sortedIterator) Iterate(fn func(d document.Document) error) error {
 	i := 0
 	for s.h.Len() > 0 && (s.k == 0 || i < s.k) {
-		err := fn(encoding.EncodedDocument(heap.Pop(s.h).(heapNode).data))
+		err := s.ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		err = fn(encoding.EncodedDocument(heap.Pop(s.h).(heapNode).data))
 		if err != nil {
 			return err
 		}
@@ -564,32 +1990,44 @@ func (s *sortedIterator) Iterate(fn func(d document.Document) error) error {
 }
 
 type heapNode struct {
-	value []byte
-	data  []byte
+	values [][]byte
+	data   []byte
 }
 
-type minHeap []heapNode
+// sortHeap is a min-heap of tuples. The order of each element
+// of the tuples is reversed if the associated field is sorted in descending order.
+type sortHeap struct {
+	nodes []heapNode
+	desc  []bool
+}
 
-func (h minHeap) Len() int           { return len(h) }
-func (h minHeap) Less(i, j int) bool { return bytes.Compare(h[i].value, h[j].value) < 0 }
-func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h sortHeap) Len() int      { return len(h.nodes) }
+func (h sortHeap) Swap(i, j int) { h.nodes[i], h.nodes[j] = h.nodes[j], h.nodes[i] }
 
-func (h *minHeap) Push(x interface{}) {
-	*h = append(*h, x.(heapNode))
-}
+func (h sortHeap) Less(i, j int) bool {
+	for k := range h.desc {
+		cmp := bytes.Compare(h.nodes[i].values[k], h.nodes[j].values[k])
+		if cmp == 0 {
+			continue
+		}
 
-func (h *minHeap) Pop() interface{} {
-	old := *h
-	n := len(old)
-	x := old[n-1]
-	*h = old[0 : n-1]
-	return x
+		if h.desc[k] {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+
+	return false
 }
 
-type maxHeap struct {
-	minHeap
+func (h *sortHeap) Push(x interface{}) {
+	h.nodes = append(h.nodes, x.(heapNode))
 }
 
-func (h maxHeap) Less(i, j int) bool {
-	return bytes.Compare(h.minHeap[i].value, h.minHeap[j].value) > 0
+func (h *sortHeap) Pop() interface{} {
+	old := h.nodes
+	n := len(old)
+	x := old[n-1]
+	h.nodes = old[0 : n-1]
+	return x
 }
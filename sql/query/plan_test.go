@@ -0,0 +1,168 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/asdine/genji/sql/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildQueryPlanCompositeIndex(t *testing.T) {
+	db, err := database.New(memoryengine.NewEngine(), nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	err = tx.CreateTable("test", nil)
+	require.NoError(t, err)
+	err = tx.CreateIndex(database.IndexConfig{
+		IndexName: "idx_a_b_c",
+		TableName: "test",
+		Paths:     []document.ValuePath{document.NewValuePath("a"), document.NewValuePath("b"), document.NewValuePath("c")},
+	})
+	require.NoError(t, err)
+	err = tx.CreateIndex(database.IndexConfig{
+		IndexName: "idx_a",
+		TableName: "test",
+		Paths:     []document.ValuePath{document.NewValuePath("a")},
+	})
+	require.NoError(t, err)
+
+	a, b, c, d := FieldSelector{"a"}, FieldSelector{"b"}, FieldSelector{"c"}, FieldSelector{"d"}
+
+	tests := []struct {
+		name  string
+		where Expr
+		eq    int
+		op    bool
+	}{
+		{"eq on a single field", Eq(a, IntValue(1)), 0, false},
+		{"eq on two fields", And(Eq(a, IntValue(1)), Eq(b, IntValue(1))), 2, false},
+		{"eq and range", And(And(Eq(a, IntValue(1)), Gt(b, IntValue(1))), Eq(c, IntValue(1))), 1, true},
+		{"eq on all fields", And(And(Eq(c, IntValue(1)), Eq(b, IntValue(1))), Eq(a, IntValue(1))), 3, false},
+		{"missing first field", And(Eq(b, IntValue(1)), Eq(c, IntValue(1))), 0, false},
+		{"range on first field", And(Gt(a, IntValue(1)), Eq(b, IntValue(1))), 0, false},
+		{"or", Or(Eq(a, IntValue(1)), Eq(b, IntValue(1))), 0, false},
+		{"other field", And(Eq(a, IntValue(1)), Eq(d, IntValue(1))), 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			qo, err := newQueryOptimizer(tx, "test", nil)
+			require.NoError(t, err)
+			qo.whereExpr = test.where
+
+			qp := qo.buildQueryPlan()
+			if test.eq == 0 && !test.op {
+				if qp.field != nil {
+					require.Nil(t, qp.field.composite)
+				}
+				return
+			}
+
+			require.NotNil(t, qp.field)
+			require.NotNil(t, qp.field.composite)
+			require.Equal(t, "idx_a_b_c", qp.field.composite.index.IndexName)
+			require.Len(t, qp.field.composite.eq, test.eq)
+			require.Equal(t, test.op, qp.field.composite.bounds != nil)
+		})
+	}
+}
+
+func TestBuildQueryPlanCombinations(t *testing.T) {
+	db, err := database.New(memoryengine.NewEngine(), nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	err = tx.CreateTable("test", &database.TableConfig{
+		FieldConstraints: []database.FieldConstraint{
+			{Path: []string{"k"}, Type: document.Int64Value, IsPrimaryKey: true},
+		},
+	})
+	require.NoError(t, err)
+	for _, name := range []string{"a", "b"} {
+		err = tx.CreateIndex(database.IndexConfig{
+			IndexName: "idx_" + name,
+			TableName: "test",
+			Paths:     []document.ValuePath{document.NewValuePath(name)},
+		})
+		require.NoError(t, err)
+	}
+
+	a, b, c, k := FieldSelector{"a"}, FieldSelector{"b"}, FieldSelector{"c"}, FieldSelector{"k"}
+
+	t.Run("range on the same field", func(t *testing.T) {
+		qo, err := newQueryOptimizer(tx, "test", nil)
+		require.NoError(t, err)
+		qo.whereExpr = And(Gt(a, IntValue(1)), Lte(IntValue(10), a))
+
+		qp := qo.buildQueryPlan()
+		require.NotNil(t, qp.field)
+		require.Equal(t, "a", qp.field.indexedField.Name())
+		require.Equal(t, []rangeBound{{scanner.GT, IntValue(1)}, {scanner.GTE, IntValue(10)}}, qp.field.bounds)
+	})
+
+	t.Run("bounded range preferred", func(t *testing.T) {
+		qo, err := newQueryOptimizer(tx, "test", nil)
+		require.NoError(t, err)
+		qo.whereExpr = And(And(Gt(a, IntValue(1)), Gt(b, IntValue(1))), Lt(b, IntValue(10)))
+
+		qp := qo.buildQueryPlan()
+		require.NotNil(t, qp.field)
+		require.Equal(t, "b", qp.field.indexedField.Name())
+		require.Len(t, qp.field.bounds, 2)
+	})
+
+	t.Run("primary key equality", func(t *testing.T) {
+		qo, err := newQueryOptimizer(tx, "test", nil)
+		require.NoError(t, err)
+		qo.whereExpr = And(Eq(a, IntValue(1)), Eq(k, IntValue(1)))
+
+		qp := qo.buildQueryPlan()
+		require.NotNil(t, qp.field)
+		require.True(t, qp.field.isPrimaryKey)
+		require.Equal(t, scanner.EQ, qp.field.op)
+	})
+
+	t.Run("intersection", func(t *testing.T) {
+		qo, err := newQueryOptimizer(tx, "test", nil)
+		require.NoError(t, err)
+		qo.whereExpr = And(And(Eq(a, IntValue(1)), Gt(c, IntValue(1))), Eq(b, IntValue(1)))
+
+		qp := qo.buildQueryPlan()
+		require.NotNil(t, qp.field)
+		require.Len(t, qp.field.intersection, 2)
+		require.Equal(t, "a", qp.field.intersection[0].indexedField.Name())
+		require.Equal(t, "b", qp.field.intersection[1].indexedField.Name())
+	})
+
+	t.Run("union", func(t *testing.T) {
+		qo, err := newQueryOptimizer(tx, "test", nil)
+		require.NoError(t, err)
+		qo.whereExpr = Or(Or(Eq(a, IntValue(1)), Gt(k, IntValue(1))), And(Eq(b, IntValue(1)), Eq(c, IntValue(1))))
+
+		qp := qo.buildQueryPlan()
+		require.NotNil(t, qp.field)
+		require.Len(t, qp.field.union, 3)
+		require.True(t, qp.field.union[1].isPrimaryKey)
+	})
+
+	t.Run("union with an operand without index", func(t *testing.T) {
+		qo, err := newQueryOptimizer(tx, "test", nil)
+		require.NoError(t, err)
+		qo.whereExpr = Or(Eq(a, IntValue(1)), Eq(c, IntValue(1)))
+
+		qp := qo.buildQueryPlan()
+		require.True(t, qp.scanTable)
+	})
+}
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"context"
 	"database/sql/driver"
 	"errors"
 
@@ -20,6 +21,12 @@ type Query struct {
 
 // Run executes all the statements in their own transaction and returns the last result.
 func (q Query) Run(db *database.Database, args []driver.NamedValue) (*Result, error) {
+	return q.RunContext(context.Background(), db, args)
+}
+
+// RunContext executes all the statements in their own transaction and returns the last result.
+// The transactions are bound to ctx, including the one owned by the returned result.
+func (q Query) RunContext(ctx context.Context, db *database.Database, args []driver.NamedValue) (*Result, error) {
 	var res Result
 	var tx *database.Transaction
 	var err error
@@ -42,7 +49,7 @@ func (q Query) Run(db *database.Database, args []driver.NamedValue) (*Result, er
 		}
 
 		// start a new transaction for every statement
-		tx, err = db.Begin(!stmt.IsReadOnly())
+		tx, err = db.BeginTx(ctx, !stmt.IsReadOnly())
 		if err != nil {
 			return nil, err
 		}
@@ -64,10 +71,21 @@ func (q Query) Run(db *database.Database, args []driver.NamedValue) (*Result, er
 // Exec the query within the given transaction. If the one of the statements requires a read-write
 // transaction and tx is not, tx will get promoted.
 func (q Query) Exec(tx *database.Transaction, args []driver.NamedValue, forceReadOnly bool) (*Result, error) {
+	return q.ExecContext(tx.Context(), tx, args, forceReadOnly)
+}
+
+// ExecContext executes the query within the given transaction, like Exec.
+// The statements stop once ctx is done, even if the context of tx is not.
+func (q Query) ExecContext(ctx context.Context, tx *database.Transaction, args []driver.NamedValue, forceReadOnly bool) (*Result, error) {
 	var res Result
 	var err error
 
 	for _, stmt := range q.Statements {
+		err = ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
 		// if the statement requires a writable transaction,
 		// promote the current transaction.
 		if !forceReadOnly && !tx.Writable() && !stmt.IsReadOnly() {
@@ -77,7 +95,7 @@ func (q Query) Exec(tx *database.Transaction, args []driver.NamedValue, forceRea
 			}
 		}
 
-		res, err = stmt.Run(tx, args)
+		res, err = stmt.Run(tx.WithContext(ctx), args)
 		if err != nil {
 			return nil, err
 		}
@@ -151,14 +169,32 @@ func (r *Result) Close() (err error) {
 	return err
 }
 
+// whereClause returns a filter selecting the documents matching e.
+// Since it is called for every document read by a query, it also stops the query
+// once the context of the transaction is done.
 func whereClause(e Expr, stack EvalStack) func(d document.Document) (bool, error) {
+	ctx := context.Background()
+	if stack.Tx != nil {
+		ctx = stack.Tx.Context()
+	}
+
 	if e == nil {
 		return func(d document.Document) (bool, error) {
+			err := ctx.Err()
+			if err != nil {
+				return false, err
+			}
+
 			return true, nil
 		}
 	}
 
 	return func(d document.Document) (bool, error) {
+		err := ctx.Err()
+		if err != nil {
+			return false, err
+		}
+
 		stack.Document = d
 		v, err := e.Eval(stack)
 		if err != nil {
@@ -0,0 +1,79 @@
+package query
+
+import (
+	"database/sql/driver"
+	"errors"
+
+	"github.com/asdine/genji/database"
+)
+
+// SavepointStmt is a DSL that allows creating a SAVEPOINT statement.
+type SavepointStmt struct {
+	SavepointName string
+}
+
+// IsReadOnly always returns false, the transaction must be writable
+// before creating savepoints so that they are not lost when it is promoted.
+// It implements the Statement interface.
+func (stmt SavepointStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the Savepoint statement in the given transaction.
+// It implements the Statement interface.
+func (stmt SavepointStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	if stmt.SavepointName == "" {
+		return res, errors.New("missing savepoint name")
+	}
+
+	err := tx.Savepoint(stmt.SavepointName)
+	return res, err
+}
+
+// RollbackToStmt is a DSL that allows creating a ROLLBACK TO SAVEPOINT statement.
+type RollbackToStmt struct {
+	SavepointName string
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt RollbackToStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the RollbackTo statement in the given transaction.
+// It implements the Statement interface.
+func (stmt RollbackToStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	if stmt.SavepointName == "" {
+		return res, errors.New("missing savepoint name")
+	}
+
+	err := tx.RollbackTo(stmt.SavepointName)
+	return res, err
+}
+
+// ReleaseStmt is a DSL that allows creating a RELEASE SAVEPOINT statement.
+type ReleaseStmt struct {
+	SavepointName string
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt ReleaseStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the Release statement in the given transaction.
+// It implements the Statement interface.
+func (stmt ReleaseStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	if stmt.SavepointName == "" {
+		return res, errors.New("missing savepoint name")
+	}
+
+	err := tx.Release(stmt.SavepointName)
+	return res, err
+}
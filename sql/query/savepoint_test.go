@@ -0,0 +1,68 @@
+package query_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavepoints(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test (a INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+
+	// the read-only transaction is promoted before the savepoint is created
+	tx, err := db.Begin(false)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	err = tx.Exec(`
+		INSERT INTO test (a) VALUES (1);
+		SAVEPOINT batch;
+		INSERT INTO test (a) VALUES (2), (3);
+		SAVEPOINT step;
+		DELETE FROM test;
+	`)
+	require.NoError(t, err)
+
+	// the failed insertion doesn't cancel the transaction
+	err = tx.Exec("INSERT INTO test (a) VALUES (4), (4)")
+	require.Equal(t, database.ErrDuplicateDocument, err)
+
+	err = tx.Exec("ROLLBACK TO SAVEPOINT step")
+	require.NoError(t, err)
+
+	check := func(expected string) {
+		st, err := tx.Query("SELECT a FROM test")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, expected, buf.String())
+	}
+	check(`[{"a":1},{"a":2},{"a":3}]`)
+
+	err = tx.Exec("ROLLBACK TO batch; INSERT INTO test (a) VALUES (5); RELEASE batch")
+	require.NoError(t, err)
+	check(`[{"a":1},{"a":5}]`)
+
+	err = tx.Exec("ROLLBACK TO step")
+	require.Equal(t, database.ErrSavepointNotFound, err)
+
+	require.NoError(t, tx.Commit())
+
+	d, err := db.QueryDocument("SELECT COUNT(*) AS n FROM test")
+	require.NoError(t, err)
+	var n int
+	require.NoError(t, document.Scan(d, &n))
+	require.Equal(t, 2, n)
+}
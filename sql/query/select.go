@@ -12,13 +12,27 @@ import (
 
 // SelectStmt is a DSL that allows creating a full Select query.
 type SelectStmt struct {
-	TableName        string
-	WhereExpr        Expr
-	OrderBy          FieldSelector
-	OrderByDirection scanner.Token
-	OffsetExpr       Expr
-	LimitExpr        Expr
-	Selectors        []ResultField
+	TableName string
+	// TableAlias is the name used to refer to the table in a join. It defaults to the table name.
+	TableAlias string
+	// FromSubquery is set if the documents are read from the result of another statement
+	// instead of a table, i.e. SELECT * FROM (SELECT ...).
+	FromSubquery *SelectStmt
+	Joins        []JoinClause
+	WhereExpr    Expr
+	GroupBy      FieldSelector
+	HavingExpr   Expr
+	OrderBy      []OrderByField
+	OffsetExpr   Expr
+	LimitExpr    Expr
+	Selectors    []ResultField
+}
+
+// OrderByField is a field used to sort the result of a query.
+// If the direction is not scanner.DESC, the results are sorted in ascending order.
+type OrderByField struct {
+	Field     FieldSelector
+	Direction scanner.Token
 }
 
 // IsReadOnly always returns true. It implements the Statement interface.
@@ -38,12 +52,16 @@ func (stmt SelectStmt) exec(tx *database.Transaction, args []driver.NamedValue)
 
 	// if there is no table name specified, evaluate the expression immediatly and return
 	// a stream with the result.
-	if stmt.TableName == "" {
+	if stmt.TableName == "" && stmt.FromSubquery == nil {
 		if len(stmt.Selectors) == 0 {
 			return res, errors.New("missing table selector")
 		}
 
 		d := documentMask{
+			stack: EvalStack{
+				Tx:     tx,
+				Params: args,
+			},
 			resultFields: stmt.Selectors,
 		}
 		var fb document.FieldBuffer
@@ -58,31 +76,214 @@ func (stmt SelectStmt) exec(tx *database.Transaction, args []driver.NamedValue)
 		return Result{Stream: document.NewStream(document.NewIterator(fb))}, nil
 	}
 
-	if stmt.OrderByDirection != scanner.DESC {
-		stmt.OrderByDirection = scanner.ASC
-	}
-
-	offset := -1
-	limit := -1
+	orderBy := stmt.orderByFields()
 
 	stack := EvalStack{
 		Tx:     tx,
 		Params: args,
 	}
 
+	limit, offset, err := stmt.limitOffset(stack)
+	if err != nil {
+		return res, err
+	}
+
+	qo, err := stmt.queryOptimizer(tx, args)
+	if err != nil {
+		return res, err
+	}
+
+	maskStack := EvalStack{
+		Tx:         tx,
+		Params:     args,
+		Cfg:        qo.cfg,
+		subqueries: qo.subqueries,
+	}
+
+	// joined documents don't belong to a single table
+	if len(qo.joins) > 0 {
+		maskStack.Cfg = nil
+		maskStack.tables = qo.joinedTables()
+	}
+
+	mask := func(d document.Document) (document.Document, error) {
+		return documentMask{
+			stack:        maskStack,
+			r:            d,
+			resultFields: stmt.Selectors,
+		}, nil
+	}
+
+	builders := stmt.aggregatorBuilders()
+
+	var st document.Stream
+
+	aggregated := stmt.isAggregated(builders)
+	if !aggregated {
+		qo.orderBy = orderBy
+		qo.limit = limit
+		qo.offset = offset
+
+		st, err = qo.optimizeQuery()
+		if err != nil {
+			return res, err
+		}
+	} else {
+		// the documents are aggregated before being sorted and limited,
+		// ordering applies to the fields of the result documents.
+		qo.groupBy = stmt.GroupBy
+		qo.having = stmt.HavingExpr
+
+		st, err = qo.optimizeAggregation(stmt.Selectors, builders)
+		if err != nil {
+			return res, err
+		}
+
+		st = st.Map(mask)
+
+		if len(orderBy) != 0 {
+			qo.orderBy = stmt.resultOrderByFields(orderBy)
+			qo.limit = limit
+			qo.offset = offset
+
+			st, err = qo.sortIterator(st)
+			if err != nil {
+				return res, err
+			}
+		}
+	}
+
+	if offset > 0 {
+		st = st.Offset(offset)
+	}
+
+	if limit >= 0 {
+		st = st.Limit(limit)
+	}
+
+	if !aggregated {
+		st = st.Map(mask)
+	}
+
+	return Result{Stream: st}, nil
+}
+
+// queryOptimizer returns the optimizer of the table of the statement,
+// along with the tables joined to it.
+// The subqueries of the statement are run before returning.
+func (stmt SelectStmt) queryOptimizer(tx *database.Transaction, args []driver.NamedValue) (queryOptimizer, error) {
+	var qo queryOptimizer
+	var err error
+
+	if stmt.FromSubquery != nil {
+		qo, err = newSubqueryOptimizer(tx, *stmt.FromSubquery, args)
+	} else {
+		qo, err = newQueryOptimizer(tx, stmt.TableName, stmt.WhereExpr)
+	}
+	if err != nil {
+		return qo, err
+	}
+	qo.whereExpr = stmt.WhereExpr
+	qo.args = args
+
+	qo.subqueries, err = runSubqueries(tx, args, stmt.exprs()...)
+	if err != nil {
+		return qo, err
+	}
+
+	qo.joins, err = stmt.newJoinTables(tx, args)
+	if err != nil {
+		return qo, err
+	}
+	for _, j := range qo.joins {
+		j.qo.subqueries = qo.subqueries
+	}
+	qo.alias = stmt.tableAlias()
+
+	return qo, nil
+}
+
+// readsTable reports whether the given table is read while the documents of the statement
+// are iterated. The subqueries of the expressions are ignored, since they are run before.
+func (stmt SelectStmt) readsTable(tableName string) bool {
+	if stmt.FromSubquery != nil {
+		if stmt.FromSubquery.readsTable(tableName) {
+			return true
+		}
+	} else if stmt.TableName == tableName {
+		return true
+	}
+
+	for _, jc := range stmt.Joins {
+		if jc.TableName == tableName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exprs returns the expressions evaluated for every document read by the statement.
+func (stmt SelectStmt) exprs() []Expr {
+	exprs := []Expr{stmt.WhereExpr, stmt.HavingExpr}
+	for _, rf := range stmt.Selectors {
+		if re, ok := rf.(ResultFieldExpr); ok {
+			exprs = append(exprs, re.Expr)
+		}
+	}
+	for _, jc := range stmt.Joins {
+		exprs = append(exprs, jc.On)
+	}
+
+	return exprs
+}
+
+// orderByFields returns the fields of the ORDER BY clause, with their direction set to either ASC or DESC.
+func (stmt SelectStmt) orderByFields() []OrderByField {
+	orderBy := make([]OrderByField, len(stmt.OrderBy))
+	for i, f := range stmt.OrderBy {
+		if f.Direction != scanner.DESC {
+			f.Direction = scanner.ASC
+		}
+		orderBy[i] = f
+	}
+
+	return orderBy
+}
+
+// resultOrderByFields returns the fields used to sort aggregated documents.
+// A result field named after the whole path, like a.b, takes precedence.
+func (stmt SelectStmt) resultOrderByFields(orderBy []OrderByField) []OrderByField {
+	for i, f := range orderBy {
+		for _, rf := range stmt.Selectors {
+			if rf.Name() == f.Field.Name() {
+				orderBy[i].Field = FieldSelector{rf.Name()}
+				break
+			}
+		}
+	}
+
+	return orderBy
+}
+
+// limitOffset evaluates the LIMIT and OFFSET expressions.
+// If one of them is not specified, it is set to -1.
+func (stmt SelectStmt) limitOffset(stack EvalStack) (limit, offset int, err error) {
+	limit, offset = -1, -1
+
 	if stmt.OffsetExpr != nil {
 		v, err := stmt.OffsetExpr.Eval(stack)
 		if err != nil {
-			return res, err
+			return 0, 0, err
 		}
 
 		if !v.Type.IsNumber() {
-			return res, fmt.Errorf("offset expression must evaluate to a number, got %q", v.Type)
+			return 0, 0, fmt.Errorf("offset expression must evaluate to a number, got %q", v.Type)
 		}
 
 		voff, err := v.ConvertToInt64()
 		if err != nil {
-			return res, err
+			return 0, 0, err
 		}
 		offset = int(voff)
 	}
@@ -90,78 +291,71 @@ func (stmt SelectStmt) exec(tx *database.Transaction, args []driver.NamedValue)
 	if stmt.LimitExpr != nil {
 		v, err := stmt.LimitExpr.Eval(stack)
 		if err != nil {
-			return res, err
+			return 0, 0, err
 		}
 
 		if !v.Type.IsNumber() {
-			return res, fmt.Errorf("limit expression must evaluate to a number, got %q", v.Type)
+			return 0, 0, fmt.Errorf("limit expression must evaluate to a number, got %q", v.Type)
 		}
 
 		vlim, err := v.ConvertToInt64()
 		if err != nil {
-			return res, err
+			return 0, 0, err
 		}
 		limit = int(vlim)
 	}
 
-	qo, err := newQueryOptimizer(tx, stmt.TableName)
-	if err != nil {
-		return res, err
-	}
-	qo.whereExpr = stmt.WhereExpr
-	qo.args = args
-	qo.orderBy = stmt.OrderBy
-	qo.orderByDirection = stmt.OrderByDirection
-	qo.limit = limit
-	qo.offset = offset
-
-	st, err := qo.optimizeQuery()
-	if err != nil {
-		return res, err
-	}
-
-	if offset > 0 {
-		st = st.Offset(offset)
-	}
+	return limit, offset, nil
+}
 
-	if limit >= 0 {
-		st = st.Limit(limit)
+// aggregatorBuilders returns the aggregate functions used by the selectors and the HAVING clause.
+func (stmt SelectStmt) aggregatorBuilders() []AggregatorBuilder {
+	builders := aggregatorBuilders(stmt.Selectors)
+	if stmt.HavingExpr != nil {
+		builders = collectAggregatorBuilders(stmt.HavingExpr, builders)
 	}
 
-	st = st.Map(func(d document.Document) (document.Document, error) {
-		return documentMask{
-			cfg:          qo.cfg,
-			r:            d,
-			resultFields: stmt.Selectors,
-		}, nil
-	})
+	return builders
+}
 
-	return Result{Stream: st}, nil
+// isAggregated returns true if the documents must be aggregated before being returned.
+func (stmt SelectStmt) isAggregated(builders []AggregatorBuilder) bool {
+	return len(builders) > 0 || len(stmt.GroupBy) > 0 || stmt.HavingExpr != nil
 }
 
 type documentMask struct {
-	cfg          *database.TableConfig
+	stack        EvalStack
 	r            document.Document
 	resultFields []ResultField
 }
 
 var _ document.Document = documentMask{}
 
-func (r documentMask) GetByField(name string) (document.Value, error) {
-	for _, rf := range r.resultFields {
-		if rf.Name() == name || rf.Name() == "*" {
-			return r.r.GetByField(name)
+func (r documentMask) GetByField(name string) (v document.Value, err error) {
+	found := false
+	err = r.Iterate(func(f string, value document.Value) error {
+		if f == name {
+			v = value
+			found = true
+			return errStop
 		}
+
+		return nil
+	})
+	if err != nil && err != errStop {
+		return
+	}
+
+	if !found {
+		return document.Value{}, document.ErrFieldNotFound
 	}
 
-	return document.Value{}, document.ErrFieldNotFound
+	return v, nil
 }
 
 func (r documentMask) Iterate(fn func(f string, v document.Value) error) error {
-	stack := EvalStack{
-		Document: r.r,
-		Cfg:      r.cfg,
-	}
+	stack := r.stack
+	stack.Document = r.r
 
 	for _, rf := range r.resultFields {
 		err := rf.Iterate(stack, fn)
@@ -209,6 +403,12 @@ func (w Wildcard) Name() string {
 	return "*"
 }
 
+// Eval returns an error. A wildcard can only be used as a result field
+// or as the argument of a function, like COUNT(*).
+func (w Wildcard) Eval(EvalStack) (document.Value, error) {
+	return nilLitteral, errors.New("unexpected wildcard")
+}
+
 // Iterate call the document iterate method.
 func (w Wildcard) Iterate(stack EvalStack, fn func(fd string, v document.Value) error) error {
 	if stack.Document == nil {
@@ -41,6 +41,36 @@ func TestSelectStmt(t *testing.T) {
 		{"With sub op", "SELECT size - 10 AS s FROM test ORDER BY k", false, `[{"s":0},{"s":0},{"s":null}]`, nil},
 		{"With mul op", "SELECT size * 10 AS s FROM test ORDER BY k", false, `[{"s":100},{"s":100},{"s":null}]`, nil},
 		{"With div op", "SELECT size / 10 AS s FROM test ORDER BY k", false, `[{"s":1},{"s":1},{"s":null}]`, nil},
+		{"With regex op", "SELECT * FROM test WHERE color =~ /^re/", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With regex op, unanchored", "SELECT * FROM test WHERE color =~ /u/", false, `[{"k":2,"color":"blue","size":10,"weight":100}]`, nil},
+		{"With regex op, no match", "SELECT * FROM test WHERE color =~ /^x/", false, `[]`, nil},
+		{"With not regex op", "SELECT * FROM test WHERE color !~ /^re/", false, `[{"k":2,"color":"blue","size":10,"weight":100},{"k":3,"height":100,"weight":200}]`, nil},
+		{"With regex op on number", "SELECT * FROM test WHERE size =~ /^1/", false, `[]`, nil},
+		{"With in op", "SELECT * FROM test WHERE color IN ('red', 'purple')", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With in op, duplicates", "SELECT * FROM test WHERE size IN (10, 10.0)", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":100}]`, nil},
+		{"With in op, array param", "SELECT * FROM test WHERE weight IN ?", false, `[{"k":2,"color":"blue","size":10,"weight":100},{"k":3,"height":100,"weight":200}]`, []interface{}{[]int{100, 200}}},
+		{"With not in op", "SELECT * FROM test WHERE color NOT IN ('red', 'purple')", false, `[{"k":2,"color":"blue","size":10,"weight":100},{"k":3,"height":100,"weight":200}]`, nil},
+		{"With pk in op", "SELECT * FROM test WHERE k IN (3, 1, 'a', 3)", false, `[{"k":3,"height":100,"weight":200},{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With is null op", "SELECT * FROM test WHERE shape IS NULL", false, `[{"k":2,"color":"blue","size":10,"weight":100},{"k":3,"height":100,"weight":200}]`, nil},
+		{"With is not null op", "SELECT * FROM test WHERE shape IS NOT NULL", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With is op", "SELECT * FROM test WHERE weight IS 100", false, `[{"k":2,"color":"blue","size":10,"weight":100}]`, nil},
+		{"With not op", "SELECT * FROM test WHERE NOT size = 10", false, `[{"k":3,"height":100,"weight":200}]`, nil},
+		{"With not op and missing field", "SELECT * FROM test WHERE NOT shape", false, `[{"k":2,"color":"blue","size":10,"weight":100},{"k":3,"height":100,"weight":200}]`, nil},
+		{"With not op and parentheses", "SELECT * FROM test WHERE NOT (color = 'red')", false, `[{"k":2,"color":"blue","size":10,"weight":100},{"k":3,"height":100,"weight":200}]`, nil},
+		{"With not op and parenthesized and", "SELECT * FROM test WHERE NOT (weight > 100 AND weight < 300)", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":100}]`, nil},
+		{"With parentheses", "SELECT * FROM test WHERE (size = 10) AND (weight > 100 OR color = 'red')", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With parentheses and arithmetic", "SELECT (size + 10) * 2 AS s FROM test ORDER BY k", false, `[{"s":40},{"s":40},{"s":null}]`, nil},
+		{"With count", "SELECT COUNT(*) FROM test", false, `[{"COUNT(*)":3}]`, nil},
+		{"With count of field", "SELECT COUNT(color) FROM test", false, `[{"COUNT(color)":2}]`, nil},
+		{"With count and where", "SELECT COUNT(*) AS c FROM test WHERE size = 10", false, `[{"c":2}]`, nil},
+		{"With count and no match", "SELECT COUNT(*) AS c FROM test WHERE size > 100", false, `[{"c":0}]`, nil},
+		{"With count in expression", "SELECT COUNT(*) + 1 AS c FROM test", false, `[{"c":4}]`, nil},
+		{"With sum and avg", "SELECT SUM(size) AS s, AVG(weight) AS a FROM test", false, `[{"s":20,"a":150.0}]`, nil},
+		{"With min and max", "SELECT MIN(color) AS a, MAX(weight) AS b FROM test", false, `[{"a":"blue","b":200}]`, nil},
+		{"With min and max and where", "SELECT MIN(weight) AS a, MAX(weight) AS b FROM test WHERE k < 3", false, `[{"a":100,"b":100}]`, nil},
+		{"With min and max on pk", "SELECT MIN(k) AS a, MAX(k) AS b FROM test WHERE size = 10", false, `[{"a":1,"b":2}]`, nil},
+		{"With max and no match", "SELECT MAX(size) AS m FROM test WHERE size > 100", false, `[{"m":null}]`, nil},
+		{"With sum of wildcard", "SELECT SUM(*) FROM test", true, ``, nil},
 		{"With field comparison", "SELECT * FROM test WHERE color < shape", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
 		{"With order by", "SELECT * FROM test ORDER BY color", false, `[{"k":3,"height":100,"weight":200},{"k":2,"color":"blue","size":10,"weight":100},{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
 		{"With order by asc", "SELECT * FROM test ORDER BY color ASC", false, `[{"k":3,"height":100,"weight":200},{"k":2,"color":"blue","size":10,"weight":100},{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
@@ -56,6 +86,9 @@ func TestSelectStmt(t *testing.T) {
 		{"With order by desc with limit offset", "SELECT * FROM test ORDER BY color DESC LIMIT 1 OFFSET 1", false, `[{"k":2,"color":"blue","size":10,"weight":100}]`, nil},
 		{"With order by pk asc", "SELECT * FROM test ORDER BY k ASC", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":100},{"k":3,"height":100,"weight":200}]`, nil},
 		{"With order by pk desc", "SELECT * FROM test ORDER BY k DESC", false, `[{"k":3,"height":100,"weight":200},{"k":2,"color":"blue","size":10,"weight":100},{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With order by multiple fields", "SELECT * FROM test ORDER BY size DESC, color", false, `[{"k":2,"color":"blue","size":10,"weight":100},{"k":1,"color":"red","size":10,"shape":"square"},{"k":3,"height":100,"weight":200}]`, nil},
+		{"With order by multiple fields desc", "SELECT * FROM test ORDER BY size, k DESC", false, `[{"k":3,"height":100,"weight":200},{"k":2,"color":"blue","size":10,"weight":100},{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With order by multiple fields and limit", "SELECT k FROM test ORDER BY size DESC, weight DESC LIMIT 1 OFFSET 1", false, `[{"k":1}]`, nil},
 		{"With order by and where", "SELECT * FROM test WHERE color != 'blue' ORDER BY color DESC LIMIT 1", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
 		{"With limit", "SELECT * FROM test WHERE size = 10 LIMIT 1", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
 		{"With offset", "SELECT *, pk() FROM test WHERE size = 10 OFFSET 1", false, `[{"pk()":2,"color":"blue","size":10,"weight":100,"k":2}]`, nil},
@@ -66,6 +99,18 @@ func TestSelectStmt(t *testing.T) {
 		{"With pk()", "SELECT pk(), color FROM test", false, `[{"pk()":1,"color":"red"},{"pk()":2,"color":"blue"},{"pk()":3,"color":null}]`, []interface{}{sql.Named("a", "red"), sql.Named("d", 100)}},
 		{"With pk in cond, gt", "SELECT * FROM test WHERE k > 0 AND weight = 100", false, `[{"k":2,"color":"blue","size":10,"weight":100,"k":2}]`, nil},
 		{"With pk in cond, =", "SELECT * FROM test WHERE k = 2.0 AND weight = 100", false, `[{"k":2,"color":"blue","size":10,"weight":100,"k":2}]`, nil},
+		{"With range", "SELECT k FROM test WHERE weight > 50 AND weight <= 200 AND weight < 150", false, `[{"k":2}]`, nil},
+		{"With swapped range", "SELECT k FROM test WHERE 150 > weight", false, `[{"k":2}]`, nil},
+		{"With empty range", "SELECT k FROM test WHERE weight > 150 AND weight < 120", false, `[]`, nil},
+		{"With range of different types", "SELECT k FROM test WHERE weight > 50 AND weight < 'a'", false, `[]`, nil},
+		{"With or", "SELECT k FROM test WHERE color = 'red' OR weight = 200 ORDER BY k", false, `[{"k":1},{"k":3}]`, nil},
+		{"With or, same document", "SELECT k FROM test WHERE size = 10 OR weight >= 100 ORDER BY k", false, `[{"k":1},{"k":2},{"k":3}]`, nil},
+		{"With or and field without index", "SELECT k FROM test WHERE color = 'red' OR z = 1", false, `[{"k":1}]`, nil},
+		{"With and on two fields", "SELECT k FROM test WHERE size = 10 AND weight = 100", false, `[{"k":2}]`, nil},
+		{"With and on two fields, no match", "SELECT k FROM test WHERE color = 'red' AND weight = 100", false, `[]`, nil},
+		{"With pk range", "SELECT k FROM test WHERE k > 1 AND k <= 3 AND k != 3", false, `[{"k":2}]`, nil},
+		{"With swapped pk range", "SELECT k FROM test WHERE 3 > k", false, `[{"k":1},{"k":2}]`, nil},
+		{"With pk range and text", "SELECT k FROM test WHERE k > 'a'", false, `[]`, nil},
 		{"With two non existing idents, =", "SELECT * FROM test WHERE z = y", false, `[]`, nil},
 		{"With two non existing idents, >", "SELECT * FROM test WHERE z > y", false, `[]`, nil},
 		{"With two non existing idents, !=", "SELECT * FROM test WHERE z != y", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":100},{"k":3,"height":100,"weight":200}]`, nil},
@@ -140,6 +185,146 @@ func TestSelectStmt(t *testing.T) {
 		require.JSONEq(t, `[{"foo": 2, "bar": "b"},{"foo": 3, "bar": "c"},{"foo": 4, "bar": "d"}]`, buf.String())
 	})
 
+	t.Run("with regex on primary key", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test (name TEXT PRIMARY KEY)")
+		require.NoError(t, err)
+
+		err = db.Exec(`INSERT INTO test (name) VALUES ('abc'), ('abd'), ('b'), ('xab')`)
+		require.NoError(t, err)
+
+		st, err := db.Query("SELECT * FROM test WHERE name =~ /^ab/")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"name": "abc"},{"name": "abd"}]`, buf.String())
+	})
+
+	t.Run("with group by", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			query    string
+			expected string
+		}{
+			{"count", "SELECT country, COUNT(*) AS c FROM test GROUP BY country ORDER BY country", `[{"country":null,"c":1},{"country":"fr","c":2},{"country":"us","c":1}]`},
+			{"having", "SELECT country, COUNT(*) AS c FROM test GROUP BY country HAVING COUNT(*) > 1", `[{"country":"fr","c":2}]`},
+			{"without aggregate", "SELECT country FROM test GROUP BY country ORDER BY country DESC", `[{"country":"us"},{"country":"fr"},{"country":null}]`},
+			{"with where", "SELECT country, MAX(age) AS m FROM test WHERE age < 40 GROUP BY country ORDER BY country", `[{"country":"fr","m":30},{"country":"us","m":20}]`},
+			{"nested document", "SELECT a.b, SUM(age) AS s FROM test GROUP BY a.b ORDER BY a.b", `[{"a.b":null,"s":40},{"a.b":1,"s":40},{"a.b":2,"s":20}]`},
+			{"array index", "SELECT tags.0 AS t, COUNT(*) AS c FROM test GROUP BY tags.0 ORDER BY t", `[{"t":null,"c":2},{"t":"x","c":2}]`},
+			{"order by multiple fields", "SELECT country, COUNT(*) AS c FROM test GROUP BY country ORDER BY c DESC, country DESC", `[{"country":"fr","c":2},{"country":"us","c":1},{"country":null,"c":1}]`},
+			{"order by aggregate", "SELECT country, COUNT(*) AS c FROM test GROUP BY country ORDER BY c DESC LIMIT 1", `[{"country":"fr","c":2}]`},
+			{"no match", "SELECT country, COUNT(*) FROM test WHERE age > 100 GROUP BY country", `[]`},
+		}
+
+		for _, test := range tests {
+			testFn := func(withIndexes bool) func(t *testing.T) {
+				return func(t *testing.T) {
+					db, err := genji.Open(":memory:")
+					require.NoError(t, err)
+					defer db.Close()
+
+					err = db.Exec("CREATE TABLE test (k INTEGER PRIMARY KEY)")
+					require.NoError(t, err)
+					if withIndexes {
+						err = db.Exec(`
+							CREATE INDEX idx_country ON test (country);
+							CREATE INDEX idx_a_b ON test (a.b);
+						`)
+						require.NoError(t, err)
+					}
+
+					err = db.Exec(`INSERT INTO test VALUES
+						{k: 1, country: 'fr', age: 10, a: {b: 1}, tags: ['x', 'y']},
+						{k: 2, country: 'us', age: 20, a: {b: 2}, tags: ['x']},
+						{k: 3, country: 'fr', age: 30, a: {b: 1}},
+						{k: 4, age: 40}
+					`)
+					require.NoError(t, err)
+
+					st, err := db.Query(test.query)
+					require.NoError(t, err)
+					defer st.Close()
+
+					var buf bytes.Buffer
+					err = document.IteratorToJSONArray(&buf, st)
+					require.NoError(t, err)
+					require.JSONEq(t, test.expected, buf.String())
+				}
+			}
+			t.Run("No Index/"+test.name, testFn(false))
+			t.Run("With Index/"+test.name, testFn(true))
+		}
+	})
+
+	t.Run("with composite index", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			query    string
+			expected string
+		}{
+			{"eq prefix", "SELECT k FROM test WHERE tenant = 'a' ORDER BY k", `[{"k":1},{"k":2},{"k":3},{"k":6}]`},
+			{"eq all fields", "SELECT k FROM test WHERE tenant = 'a' AND c.at = 20 AND status = 'open'", `[{"k":2}]`},
+			{"eq and gt", "SELECT k FROM test WHERE tenant = 'a' AND c.at > 10 ORDER BY k", `[{"k":2},{"k":3}]`},
+			{"eq and gte", "SELECT k FROM test WHERE c.at >= 10 AND tenant = 'a' ORDER BY k", `[{"k":1},{"k":2},{"k":3}]`},
+			{"eq and lt", "SELECT k FROM test WHERE tenant = 'a' AND c.at < 30 ORDER BY k", `[{"k":1},{"k":2}]`},
+			{"eq and lte", "SELECT k FROM test WHERE tenant = 'a' AND c.at <= 20 ORDER BY k", `[{"k":1},{"k":2}]`},
+			{"eq and swapped range", "SELECT k FROM test WHERE tenant = 'a' AND 20 > c.at", `[{"k":1}]`},
+			{"eq and range with param", "SELECT k FROM test WHERE tenant = ? AND c.at > ? ORDER BY k", `[{"k":4}]`},
+			{"other fields", "SELECT k FROM test WHERE tenant = 'a' AND c.at > 10 AND status = 'closed'", `[{"k":3}]`},
+			{"missing field", "SELECT k FROM test WHERE tenant = 'a' AND c.at IS NULL", `[{"k":6}]`},
+			{"range on first field", "SELECT k FROM test WHERE tenant > 'a' ORDER BY k", `[{"k":4},{"k":5}]`},
+		}
+
+		for _, test := range tests {
+			testFn := func(withIndexes bool) func(t *testing.T) {
+				return func(t *testing.T) {
+					db, err := genji.Open(":memory:")
+					require.NoError(t, err)
+					defer db.Close()
+
+					err = db.Exec("CREATE TABLE test (k INTEGER PRIMARY KEY)")
+					require.NoError(t, err)
+					if withIndexes {
+						err = db.Exec("CREATE INDEX idx_tenant_at_status ON test (tenant, c.at, status)")
+						require.NoError(t, err)
+					}
+
+					err = db.Exec(`INSERT INTO test VALUES
+						{k: 1, tenant: 'a', c: {at: 10}, status: 'open'},
+						{k: 2, tenant: 'a', c: {at: 20}, status: 'open'},
+						{k: 3, tenant: 'a', c: {at: 30}, status: 'closed'},
+						{k: 4, tenant: 'b', c: {at: 10}, status: 'open'},
+						{k: 5, tenant: 'b', c: {at: 'x'}, status: 'open'},
+						{k: 6, tenant: 'a', status: 'open'}
+					`)
+					require.NoError(t, err)
+
+					// make sure the index is updated
+					err = db.Exec("UPDATE test SET status = 'closed' WHERE k = 3")
+					require.NoError(t, err)
+
+					st, err := db.Query(test.query, "b", 5)
+					require.NoError(t, err)
+					defer st.Close()
+
+					var buf bytes.Buffer
+					err = document.IteratorToJSONArray(&buf, st)
+					require.NoError(t, err)
+					require.JSONEq(t, test.expected, buf.String())
+				}
+			}
+			t.Run("No Index/"+test.name, testFn(false))
+			t.Run("With Index/"+test.name, testFn(true))
+		}
+	})
+
 	t.Run("with documents", func(t *testing.T) {
 		db, err := genji.Open(":memory:")
 		require.NoError(t, err)
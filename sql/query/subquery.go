@@ -0,0 +1,166 @@
+package query
+
+import (
+	"database/sql/driver"
+	"errors"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+)
+
+// Subquery is a Select statement used as an expression, i.e. (SELECT a FROM b).
+// It must return at most one document containing a single field, whose value is the
+// value of the expression, or NULL if it returns no document.
+// If List is true, which is the case when the subquery is the right operand of IN or NOT IN,
+// the subquery returns an array containing the value of every document.
+//
+// A subquery can't refer to the documents of the statement it belongs to.
+// It is run in the same transaction, once per execution of that statement.
+type Subquery struct {
+	Stmt SelectStmt
+	List bool
+}
+
+// Eval returns the result of the subquery, which is run unless it has already been run
+// before executing the statement.
+func (s *Subquery) Eval(stack EvalStack) (document.Value, error) {
+	if v, ok := stack.subqueries[s]; ok {
+		return v, nil
+	}
+
+	return s.run(stack.Tx, stack.Params)
+}
+
+func (s *Subquery) run(tx *database.Transaction, args []driver.NamedValue) (document.Value, error) {
+	res, err := s.Stmt.exec(tx, args)
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	var values document.ValueBuffer
+	err = res.Iterate(func(d document.Document) error {
+		if !s.List && len(values) > 0 {
+			return errors.New("subquery returned more than one document")
+		}
+
+		var v document.Value
+		var n int
+		err := d.Iterate(func(f string, fv document.Value) error {
+			v = fv
+			n++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			return errors.New("subquery must return only one field")
+		}
+
+		// the documents of the stream are only valid during the iteration
+		v, err = copyValue(v)
+		if err != nil {
+			return err
+		}
+
+		values = values.Append(v)
+		return nil
+	})
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	if s.List {
+		return document.NewArrayValue(values), nil
+	}
+
+	if len(values) == 0 {
+		return nilLitteral, nil
+	}
+
+	return values[0], nil
+}
+
+// subqueryResults holds the results of the subqueries of a statement.
+type subqueryResults map[*Subquery]document.Value
+
+// runSubqueries runs the subqueries found in the given expressions. This is done before
+// reading any document of the statement, so that subqueries are run only once
+// and the stores they read are never iterated while the statement reads or modifies a table.
+func runSubqueries(tx *database.Transaction, args []driver.NamedValue, exprs ...Expr) (subqueryResults, error) {
+	var subqueries []*Subquery
+	for _, e := range exprs {
+		subqueries = collectSubqueries(e, subqueries)
+	}
+
+	if len(subqueries) == 0 {
+		return nil, nil
+	}
+
+	results := make(subqueryResults, len(subqueries))
+	for _, s := range subqueries {
+		v, err := s.run(tx, args)
+		if err != nil {
+			return nil, err
+		}
+
+		results[s] = v
+	}
+
+	return results, nil
+}
+
+// collectSubqueries returns the subqueries used by the expression. The subqueries
+// of a subquery are run with it and are not returned.
+func collectSubqueries(e Expr, subqueries []*Subquery) []*Subquery {
+	switch t := e.(type) {
+	case *Subquery:
+		return append(subqueries, t)
+	case interface {
+		LeftHand() Expr
+		RightHand() Expr
+	}:
+		if l := t.LeftHand(); l != nil {
+			subqueries = collectSubqueries(l, subqueries)
+		}
+		if r := t.RightHand(); r != nil {
+			subqueries = collectSubqueries(r, subqueries)
+		}
+	case Cast:
+		subqueries = collectSubqueries(t.Expr, subqueries)
+	case Parentheses:
+		subqueries = collectSubqueries(t.E, subqueries)
+	case LiteralExprList:
+		for _, e := range t {
+			subqueries = collectSubqueries(e, subqueries)
+		}
+	case KVPairs:
+		for _, kv := range t {
+			subqueries = collectSubqueries(kv.V, subqueries)
+		}
+	case *CountFunc:
+		subqueries = collectSubqueries(t.Expr, subqueries)
+	case *SumFunc:
+		subqueries = collectSubqueries(t.Expr, subqueries)
+	case *AvgFunc:
+		subqueries = collectSubqueries(t.Expr, subqueries)
+	case *MinFunc:
+		subqueries = collectSubqueries(t.Expr, subqueries)
+	case *MaxFunc:
+		subqueries = collectSubqueries(t.Expr, subqueries)
+	}
+
+	return subqueries
+}
+
+// subqueryValue returns the result of e if it is a subquery that has already been run.
+// This allows the query planner to compare indexed fields with the result of subqueries.
+func (qo *queryOptimizer) subqueryValue(e Expr) Expr {
+	if s, ok := e.(*Subquery); ok {
+		if v, ok := qo.subqueries[s]; ok {
+			return LiteralValue(v)
+		}
+	}
+
+	return e
+}
@@ -0,0 +1,150 @@
+package query_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubquery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		fails    bool
+		expected string
+	}{
+		{"In", "SELECT name FROM users WHERE id IN (SELECT userId FROM bans)", false,
+			`[{"name":"alice"},{"name":"carol"}]`},
+		{"Not in", "SELECT name FROM users WHERE id NOT IN (SELECT userId FROM bans WHERE reason = 'spam')", false,
+			`[{"name":"bob"},{"name":"carol"}]`},
+		{"In, indexed", "SELECT id FROM users WHERE age IN (SELECT age FROM users WHERE id > 1)", false,
+			`[{"id":2},{"id":3}]`},
+		{"Scalar in where", "SELECT name FROM users WHERE age > (SELECT AVG(age) FROM users)", false,
+			`[{"name":"carol"}]`},
+		{"Scalar in projection", "SELECT name, (SELECT COUNT(*) FROM bans) AS bans FROM users WHERE id = 1", false,
+			`[{"name":"alice","bans":2}]`},
+		{"Scalar without table", "SELECT (SELECT name FROM users WHERE id = 2) AS name", false,
+			`[{"name":"bob"}]`},
+		{"Empty scalar", "SELECT (SELECT name FROM users WHERE id = 10) AS name", false,
+			`[{"name":null}]`},
+		{"Params", "SELECT name FROM users WHERE id IN (SELECT userId FROM bans WHERE reason = ?) AND age > ?", false,
+			`[{"name":"carol"}]`},
+		{"From", "SELECT s.name FROM (SELECT name, age FROM users WHERE age > 20) AS s ORDER BY s.age DESC", false,
+			`[{"s.name":"carol"},{"s.name":"bob"}]`},
+		{"From, aggregated", "SELECT COUNT(*) AS n FROM (SELECT * FROM bans)", false,
+			`[{"n":2}]`},
+		{"From, joined", "SELECT s.name, b.reason FROM (SELECT * FROM users) AS s JOIN bans b ON b.userId = s.id", false,
+			`[{"s.name":"alice","b.reason":"spam"},{"s.name":"carol","b.reason":"abuse"}]`},
+		{"Too many documents", "SELECT (SELECT name FROM users)", true, ``},
+		{"Too many fields", "SELECT (SELECT name, age FROM users WHERE id = 1)", true, ``},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.Open(":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec(`
+				CREATE TABLE users (id INTEGER PRIMARY KEY);
+				CREATE INDEX idx_users_age ON users (age);
+				CREATE TABLE bans;
+				INSERT INTO users (id, name, age) VALUES (1, 'alice', 20), (2, 'bob', 25), (3, 'carol', 40);
+				INSERT INTO bans (userId, reason) VALUES (1, 'spam'), (3, 'abuse');
+			`)
+			require.NoError(t, err)
+
+			var args []interface{}
+			if test.name == "Params" {
+				args = []interface{}{"abuse", 30}
+			}
+
+			st, err := db.Query(test.query, args...)
+			if err == nil {
+				defer st.Close()
+			}
+
+			var buf bytes.Buffer
+			if err == nil {
+				err = document.IteratorToJSONArray(&buf, st)
+			}
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.JSONEq(t, test.expected, buf.String())
+		})
+	}
+
+	t.Run("Update and delete", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE users (id INTEGER PRIMARY KEY);
+			CREATE TABLE bans;
+			INSERT INTO users (id, banned) VALUES (1, false), (2, false), (3, false);
+			INSERT INTO bans (userId) VALUES (1), (3);
+			UPDATE users SET banned = true WHERE id IN (SELECT userId FROM bans);
+			DELETE FROM bans WHERE userId = (SELECT MIN(id) FROM users WHERE banned = true);
+		`)
+		require.NoError(t, err)
+
+		st, err := db.Query("SELECT id FROM users WHERE banned = true")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"id":1},{"id":3}]`, buf.String())
+
+		st, err = db.Query("SELECT userId FROM bans")
+		require.NoError(t, err)
+		defer st.Close()
+
+		buf.Reset()
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"userId":3}]`, buf.String())
+	})
+
+	t.Run("Explain", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE users (id INTEGER PRIMARY KEY);
+			CREATE TABLE bans;
+			INSERT INTO bans (userId) VALUES (1), (3);
+		`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			query    string
+			expected string
+		}{
+			{"EXPLAIN SELECT * FROM users WHERE id IN (SELECT userId FROM bans)",
+				`{"table":"users","scan":"primary key","field":"id","op":"IN","value":[1,3],"sort":false}`},
+			{"EXPLAIN SELECT * FROM (SELECT * FROM users WHERE id = 1)",
+				`{"subquery":{"table":"users","scan":"primary key","field":"id","op":"=","value":1,"sort":false},"scan":"subquery","sort":false}`},
+		}
+
+		for _, test := range tests {
+			st, err := db.Query(test.query)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			st.Close()
+			require.NoError(t, err)
+			require.JSONEq(t, "["+test.expected+"]", buf.String())
+		}
+	})
+}
@@ -15,10 +15,25 @@ const updateBufferSize = 100
 // UpdateStmt is a DSL that allows creating a full Update query.
 type UpdateStmt struct {
 	TableName string
-	Pairs     map[string]Expr
+
+	// Pairs is used along with the Set clause. It holds
+	// each path with its corresponding value that should be set in the document.
+	Pairs []UpdateSetPair
+
+	// UnsetFields is used along with the Unset clause. It holds
+	// each path that should be removed from the document.
+	UnsetFields []document.ValuePath
+
 	WhereExpr Expr
 }
 
+// UpdateSetPair associates a path with the expression whose result is set at that path.
+// The expression is evaluated against the document as it was before the update.
+type UpdateSetPair struct {
+	Path document.ValuePath
+	Expr Expr
+}
+
 // IsReadOnly always returns false. It implements the Statement interface.
 func (stmt UpdateStmt) IsReadOnly() bool {
 	return false
@@ -33,13 +48,24 @@ func (stmt UpdateStmt) Run(tx *database.Transaction, args []driver.NamedValue) (
 		return res, errors.New("missing table name")
 	}
 
-	if len(stmt.Pairs) == 0 {
-		return res, errors.New("Set method not called")
+	if len(stmt.Pairs) == 0 && len(stmt.UnsetFields) == 0 {
+		return res, errors.New("Set or Unset method not called")
+	}
+
+	exprs := []Expr{stmt.WhereExpr}
+	for _, p := range stmt.Pairs {
+		exprs = append(exprs, p.Expr)
+	}
+
+	subqueries, err := runSubqueries(tx, args, exprs...)
+	if err != nil {
+		return res, err
 	}
 
 	stack := EvalStack{
-		Tx:     tx,
-		Params: args,
+		Tx:         tx,
+		Params:     args,
+		subqueries: subqueries,
 	}
 
 	t, err := tx.GetTable(stmt.TableName)
@@ -67,30 +93,22 @@ func (stmt UpdateStmt) Run(tx *database.Transaction, args []driver.NamedValue) (
 			}
 
 			docs[i].Reset()
-			err := docs[i].ScanDocument(d)
+			err := docs[i].Copy(d)
 			if err != nil {
 				return err
 			}
 
-			for fname, e := range stmt.Pairs {
-				_, err := docs[i].GetByField(fname)
-				if err != nil {
-					continue
-				}
+			stack.Document = d
+			err = setPairs(&docs[i], stmt.Pairs, stack)
+			if err != nil {
+				return err
+			}
 
-				ev, err := e.Eval(EvalStack{
-					Tx:       tx,
-					Document: d,
-					Params:   args,
-				})
+			for _, path := range stmt.UnsetFields {
+				err = docs[i].DeletePath(path)
 				if err != nil && err != document.ErrFieldNotFound {
 					return err
 				}
-
-				err = docs[i].Replace(fname, ev)
-				if err != nil {
-					return err
-				}
 			}
 
 			// copy the key and reuse the buffer
@@ -99,6 +117,9 @@ func (stmt UpdateStmt) Run(tx *database.Transaction, args []driver.NamedValue) (
 
 			return nil
 		})
+		if err != nil {
+			return res, err
+		}
 
 		for j := 0; j < i; j++ {
 			err = t.Replace(keys[j], docs[j])
@@ -107,14 +128,36 @@ func (stmt UpdateStmt) Run(tx *database.Transaction, args []driver.NamedValue) (
 			}
 		}
 
-		if i < deleteBufferSize {
+		if i < updateBufferSize {
 			break
 		}
 
-		resumableStore.key = keys[i-1]
+		// resume right after the last updated document
+		resumableStore.key = append(append(resumableStore.key[:0], keys[i-1]...), 0)
+	}
+
+	return res, nil
+}
+
+// setPairs evaluates the expressions of the pairs against the document of the stack
+// and sets their results in fb. Fields that don't exist are evaluated to NULL.
+func setPairs(fb *document.FieldBuffer, pairs []UpdateSetPair, stack EvalStack) error {
+	for _, p := range pairs {
+		v, err := p.Expr.Eval(stack)
+		if err == document.ErrFieldNotFound {
+			v, err = nilLitteral, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = fb.SetPath(p.Path, v)
+		if err != nil {
+			return err
+		}
 	}
 
-	return res, err
+	return nil
 }
 
 // storeFromKey implements an engine.Store which iterates from a certain key.
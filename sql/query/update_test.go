@@ -3,9 +3,11 @@ package query_test
 import (
 	"bytes"
 	"database/sql"
+	"fmt"
 	"testing"
 
 	"github.com/asdine/genji"
+	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
 	"github.com/stretchr/testify/require"
 )
@@ -18,13 +20,18 @@ func TestUpdateStmt(t *testing.T) {
 		expected string
 		params   []interface{}
 	}{
-		{"No cond", `UPDATE test SET a = 'boo'`, false, `[{"a":"boo","b":"bar1","c":"baz1"},{"a":"boo","b":"bar2"},{"d":"foo3","e":"bar3"}]`, nil},
-		{"No cond / with ident string", "UPDATE test SET `a` = 'boo'", false, `[{"a":"boo","b":"bar1","c":"baz1"},{"a":"boo","b":"bar2"},{"d":"foo3","e":"bar3"}]`, nil},
-		{"No cond / with multiple idents", `UPDATE test SET a = c`, false, `[{"a":"baz1","b":"bar1","c":"baz1"},{"a":null,"b":"bar2"},{"d":"foo3","e":"bar3"}]`, nil},
+		{"No cond", `UPDATE test SET a = 'boo'`, false, `[{"a":"boo","b":"bar1","c":"baz1"},{"a":"boo","b":"bar2"},{"d":"foo3","e":"bar3","a":"boo"}]`, nil},
+		{"No cond / with ident string", "UPDATE test SET `a` = 'boo'", false, `[{"a":"boo","b":"bar1","c":"baz1"},{"a":"boo","b":"bar2"},{"d":"foo3","e":"bar3","a":"boo"}]`, nil},
+		{"No cond / with multiple idents", `UPDATE test SET a = c`, false, `[{"a":"baz1","b":"bar1","c":"baz1"},{"a":null,"b":"bar2"},{"d":"foo3","e":"bar3","a":null}]`, nil},
 		{"No cond / with string", `UPDATE test SET 'a' = 'boo'`, true, "", nil},
 		{"With cond", "UPDATE test SET a = 1, b = 2 WHERE a = 'foo2'", false, `[{"a":"foo1","b":"bar1","c":"baz1"},{"a":1,"b":2},{"d":"foo3","e":"bar3"}]`, nil},
 		{"Field not found", "UPDATE test SET a = 1, b = 2 WHERE a = f", false, `[{"a":"foo1","b":"bar1","c":"baz1"},{"a":"foo2","b":"bar2"},{"d":"foo3","e":"bar3"}]`, nil},
 		{"Positional params", "UPDATE test SET a = ?, b = ? WHERE a = ?", false, `[{"a":"a","b":"b","c":"baz1"},{"a":"foo2","b":"bar2"},{"d":"foo3","e":"bar3"}]`, []interface{}{"a", "b", "foo1"}},
+		{"Nested path", "UPDATE test SET f.g = a WHERE b = 'bar1'", false, `[{"a":"foo1","b":"bar1","c":"baz1","f":{"g":"foo1"}},{"a":"foo2","b":"bar2"},{"d":"foo3","e":"bar3"}]`, nil},
+		{"Nested path / not a document", "UPDATE test SET a.b = 1", true, "", nil},
+		{"Old document", "UPDATE test SET a = b, b = a WHERE c = 'baz1'", false, `[{"a":"bar1","b":"foo1","c":"baz1"},{"a":"foo2","b":"bar2"},{"d":"foo3","e":"bar3"}]`, nil},
+		{"Unset", "UPDATE test UNSET a, c", false, `[{"b":"bar1"},{"b":"bar2"},{"d":"foo3","e":"bar3"}]`, nil},
+		{"Unset with cond", "UPDATE test UNSET d WHERE e = 'bar3'", false, `[{"a":"foo1","b":"bar1","c":"baz1"},{"a":"foo2","b":"bar2"},{"e":"bar3"}]`, nil},
 		{"Named params", "UPDATE test SET a = $a, b = $b WHERE a = $c", false, `[{"a":"a","b":"b","c":"baz1"},{"a":"foo2","b":"bar2"},{"d":"foo3","e":"bar3"}]`, []interface{}{sql.Named("b", "b"), sql.Named("a", "a"), sql.Named("c", "foo1")}},
 	}
 
@@ -61,4 +68,80 @@ func TestUpdateStmt(t *testing.T) {
 			require.JSONEq(t, test.expected, buf.String())
 		})
 	}
+
+	t.Run("Arrays and documents", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			INSERT INTO test (a, tags) VALUES ({b: 1, c: [1, 2]}, ['x', 'y', 'z']);
+			UPDATE test SET a.b = a.b + 1, a.c[1] = 3, tags[2] = 'w';
+			UPDATE test UNSET tags.0, a.c[0];
+		`)
+		require.NoError(t, err)
+
+		st, err := db.Query("SELECT a, tags FROM test")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"a":{"b":2,"c":[3]},"tags":["y","w"]}]`, buf.String())
+
+		err = db.Exec("UPDATE test SET tags[5] = 'v'")
+		require.Equal(t, document.ErrIndexOutOfRange, err)
+		err = db.Exec("UPDATE test SET tags.2 = 'v'")
+		require.Equal(t, document.ErrIndexOutOfRange, err)
+	})
+
+	t.Run("Constraints and indexes", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (id INTEGER PRIMARY KEY, counter INT32 NOT NULL);
+			CREATE UNIQUE INDEX idx_test_name ON test (name);
+		`)
+		require.NoError(t, err)
+
+		// more documents than the size of the update buffer
+		for i := 0; i < 250; i++ {
+			err = db.Exec("INSERT INTO test (id, counter, name) VALUES (?, 0, ?)", i, fmt.Sprintf("name%d", i))
+			require.NoError(t, err)
+		}
+
+		err = db.Exec("UPDATE test SET counter = counter + 1.0, name = name")
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("SELECT COUNT(*) AS n, SUM(counter) AS s FROM test WHERE counter = 1")
+		require.NoError(t, err)
+		var n, sum int
+		err = document.Scan(d, &n, &sum)
+		require.NoError(t, err)
+		require.Equal(t, 250, n)
+		require.Equal(t, 250, sum)
+
+		err = db.Exec("UPDATE test UNSET counter WHERE id = 1")
+		require.Error(t, err)
+
+		err = db.Exec("UPDATE test SET id = 1000 WHERE id = 1")
+		require.Error(t, err)
+
+		err = db.Exec("UPDATE test SET name = 'name2' WHERE id = 1")
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		err = db.Exec("UPDATE test SET name = 'foo' WHERE id = 1")
+		require.NoError(t, err)
+
+		d, err = db.QueryDocument("SELECT id FROM test WHERE name = 'foo'")
+		require.NoError(t, err)
+		var id int
+		err = document.Scan(d, &id)
+		require.NoError(t, err)
+		require.Equal(t, 1, id)
+	})
 }
@@ -39,6 +39,13 @@ func (s *Scanner) ReadRune() (ch rune, size int, err error) {
 	return
 }
 
+// UnreadRune pushes the previously read rune back onto the buffer.
+// It implements the io.RuneScanner interface.
+func (s *Scanner) UnreadRune() error {
+	s.unread()
+	return nil
+}
+
 func (s *Scanner) unread() {
 	if ch, _ := s.r.curr(); ch != eof {
 		s.buf.Truncate(s.buf.Len() - utf8.RuneLen(ch))
@@ -298,16 +305,27 @@ func (s *Scanner) scanString() TokenInfo {
 	return TokenInfo{STRING, pos, lit, s.unbuffer()}
 }
 
-// ScanRegex consumes a token to find escapes
+// ScanRegex consumes a token to find escapes.
+// Leading whitespaces are skipped.
 func (s *Scanner) ScanRegex() TokenInfo {
-	_, pos := s.r.curr()
+	// Skip whitespaces preceding the regex.
+	for {
+		if ch, _ := s.read(); !isWhitespace(ch) {
+			s.unread()
+			break
+		}
+	}
+
+	// Save the starting position of the regex.
+	_, pos := s.read()
+	s.unread()
 
 	// Start & end sentinels.
 	start, end := '/', '/'
 	// Valid escape chars.
 	escapes := map[rune]rune{'/': '/'}
 
-	b, err := ScanDelimited(s.r, start, end, escapes, true)
+	b, err := ScanDelimited(s, start, end, escapes, true)
 
 	if err == errBadEscape {
 		_, pos = s.r.curr()
@@ -424,7 +442,7 @@ type BufScanner struct {
 	s   *Scanner
 	i   int // buffer index
 	n   int // buffer size
-	buf [3]TokenInfo
+	buf [4]TokenInfo
 }
 
 // NewBufScanner returns a new buffered scanner for a reader.
@@ -42,6 +42,10 @@ func TestScanner_Scan(t *testing.T) {
 		{s: `and`, tok: scanner.AND, raw: `and`},
 		{s: `OR`, tok: scanner.OR, raw: `OR`},
 		{s: `or`, tok: scanner.OR, raw: `or`},
+		{s: `IN`, tok: scanner.IN, raw: `IN`},
+		{s: `in`, tok: scanner.IN, raw: `in`},
+		{s: `IS`, tok: scanner.IS, raw: `IS`},
+		{s: `is`, tok: scanner.IS, raw: `is`},
 
 		{s: `=`, tok: scanner.EQ, raw: `=`},
 		{s: `==`, tok: scanner.EQ, raw: `==`},
@@ -133,6 +137,8 @@ func TestScanner_Scan(t *testing.T) {
 		{s: `DESC`, tok: scanner.DESC, raw: `DESC`},
 		{s: `DROP`, tok: scanner.DROP, raw: `DROP`},
 		{s: `FROM`, tok: scanner.FROM, raw: `FROM`},
+		{s: `GROUP`, tok: scanner.GROUP, raw: `GROUP`},
+		{s: `HAVING`, tok: scanner.HAVING, raw: `HAVING`},
 		{s: `INSERT`, tok: scanner.INSERT, raw: `INSERT`},
 		{s: `INTO`, tok: scanner.INTO, raw: `INTO`},
 		{s: `LIMIT`, tok: scanner.LIMIT, raw: `LIMIT`},
@@ -273,6 +279,9 @@ func TestScanRegex(t *testing.T) {
 		{in: `/foo\\/bar/`, tok: scanner.REGEX, lit: `foo\/bar`},
 		{in: `/foo\\bar/`, tok: scanner.REGEX, lit: `foo\\bar`},
 		{in: `/http\:\/\/www\.example\.com/`, tok: scanner.REGEX, lit: `http\://www\.example\.com`},
+		{in: `  /^foo/`, tok: scanner.REGEX, lit: `^foo`},
+		{in: `foo/`, tok: scanner.BADREGEX},
+		{in: `/foo`, tok: scanner.BADREGEX, lit: ``},
 	}
 
 	for i, tt := range tests {
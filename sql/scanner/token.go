@@ -55,6 +55,10 @@ const (
 	LTE      // <=
 	GT       // >
 	GTE      // >=
+	IN       // IN
+	NIN      // NOT IN
+	IS       // IS
+	ISN      // IS NOT
 	operatorEnd
 
 	LPAREN      // (
@@ -71,35 +75,64 @@ const (
 
 	keywordBeg
 	// ALL and the following are Genji SQL Keywords
+	ADD_KEYWORD
+	ALTER
+	ANALYZE
 	AS
 	ASC
 	BY
+	CASCADE
 	CAST
+	CHECK
+	CONFLICT
 	CREATE
+	DEFAULT
 	DELETE
 	DESC
+	DO
 	DROP
 	EXISTS
+	EXPLAIN
+	FIELD
 	FROM
+	GROUP
+	HAVING
 	IF
+	INCREMENT
 	INDEX
+	INNER
 	INSERT
 	INTO
+	JOIN
 	KEY
+	LEFT
 	LIMIT
 	NOT
+	NOTHING
 	OFFSET
 	ON
 	ORDER
+	OUTER
 	PRIMARY
+	REFERENCES
+	RELEASE
+	RENAME
+	RESTRICT
+	RETURNING
+	ROLLBACK
+	SAVEPOINT
 	SELECT
+	SEQUENCE
 	SET
+	START
 	TABLE
 	TO
 	UNIQUE
+	UNSET
 	UPDATE
 	VALUES
 	WHERE
+	WITH
 
 	TYPEBYTES
 	TYPESTRING
@@ -132,6 +165,7 @@ var tokens = [...]string{
 	TRUE:            "TRUE",
 	FALSE:           "FALSE",
 	REGEX:           "REGEX",
+	BADREGEX:        "BADREGEX",
 	NULL:            "NULL",
 
 	ADD:        "+",
@@ -154,6 +188,10 @@ var tokens = [...]string{
 	LTE:      "<=",
 	GT:       ">",
 	GTE:      ">=",
+	IN:       "IN",
+	NIN:      "NOT IN",
+	IS:       "IS",
+	ISN:      "IS NOT",
 
 	LPAREN:      "(",
 	RPAREN:      ")",
@@ -167,35 +205,64 @@ var tokens = [...]string{
 	SEMICOLON:   ";",
 	DOT:         ".",
 
-	AS:      "AS",
-	ASC:     "ASC",
-	BY:      "BY",
-	CREATE:  "CREATE",
-	CAST:    "CAST",
-	DELETE:  "DELETE",
-	DESC:    "DESC",
-	DROP:    "DROP",
-	EXISTS:  "EXISTS",
-	KEY:     "KEY",
-	FROM:    "FROM",
-	IF:      "IF",
-	INDEX:   "INDEX",
-	INSERT:  "INSERT",
-	INTO:    "INTO",
-	LIMIT:   "LIMIT",
-	NOT:     "NOT",
-	OFFSET:  "OFFSET",
-	ON:      "ON",
-	ORDER:   "ORDER",
-	PRIMARY: "PRIMARY",
-	SELECT:  "SELECT",
-	SET:     "SET",
-	TABLE:   "TABLE",
-	TO:      "TO",
-	UNIQUE:  "UNIQUE",
-	UPDATE:  "UPDATE",
-	VALUES:  "VALUES",
-	WHERE:   "WHERE",
+	ADD_KEYWORD: "ADD",
+	ALTER:       "ALTER",
+	ANALYZE:     "ANALYZE",
+	AS:          "AS",
+	ASC:         "ASC",
+	BY:          "BY",
+	CREATE:      "CREATE",
+	CASCADE:     "CASCADE",
+	CAST:        "CAST",
+	CHECK:       "CHECK",
+	CONFLICT:    "CONFLICT",
+	DEFAULT:     "DEFAULT",
+	DELETE:      "DELETE",
+	DESC:        "DESC",
+	DO:          "DO",
+	DROP:        "DROP",
+	EXISTS:      "EXISTS",
+	EXPLAIN:     "EXPLAIN",
+	FIELD:       "FIELD",
+	KEY:         "KEY",
+	FROM:        "FROM",
+	GROUP:       "GROUP",
+	HAVING:      "HAVING",
+	IF:          "IF",
+	INCREMENT:   "INCREMENT",
+	INDEX:       "INDEX",
+	INNER:       "INNER",
+	INSERT:      "INSERT",
+	INTO:        "INTO",
+	JOIN:        "JOIN",
+	LEFT:        "LEFT",
+	LIMIT:       "LIMIT",
+	NOT:         "NOT",
+	NOTHING:     "NOTHING",
+	OFFSET:      "OFFSET",
+	ON:          "ON",
+	ORDER:       "ORDER",
+	OUTER:       "OUTER",
+	PRIMARY:     "PRIMARY",
+	REFERENCES:  "REFERENCES",
+	RELEASE:     "RELEASE",
+	RENAME:      "RENAME",
+	RESTRICT:    "RESTRICT",
+	RETURNING:   "RETURNING",
+	ROLLBACK:    "ROLLBACK",
+	SAVEPOINT:   "SAVEPOINT",
+	SELECT:      "SELECT",
+	SEQUENCE:    "SEQUENCE",
+	SET:         "SET",
+	START:       "START",
+	TABLE:       "TABLE",
+	TO:          "TO",
+	UNIQUE:      "UNIQUE",
+	UNSET:       "UNSET",
+	UPDATE:      "UPDATE",
+	VALUES:      "VALUES",
+	WHERE:       "WHERE",
+	WITH:        "WITH",
 
 	TYPEBYTES:    "BYTES",
 	TYPESTRING:   "STRING",
@@ -219,7 +286,7 @@ func init() {
 	for tok := keywordBeg + 1; tok < keywordEnd; tok++ {
 		keywords[strings.ToLower(tokens[tok])] = tok
 	}
-	for _, tok := range []Token{AND, OR, TRUE, FALSE, NULL} {
+	for _, tok := range []Token{AND, OR, IN, IS, TRUE, FALSE, NULL} {
 		keywords[strings.ToLower(tokens[tok])] = tok
 	}
 }
@@ -239,12 +306,14 @@ func (tok Token) Precedence() int {
 		return 1
 	case AND:
 		return 2
-	case EQ, NEQ, EQREGEX, NEQREGEX, LT, LTE, GT, GTE:
+	case NOT:
 		return 3
-	case ADD, SUB, BITWISEOR, BITWISEXOR:
+	case EQ, NEQ, EQREGEX, NEQREGEX, LT, LTE, GT, GTE, IN, NIN, IS, ISN:
 		return 4
-	case MUL, DIV, MOD, BITWISEAND:
+	case ADD, SUB, BITWISEOR, BITWISEXOR:
 		return 5
+	case MUL, DIV, MOD, BITWISEAND:
+		return 6
 	}
 	return 0
 }